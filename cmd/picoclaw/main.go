@@ -18,11 +18,15 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/chzyer/readline"
 	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/api"
 	"github.com/sipeed/picoclaw/pkg/auth"
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/channels"
@@ -32,12 +36,17 @@ import (
 	"github.com/sipeed/picoclaw/pkg/health"
 	"github.com/sipeed/picoclaw/pkg/heartbeat"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/mcp"
 	"github.com/sipeed/picoclaw/pkg/memory"
 	"github.com/sipeed/picoclaw/pkg/migrate"
+	"github.com/sipeed/picoclaw/pkg/netguard"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/sandbox"
+	"github.com/sipeed/picoclaw/pkg/session"
 	"github.com/sipeed/picoclaw/pkg/skills"
 	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/usage"
 	"github.com/sipeed/picoclaw/pkg/voice"
 )
 
@@ -121,6 +130,8 @@ func copyDirectory(src, dst string) error {
 }
 
 func main() {
+	sandbox.Init()
+
 	if len(os.Args) < 2 {
 		printHelp()
 		os.Exit(1)
@@ -143,6 +154,14 @@ func main() {
 		authCmd()
 	case "cron":
 		cronCmd()
+	case "mcp":
+		mcpCmd()
+	case "usage":
+		usageCmd()
+	case "tools":
+		toolsCmd()
+	case "sessions":
+		sessionsCmd()
 	case "skills":
 		if len(os.Args) < 3 {
 			skillsHelp()
@@ -212,6 +231,10 @@ func printHelp() {
 	fmt.Println("  gateway     Start picoclaw gateway")
 	fmt.Println("  status      Show picoclaw status")
 	fmt.Println("  cron        Manage scheduled tasks")
+	fmt.Println("  mcp         Serve picoclaw tools over MCP")
+	fmt.Println("  usage       Show token usage and cost")
+	fmt.Println("  tools       Check what the exec tool would run")
+	fmt.Println("  sessions    List, search, export, import and prune conversations")
 	fmt.Println("  migrate     Migrate from OpenClaw to PicoClaw")
 	fmt.Println("  skills      Manage skills (install, list, remove)")
 	fmt.Println("  version     Show version information")
@@ -374,6 +397,7 @@ func migrateHelp() {
 func agentCmd() {
 	message := ""
 	sessionKey := "cli:default"
+	profile := ""
 
 	args := os.Args[2:]
 	for i := 0; i < len(args); i++ {
@@ -391,6 +415,11 @@ func agentCmd() {
 				sessionKey = args[i+1]
 				i++
 			}
+		case "-p", "--profile":
+			if i+1 < len(args) {
+				profile = args[i+1]
+				i++
+			}
 		}
 	}
 
@@ -400,6 +429,16 @@ func agentCmd() {
 		os.Exit(1)
 	}
 
+	// Usage is recorded in the default workspace so budgets cover every profile
+	usageDir := usage.Dir(cfg.WorkspacePath())
+	if profile != "" && profile != config.DefaultProfile {
+		cfg, err = cfg.ForProfile(profile)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	provider, err := providers.CreateProvider(cfg)
 	if err != nil {
 		fmt.Printf("Error creating provider: %v\n", err)
@@ -408,6 +447,16 @@ func agentCmd() {
 
 	msgBus := bus.NewMessageBus()
 	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider)
+	if usageDir != usage.Dir(cfg.WorkspacePath()) {
+		if ledger, err := usage.NewLedger(usageDir, cfg.Usage.Prices); err == nil {
+			agentLoop.SetUsageLedger(ledger)
+		}
+	}
+
+	mcpManager := setupMCP(agentLoop, cfg)
+	defer mcpManager.Stop()
+	// Kills the commands left running in the background
+	defer agentLoop.Stop()
 
 	// Print agent startup info (only for interactive mode)
 	startupInfo := agentLoop.GetStartupInfo()
@@ -419,6 +468,12 @@ func agentCmd() {
 		})
 
 	if message != "" {
+		reader := bufio.NewReader(os.Stdin)
+		agentLoop.SetApprovalPrompt(terminalApproval(func(prompt string) (string, error) {
+			fmt.Print(prompt)
+			return reader.ReadString('\n')
+		}))
+
 		ctx := context.Background()
 		response, err := agentLoop.ProcessDirect(ctx, message, sessionKey)
 		if err != nil {
@@ -451,6 +506,12 @@ func interactiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
 	}
 	defer rl.Close()
 
+	agentLoop.SetApprovalPrompt(terminalApproval(func(approvalPrompt string) (string, error) {
+		rl.SetPrompt(approvalPrompt)
+		defer rl.SetPrompt(prompt)
+		return rl.Readline()
+	}))
+
 	for {
 		line, err := rl.Readline()
 		if err != nil {
@@ -485,6 +546,11 @@ func interactiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
 
 func simpleInteractiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
 	reader := bufio.NewReader(os.Stdin)
+	agentLoop.SetApprovalPrompt(terminalApproval(func(prompt string) (string, error) {
+		fmt.Print(prompt)
+		return reader.ReadString('\n')
+	}))
+
 	for {
 		fmt.Print(fmt.Sprintf("%s You: ", logo))
 		line, err := reader.ReadString('\n')
@@ -518,6 +584,19 @@ func simpleInteractiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
 	}
 }
 
+// terminalApproval returns an approval prompt for agent.SetApprovalPrompt
+// that asks on the terminal. readLine shows its prompt and returns the line
+// typed. Tool calls running in parallel ask one at a time.
+func terminalApproval(readLine func(prompt string) (string, error)) func(ctx context.Context, question string) (string, error) {
+	var mu sync.Mutex
+	return func(ctx context.Context, question string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Printf("\n%s\n", question)
+		return readLine("Approve? [y]es / [n]o / [a]lways: ")
+	}
+}
+
 func gatewayCmd() {
 	// Check for --debug flag
 	args := os.Args[2:]
@@ -541,26 +620,20 @@ func gatewayCmd() {
 		os.Exit(1)
 	}
 
-	msgBus := bus.NewMessageBus()
+	msgBus, err := setupMessageBus(cfg)
+	if err != nil {
+		fmt.Printf("Error opening message bus: %v\n", err)
+		os.Exit(1)
+	}
 	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider)
 
-	// Initialize memory system
-	var memoryStore *memory.MemoryStore
-	memoryConfig := memory.DefaultConfig(cfg.WorkspacePath())
-	
-	// Try to use OpenAI if API key is available
-	if cfg.Providers.OpenAI.APIKey != "" {
-		memoryConfig.EmbeddingProvider = "openai"
-		memoryConfig.OpenAIAPIKey = cfg.Providers.OpenAI.APIKey
-		memoryConfig.EmbeddingModel = "text-embedding-3-small"
-		logger.InfoC("memory", "Using OpenAI embeddings for memory")
-	} else {
-		// Fallback to simple embedder
-		memoryConfig.EmbeddingProvider = "simple"
-		logger.InfoC("memory", "Using simple embedder for memory (no OpenAI API key)")
+	if err := setupAgentProfiles(cfg, msgBus, agentLoop); err != nil {
+		fmt.Printf("Error setting up agent profiles: %v\n", err)
+		os.Exit(1)
 	}
-	
-	memoryStore, err = memory.NewMemoryStore(memoryConfig)
+
+	// Initialize memory system
+	memoryStore, err := setupMemoryStore(cfg)
 	if err != nil {
 		logger.WarnCF("memory", "Failed to initialize memory store", map[string]interface{}{
 			"error": err.Error(),
@@ -575,6 +648,11 @@ func gatewayCmd() {
 		}
 	}
 
+	mcpManager := setupMCP(agentLoop, cfg)
+	if n := mcpManager.ToolCount(); n > 0 {
+		fmt.Printf("✓ MCP tools registered: %d\n", n)
+	}
+
 	// Print agent startup info
 	fmt.Println("\n📦 Agent Status:")
 	startupInfo := agentLoop.GetStartupInfo()
@@ -584,6 +662,9 @@ func gatewayCmd() {
 	fmt.Printf("  • Skills: %d/%d available\n",
 		skillsInfo["available"],
 		skillsInfo["total"])
+	if profiles := agentLoop.Profiles(); len(profiles) > 0 {
+		fmt.Printf("  • Profiles: %s\n", strings.Join(profiles, ", "))
+	}
 
 	// Log to file as well
 	logger.InfoCF("agent", "Agent initialized",
@@ -595,7 +676,7 @@ func gatewayCmd() {
 
 	// Setup cron tool and service
 	execTimeout := time.Duration(cfg.Tools.Cron.ExecTimeoutMinutes) * time.Minute
-	cronService := setupCronTool(agentLoop, msgBus, cfg.WorkspacePath(), cfg.Agents.Defaults.RestrictToWorkspace, execTimeout)
+	cronService := setupCronTool(agentLoop, msgBus, cfg, execTimeout)
 
 	heartbeatService := heartbeat.NewHeartbeatService(
 		cfg.WorkspacePath(),
@@ -697,12 +778,18 @@ func gatewayCmd() {
 	}
 
 	healthServer := health.NewServer(cfg.Gateway.Host, cfg.Gateway.Port)
+	if cfg.Gateway.APIToken != "" {
+		healthServer.Handle("/v1/", api.NewHandler(agentLoop, cfg.Gateway.APIToken, cfg.Gateway.APISessions))
+	}
 	go func() {
 		if err := healthServer.Start(); err != nil && err != http.ErrServerClosed {
 			logger.ErrorCF("health", "Health server error", map[string]interface{}{"error": err.Error()})
 		}
 	}()
 	fmt.Printf("✓ Health endpoints available at http://%s:%d/health and /ready\n", cfg.Gateway.Host, cfg.Gateway.Port)
+	if cfg.Gateway.APIToken != "" {
+		fmt.Printf("✓ OpenAI-compatible API available at http://%s:%d/v1\n", cfg.Gateway.Host, cfg.Gateway.Port)
+	}
 
 	go agentLoop.Run(ctx)
 
@@ -716,8 +803,10 @@ func gatewayCmd() {
 	deviceService.Stop()
 	heartbeatService.Stop()
 	cronService.Stop()
+	mcpManager.Stop()
 	agentLoop.Stop()
 	channelManager.StopAll(ctx)
+	msgBus.Close()
 	fmt.Println("✓ Gateway stopped")
 }
 
@@ -753,6 +842,14 @@ func statusCmd() {
 
 	if _, err := os.Stat(configPath); err == nil {
 		fmt.Printf("Model: %s\n", cfg.Agents.Defaults.Model)
+		if len(cfg.Agents.Profiles) > 0 {
+			names := make([]string, 0, len(cfg.Agents.Profiles))
+			for name := range cfg.Agents.Profiles {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			fmt.Printf("Agent profiles: %s (%d routes)\n", strings.Join(names, ", "), len(cfg.Agents.Routes))
+		}
 
 		hasOpenRouter := cfg.Providers.OpenRouter.APIKey != ""
 		hasAnthropic := cfg.Providers.Anthropic.APIKey != ""
@@ -780,6 +877,17 @@ func statusCmd() {
 			fmt.Println("vLLM/Local: not set")
 		}
 
+		if cfg.Bus.Durable {
+			if stats, err := bus.ReadQueueStats(busDir(cfg)); err == nil {
+				fmt.Printf("Message bus: durable (inbound %d, outbound %d queued; %d dead letters)\n",
+					stats.Inbound, stats.Outbound, stats.DeadLetters)
+			} else {
+				fmt.Printf("Message bus: durable (unreadable: %v)\n", err)
+			}
+		} else {
+			fmt.Println("Message bus: in-memory")
+		}
+
 		store, _ := auth.LoadStore()
 		if store != nil && len(store.Credentials) > 0 {
 			fmt.Println("\nOAuth/Token Auth:")
@@ -1015,19 +1123,94 @@ func authStatusCmd() {
 	}
 }
 
+// setupMessageBus creates the gateway's message bus. With bus.durable set,
+// queued messages are journaled under state/bus and survive restarts.
+func setupMessageBus(cfg *config.Config) (*bus.MessageBus, error) {
+	msgBus := bus.NewMessageBus()
+	if cfg.Bus.Durable {
+		var err error
+		msgBus, err = bus.NewDurableMessageBus(busDir(cfg))
+		if err != nil {
+			return nil, err
+		}
+		msgBus.SetSyncInterval(time.Duration(cfg.Bus.SyncIntervalMS) * time.Millisecond)
+	}
+	if cfg.Bus.MaxRetries > 0 {
+		msgBus.SetMaxRetries(cfg.Bus.MaxRetries)
+	}
+	return msgBus, nil
+}
+
+// setupAgentProfiles creates an agent for every configured profile and adds
+// it to agentLoop, which routes inbound messages to them. A profile
+// workspace that does not exist yet is created from the workspace templates.
+func setupAgentProfiles(cfg *config.Config, msgBus *bus.MessageBus, agentLoop *agent.AgentLoop) error {
+	for name := range cfg.Agents.Profiles {
+		profileCfg, err := cfg.ForProfile(name)
+		if err != nil {
+			return err
+		}
+
+		workspace := profileCfg.WorkspacePath()
+		if _, err := os.Stat(workspace); os.IsNotExist(err) {
+			createWorkspaceTemplates(workspace)
+		}
+
+		provider, err := providers.CreateProvider(profileCfg)
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+		agentLoop.AddProfile(name, agent.NewAgentLoop(profileCfg, msgBus, provider))
+
+		logger.InfoCF("agent", "Agent profile loaded",
+			map[string]interface{}{
+				"profile":   name,
+				"model":     profileCfg.Agents.Defaults.Model,
+				"workspace": workspace,
+			})
+	}
+	return nil
+}
+
+func busDir(cfg *config.Config) string {
+	return filepath.Join(cfg.WorkspacePath(), "state", "bus")
+}
+
+// setupMemoryStore creates the memory store, using OpenAI embeddings when
+// an OpenAI API key is configured.
+func setupMemoryStore(cfg *config.Config) (*memory.MemoryStore, error) {
+	memoryConfig := memory.DefaultConfig(cfg.WorkspacePath())
+
+	// Try to use OpenAI if API key is available
+	if cfg.Providers.OpenAI.APIKey != "" {
+		memoryConfig.EmbeddingProvider = "openai"
+		memoryConfig.OpenAIAPIKey = cfg.Providers.OpenAI.APIKey
+		memoryConfig.EmbeddingModel = "text-embedding-3-small"
+		logger.InfoC("memory", "Using OpenAI embeddings for memory")
+	} else {
+		// Fallback to simple embedder
+		memoryConfig.EmbeddingProvider = "simple"
+		logger.InfoC("memory", "Using simple embedder for memory (no OpenAI API key)")
+	}
+
+	return memory.NewMemoryStore(memoryConfig)
+}
+
 func getConfigPath() string {
 	home, _ := os.UserHomeDir()
 	return filepath.Join(home, ".picoclaw", "config.json")
 }
 
-func setupCronTool(agentLoop *agent.AgentLoop, msgBus *bus.MessageBus, workspace string, restrict bool, execTimeout time.Duration) *cron.CronService {
+func setupCronTool(agentLoop *agent.AgentLoop, msgBus *bus.MessageBus, cfg *config.Config, execTimeout time.Duration) *cron.CronService {
+	workspace := cfg.WorkspacePath()
 	cronStorePath := filepath.Join(workspace, "cron", "jobs.json")
 
 	// Create cron service
 	cronService := cron.NewCronService(cronStorePath, nil)
 
 	// Create and register CronTool
-	cronTool := tools.NewCronTool(cronService, agentLoop, msgBus, workspace, restrict, execTimeout)
+	cronTool := tools.NewCronTool(cronService, agentLoop, msgBus, workspace, cfg.Agents.Defaults.RestrictToWorkspace, execTimeout)
+	agent.ConfigureCronTool(cronTool, cfg, workspace)
 	agentLoop.RegisterTool(cronTool)
 
 	// Set the onJob handler
@@ -1039,8 +1222,28 @@ func setupCronTool(agentLoop *agent.AgentLoop, msgBus *bus.MessageBus, workspace
 	return cronService
 }
 
+// setupMCP starts the configured MCP servers and registers their tools
+// with the agent.
+func setupMCP(agentLoop *agent.AgentLoop, cfg *config.Config) *mcp.Manager {
+	// Through the agent loop, the tools also reach the agent profiles.
+	mcpManager := mcp.NewManager(cfg.Tools.MCP, agentLoop.RegisterTool, agentLoop.UnregisterTool)
+	mcpManager.Start(context.Background())
+	return mcpManager
+}
+
+// loadConfig loads config.json and applies its network policy to every
+// outbound request made for the agent.
 func loadConfig() (*config.Config, error) {
-	return config.LoadConfig(getConfigPath())
+	cfg, err := config.LoadConfig(getConfigPath())
+	if err != nil {
+		return nil, err
+	}
+	policy, err := netguard.New(cfg.Tools.Network)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tools.network: %w", err)
+	}
+	netguard.SetDefault(policy)
+	return cfg, nil
 }
 
 func cronCmd() {
@@ -1257,6 +1460,525 @@ func cronEnableCmd(storePath string, disable bool) {
 	}
 }
 
+// usageCmd prints a report of the usage ledger of the default workspace.
+func usageCmd() {
+	days := 30
+	by := "day"
+
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-d", "--days":
+			if i+1 < len(args) {
+				if n, err := strconv.Atoi(args[i+1]); err == nil && n > 0 {
+					days = n
+				}
+				i++
+			}
+		case "-b", "--by":
+			if i+1 < len(args) {
+				by = args[i+1]
+				i++
+			}
+		case "-h", "--help":
+			usageHelp()
+			return
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	now := time.Now()
+	since := time.Date(now.Year(), now.Month(), now.Day()-days+1, 0, 0, 0, 0, now.Location())
+	records, err := usage.Read(usage.Dir(cfg.WorkspacePath()), since)
+	if err != nil {
+		fmt.Printf("Error reading usage: %v\n", err)
+		os.Exit(1)
+	}
+	rows, err := usage.Group(records, by)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		usageHelp()
+		os.Exit(1)
+	}
+	if len(rows) == 0 {
+		fmt.Printf("No usage recorded in the last %d days.\n", days)
+		return
+	}
+
+	fmt.Printf("\nUsage of the last %d days by %s:\n\n", days, by)
+	fmt.Printf("  %-32s %9s %12s %12s %12s\n", strings.ToUpper(by), "REQUESTS", "PROMPT", "COMPLETION", "COST")
+	var total usage.Totals
+	for _, row := range rows {
+		fmt.Printf("  %-32s %9d %12d %12d %12s\n", row.Key, row.Requests, row.PromptTokens, row.CompletionTokens, usage.FormatCost(row.Cost))
+		total.Requests += row.Requests
+		total.PromptTokens += row.PromptTokens
+		total.CompletionTokens += row.CompletionTokens
+		total.Cost += row.Cost
+	}
+	fmt.Printf("  %-32s %9d %12d %12d %12s\n", "TOTAL", total.Requests, total.PromptTokens, total.CompletionTokens, usage.FormatCost(total.Cost))
+}
+
+func usageHelp() {
+	fmt.Println("\nUsage: picoclaw usage [options]")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  -d, --days <n>   Report the last n days (default: 30)")
+	fmt.Println("  -b, --by <key>   Group by day, model, session, channel or sender (default: day)")
+}
+
+func toolsCmd() {
+	if len(os.Args) < 3 {
+		toolsHelp()
+		return
+	}
+
+	switch os.Args[2] {
+	case "check":
+		toolsCheckCmd(os.Args[3:])
+	default:
+		fmt.Printf("Unknown tools command: %s\n", os.Args[2])
+		toolsHelp()
+	}
+}
+
+func toolsHelp() {
+	fmt.Println("\nTools commands:")
+	fmt.Println("  check <command>        Show whether the exec tool would run a command, and which rule decides")
+	fmt.Println()
+	fmt.Println("Check options:")
+	fmt.Println("  -c, --channel <name>   Apply the overrides of a channel (e.g. telegram)")
+}
+
+// toolsCheckCmd runs a command through the exec tool's rules without
+// running it.
+func toolsCheckCmd(args []string) {
+	channel := ""
+	var command string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-c", "--channel":
+			if i+1 < len(args) {
+				channel = args[i+1]
+				i++
+			}
+		default:
+			command = strings.TrimSpace(strings.Join(args[i:], " "))
+			i = len(args)
+		}
+	}
+	if command == "" {
+		toolsHelp()
+		os.Exit(1)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	execCfg := cfg.Tools.Exec
+
+	execTool := tools.NewExecTool(cfg.WorkspacePath(), cfg.Agents.Defaults.RestrictToWorkspace)
+	general, channels := agent.ExecPolicies(execCfg)
+	if err := execTool.SetPolicy(general, channels); err != nil {
+		fmt.Printf("Invalid exec policy, every command would be blocked: %v\n", err)
+		os.Exit(1)
+	}
+	decision := execTool.Check(command, channel)
+
+	fmt.Printf("Command:  %s\n", command)
+	if _, ok := execCfg.Channels[channel]; ok {
+		fmt.Printf("Channel:  %s (with overrides)\n", channel)
+	} else if channel != "" {
+		fmt.Printf("Channel:  %s (no overrides, general rules)\n", channel)
+	}
+	if !decision.Allowed {
+		fmt.Println("Result:   BLOCKED")
+		fmt.Printf("Reason:   %s\n", decision.Reason)
+		fmt.Printf("Rule:     %s\n", decision.Rule)
+		os.Exit(1)
+	}
+
+	fmt.Println("Result:   ALLOWED")
+	if decision.Rule != "" {
+		fmt.Printf("Rule:     %s\n", decision.Rule)
+	} else {
+		fmt.Println("Rule:     no deny pattern matches")
+	}
+
+	if cfg.Tools.Approval.Enabled {
+		rules := make([]tools.ApprovalRule, len(cfg.Tools.Approval.Rules))
+		for i, r := range cfg.Tools.Approval.Rules {
+			rules[i] = tools.ApprovalRule{Tool: r.Tool, Arg: r.Arg, Pattern: r.Pattern}
+		}
+		if policy, err := tools.NewApprovalPolicy(rules); err != nil {
+			fmt.Println("Approval: required (invalid approval rules)")
+		} else if rule, ok := policy.Match("exec", map[string]interface{}{"command": command}); ok {
+			fmt.Printf("Approval: required (rule tool=%s arg=%s pattern=%s)\n", rule.Tool, rule.Arg, rule.Pattern)
+		}
+	}
+	if execCfg.Sandbox.Enabled {
+		network := "blocked"
+		if execCfg.Sandbox.Network {
+			network = "allowed"
+		}
+		fmt.Printf("Sandbox:  %s backend, network %s\n", execCfg.Sandbox.Backend, network)
+	}
+}
+
+func sessionsCmd() {
+	if len(os.Args) < 3 {
+		sessionsHelp()
+		return
+	}
+
+	profile := ""
+	limit := 20
+	output := ""
+	format := ""
+	target := ""
+	var conversations []string
+	var rest []string
+	args := os.Args[3:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-p", "--profile":
+			if i+1 < len(args) {
+				profile = args[i+1]
+				i++
+			}
+		case "-n", "--limit":
+			if i+1 < len(args) {
+				if n, err := strconv.Atoi(args[i+1]); err == nil && n > 0 {
+					limit = n
+				}
+				i++
+			}
+		case "-o", "--output":
+			if i+1 < len(args) {
+				output = args[i+1]
+				i++
+			}
+		case "-f", "--format":
+			if i+1 < len(args) {
+				format = args[i+1]
+				i++
+			}
+		case "-s", "--session":
+			if i+1 < len(args) {
+				target = args[i+1]
+				i++
+			}
+		case "-c", "--conversation":
+			if i+1 < len(args) {
+				conversations = append(conversations, args[i+1])
+				i++
+			}
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if profile != "" && profile != config.DefaultProfile {
+		cfg, err = cfg.ForProfile(profile)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	sessions, err := agent.OpenSessions(cfg, cfg.WorkspacePath())
+	if err != nil {
+		fmt.Printf("Error opening sessions: %v\n", err)
+		os.Exit(1)
+	}
+	defer sessions.Close()
+
+	switch os.Args[2] {
+	case "list":
+		prefix := ""
+		if len(rest) > 0 {
+			prefix = rest[0]
+		}
+		sessionsListCmd(sessions, prefix)
+	case "show", "export":
+		if len(rest) < 1 {
+			fmt.Printf("Usage: picoclaw sessions %s <session-key>\n", os.Args[2])
+			os.Exit(1)
+		}
+		if os.Args[2] == "show" {
+			sessionsShowCmd(sessions, rest[0])
+		} else {
+			sessionsExportCmd(sessions, rest[0], format, output)
+		}
+	case "import":
+		if len(rest) < 1 {
+			fmt.Println("Usage: picoclaw sessions import <file> [--format auto|openai|chatgpt|openclaw] [-s <session-key>]")
+			os.Exit(1)
+		}
+		sessionsImportCmd(sessions, rest[0], format, target, conversations)
+	case "search":
+		if len(rest) < 1 {
+			fmt.Println("Usage: picoclaw sessions search <words>")
+			os.Exit(1)
+		}
+		sessionsSearchCmd(sessions, strings.Join(rest, " "), limit)
+	case "prune":
+		sessionsPruneCmd(sessions, cfg.Sessions)
+	default:
+		fmt.Printf("Unknown sessions command: %s\n", os.Args[2])
+		sessionsHelp()
+	}
+}
+
+func sessionsHelp() {
+	fmt.Println("\nSessions commands:")
+	fmt.Println("  list [prefix]          List sessions, e.g. those of one channel with 'telegram:'")
+	fmt.Println("  show <key>             Print the history of a session")
+	fmt.Println("  export <key>           Write a session as Markdown, OpenAI JSONL or HTML")
+	fmt.Println("  import <file>          Add sessions from an OpenAI JSONL file, a ChatGPT export or an OpenClaw session")
+	fmt.Println("  search <words>         Find past messages containing the words")
+	fmt.Println("  prune                  Apply the retention settings in sessions.retention now")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  -p, --profile <name>   Use the sessions of an agent profile")
+	fmt.Println("  -n, --limit <n>        Search results to show (default: 20)")
+	fmt.Println("  -f, --format <format>  Export: markdown, jsonl or html (default: markdown)")
+	fmt.Println("                         Import: auto, openai, chatgpt or openclaw (default: auto)")
+	fmt.Println("  -o, --output <file>    Export to a file instead of standard output")
+	fmt.Println("  -s, --session <key>    Import into this session, e.g. telegram:123456")
+	fmt.Println("  -c, --conversation <id or title>")
+	fmt.Println("                         Import only this conversation; can be repeated")
+	fmt.Println()
+	fmt.Println("Examples:")
+	fmt.Println("  picoclaw sessions export telegram:123456 -f jsonl -o chat.jsonl")
+	fmt.Println("  picoclaw sessions import conversations.json -c \"Trip planning\" -s telegram:123456")
+}
+
+func sessionsListCmd(sessions *session.SessionManager, prefix string) {
+	infos := sessions.List(prefix)
+	if len(infos) == 0 {
+		fmt.Println("No sessions.")
+		return
+	}
+	fmt.Printf("  %-40s %-20s %8s %-16s %s\n", "KEY", "NAME", "MESSAGES", "UPDATED", "MODEL")
+	for _, info := range infos {
+		name := info.Name
+		if info.Archived {
+			name += " (archived)"
+		}
+		fmt.Printf("  %-40s %-20s %8d %-16s %s\n", info.Key, name, info.Messages, info.Updated.Format("2006-01-02 15:04"), info.Model)
+	}
+}
+
+func sessionsShowCmd(sessions *session.SessionManager, key string) {
+	history := sessions.GetHistory(key)
+	summary := sessions.GetSummary(key)
+	if len(history) == 0 && summary == "" {
+		fmt.Printf("Session %s has no messages.\n", key)
+		return
+	}
+	if summary != "" {
+		fmt.Printf("[summary] %s\n\n", summary)
+	}
+	for _, m := range history {
+		content := m.Content
+		for _, tc := range m.ToolCalls {
+			content += fmt.Sprintf("\n  -> %s", tc.Name)
+		}
+		fmt.Printf("[%s] %s\n\n", m.Role, content)
+	}
+}
+
+func sessionsExportCmd(sessions *session.SessionManager, key, format, output string) {
+	history := sessions.GetHistory(key)
+	summary := sessions.GetSummary(key)
+	if len(history) == 0 && summary == "" {
+		fmt.Printf("Session %s has no messages.\n", key)
+		os.Exit(1)
+	}
+	content, err := session.Export(format, key, summary, history)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if output == "" {
+		fmt.Print(content)
+		return
+	}
+	if err := os.WriteFile(output, []byte(content), 0644); err != nil {
+		fmt.Printf("Error writing %s: %v\n", output, err)
+		os.Exit(1)
+	}
+	fmt.Printf("✓ Exported %d messages to %s\n", len(history), output)
+}
+
+func sessionsImportCmd(sessions *session.SessionManager, file, format, target string, want []string) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Printf("Error reading %s: %v\n", file, err)
+		os.Exit(1)
+	}
+	convs, format, err := session.ParseConversations(data, format)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	convs = session.SelectConversations(convs, want)
+	if len(convs) == 0 {
+		fmt.Println("No conversations to import.")
+		os.Exit(1)
+	}
+	if target != "" && len(convs) > 1 {
+		fmt.Printf("%s has %d conversations; pick one with -c to import it into %s.\n", file, len(convs), target)
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, conv := range convs {
+		key := target
+		if key == "" {
+			key = fmt.Sprintf("import:%s:%s", format, conv.ID)
+		}
+		if err := sessions.Import(key, conv); err != nil {
+			fmt.Printf("  ✗ %s: %v\n", key, err)
+			failed = true
+			continue
+		}
+		label := key
+		if conv.Title != "" {
+			label += " (" + conv.Title + ")"
+		}
+		fmt.Printf("  ✓ Imported %d messages into %s\n", len(conv.Messages), label)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func sessionsSearchCmd(sessions *session.SessionManager, query string, limit int) {
+	matches, err := sessions.Search(query, limit)
+	if err != nil {
+		fmt.Printf("Error searching: %v\n", err)
+		os.Exit(1)
+	}
+	if len(matches) == 0 {
+		fmt.Println("No messages found.")
+		return
+	}
+	for _, m := range matches {
+		fmt.Printf("%s  %s  [%s]\n  %s\n\n", m.Time.Format("2006-01-02 15:04"), m.Key, m.Role, m.Snippet)
+	}
+}
+
+func sessionsPruneCmd(sessions *session.SessionManager, cfg config.SessionsConfig) {
+	retention := agent.SessionRetention(cfg)
+	if retention == nil {
+		fmt.Println("No retention configured in sessions.retention; nothing to prune.")
+		return
+	}
+	deleted, trimmed, err := sessions.Prune(retention, time.Now())
+	if err != nil {
+		fmt.Printf("Error pruning sessions: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✓ Deleted %d sessions, trimmed %d\n", deleted, trimmed)
+}
+
+func mcpCmd() {
+	if len(os.Args) < 3 {
+		mcpHelp()
+		return
+	}
+
+	switch os.Args[2] {
+	case "serve":
+		mcpServeCmd()
+	default:
+		fmt.Printf("Unknown mcp command: %s\n", os.Args[2])
+		mcpHelp()
+	}
+}
+
+func mcpHelp() {
+	fmt.Println("\nMCP commands:")
+	fmt.Println("  serve            Expose picoclaw tools to MCP clients over stdio")
+	fmt.Println()
+	fmt.Println("Example client configuration:")
+	fmt.Println(`  {"command": "picoclaw", "args": ["mcp", "serve"]}`)
+}
+
+// mcpServeCmd serves the agent's tools over MCP on stdin/stdout. Stdout
+// carries the protocol, so all diagnostics go to stderr.
+func mcpServeCmd() {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	workspace := cfg.WorkspacePath()
+	os.MkdirAll(workspace, 0755)
+	restrict := cfg.Agents.Defaults.RestrictToWorkspace
+
+	registry := agent.NewToolRegistry(cfg)
+
+	// Jobs are stored for the gateway to run; this process only edits them,
+	// and the gateway picks up the changed file.
+	// Reminders are delivered to the chat that talked to the agent last.
+	cronService := cron.NewCronService(filepath.Join(workspace, "cron", "jobs.json"), nil)
+	execTimeout := time.Duration(cfg.Tools.Cron.ExecTimeoutMinutes) * time.Minute
+	cronTool := tools.NewCronTool(cronService, nil, bus.NewMessageBus(), workspace, restrict, execTimeout)
+	agent.ConfigureCronTool(cronTool, cfg, workspace)
+	lastChannel := state.NewManager(workspace).GetLastChannel()
+	if channel, chatID, ok := strings.Cut(lastChannel, ":"); ok {
+		cronTool.SetContext(channel, chatID)
+	}
+	registry.Register(cronTool)
+
+	if memoryStore, err := setupMemoryStore(cfg); err != nil {
+		logger.WarnCF("memory", "Failed to initialize memory store", map[string]interface{}{
+			"error": err.Error(),
+		})
+	} else {
+		memory.RegisterWithToolRegistry(registry, memoryStore)
+	}
+
+	// MCP clients cannot answer approval requests
+	agent.RefuseApprovals(registry, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt)
+	go func() {
+		<-sigChan
+		cancel()
+	}()
+
+	logger.InfoCF("mcp", "Serving tools over MCP stdio",
+		map[string]interface{}{
+			"tools":    registry.Count(),
+			"restrict": restrict,
+		})
+
+	server := mcp.NewServer(registry, mcp.Implementation{Name: "picoclaw", Version: version})
+	if err := server.Serve(ctx, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "MCP server error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
 func skillsHelp() {
 	fmt.Println("\nSkills commands:")
 	fmt.Println("  list                    List installed skills")
@@ -0,0 +1,416 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// defaultApprovalTimeout is used when the config leaves the timeout unset.
+const defaultApprovalTimeout = 5 * time.Minute
+
+// approvalIDs numbers approval requests; the numbers are unique across the
+// brokers of all profiles, so a button always finds its own request.
+var approvalIDs atomic.Uint64
+
+type approvalAnswer int
+
+const (
+	answerDeny approvalAnswer = iota
+	answerApprove
+	answerAlways
+)
+
+// approvalBroker asks for approval of tool calls in the chat they were made
+// for. The turn that made the call waits while Run hands replies to Answer
+// before dispatching them, since the session's queue is blocked by the turn.
+type approvalBroker struct {
+	bus     *bus.MessageBus
+	timeout time.Duration
+
+	mu         sync.Mutex
+	pending    map[string][]*pendingApproval // by conversation, oldest first
+	remembered map[string]map[string]bool    // rules answered with "always", by conversation
+	prompt     func(ctx context.Context, question string) (string, error)
+}
+
+type pendingApproval struct {
+	id     uint64
+	tool   string
+	sender string // only this sender may answer; "" lets anyone in the chat
+	answer chan approvalAnswer
+}
+
+func newApprovalBroker(msgBus *bus.MessageBus, timeout time.Duration) *approvalBroker {
+	if timeout <= 0 {
+		timeout = defaultApprovalTimeout
+	}
+	return &approvalBroker{
+		bus:        msgBus,
+		timeout:    timeout,
+		pending:    make(map[string][]*pendingApproval),
+		remembered: make(map[string]map[string]bool),
+	}
+}
+
+// newApprovalPolicy converts the configured rules.
+func newApprovalPolicy(cfg config.ApprovalConfig) (*tools.ApprovalPolicy, error) {
+	rules := make([]tools.ApprovalRule, len(cfg.Rules))
+	for i, r := range cfg.Rules {
+		rules[i] = tools.ApprovalRule{Tool: r.Tool, Arg: r.Arg, Pattern: r.Pattern}
+	}
+	return tools.NewApprovalPolicy(rules)
+}
+
+// refuseApprovals denies every call that needs approval.
+type refuseApprovals struct{}
+
+func (refuseApprovals) RequestApproval(ctx context.Context, req tools.ApprovalRequest) error {
+	return fmt.Errorf("it needs approval under tools.approval and there is no one to ask")
+}
+
+// RefuseApprovals applies the approval rules of cfg to a registry whose
+// callers cannot be asked, such as the MCP clients of "picoclaw mcp serve":
+// tools that always need approval are removed, and calls of the others
+// that match a rule are refused.
+func RefuseApprovals(registry *tools.ToolRegistry, cfg *config.Config) {
+	if !cfg.Tools.Approval.Enabled {
+		return
+	}
+	policy, err := newApprovalPolicy(cfg.Tools.Approval)
+	if err != nil {
+		logger.ErrorCF("agent", "Invalid approval rules, every tool needs approval",
+			map[string]interface{}{
+				"error": err.Error(),
+			})
+		policy, _ = tools.NewApprovalPolicy([]tools.ApprovalRule{{Tool: "*"}})
+	}
+	for _, name := range registry.List() {
+		if policy.Always(name) {
+			registry.Unregister(name)
+		}
+	}
+	registry.SetApproval(policy, refuseApprovals{})
+}
+
+func conversationKey(channel, chatID string) string {
+	return channel + ":" + chatID
+}
+
+// rememberKey identifies what an "always" answer approves: calls of one
+// tool matching one rule. For a rule with a pattern the matched argument
+// is part of the key, so approving one harmless command does not approve
+// every command the rule covers.
+func rememberKey(req tools.ApprovalRequest) string {
+	parts := []string{req.Tool, req.Rule.Tool, req.Rule.Arg, req.Rule.Pattern}
+	if req.Rule.Pattern != "" {
+		parts = append(parts, req.Subject())
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// alwaysScope says what answering "always" approves; see rememberKey.
+func alwaysScope(req tools.ApprovalRequest) string {
+	switch {
+	case req.Rule.Pattern == "":
+		return fmt.Sprintf("approve every %s call for the rest of the chat", req.Tool)
+	case req.Rule.Arg != "":
+		return fmt.Sprintf("approve %s with this same %s for the rest of the chat", req.Tool, req.Rule.Arg)
+	default:
+		return fmt.Sprintf("approve this same %s call for the rest of the chat", req.Tool)
+	}
+}
+
+// RequestApproval implements tools.Approver.
+func (b *approvalBroker) RequestApproval(ctx context.Context, req tools.ApprovalRequest) error {
+	conversation := conversationKey(req.Channel, req.ChatID)
+
+	b.mu.Lock()
+	if b.remembered[conversation][rememberKey(req)] {
+		b.mu.Unlock()
+		return nil
+	}
+	prompt := b.prompt
+	b.mu.Unlock()
+
+	var answer approvalAnswer
+	var err error
+	switch {
+	case req.Channel == "" || req.ChatID == "":
+		return errors.New("it needs approval, but there is no chat to ask in")
+	case constants.IsInternalChannel(req.Channel):
+		if prompt == nil {
+			return errors.New("it needs approval, but there is no user to ask")
+		}
+		answer, err = b.askPrompt(ctx, prompt, req)
+	default:
+		answer, err = b.askChat(ctx, conversation, req)
+	}
+	if err != nil {
+		return err
+	}
+
+	logger.InfoCF("agent", "Tool call approval answered",
+		map[string]interface{}{
+			"tool":     req.Tool,
+			"channel":  req.Channel,
+			"chat_id":  req.ChatID,
+			"approved": answer != answerDeny,
+			"always":   answer == answerAlways,
+		})
+
+	switch answer {
+	case answerAlways:
+		b.mu.Lock()
+		if b.remembered[conversation] == nil {
+			b.remembered[conversation] = make(map[string]bool)
+		}
+		b.remembered[conversation][rememberKey(req)] = true
+		b.mu.Unlock()
+		return nil
+	case answerApprove:
+		return nil
+	default:
+		return errors.New("the user denied it")
+	}
+}
+
+// askChat sends the question to the conversation and waits for Answer.
+func (b *approvalBroker) askChat(ctx context.Context, conversation string, req tools.ApprovalRequest) (approvalAnswer, error) {
+	p := &pendingApproval{id: approvalIDs.Add(1), tool: req.Tool, sender: req.SenderID, answer: make(chan approvalAnswer, 1)}
+	b.mu.Lock()
+	b.pending[conversation] = append(b.pending[conversation], p)
+	b.mu.Unlock()
+
+	data := func(answer string) string {
+		return fmt.Sprintf("approval:%d:%s", p.id, answer)
+	}
+	b.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: req.Channel,
+		ChatID:  req.ChatID,
+		Content: approvalQuestion(req) + fmt.Sprintf(
+			"\n\nReply \"yes\", \"no\" or \"always\" (%s). No answer within %s denies it.",
+			alwaysScope(req), b.timeout),
+		Buttons: []bus.Button{
+			{Text: "Approve", Data: data("yes")},
+			{Text: "Always", Data: data("always")},
+			{Text: "Deny", Data: data("no")},
+		},
+	})
+
+	timer := time.NewTimer(b.timeout)
+	defer timer.Stop()
+
+	select {
+	case answer := <-p.answer:
+		return answer, nil
+	case <-timer.C:
+		if b.remove(conversation, p) {
+			b.bus.PublishOutbound(bus.OutboundMessage{
+				Channel: req.Channel,
+				ChatID:  req.ChatID,
+				Content: fmt.Sprintf("No answer, %s was not run.", req.Tool),
+			})
+			return answerDeny, fmt.Errorf("the user did not answer within %s", b.timeout)
+		}
+		// Answered just as the timer fired.
+		return <-p.answer, nil
+	case <-ctx.Done():
+		b.remove(conversation, p)
+		return answerDeny, ctx.Err()
+	}
+}
+
+// askPrompt asks through the prompt function set for direct conversations.
+func (b *approvalBroker) askPrompt(ctx context.Context, prompt func(ctx context.Context, question string) (string, error), req tools.ApprovalRequest) (approvalAnswer, error) {
+	reply, err := prompt(ctx, approvalQuestion(req))
+	if err != nil {
+		return answerDeny, fmt.Errorf("asking for approval failed: %w", err)
+	}
+	answer, ok := parseApprovalAnswer(reply)
+	if !ok {
+		return answerDeny, nil
+	}
+	return answer, nil
+}
+
+// remove drops p from the pending requests and reports whether it was
+// still pending.
+func (b *approvalBroker) remove(conversation string, p *pendingApproval) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	queue := b.pending[conversation]
+	for i, q := range queue {
+		if q == p {
+			b.pending[conversation] = append(queue[:i:i], queue[i+1:]...)
+			if len(b.pending[conversation]) == 0 {
+				delete(b.pending, conversation)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Answer resolves a pending request with msg if msg answers one. A plain
+// reply answers the oldest request of the chat that its sender may answer;
+// a button names its own. Only the sender whose message led to a call may
+// answer for it, so other members of a group cannot approve it. Answer
+// reports whether msg was consumed.
+func (b *approvalBroker) Answer(msg bus.InboundMessage) bool {
+	id, answer, ok := parseApprovalReply(msg.Content)
+	if !ok {
+		return false
+	}
+	conversation := conversationKey(msg.Channel, msg.ChatID)
+
+	b.mu.Lock()
+	queue := b.pending[conversation]
+	var p *pendingApproval
+	foreign := false
+	for _, q := range queue {
+		if id != 0 && q.id != id {
+			continue
+		}
+		if q.sender != "" && q.sender != msg.SenderID {
+			foreign = foreign || id != 0
+			continue
+		}
+		p = q
+		break
+	}
+	b.mu.Unlock()
+
+	if p == nil && foreign {
+		b.bus.PublishOutbound(bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: "Only the person who made the request can answer this approval.",
+		})
+		return true
+	}
+	if p == nil || !b.remove(conversation, p) {
+		return false
+	}
+	p.answer <- answer
+
+	reply := fmt.Sprintf("Denied %s.", p.tool)
+	if answer != answerDeny {
+		reply = fmt.Sprintf("Approved %s.", p.tool)
+	}
+	b.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Content: reply,
+	})
+	return true
+}
+
+// parseApprovalReply parses a reply to an approval request: a plain answer,
+// or "approval:<id>:<answer>" sent by a button, which returns the ID.
+func parseApprovalReply(text string) (uint64, approvalAnswer, bool) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	var id uint64
+	if rest, ok := strings.CutPrefix(text, "approval:"); ok {
+		idText, answerText, _ := strings.Cut(rest, ":")
+		parsed, err := strconv.ParseUint(idText, 10, 64)
+		if err != nil {
+			return 0, answerDeny, false
+		}
+		id, text = parsed, answerText
+	}
+	answer, ok := parseApprovalAnswer(text)
+	return id, answer, ok
+}
+
+func parseApprovalAnswer(text string) (approvalAnswer, bool) {
+	switch strings.ToLower(strings.TrimSpace(text)) {
+	case "yes", "y", "approve", "ok":
+		return answerApprove, true
+	case "always", "a":
+		return answerAlways, true
+	case "no", "n", "deny":
+		return answerDeny, true
+	}
+	return answerDeny, false
+}
+
+// approvalQuestion describes the call waiting for approval.
+func approvalQuestion(req tools.ApprovalRequest) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "⚠️ Approval needed: %s", req.Tool)
+
+	keys := make([]string, 0, len(req.Args))
+	for k := range req.Args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		value, ok := req.Args[k].(string)
+		if !ok {
+			data, _ := json.Marshal(req.Args[k])
+			value = string(data)
+		}
+		fmt.Fprintf(&sb, "\n%s: %s", k, utils.Truncate(value, 300))
+	}
+	return sb.String()
+}
+
+// SetApprovalPrompt sets how tool calls are approved in conversations
+// without a chat, such as the CLI: prompt shows the question, asks for an
+// answer and returns the reply, "yes", "no" or "always". Without it, such
+// calls are denied.
+func (al *AgentLoop) SetApprovalPrompt(prompt func(ctx context.Context, question string) (string, error)) {
+	if al.approvals != nil {
+		al.approvals.mu.Lock()
+		al.approvals.prompt = prompt
+		al.approvals.mu.Unlock()
+	}
+	for _, profile := range al.profiles {
+		profile.SetApprovalPrompt(prompt)
+	}
+}
+
+// answerApproval hands msg to the approval requests of this agent and its
+// profiles and reports whether it was consumed as an answer. A button of a
+// request that was already answered or timed out is consumed as well.
+func (al *AgentLoop) answerApproval(msg bus.InboundMessage) bool {
+	if al.resolveApproval(msg) {
+		return true
+	}
+	if id, _, ok := parseApprovalReply(msg.Content); ok && id != 0 {
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: "This approval request is no longer pending.",
+		})
+		return true
+	}
+	return false
+}
+
+func (al *AgentLoop) resolveApproval(msg bus.InboundMessage) bool {
+	if al.approvals != nil && al.approvals.Answer(msg) {
+		return true
+	}
+	for _, profile := range al.profiles {
+		if profile.resolveApproval(msg) {
+			return true
+		}
+	}
+	return false
+}
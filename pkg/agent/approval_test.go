@@ -0,0 +1,168 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+func nextOutbound(t *testing.T, msgBus *bus.MessageBus) bus.OutboundMessage {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.SubscribeOutbound(ctx)
+	if !ok {
+		t.Fatal("no outbound message")
+	}
+	return msg
+}
+
+func TestApprovalBroker_AskAndRemember(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	b := newApprovalBroker(msgBus, time.Second)
+	req := tools.ApprovalRequest{
+		Tool:    "exec",
+		Args:    map[string]interface{}{"command": "rm -rf build"},
+		Rule:    tools.ApprovalRule{Tool: "exec"},
+		Channel: "telegram",
+		ChatID:  "42",
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- b.RequestApproval(context.Background(), req) }()
+
+	prompt := nextOutbound(t, msgBus)
+	if !strings.Contains(prompt.Content, "rm -rf build") || len(prompt.Buttons) != 3 {
+		t.Fatalf("prompt = %+v, want the command and three buttons", prompt)
+	}
+	if b.Answer(bus.InboundMessage{Channel: "telegram", ChatID: "7", Content: prompt.Buttons[1].Data}) {
+		t.Error("an answer from another chat should not resolve the request")
+	}
+	if !b.Answer(bus.InboundMessage{Channel: "telegram", ChatID: "42", Content: prompt.Buttons[1].Data}) {
+		t.Fatal("Answer() with the Always button = false, want true")
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("RequestApproval() = %v, want approved", err)
+	}
+	if reply := nextOutbound(t, msgBus); !strings.Contains(reply.Content, "Approved") {
+		t.Errorf("confirmation = %q, want Approved", reply.Content)
+	}
+
+	// "always" approves later calls of the same rule in this chat only.
+	if err := b.RequestApproval(context.Background(), req); err != nil {
+		t.Errorf("remembered RequestApproval() = %v, want nil", err)
+	}
+
+	other := req
+	other.ChatID = "7"
+	go func() { done <- b.RequestApproval(context.Background(), other) }()
+	nextOutbound(t, msgBus)
+	if !b.Answer(bus.InboundMessage{Channel: "telegram", ChatID: "7", Content: " No "}) {
+		t.Fatal("Answer() with a plain no = false, want true")
+	}
+	if err := <-done; err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Errorf("RequestApproval() = %v, want denied", err)
+	}
+}
+
+func TestApprovalBroker_TimeoutAndDirectChannels(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	b := newApprovalBroker(msgBus, 50*time.Millisecond)
+	req := tools.ApprovalRequest{Tool: "write_file", Rule: tools.ApprovalRule{Tool: "write_file"}, Channel: "slack", ChatID: "C1"}
+
+	done := make(chan error, 1)
+	go func() { done <- b.RequestApproval(context.Background(), req) }()
+	prompt := nextOutbound(t, msgBus)
+	if err := <-done; err == nil || !strings.Contains(err.Error(), "did not answer") {
+		t.Errorf("RequestApproval() = %v, want a timeout", err)
+	}
+	if b.Answer(bus.InboundMessage{Channel: "slack", ChatID: "C1", Content: prompt.Buttons[0].Data}) {
+		t.Error("Answer() after the timeout = true, want false")
+	}
+
+	req.Channel, req.ChatID = "cli", "direct"
+	if err := b.RequestApproval(context.Background(), req); err == nil {
+		t.Error("RequestApproval() without a prompt for the CLI should deny")
+	}
+	b.prompt = func(ctx context.Context, question string) (string, error) { return "y\n", nil }
+	if err := b.RequestApproval(context.Background(), req); err != nil {
+		t.Errorf("RequestApproval() answered yes at the prompt = %v, want nil", err)
+	}
+}
+
+func TestApprovalBroker_OnlyRequesterAnswers(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	b := newApprovalBroker(msgBus, time.Second)
+	req := tools.ApprovalRequest{
+		Tool:     "exec",
+		Args:     map[string]interface{}{"command": "git status"},
+		Rule:     tools.ApprovalRule{Tool: "exec", Arg: "command", Pattern: "git *"},
+		Channel:  "telegram",
+		ChatID:   "-100",
+		SenderID: "alice",
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- b.RequestApproval(context.Background(), req) }()
+	prompt := nextOutbound(t, msgBus)
+	if !strings.Contains(prompt.Content, "same command") {
+		t.Errorf("prompt = %q, want it to say always covers the same command", prompt.Content)
+	}
+
+	if b.Answer(bus.InboundMessage{Channel: "telegram", ChatID: "-100", SenderID: "mallory", Content: "yes"}) {
+		t.Error("a plain reply from another member should not answer the request")
+	}
+	if !b.Answer(bus.InboundMessage{Channel: "telegram", ChatID: "-100", SenderID: "mallory", Content: prompt.Buttons[1].Data}) {
+		t.Fatal("a button press from another member should be consumed")
+	}
+	if reply := nextOutbound(t, msgBus); !strings.Contains(reply.Content, "Only the person") {
+		t.Errorf("reply to another member = %q", reply.Content)
+	}
+	if !b.Answer(bus.InboundMessage{Channel: "telegram", ChatID: "-100", SenderID: "alice", Content: "always"}) {
+		t.Fatal("Answer() from the requester = false, want true")
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("RequestApproval() = %v, want approved", err)
+	}
+	nextOutbound(t, msgBus)
+
+	// "always" covers the same command, not everything the pattern matches.
+	if err := b.RequestApproval(context.Background(), req); err != nil {
+		t.Errorf("same command after always = %v, want nil", err)
+	}
+	other := req
+	other.Args = map[string]interface{}{"command": "git push --force"}
+	go func() { done <- b.RequestApproval(context.Background(), other) }()
+	nextOutbound(t, msgBus)
+	b.Answer(bus.InboundMessage{Channel: "telegram", ChatID: "-100", SenderID: "alice", Content: "no"})
+	if err := <-done; err == nil {
+		t.Error("a different command was approved by an earlier always")
+	}
+}
+
+func TestRefuseApprovals(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.Tools.Approval.Enabled = true
+	cfg.Tools.Approval.Rules = []config.ApprovalRule{
+		{Tool: "exec"},
+		{Tool: "write_file", Arg: "path", Pattern: `\.sh$`},
+	}
+	registry := NewToolRegistry(cfg)
+	RefuseApprovals(registry, cfg)
+
+	if _, ok := registry.Get("exec"); ok {
+		t.Error("exec always needs approval and should be left out")
+	}
+	if result := registry.Execute(context.Background(), "write_file", map[string]interface{}{"path": "run.sh", "content": "rm -rf ~"}); !result.IsError {
+		t.Error("a write matching a rule ran without approval")
+	}
+	if result := registry.Execute(context.Background(), "write_file", map[string]interface{}{"path": "notes.md", "content": "hi"}); result.IsError {
+		t.Errorf("a write no rule covers was refused: %s", result.ForLLM)
+	}
+}
@@ -0,0 +1,323 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// Command is a chat command such as /reset. Commands are handled here, the
+// same way for every channel; channels only turn their native command UI
+// into "/name args" messages. Messages starting with "/" that name no
+// command go to the LLM as usual.
+type Command struct {
+	Name        string   // without the leading "/"
+	Aliases     []string // other names, not shown in menus
+	Usage       string   // arguments shown by /help, e.g. "[list|switch <n>]"
+	Description string
+	Hidden      bool // left out of /help and channel menus
+	Handler     func(ctx context.Context, req CommandRequest) string
+}
+
+// CommandRequest is one use of a command.
+type CommandRequest struct {
+	Channel    string
+	ChatID     string
+	SenderID   string
+	ChatKey    string // session key the channel gave the chat
+	SessionKey string // the chat's active session, see /session switch
+	Args       []string
+}
+
+// commandRegistry holds the commands of an agent in registration order.
+type commandRegistry struct {
+	mu       sync.RWMutex
+	commands []*Command
+	byName   map[string]*Command // names and aliases
+}
+
+func newCommandRegistry() *commandRegistry {
+	return &commandRegistry{byName: make(map[string]*Command)}
+}
+
+// register adds cmd, replacing a command of the same name.
+func (r *commandRegistry) register(cmd Command) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := &cmd
+	replaced := false
+	for i, existing := range r.commands {
+		if existing.Name == cmd.Name {
+			for _, alias := range existing.Aliases {
+				delete(r.byName, alias)
+			}
+			r.commands[i] = c
+			replaced = true
+		}
+	}
+	if !replaced {
+		r.commands = append(r.commands, c)
+	}
+	r.byName[cmd.Name] = c
+	for _, alias := range cmd.Aliases {
+		r.byName[alias] = c
+	}
+}
+
+func (r *commandRegistry) get(name string) (*Command, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	cmd, ok := r.byName[name]
+	return cmd, ok
+}
+
+// visible returns the commands shown by /help and in channel menus.
+func (r *commandRegistry) visible() []*Command {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var cmds []*Command
+	for _, cmd := range r.commands {
+		if !cmd.Hidden {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return cmds
+}
+
+// RegisterCommand adds a chat command to this agent and its profiles,
+// replacing a command of the same name.
+func (al *AgentLoop) RegisterCommand(cmd Command) {
+	al.commands.register(cmd)
+	for _, profile := range al.profiles {
+		profile.RegisterCommand(cmd)
+	}
+	if al.channelManager != nil {
+		al.channelManager.SetCommands(al.commandMenu())
+	}
+}
+
+// commandMenu describes the visible commands for channel command menus.
+func (al *AgentLoop) commandMenu() []channels.CommandInfo {
+	var infos []channels.CommandInfo
+	for _, cmd := range al.commands.visible() {
+		infos = append(infos, channels.CommandInfo{Name: cmd.Name, Description: cmd.Description})
+	}
+	return infos
+}
+
+// handleCommand runs the command msg starts with, if any.
+func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage) (string, bool) {
+	content := strings.TrimSpace(msg.Content)
+	if !strings.HasPrefix(content, "/") {
+		return "", false
+	}
+
+	parts := strings.Fields(content)
+	cmd, ok := al.commands.get(strings.ToLower(strings.TrimPrefix(parts[0], "/")))
+	if !ok {
+		return "", false
+	}
+
+	logger.InfoCF("agent", "Handling command",
+		map[string]interface{}{
+			"command":     cmd.Name,
+			"channel":     msg.Channel,
+			"chat_id":     msg.ChatID,
+			"session_key": msg.SessionKey,
+		})
+	return cmd.Handler(ctx, CommandRequest{
+		Channel:    msg.Channel,
+		ChatID:     msg.ChatID,
+		SenderID:   msg.SenderID,
+		ChatKey:    msg.SessionKey,
+		SessionKey: al.activeSession(msg.SessionKey),
+		Args:       parts[1:],
+	}), true
+}
+
+// registerBuiltinCommands registers the commands every agent has.
+func (al *AgentLoop) registerBuiltinCommands() {
+	for _, cmd := range []Command{
+		{Name: "help", Aliases: []string{"start"}, Description: "Show the available commands", Handler: al.cmdHelp},
+		{Name: "reset", Description: "Clear the conversation of the current session", Handler: al.cmdReset},
+		{Name: "session", Usage: "[list|new|switch|rename|archive|delete|fork|export]", Description: "Manage the conversations of this chat", Handler: al.cmdSession},
+		{Name: "model", Usage: "[list|switch <model>|switch default]", Description: "Show or change the model of the current session", Handler: al.cmdModel},
+		{Name: "usage", Description: "Show token usage, cost and budget", Handler: al.cmdUsage},
+		{Name: "status", Description: "Show the agent's status", Handler: al.cmdStatus},
+
+		// Older forms of /model and /status
+		{Name: "show", Usage: "[model|channel]", Hidden: true, Handler: al.cmdShow},
+		{Name: "list", Usage: "[models|channels]", Hidden: true, Handler: al.cmdList},
+		{Name: "switch", Usage: "model to <model>", Hidden: true, Handler: al.cmdSwitch},
+	} {
+		al.commands.register(cmd)
+	}
+}
+
+func (al *AgentLoop) cmdHelp(ctx context.Context, req CommandRequest) string {
+	var sb strings.Builder
+	sb.WriteString("Commands:\n")
+	for _, cmd := range al.commands.visible() {
+		sb.WriteString("/" + cmd.Name)
+		if cmd.Usage != "" {
+			sb.WriteString(" " + cmd.Usage)
+		}
+		sb.WriteString(" - " + cmd.Description + "\n")
+	}
+	sb.WriteString("\nAnything else is sent to the agent.")
+	return sb.String()
+}
+
+func (al *AgentLoop) cmdReset(ctx context.Context, req CommandRequest) string {
+	al.sessions.TruncateHistory(req.SessionKey, 0)
+	al.sessions.SetSummary(req.SessionKey, "")
+	if err := al.sessions.Save(req.SessionKey); err != nil {
+		return fmt.Sprintf("Failed to clear the conversation: %v", err)
+	}
+	// Background commands belong to the conversation that started them
+	al.EndSession(req.SessionKey)
+	return "Conversation cleared."
+}
+
+func (al *AgentLoop) cmdModel(ctx context.Context, req CommandRequest) string {
+	sub := ""
+	if len(req.Args) > 0 {
+		sub = strings.ToLower(req.Args[0])
+	}
+	switch sub {
+	case "", "show":
+		reply := fmt.Sprintf("Current model: %s", al.modelFor(req.SessionKey))
+		if al.sessions.GetModel(req.SessionKey) != "" {
+			reply += fmt.Sprintf(" (default: %s)", al.currentModel())
+		}
+		if reporter, ok := al.provider.(providers.StatusReporter); ok {
+			reply += "\nProviders: " + reporter.Status()
+		}
+		return reply
+	case "list":
+		var sb strings.Builder
+		sb.WriteString("Configured models:\n")
+		for _, model := range al.models {
+			sb.WriteString("- " + model + "\n")
+		}
+		sb.WriteString("Switch with /model switch <model>; other models served by the provider work too.")
+		return sb.String()
+	case "switch":
+		if len(req.Args) < 2 {
+			return "Usage: /model switch <model>, or /model switch default"
+		}
+		return al.switchModel(req, req.Args[1])
+	default:
+		return "Usage: /model [list|switch <model>|switch default]"
+	}
+}
+
+// switchModel sets the model of the active session; "default" goes back to
+// the agent's model.
+func (al *AgentLoop) switchModel(req CommandRequest, model string) string {
+	old := al.modelFor(req.SessionKey)
+	if model == "default" || model == al.currentModel() {
+		model = ""
+	}
+	al.sessions.SetModel(req.SessionKey, model)
+	if err := al.sessions.Save(req.SessionKey); err != nil {
+		return fmt.Sprintf("Failed to save the model: %v", err)
+	}
+	return fmt.Sprintf("Switched model from %s to %s for this session.", old, al.modelFor(req.SessionKey))
+}
+
+func (al *AgentLoop) cmdUsage(ctx context.Context, req CommandRequest) string {
+	return al.usageReport()
+}
+
+func (al *AgentLoop) cmdStatus(ctx context.Context, req CommandRequest) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Model: %s\n", al.modelFor(req.SessionKey))
+	fmt.Fprintf(&sb, "Session: %s, %d messages\n", al.sessionLabel(req.ChatKey, req.SessionKey), len(al.sessions.GetHistory(req.SessionKey)))
+	fmt.Fprintf(&sb, "Tools: %d\n", len(al.tools.List()))
+	if profiles := al.Profiles(); len(profiles) > 0 {
+		fmt.Fprintf(&sb, "Profiles: %s\n", strings.Join(profiles, ", "))
+	}
+	sb.WriteString(al.channelList())
+	return sb.String()
+}
+
+// channelList names the enabled channels.
+func (al *AgentLoop) channelList() string {
+	if al.channelManager == nil {
+		return "Channels: none (channel manager not initialized)"
+	}
+	enabled := al.channelManager.GetEnabledChannels()
+	if len(enabled) == 0 {
+		return "Channels: none"
+	}
+	return "Channels: " + strings.Join(enabled, ", ")
+}
+
+func (al *AgentLoop) cmdShow(ctx context.Context, req CommandRequest) string {
+	if len(req.Args) > 0 {
+		switch req.Args[0] {
+		case "model":
+			return al.cmdModel(ctx, CommandRequest{ChatKey: req.ChatKey, SessionKey: req.SessionKey})
+		case "channel":
+			return fmt.Sprintf("Current channel: %s", req.Channel)
+		}
+	}
+	return "Usage: /show [model|channel]"
+}
+
+func (al *AgentLoop) cmdList(ctx context.Context, req CommandRequest) string {
+	if len(req.Args) > 0 {
+		switch req.Args[0] {
+		case "models":
+			return al.cmdModel(ctx, CommandRequest{ChatKey: req.ChatKey, SessionKey: req.SessionKey, Args: []string{"list"}})
+		case "channels":
+			return al.channelList()
+		}
+	}
+	return "Usage: /list [models|channels]"
+}
+
+func (al *AgentLoop) cmdSwitch(ctx context.Context, req CommandRequest) string {
+	if len(req.Args) < 3 || req.Args[0] != "model" || req.Args[1] != "to" {
+		return "Usage: /switch model to <model>"
+	}
+	return al.switchModel(req, req.Args[2])
+}
+
+// modelFor returns the model of a session: the one chosen with /model
+// switch, or the agent's.
+func (al *AgentLoop) modelFor(sessionKey string) string {
+	if model := al.sessions.GetModel(sessionKey); model != "" {
+		return model
+	}
+	return al.currentModel()
+}
+
+// configuredModels lists the models named in cfg, for /model list.
+func configuredModels(cfg *config.Config) []string {
+	defaults := cfg.Agents.Defaults
+	candidates := []string{defaults.Model, defaults.Routing.Cheap.Model, defaults.Routing.Strong.Model}
+	for _, fb := range defaults.Fallbacks {
+		candidates = append(candidates, fb.Model)
+	}
+	candidates = append(candidates, cfg.Usage.Budget.DowngradeModel)
+
+	var models []string
+	seen := make(map[string]bool)
+	for _, model := range candidates {
+		if model != "" && !seen[model] {
+			seen[model] = true
+			models = append(models, model)
+		}
+	}
+	return models
+}
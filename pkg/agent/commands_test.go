@@ -0,0 +1,188 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestAgentLoop_SessionCommands(t *testing.T) {
+	al, provider := newUsageLoop(t, config.BudgetConfig{})
+	ctx := context.Background()
+	send := func(content string) string {
+		t.Helper()
+		reply, err := al.processMessage(ctx, bus.InboundMessage{
+			Channel: "cli", ChatID: "42", SenderID: "7", Content: content, SessionKey: "cli:42",
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", content, err)
+		}
+		return reply
+	}
+
+	send("hello")
+	if reply := send("/session fork"); !strings.Contains(reply, "now using #2") {
+		t.Fatalf("/session fork = %q", reply)
+	}
+	send("only in the fork")
+	if got := len(al.sessions.GetHistory("cli:42#2")); got != 4 {
+		t.Errorf("fork has %d messages, want 4", got)
+	}
+	if got := len(al.sessions.GetHistory("cli:42")); got != 2 {
+		t.Errorf("main session has %d messages, want 2", got)
+	}
+
+	// The model is chosen per session and persisted with it
+	if reply := send("/model switch other-model"); !strings.Contains(reply, "to other-model") {
+		t.Errorf("/model switch = %q", reply)
+	}
+	send("with the other model")
+	if last := provider.models[len(provider.models)-1]; last != "other-model" {
+		t.Errorf("LLM called with %q, want other-model", last)
+	}
+	data, err := os.ReadFile(filepath.Join(al.workspace, "sessions", "cli_42#2.json"))
+	if err != nil || !strings.Contains(string(data), `"model": "other-model"`) {
+		t.Errorf("session file = %s, %v, want the model saved", data, err)
+	}
+
+	list := send("/session list")
+	if !strings.Contains(list, "1. main - 2 messages") || !strings.Contains(list, "* 2. #2 - 6 messages, model other-model") {
+		t.Errorf("/session list = %q", list)
+	}
+	if reply := send("/session switch main"); !strings.Contains(reply, "Switched to session main") {
+		t.Errorf("/session switch = %q", reply)
+	}
+	send("back in main")
+	if last := provider.models[len(provider.models)-1]; last != "test-model" {
+		t.Errorf("LLM called with %q in main, want test-model", last)
+	}
+
+	if reply := send("/reset"); reply != "Conversation cleared." {
+		t.Errorf("/reset = %q", reply)
+	}
+	if got := len(al.sessions.GetHistory("cli:42")); got != 0 {
+		t.Errorf("main session has %d messages after /reset, want 0", got)
+	}
+	if got := len(al.sessions.GetHistory("cli:42#2")); got != 6 {
+		t.Errorf("/reset cleared the fork too: %d messages", got)
+	}
+
+	if reply := send("/session switch 2"); !strings.Contains(reply, "#2") {
+		t.Errorf("/session switch 2 = %q", reply)
+	}
+	reply := send("/session export")
+	path := strings.TrimSuffix(strings.TrimPrefix(reply, "Exported 6 messages to "), ".")
+	data, err = os.ReadFile(path)
+	if err != nil || !strings.Contains(string(data), "**User:**\n\nonly in the fork") {
+		t.Errorf("/session export = %q, file %s, %v", reply, data, err)
+	}
+
+	// Unknown commands and paths go to the LLM
+	calls := len(provider.models)
+	send("/etc/hosts has a typo")
+	if len(provider.models) != calls+1 {
+		t.Error("message starting with an unknown command did not reach the LLM")
+	}
+}
+
+func TestAgentLoop_NamedSessions(t *testing.T) {
+	al, provider := newUsageLoop(t, config.BudgetConfig{})
+	ctx := context.Background()
+	send := func(al *AgentLoop, content string) string {
+		t.Helper()
+		reply, err := al.processMessage(ctx, bus.InboundMessage{
+			Channel: "cli", ChatID: "42", SenderID: "7", Content: content, SessionKey: "cli:42",
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", content, err)
+		}
+		return reply
+	}
+
+	send(al, "hello")
+	if reply := send(al, "/session new research"); !strings.Contains(reply, "Started session research") {
+		t.Fatalf("/session new = %q", reply)
+	}
+	send(al, "first question")
+	if got := len(al.sessions.GetHistory("cli:42#2")); got != 2 {
+		t.Errorf("new session has %d messages, want 2", got)
+	}
+	if reply := send(al, "/session new research"); !strings.Contains(reply, "already exists") {
+		t.Errorf("duplicate name = %q", reply)
+	}
+	if reply := send(al, "/session rename 7"); !strings.Contains(reply, "reserved") {
+		t.Errorf("numeric name = %q", reply)
+	}
+	if reply := send(al, "/session rename papers"); reply != "Renamed session research to papers." {
+		t.Errorf("/session rename = %q", reply)
+	}
+	send(al, "/session new")
+	send(al, "scratch")
+
+	// The active session is kept in the state file across restarts
+	cfg := &config.Config{Agents: config.AgentsConfig{Defaults: config.AgentDefaults{
+		Workspace: al.workspace, Model: "test-model", MaxTokens: 4096, MaxToolIterations: 10,
+	}}}
+	restarted := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	if reply := send(restarted, "/session"); !strings.Contains(reply, "Session: #3 (cli:42#3)") {
+		t.Errorf("/session after restart = %q", reply)
+	}
+
+	if reply := send(restarted, "/session archive"); !strings.Contains(reply, "Archived session #3") || !strings.Contains(reply, "Now using main") {
+		t.Errorf("/session archive = %q", reply)
+	}
+	list := send(restarted, "/session list")
+	if strings.Contains(list, "#3") || !strings.Contains(list, "2. papers - 2 messages") || !strings.Contains(list, "1 archived") {
+		t.Errorf("/session list = %q", list)
+	}
+	if all := send(restarted, "/session list all"); !strings.Contains(all, "3. #3 - 2 messages") || !strings.Contains(all, "(archived)") {
+		t.Errorf("/session list all = %q", all)
+	}
+	if reply := send(restarted, "/session switch 3"); !strings.Contains(reply, "no longer archived") {
+		t.Errorf("/session switch to an archived session = %q", reply)
+	}
+
+	if reply := send(restarted, "/session delete main"); !strings.Contains(reply, "cannot be deleted") {
+		t.Errorf("/session delete main = %q", reply)
+	}
+	if reply := send(restarted, "/session delete 3"); !strings.Contains(reply, "Deleted session #3") || !strings.Contains(reply, "Now using main") {
+		t.Errorf("/session delete = %q", reply)
+	}
+	if _, err := os.Stat(filepath.Join(al.workspace, "sessions", "cli_42#3.json")); !os.IsNotExist(err) {
+		t.Errorf("deleted session file still exists: %v", err)
+	}
+	if reply := send(restarted, "/session switch Papers"); !strings.Contains(reply, "Switched to session papers") {
+		t.Errorf("/session switch by name = %q", reply)
+	}
+}
+
+func TestAgentLoop_RegisterCommand(t *testing.T) {
+	al, _ := newUsageLoop(t, config.BudgetConfig{})
+	al.RegisterCommand(Command{
+		Name:        "ping",
+		Aliases:     []string{"p"},
+		Description: "Answer with pong",
+		Handler: func(ctx context.Context, req CommandRequest) string {
+			return "pong " + strings.Join(req.Args, " ")
+		},
+	})
+
+	reply, handled := al.handleCommand(context.Background(), bus.InboundMessage{Content: "/P  a b", SessionKey: "cli:1"})
+	if !handled || reply != "pong a b" {
+		t.Errorf("/P a b = %q, %v, want pong a b", reply, handled)
+	}
+
+	help, _ := al.handleCommand(context.Background(), bus.InboundMessage{Content: "/help"})
+	if !strings.Contains(help, "/ping - Answer with pong") || strings.Contains(help, "/switch") {
+		t.Errorf("/help = %q, want /ping and no hidden commands", help)
+	}
+	menu := al.commandMenu()
+	if last := menu[len(menu)-1]; last.Name != "ping" {
+		t.Errorf("last menu command = %+v, want ping", last)
+	}
+}
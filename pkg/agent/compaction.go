@@ -0,0 +1,366 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/session"
+	"github.com/sipeed/picoclaw/pkg/tokenizer"
+	"github.com/sipeed/picoclaw/pkg/usage"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// Long sessions are compacted: all but their most recent messages are
+// replaced by summaries. The messages are summarized in chunks, oldest
+// first, each with the summary of the chunk before it. Tool calls and
+// results are condensed to what they did, such as the files edited and the
+// commands run, before they reach the summarizer.
+//
+// The summaries form tiers (see session.SummaryPart). Each chunk becomes a
+// tier 0 part; once a tier holds more than summaryFanout parts, its oldest
+// are merged into one part of the tier above, and the top tier is kept as
+// a single part. Recent conversation is summarized in detail, older
+// conversation more briefly, and the total stays bounded.
+
+const (
+	summaryFanout     = 4   // parts a tier holds before its oldest are merged
+	maxToolResultText = 500 // characters of a tool result shown to the summarizer
+	maxToolArgsText   = 200 // characters of tool call arguments shown to the summarizer
+)
+
+// summarizer holds the compaction settings of an agent.
+type summarizer struct {
+	provider    providers.LLMProvider // dedicated summarization model; nil uses the agent's
+	model       string
+	keep        int // recent messages kept word for word
+	chunkTokens int
+	maxTiers    int
+}
+
+// newSummarizer creates the configured summarization model. If it cannot
+// be created, the agent's own model summarizes.
+func newSummarizer(cfg *config.Config) summarizer {
+	sc := cfg.Agents.Defaults.Summarization
+	s := summarizer{
+		keep:        sc.KeepMessages,
+		chunkTokens: sc.ChunkTokens,
+		maxTiers:    sc.MaxTiers,
+	}
+	if s.keep <= 0 {
+		s.keep = 8
+	}
+	if s.chunkTokens <= 0 {
+		s.chunkTokens = 4000
+	}
+	if s.maxTiers <= 0 {
+		s.maxTiers = 3
+	}
+
+	if sc.Model == "" && sc.Provider == "" {
+		return s
+	}
+	modelCfg := cfg.ForModel(config.ModelTarget{Provider: sc.Provider, Model: sc.Model})
+	provider, err := providers.CreateProvider(modelCfg)
+	if err != nil {
+		logger.ErrorCF("agent", "Failed to create summarization model, using the agent's model",
+			map[string]interface{}{
+				"model": sc.Model,
+				"error": err.Error(),
+			})
+		return s
+	}
+	s.provider = provider
+	s.model = modelCfg.Agents.Defaults.Model
+	return s
+}
+
+// summarizeSession compacts the history of a session.
+func (al *AgentLoop) summarizeSession(sessionKey string) {
+	history := al.sessions.GetHistory(sessionKey)
+	cut := compactionCut(history, al.summarizer.keep)
+	if cut == 0 {
+		return
+	}
+
+	model, err := al.budgetModel(al.modelFor(sessionKey))
+	if err != nil {
+		return
+	}
+	provider := al.provider
+	if al.summarizer.provider != nil {
+		provider, model = al.summarizer.provider, al.summarizer.model
+	}
+	record := usage.Record{Session: sessionKey}
+
+	parts := al.sessions.GetSummaries(sessionKey)
+	if len(parts) == 0 {
+		// A summary from before summaries had tiers covers everything
+		// up to now, like a top tier part.
+		if summary := al.sessions.GetSummary(sessionKey); summary != "" {
+			parts = []session.SummaryPart{{Tier: al.summarizer.maxTiers - 1, Text: summary}}
+		}
+	}
+	previous := ""
+	if n := len(parts); n > 0 {
+		previous = parts[n-1].Text
+	}
+
+	counter := al.tokenizer.For(model)
+	chunkTokens := min(al.summarizer.chunkTokens, al.inputBudget(model)/2)
+	compacted := 0
+	condensed := condenseMessages(history[:cut], chunkTokens)
+	for _, chunk := range chunkTranscript(counter, history[:cut], condensed, chunkTokens) {
+		text, err := al.summarizeChunk(provider, model, previous, chunk.text, record)
+		if err != nil {
+			logger.WarnCF("agent", "Failed to summarize conversation",
+				map[string]interface{}{
+					"session_key": sessionKey,
+					"error":       err.Error(),
+				})
+			break
+		}
+		parts = append(parts, session.SummaryPart{Tier: 0, Text: text, Messages: chunk.messages})
+		previous = text
+		compacted += chunk.messages
+	}
+	if compacted == 0 {
+		return
+	}
+	parts = al.mergeSummaryTiers(provider, model, parts, record)
+
+	if !al.sessions.Compact(sessionKey, history[:compacted], parts) {
+		// The history was reset or replaced meanwhile
+		return
+	}
+	al.sessions.Save(sessionKey)
+
+	logger.InfoCF("agent", "Compacted conversation history",
+		map[string]interface{}{
+			"session_key":   sessionKey,
+			"model":         model,
+			"compacted":     compacted,
+			"kept":          len(history) - compacted,
+			"summary_parts": len(parts),
+		})
+}
+
+// compactionCut returns how many of the oldest messages to compact so that
+// about keep messages remain. Tool results stay with the assistant message
+// that called the tool.
+func compactionCut(history []providers.Message, keep int) int {
+	cut := len(history) - keep
+	if cut <= 0 {
+		return 0
+	}
+	for cut > 0 && cut < len(history) && history[cut].Role == "tool" {
+		cut--
+	}
+	return cut
+}
+
+// condenseMessages renders each message for the summarizer. Tool calls
+// become a line saying what they did and tool results are shortened; text
+// longer than half a chunk is cut. Other messages render as "".
+func condenseMessages(messages []providers.Message, chunkTokens int) []string {
+	maxText := chunkTokens * 2 // about half a chunk, at ~4 characters a token
+	toolNames := make(map[string]string)
+	condensed := make([]string, 0, len(messages))
+	for _, m := range messages {
+		var sb strings.Builder
+		switch m.Role {
+		case "user":
+			fmt.Fprintf(&sb, "User: %s", utils.Truncate(m.Content, maxText))
+		case "assistant":
+			if m.Content != "" {
+				fmt.Fprintf(&sb, "Assistant: %s", utils.Truncate(m.Content, maxText))
+			}
+			for _, tc := range m.ToolCalls {
+				name, args := toolCallParts(tc)
+				toolNames[tc.ID] = name
+				if sb.Len() > 0 {
+					sb.WriteString("\n")
+				}
+				fmt.Fprintf(&sb, "Assistant %s", describeToolCall(name, args))
+			}
+		case "tool":
+			name := toolNames[m.ToolCallID]
+			if name == "" {
+				name = "tool"
+			}
+			fmt.Fprintf(&sb, "Result of %s: %s", name, utils.Truncate(strings.TrimSpace(m.Content), maxToolResultText))
+		}
+		condensed = append(condensed, sb.String())
+	}
+	return condensed
+}
+
+// toolCallParts returns the name and arguments of a tool call, which are
+// kept either directly or in Function.
+func toolCallParts(tc providers.ToolCall) (string, map[string]interface{}) {
+	if tc.Function == nil {
+		return tc.Name, tc.Arguments
+	}
+	var args map[string]interface{}
+	json.Unmarshal([]byte(tc.Function.Arguments), &args)
+	return tc.Function.Name, args
+}
+
+// describeToolCall says in a few words what a tool call did.
+func describeToolCall(name string, args map[string]interface{}) string {
+	arg := func(key string) string {
+		s, _ := args[key].(string)
+		return utils.Truncate(s, maxToolArgsText)
+	}
+	switch name {
+	case "read_file":
+		return "read file " + arg("path")
+	case "write_file":
+		return "wrote file " + arg("path")
+	case "edit_file":
+		return "edited file " + arg("path")
+	case "append_file":
+		return "appended to file " + arg("path")
+	case "list_dir":
+		return "listed directory " + arg("path")
+	case "exec":
+		return "ran command `" + arg("command") + "`"
+	case "web_fetch":
+		return "fetched " + arg("url")
+	case "web_search":
+		return fmt.Sprintf("searched the web for %q", arg("query"))
+	}
+	data, _ := json.Marshal(args)
+	return fmt.Sprintf("called %s(%s)", name, utils.Truncate(string(data), maxToolArgsText))
+}
+
+// transcriptChunk is a part of a condensed conversation summarized in one
+// call.
+type transcriptChunk struct {
+	text     string
+	messages int
+}
+
+// chunkTranscript groups messages, condensed by condenseMessages, into
+// chunks of about chunkTokens. A message is never split, and tool results
+// stay in the chunk of their call.
+func chunkTranscript(counter tokenizer.Counter, messages []providers.Message, condensed []string, chunkTokens int) []transcriptChunk {
+	var chunks []transcriptChunk
+	var current transcriptChunk
+	tokens := 0
+	for i, text := range condensed {
+		n := counter.Count(text)
+		if current.messages > 0 && tokens+n > chunkTokens && messages[i].Role != "tool" {
+			chunks = append(chunks, current)
+			current, tokens = transcriptChunk{}, 0
+		}
+		if text != "" {
+			current.text += text + "\n"
+		}
+		current.messages++
+		tokens += n
+	}
+	if current.messages > 0 {
+		chunks = append(chunks, current)
+	}
+	return chunks
+}
+
+const summarizePrompt = `Summarize this part of a conversation between a user and an AI assistant, so the assistant can continue it without the original messages.
+
+Keep the user's goals, preferences and instructions, decisions made, facts learned, and open questions and tasks. Say what the assistant did with its tools: which files it read, wrote or edited, which commands it ran and what came of them, what it looked up. Leave out greetings and small talk. Write plain text of at most 250 words.`
+
+const mergePrompt = `Combine these consecutive summaries of a conversation between a user and an AI assistant into one summary of at most 300 words. Keep goals, decisions, facts, open tasks, and the files and commands that mattered; shorten the rest. Write plain text.`
+
+// summarizeChunk summarizes one chunk of a conversation, given the summary
+// of the conversation before it.
+func (al *AgentLoop) summarizeChunk(provider providers.LLMProvider, model, previous, transcript string, record usage.Record) (string, error) {
+	prompt := summarizePrompt
+	if previous != "" {
+		prompt += "\n\nSUMMARY OF THE CONVERSATION BEFORE THIS PART:\n" + previous
+	}
+	prompt += "\n\nCONVERSATION:\n" + transcript
+	return al.summaryCall(provider, model, prompt, record)
+}
+
+// mergeSummaryTiers merges the oldest parts of every tier that holds too
+// many into one part of the tier above. If a merge fails, the parts are
+// kept as they are.
+func (al *AgentLoop) mergeSummaryTiers(provider providers.LLMProvider, model string, parts []session.SummaryPart, record usage.Record) []session.SummaryPart {
+	top := al.summarizer.maxTiers - 1
+	for tier := 0; tier <= top; tier++ {
+		limit := summaryFanout
+		if tier == top {
+			limit = 1
+		}
+		for {
+			// Parts are ordered oldest first, and tiers only rise toward
+			// the oldest, so a tier's parts are next to each other.
+			first, count := -1, 0
+			for i, p := range parts {
+				if p.Tier == tier {
+					if first < 0 {
+						first = i
+					}
+					count++
+				}
+			}
+			if count <= limit {
+				break
+			}
+			n := summaryFanout
+			if tier == top {
+				n = count
+			}
+
+			var sb strings.Builder
+			sb.WriteString(mergePrompt)
+			merged := session.SummaryPart{Tier: min(tier+1, top)}
+			for i, p := range parts[first : first+n] {
+				fmt.Fprintf(&sb, "\n\nSUMMARY %d:\n%s", i+1, p.Text)
+				merged.Messages += p.Messages
+			}
+			text, err := al.summaryCall(provider, model, sb.String(), record)
+			if err != nil {
+				logger.WarnCF("agent", "Failed to merge conversation summaries",
+					map[string]interface{}{
+						"tier":  tier,
+						"error": err.Error(),
+					})
+				return parts
+			}
+			merged.Text = text
+
+			next := make([]session.SummaryPart, 0, len(parts)-n+1)
+			next = append(next, parts[:first]...)
+			next = append(next, merged)
+			parts = append(next, parts[first+n:]...)
+		}
+	}
+	return parts
+}
+
+// summaryCall sends one summarization prompt.
+func (al *AgentLoop) summaryCall(provider providers.LLMProvider, model, prompt string, record usage.Record) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	response, err := provider.Chat(ctx, []providers.Message{{Role: "user", Content: prompt}}, nil, model, map[string]interface{}{
+		"max_tokens":  1024,
+		"temperature": 0.3,
+	})
+	if err != nil {
+		return "", err
+	}
+	al.recordUsage(record, model, response)
+	text := strings.TrimSpace(response.Content)
+	if text == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return text, nil
+}
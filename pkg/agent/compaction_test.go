@@ -0,0 +1,166 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// summaryProvider answers every prompt with a numbered summary and fails
+// from call failFrom on, if set.
+type summaryProvider struct {
+	mu       sync.Mutex
+	prompts  []string
+	models   []string
+	failFrom int
+}
+
+func (p *summaryProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.prompts = append(p.prompts, messages[0].Content)
+	p.models = append(p.models, model)
+	if p.failFrom > 0 && len(p.prompts) >= p.failFrom {
+		return nil, fmt.Errorf("unavailable")
+	}
+	return &providers.LLMResponse{Content: fmt.Sprintf("summary %d", len(p.prompts))}, nil
+}
+
+func (p *summaryProvider) GetDefaultModel() string {
+	return "small-model"
+}
+
+func newCompactionLoop(t *testing.T, sc config.SummarizationConfig) (*AgentLoop, *summaryProvider, *summaryProvider) {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:     t.TempDir(),
+				Model:         "test-model",
+				MaxTokens:     4096,
+				Summarization: sc,
+			},
+		},
+	}
+	agentProvider := &summaryProvider{}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), agentProvider)
+	dedicated := &summaryProvider{}
+	al.summarizer.provider, al.summarizer.model = dedicated, "small-model"
+	return al, agentProvider, dedicated
+}
+
+// addToolTurns adds turns in which the assistant edits a file and runs a
+// command before answering.
+func addToolTurns(al *AgentLoop, key string, turns int) {
+	for i := 0; i < turns; i++ {
+		al.sessions.AddMessage(key, "user", fmt.Sprintf("fix bug %d", i))
+		al.sessions.AddFullMessage(key, providers.Message{Role: "assistant", ToolCalls: []providers.ToolCall{
+			{ID: fmt.Sprintf("e%d", i), Type: "function", Function: &providers.FunctionCall{Name: "edit_file", Arguments: `{"path":"main.go","old_text":"a","new_text":"b"}`}},
+			{ID: fmt.Sprintf("x%d", i), Type: "function", Function: &providers.FunctionCall{Name: "exec", Arguments: `{"command":"make test"}`}},
+		}})
+		al.sessions.AddFullMessage(key, providers.Message{Role: "tool", ToolCallID: fmt.Sprintf("e%d", i), Content: "File edited"})
+		al.sessions.AddFullMessage(key, providers.Message{Role: "tool", ToolCallID: fmt.Sprintf("x%d", i), Content: "PASS"})
+		al.sessions.AddMessage(key, "assistant", fmt.Sprintf("bug %d fixed", i))
+	}
+}
+
+func TestSummarizeSession_CompactsIntoTiers(t *testing.T) {
+	// Keeping 3 messages would start the history with a tool result, so
+	// the whole last tool call is kept.
+	al, agentProvider, dedicated := newCompactionLoop(t, config.SummarizationConfig{KeepMessages: 3, ChunkTokens: 40, MaxTiers: 2})
+	key := "cli:1"
+	addToolTurns(al, key, 8)
+
+	al.summarizeSession(key)
+
+	history := al.sessions.GetHistory(key)
+	if len(history) != 4 || history[0].Role != "assistant" || len(history[0].ToolCalls) != 2 {
+		t.Fatalf("kept history = %+v, want the last tool call, its results and the answer", history)
+	}
+	if len(agentProvider.prompts) != 0 {
+		t.Errorf("the agent's model was asked for %d summaries", len(agentProvider.prompts))
+	}
+	for _, model := range dedicated.models {
+		if model != "small-model" {
+			t.Errorf("summary requested from %q, want small-model", model)
+		}
+	}
+
+	first := dedicated.prompts[0]
+	if !strings.Contains(first, "User: fix bug 0") || !strings.Contains(first, "Assistant edited file main.go") ||
+		!strings.Contains(first, "Assistant ran command `make test`") || !strings.Contains(first, "Result of exec: PASS") {
+		t.Errorf("first prompt does not condense the tool calls:\n%s", first)
+	}
+	if !strings.Contains(dedicated.prompts[1], "BEFORE THIS PART:\nsummary 1") {
+		t.Errorf("second chunk was summarized without the first:\n%s", dedicated.prompts[1])
+	}
+
+	parts := al.sessions.GetSummaries(key)
+	tiers := map[int]int{}
+	covered := 0
+	for i, p := range parts {
+		tiers[p.Tier]++
+		covered += p.Messages
+		if i > 0 && p.Tier > parts[i-1].Tier {
+			t.Errorf("parts out of order: %+v", parts)
+		}
+	}
+	if tiers[1] != 1 || tiers[0] < 1 || tiers[0] > summaryFanout || len(tiers) != 2 {
+		t.Errorf("tiers = %v, want one top part and at most %d tier 0 parts", tiers, summaryFanout)
+	}
+	if covered != 40-4 {
+		t.Errorf("parts cover %d messages, want 36", covered)
+	}
+	if summary := al.sessions.GetSummary(key); !strings.HasSuffix(summary, parts[len(parts)-1].Text) {
+		t.Errorf("summary %q does not end with the newest part", summary)
+	}
+
+	// A summary set directly, as after /reset, replaces the parts
+	al.sessions.SetSummary(key, "")
+	if parts := al.sessions.GetSummaries(key); len(parts) != 0 {
+		t.Errorf("summary parts after SetSummary = %+v", parts)
+	}
+}
+
+func TestSummarizeSession_FailureKeepsToolPairs(t *testing.T) {
+	al, _, dedicated := newCompactionLoop(t, config.SummarizationConfig{KeepMessages: 2, ChunkTokens: 30, MaxTiers: 3})
+	dedicated.failFrom = 2
+	key := "cli:2"
+	addToolTurns(al, key, 3)
+	al.sessions.SetSummary(key, "earlier work")
+
+	al.summarizeSession(key)
+
+	history := al.sessions.GetHistory(key)
+	if len(history) == 15 || history[0].Role == "tool" {
+		t.Fatalf("history after a failed chunk starts with %q and has %d messages", history[0].Role, len(history))
+	}
+	parts := al.sessions.GetSummaries(key)
+	if len(parts) != 2 || parts[0].Text != "earlier work" || parts[0].Tier != 2 || parts[1].Text != "summary 1" {
+		t.Errorf("parts = %+v, want the old summary as top tier and the one chunk summarized", parts)
+	}
+	if !strings.Contains(dedicated.prompts[0], "BEFORE THIS PART:\nearlier work") {
+		t.Errorf("first chunk was summarized without the old summary:\n%s", dedicated.prompts[0])
+	}
+}
+
+func TestCompactionCut(t *testing.T) {
+	history := []providers.Message{
+		{Role: "user"},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "1"}}},
+		{Role: "tool", ToolCallID: "1"},
+		{Role: "tool", ToolCallID: "1"},
+		{Role: "assistant"},
+	}
+	for keep, want := range map[int]int{0: 5, 1: 4, 2: 1, 3: 1, 4: 1, 5: 0, 9: 0} {
+		if got := compactionCut(history, keep); got != want {
+			t.Errorf("compactionCut(keep %d) = %d, want %d", keep, got, want)
+		}
+	}
+}
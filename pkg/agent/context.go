@@ -205,16 +205,66 @@ func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary str
 		Content: systemPrompt,
 	})
 
-	messages = append(messages, history...)
+	messages = append(messages, limitHistoryImages(history)...)
 
 	messages = append(messages, providers.Message{
 		Role:    "user",
 		Content: currentMessage,
+		Parts:   imageParts(currentMessage, media),
 	})
 
 	return messages
 }
 
+// maxHistoryImages is how many images from earlier turns are sent again with
+// each request. Older images are dropped, leaving their message text.
+const maxHistoryImages = 4
+
+// imageParts returns the content parts for a user message with attached
+// media, or nil when none of the media is an image.
+func imageParts(text string, media []string) []providers.ContentPart {
+	var images []providers.ContentPart
+	for _, path := range media {
+		if providers.ImageMediaType(path) != "" {
+			images = append(images, providers.ImagePart(path))
+		}
+	}
+	if len(images) == 0 {
+		return nil
+	}
+
+	parts := make([]providers.ContentPart, 0, len(images)+1)
+	if text != "" {
+		parts = append(parts, providers.TextPart(text))
+	}
+	return append(parts, images...)
+}
+
+// limitHistoryImages keeps the parts of only the most recent image messages.
+// Messages are copied rather than modified, since history belongs to the
+// session manager.
+func limitHistoryImages(history []providers.Message) []providers.Message {
+	result := make([]providers.Message, len(history))
+	copy(result, history)
+
+	images := 0
+	for i := len(result) - 1; i >= 0; i-- {
+		if len(result[i].Parts) == 0 {
+			continue
+		}
+		if images >= maxHistoryImages {
+			result[i].Parts = nil
+			continue
+		}
+		for _, part := range result[i].Parts {
+			if part.Type == "image" {
+				images++
+			}
+		}
+	}
+	return result
+}
+
 func (cb *ContextBuilder) AddToolResult(messages []providers.Message, toolCallID, toolName, result string) []providers.Message {
 	messages = append(messages, providers.Message{
 		Role:       "tool",
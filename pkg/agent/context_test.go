@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func TestBuildMessages_ImageMedia(t *testing.T) {
+	cb := NewContextBuilder(t.TempDir())
+
+	messages := cb.BuildMessages(nil, "", "what is this? [image: photo]",
+		[]string{"/tmp/photo.jpg", "/tmp/voice.ogg"}, "telegram", "1")
+
+	user := messages[len(messages)-1]
+	if user.Content != "what is this? [image: photo]" {
+		t.Errorf("Expected text content to be kept, got %q", user.Content)
+	}
+	if len(user.Parts) != 2 || user.Parts[0].Type != "text" || user.Parts[1].Path != "/tmp/photo.jpg" {
+		t.Fatalf("Expected text and one image part, got %+v", user.Parts)
+	}
+	if user.Parts[1].MediaType != "image/jpeg" {
+		t.Errorf("Expected image/jpeg, got %q", user.Parts[1].MediaType)
+	}
+
+	messages = cb.BuildMessages(nil, "", "listen", []string{"/tmp/voice.ogg"}, "telegram", "1")
+	if parts := messages[len(messages)-1].Parts; parts != nil {
+		t.Errorf("Expected no parts without images, got %+v", parts)
+	}
+}
+
+func TestBuildMessages_LimitsHistoryImages(t *testing.T) {
+	cb := NewContextBuilder(t.TempDir())
+
+	var history []providers.Message
+	for i := 0; i < maxHistoryImages+2; i++ {
+		path := fmt.Sprintf("/tmp/%d.png", i)
+		history = append(history, providers.Message{
+			Role:    "user",
+			Content: "img",
+			Parts:   []providers.ContentPart{providers.ImagePart(path)},
+		})
+	}
+
+	messages := cb.BuildMessages(history, "", "next", nil, "", "")
+
+	withImages := 0
+	for _, m := range messages {
+		if len(m.Parts) > 0 {
+			withImages++
+		}
+	}
+	if withImages != maxHistoryImages {
+		t.Errorf("Expected %d messages with images, got %d", maxHistoryImages, withImages)
+	}
+	if messages[1].Parts != nil {
+		t.Error("Expected the oldest image to be dropped")
+	}
+	if history[0].Parts == nil {
+		t.Error("BuildMessages must not modify session history")
+	}
+}
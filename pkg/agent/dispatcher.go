@@ -0,0 +1,133 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// defaultMaxConcurrentSessions is used when the config leaves the pool size unset.
+const defaultMaxConcurrentSessions = 4
+
+// sessionDispatcher runs inbound messages for different sessions in parallel
+// while keeping messages of the same session strictly in arrival order.
+// Direct turns, such as API requests, queue with them through Do.
+//
+// Each session with pending work gets one goroutine that drains its queue;
+// the number of turns running at the same time is capped by slots.
+type sessionDispatcher struct {
+	handle func(ctx context.Context, msg bus.InboundMessage)
+	slots  chan struct{}
+	mu     sync.Mutex
+	queues map[string][]dispatchJob
+	wg     sync.WaitGroup
+}
+
+// dispatchJob is one queued turn. It is skipped when ctx ends before the
+// turn starts; done, if set, is closed once the job ran or was skipped.
+type dispatchJob struct {
+	ctx  context.Context
+	run  func(ctx context.Context)
+	done chan struct{}
+}
+
+func newSessionDispatcher(workers int, handle func(ctx context.Context, msg bus.InboundMessage)) *sessionDispatcher {
+	if workers <= 0 {
+		workers = defaultMaxConcurrentSessions
+	}
+	return &sessionDispatcher{
+		handle: handle,
+		slots:  make(chan struct{}, workers),
+		queues: make(map[string][]dispatchJob),
+	}
+}
+
+// dispatchKey returns the ordering key for a message. Messages without a
+// session key are ordered per channel/chat instead.
+func dispatchKey(msg bus.InboundMessage) string {
+	if msg.SessionKey != "" {
+		return msg.SessionKey
+	}
+	return msg.Channel + ":" + msg.ChatID
+}
+
+// Dispatch queues msg behind any pending messages of the same session.
+func (d *sessionDispatcher) Dispatch(ctx context.Context, msg bus.InboundMessage) {
+	d.enqueue(dispatchKey(msg), dispatchJob{
+		ctx: ctx,
+		run: func(ctx context.Context) { d.handle(ctx, msg) },
+	})
+}
+
+// Do runs fn in the queue of the session key and waits for it. It reports
+// false if ctx ended before fn could start.
+func (d *sessionDispatcher) Do(ctx context.Context, key string, fn func(ctx context.Context)) bool {
+	ran := false
+	job := dispatchJob{
+		ctx:  ctx,
+		run:  func(ctx context.Context) { ran = true; fn(ctx) },
+		done: make(chan struct{}),
+	}
+	d.enqueue(key, job)
+	<-job.done
+	return ran
+}
+
+func (d *sessionDispatcher) enqueue(key string, job dispatchJob) {
+	d.mu.Lock()
+	queue, active := d.queues[key]
+	d.queues[key] = append(queue, job)
+	d.mu.Unlock()
+
+	if !active {
+		d.wg.Add(1)
+		go d.drain(key)
+	}
+}
+
+// Wait blocks until every queued message has been handled or dropped.
+func (d *sessionDispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// drain processes the queue of one session until it is empty.
+// The queue entry stays in the map while a job is being handled so that
+// enqueue appends to it instead of starting a second drainer.
+func (d *sessionDispatcher) drain(key string) {
+	defer d.wg.Done()
+
+	for {
+		d.mu.Lock()
+		queue := d.queues[key]
+		if len(queue) == 0 {
+			delete(d.queues, key)
+			d.mu.Unlock()
+			return
+		}
+		job := queue[0]
+		d.mu.Unlock()
+
+		if job.ctx.Err() == nil {
+			select {
+			case d.slots <- struct{}{}:
+				job.run(job.ctx)
+				<-d.slots
+			case <-job.ctx.Done():
+			}
+		}
+		if job.done != nil {
+			close(job.done)
+		}
+
+		d.mu.Lock()
+		d.queues[key] = d.queues[key][1:]
+		d.mu.Unlock()
+	}
+}
@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestSessionDispatcher_PreservesOrderWithinSession(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+
+	d := newSessionDispatcher(4, func(ctx context.Context, msg bus.InboundMessage) {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		got = append(got, msg.Content)
+		mu.Unlock()
+	})
+
+	ctx := context.Background()
+	want := []string{"1", "2", "3", "4", "5"}
+	for _, content := range want {
+		d.Dispatch(ctx, bus.InboundMessage{SessionKey: "s1", Content: content})
+	}
+	d.Wait()
+
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d messages, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected message %d to be %q, got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestSessionDispatcher_RunsSessionsInParallel(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan string, 2)
+
+	d := newSessionDispatcher(2, func(ctx context.Context, msg bus.InboundMessage) {
+		started <- msg.SessionKey
+		<-release
+	})
+
+	ctx := context.Background()
+	d.Dispatch(ctx, bus.InboundMessage{SessionKey: "slow"})
+	d.Dispatch(ctx, bus.InboundMessage{SessionKey: "fast"})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("Expected both sessions to start while the other one is blocked")
+		}
+	}
+	close(release)
+	d.Wait()
+}
+
+func TestSessionDispatcher_LimitsConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	running, peak := 0, 0
+
+	d := newSessionDispatcher(2, func(ctx context.Context, msg bus.InboundMessage) {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+
+	ctx := context.Background()
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		d.Dispatch(ctx, bus.InboundMessage{SessionKey: key})
+	}
+	d.Wait()
+
+	if peak > 2 {
+		t.Errorf("Expected at most 2 concurrent sessions, got %d", peak)
+	}
+}
+
+func TestSessionDispatcher_DoWaitsForSession(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	d := newSessionDispatcher(4, func(ctx context.Context, msg bus.InboundMessage) {
+		close(started)
+		<-release
+	})
+
+	ctx := context.Background()
+	d.Dispatch(ctx, bus.InboundMessage{SessionKey: "s1"})
+	<-started
+
+	done := make(chan bool)
+	go func() {
+		done <- d.Do(ctx, "s1", func(ctx context.Context) {})
+	}()
+	select {
+	case <-done:
+		t.Fatal("Expected Do to wait for the running message of its session")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if ran := <-done; !ran {
+		t.Error("Expected Do to run its function")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if d.Do(cancelled, "s2", func(ctx context.Context) { t.Error("Expected a cancelled job to be skipped") }) {
+		t.Error("Expected Do to report a skipped job")
+	}
+	d.Wait()
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/sandbox"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// ExecPolicies converts the exec settings of cfg: the general policy and
+// one per channel with overrides.
+func ExecPolicies(cfg config.ExecToolsConfig) (tools.ExecPolicy, map[string]tools.ExecPolicy) {
+	general := tools.ExecPolicy{
+		Timeout:       time.Duration(cfg.TimeoutSeconds) * time.Second,
+		MaxOutput:     cfg.MaxOutputChars,
+		Shell:         cfg.Shell,
+		AllowPatterns: cfg.AllowPatterns,
+		DenyPatterns:  cfg.DenyPatterns,
+		EnvAllowlist:  cfg.EnvAllowlist,
+		Env:           cfg.Env,
+	}
+
+	channels := make(map[string]tools.ExecPolicy, len(cfg.Channels))
+	for channel, o := range cfg.Channels {
+		p := general
+		p.Disabled = o.Disabled
+		if o.TimeoutSeconds > 0 {
+			p.Timeout = time.Duration(o.TimeoutSeconds) * time.Second
+		}
+		if o.MaxOutputChars > 0 {
+			p.MaxOutput = o.MaxOutputChars
+		}
+		if o.Shell != "" {
+			p.Shell = o.Shell
+		}
+		if len(o.AllowPatterns) > 0 {
+			p.AllowPatterns = o.AllowPatterns
+		}
+		if len(o.EnvAllowlist) > 0 {
+			p.EnvAllowlist = o.EnvAllowlist
+		}
+		p.DenyPatterns = append(append([]string(nil), general.DenyPatterns...), o.DenyPatterns...)
+		if len(o.Env) > 0 {
+			p.Env = make(map[string]string, len(general.Env)+len(o.Env))
+			for k, v := range general.Env {
+				p.Env[k] = v
+			}
+			for k, v := range o.Env {
+				p.Env[k] = v
+			}
+		}
+		channels[channel] = p
+	}
+	return general, channels
+}
+
+// newProcessManager returns the manager of background commands configured
+// by cfg, or nil when they are disabled.
+func newProcessManager(cfg config.ExecBackgroundConfig) *tools.ProcessManager {
+	if !cfg.Enabled {
+		return nil
+	}
+	return tools.NewProcessManager(cfg.MaxProcesses,
+		time.Duration(cfg.MaxLifetimeMinutes)*time.Minute, cfg.BufferKB*1024)
+}
+
+// NewExecTool returns the exec tool configured by cfg for commands in
+// workspace.
+func NewExecTool(cfg *config.Config, workspace string, restrict bool) *tools.ExecTool {
+	execTool := tools.NewExecTool(workspace, restrict)
+	general, channels := ExecPolicies(cfg.Tools.Exec)
+	if err := execTool.SetPolicy(general, channels); err != nil {
+		// Fail closed: a broken deny pattern must not let every command through.
+		logger.ErrorCF("agent", "Invalid exec policy, shell commands are disabled",
+			map[string]interface{}{
+				"error": err.Error(),
+			})
+		execTool.SetPolicy(tools.ExecPolicy{Disabled: true}, nil)
+	}
+	execTool.SetSandbox(sandbox.New(cfg.Tools.Exec.Sandbox, workspace))
+	return execTool
+}
+
+// ConfigureCronTool applies the exec policy and sandbox of cfg to the
+// commands of scheduled jobs.
+func ConfigureCronTool(cronTool *tools.CronTool, cfg *config.Config, workspace string) {
+	general, channels := ExecPolicies(cfg.Tools.Exec)
+	if err := cronTool.SetExecPolicy(general, channels); err != nil {
+		logger.ErrorCF("agent", "Invalid exec policy, scheduled commands are disabled",
+			map[string]interface{}{
+				"error": err.Error(),
+			})
+		cronTool.SetExecPolicy(tools.ExecPolicy{Disabled: true}, nil)
+	}
+	cronTool.SetSandbox(sandbox.New(cfg.Tools.Exec.Sandbox, workspace))
+}
@@ -16,7 +16,6 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
-	"unicode/utf8"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/channels"
@@ -26,7 +25,9 @@ import (
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/session"
 	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/tokenizer"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/usage"
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
@@ -34,35 +35,91 @@ type AgentLoop struct {
 	bus            *bus.MessageBus
 	provider       providers.LLMProvider
 	workspace      string
-	model          string
-	contextWindow  int // Maximum context window size in tokens
+	model          string          // Default model; sessions may choose another with /model
+	models         []string        // Models named in the config, for /model list
+	contextWindow  int             // Configured context window in tokens; 0 looks it up by model
+	vision         map[string]bool // Configured image support by model; others are looked up
+	maxTokens      int             // Output cap of each LLM call
+	tokenizer      *tokenizer.Registry
 	maxIterations  int
+	maxConcurrent  int  // Maximum number of sessions processed in parallel
+	streaming      bool // Stream partial replies when the provider supports it
 	sessions       *session.SessionManager
+	retention      func(key string) session.Retention // nil keeps every session
 	state          *state.Manager
 	contextBuilder *ContextBuilder
 	tools          *tools.ToolRegistry
 	running        atomic.Bool
-	summarizing    sync.Map // Tracks which sessions are currently being summarized
+	summarizing    sync.Map           // Tracks which sessions are currently being summarized
+	summarizer     summarizer         // Compacts long sessions; see compaction.go
+	dispatcher     *sessionDispatcher // Orders the turns of each session; see Run and ProcessAPI
 	channelManager *channels.Manager
+	profiles       map[string]*AgentLoop // Named agent profiles messages can be routed to
+	routes         []config.AgentRoute
+	usage          *usage.Ledger // Records token usage; nil disables usage tracking and budgets
+	budget         config.BudgetConfig
+	approvals      *approvalBroker       // Asks the user to approve dangerous tool calls; nil runs them without asking
+	processes      *tools.ProcessManager // Commands exec started in the background; nil when disabled
+	commands       *commandRegistry      // Chat commands such as /reset
 }
 
 // processOptions configures how a message is processed
 type processOptions struct {
-	SessionKey      string // Session identifier for history/context
-	Channel         string // Target channel for tool execution
-	ChatID          string // Target chat ID for tool execution
-	UserMessage     string // User message content (may include prefix)
-	DefaultResponse string // Response when LLM returns empty
-	EnableSummary   bool   // Whether to trigger summarization
-	SendResponse    bool   // Whether to send response via bus
-	NoHistory       bool   // If true, don't load session history (for heartbeat)
+	SessionKey      string             // Session identifier for history/context
+	Channel         string             // Target channel for tool execution
+	ChatID          string             // Target chat ID for tool execution
+	SenderID        string             // Sender of the message, recorded in the usage ledger
+	UserMessage     string             // User message content (may include prefix)
+	DefaultResponse string             // Response when LLM returns empty
+	EnableSummary   bool               // Whether to trigger summarization
+	SendResponse    bool               // Whether to send response via bus
+	NoHistory       bool               // If true, don't load session history (for heartbeat)
+	Stream          bool               // Whether to publish partial output while the LLM responds
+	OnDelta         func(delta string) // Receives streamed text for direct callers; nil disables
+	Media           []string           // Local paths of files attached to the user message
 }
 
 // createToolRegistry creates a tool registry with common tools.
 // This is shared between main agent and subagents.
-func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msgBus *bus.MessageBus) *tools.ToolRegistry {
+func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msgBus *bus.MessageBus, processes *tools.ProcessManager) *tools.ToolRegistry {
 	registry := tools.NewToolRegistry()
+	registry.SetAllowed(cfg.Agents.Defaults.Tools)
+	registry.SetParallelism(cfg.Tools.Parallel.MaxConcurrent, time.Duration(cfg.Tools.Parallel.TimeoutSeconds)*time.Second)
+	registerBaseTools(registry, workspace, restrict, cfg, processes)
 
+	// Message tool - available to both agent and subagent
+	// Subagent uses it to communicate directly with user
+	messageTool := tools.NewMessageTool(workspace, restrict)
+	messageTool.SetSendCallback(func(channel, chatID, content string, attachments []bus.Attachment) error {
+		msgBus.PublishOutbound(bus.OutboundMessage{
+			Channel:     channel,
+			ChatID:      chatID,
+			Content:     content,
+			Attachments: attachments,
+		})
+		return nil
+	})
+	registry.Register(messageTool)
+	registry.Register(tools.NewSendFileTool(messageTool))
+
+	return registry
+}
+
+// NewToolRegistry returns the file system, shell, web and hardware tools
+// configured by cfg, sandboxed the same way as the agent's own tools.
+// Tools that need a running agent (message, spawn, subagent, process) are
+// not included.
+func NewToolRegistry(cfg *config.Config) *tools.ToolRegistry {
+	registry := tools.NewToolRegistry()
+	registry.SetAllowed(cfg.Agents.Defaults.Tools)
+	registerBaseTools(registry, cfg.WorkspacePath(), cfg.Agents.Defaults.RestrictToWorkspace, cfg, nil)
+	return registry
+}
+
+// registerBaseTools registers the tools that work without an agent loop.
+// With processes, exec can start commands in the background and the
+// process tool manages them.
+func registerBaseTools(registry *tools.ToolRegistry, workspace string, restrict bool, cfg *config.Config, processes *tools.ProcessManager) {
 	// File system tools
 	registry.Register(tools.NewReadFileTool(workspace, restrict))
 	registry.Register(tools.NewWriteFileTool(workspace, restrict))
@@ -71,7 +128,12 @@ func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msg
 	registry.Register(tools.NewAppendFileTool(workspace, restrict))
 
 	// Shell execution
-	registry.Register(tools.NewExecTool(workspace, restrict))
+	execTool := NewExecTool(cfg, workspace, restrict)
+	if processes != nil {
+		execTool.SetProcessManager(processes)
+		registry.Register(tools.NewProcessTool(processes, cfg.Tools.Exec.MaxOutputChars))
+	}
+	registry.Register(execTool)
 
 	if searchTool := tools.NewWebSearchTool(tools.WebSearchToolOptions{
 		BraveAPIKey:          cfg.Tools.Web.Brave.APIKey,
@@ -85,26 +147,15 @@ func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msg
 	}); searchTool != nil {
 		registry.Register(searchTool)
 	}
-	registry.Register(tools.NewWebFetchTool(50000))
+	fetchTool := tools.NewWebFetchTool(cfg.Tools.Web.Fetch.MaxChars)
+	if cfg.Tools.Web.Fetch.CacheMB > 0 {
+		fetchTool.SetCache(filepath.Join(workspace, "state", "web_cache"), int64(cfg.Tools.Web.Fetch.CacheMB)<<20)
+	}
+	registry.Register(fetchTool)
 
 	// Hardware tools (I2C, SPI) - Linux only, returns error on other platforms
 	registry.Register(tools.NewI2CTool())
 	registry.Register(tools.NewSPITool())
-
-	// Message tool - available to both agent and subagent
-	// Subagent uses it to communicate directly with user
-	messageTool := tools.NewMessageTool()
-	messageTool.SetSendCallback(func(channel, chatID, content string) error {
-		msgBus.PublishOutbound(bus.OutboundMessage{
-			Channel: channel,
-			ChatID:  chatID,
-			Content: content,
-		})
-		return nil
-	})
-	registry.Register(messageTool)
-
-	return registry
 }
 
 func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers.LLMProvider) *AgentLoop {
@@ -113,12 +164,15 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 
 	restrict := cfg.Agents.Defaults.RestrictToWorkspace
 
+	// Background commands of the agent and its subagents
+	processes := newProcessManager(cfg.Tools.Exec.Background)
+
 	// Create tool registry for main agent
-	toolsRegistry := createToolRegistry(workspace, restrict, cfg, msgBus)
+	toolsRegistry := createToolRegistry(workspace, restrict, cfg, msgBus, processes)
 
 	// Create subagent manager with its own tool registry
 	subagentManager := tools.NewSubagentManager(provider, cfg.Agents.Defaults.Model, workspace, msgBus)
-	subagentTools := createToolRegistry(workspace, restrict, cfg, msgBus)
+	subagentTools := createToolRegistry(workspace, restrict, cfg, msgBus, processes)
 	// Subagent doesn't need spawn/subagent tools to avoid recursion
 	subagentManager.SetTools(subagentTools)
 
@@ -130,7 +184,31 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 	subagentTool := tools.NewSubagentTool(subagentManager)
 	toolsRegistry.Register(subagentTool)
 
-	sessionsManager := session.NewSessionManager(filepath.Join(workspace, "sessions"))
+	var approvals *approvalBroker
+	if cfg.Tools.Approval.Enabled {
+		approvals = newApprovalBroker(msgBus, time.Duration(cfg.Tools.Approval.TimeoutSeconds)*time.Second)
+		policy, err := newApprovalPolicy(cfg.Tools.Approval)
+		if err != nil {
+			// Fail closed: an invalid rule must not let dangerous calls through.
+			logger.ErrorCF("agent", "Invalid approval rules, every tool call needs approval",
+				map[string]interface{}{
+					"error": err.Error(),
+				})
+			policy, _ = tools.NewApprovalPolicy([]tools.ApprovalRule{{Tool: "*"}})
+		}
+		toolsRegistry.SetApproval(policy, approvals)
+		subagentTools.SetApproval(policy, approvals)
+	}
+
+	sessionsManager, err := OpenSessions(cfg, workspace)
+	if err != nil {
+		logger.ErrorCF("agent", "Failed to open session store, keeping sessions as JSON files",
+			map[string]interface{}{
+				"backend": cfg.Sessions.Backend,
+				"error":   err.Error(),
+			})
+		sessionsManager = session.NewSessionManager(filepath.Join(workspace, "sessions"))
+	}
 
 	// Create state manager for atomic state persistence
 	stateManager := state.NewManager(workspace)
@@ -139,24 +217,59 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 	contextBuilder := NewContextBuilder(workspace)
 	contextBuilder.SetToolsRegistry(toolsRegistry)
 
-	return &AgentLoop{
+	maxTokens := cfg.Agents.Defaults.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = 8192
+	}
+
+	usageLedger, err := usage.NewLedger(usage.Dir(workspace), cfg.Usage.Prices)
+	if err != nil {
+		logger.WarnCF("agent", "Usage tracking disabled",
+			map[string]interface{}{
+				"error": err.Error(),
+			})
+	}
+
+	al := &AgentLoop{
 		bus:            msgBus,
 		provider:       provider,
 		workspace:      workspace,
 		model:          cfg.Agents.Defaults.Model,
-		contextWindow:  cfg.Agents.Defaults.MaxTokens, // Restore context window for summarization
+		models:         configuredModels(cfg),
+		contextWindow:  cfg.Agents.Defaults.ContextWindow,
+		vision:         cfg.Agents.Defaults.Vision,
+		maxTokens:      maxTokens,
+		tokenizer:      tokenizer.NewRegistry(cfg.TokenizerPath()),
 		maxIterations:  cfg.Agents.Defaults.MaxToolIterations,
+		maxConcurrent:  cfg.Agents.Defaults.MaxConcurrentSessions,
+		streaming:      cfg.Agents.Defaults.Streaming,
 		sessions:       sessionsManager,
+		retention:      SessionRetention(cfg.Sessions),
 		state:          stateManager,
 		contextBuilder: contextBuilder,
 		tools:          toolsRegistry,
 		summarizing:    sync.Map{},
+		summarizer:     newSummarizer(cfg),
+		routes:         cfg.Agents.Routes,
+		usage:          usageLedger,
+		budget:         cfg.Usage.Budget,
+		approvals:      approvals,
+		processes:      processes,
+		commands:       newCommandRegistry(),
 	}
+	al.registerBuiltinCommands()
+	// Messages of one session are handled in order; different sessions run in parallel.
+	al.dispatcher = newSessionDispatcher(al.maxConcurrent, al.handleRouted)
+	return al
 }
 
 func (al *AgentLoop) Run(ctx context.Context) error {
 	al.running.Store(true)
 
+	go al.pruneSessions(ctx)
+
+	defer al.dispatcher.Wait()
+
 	for al.running.Load() {
 		select {
 		case <-ctx.Done():
@@ -167,45 +280,102 @@ func (al *AgentLoop) Run(ctx context.Context) error {
 				continue
 			}
 
-			response, err := al.processMessage(ctx, msg)
-			if err != nil {
-				response = fmt.Sprintf("Error processing message: %v", err)
+			// Replies to approval requests go to the waiting turn, which
+			// blocks its session's queue until it gets them.
+			if al.answerApproval(msg) {
+				al.bus.AckInbound(msg)
+				continue
 			}
 
-			if response != "" {
-				// Check if the message tool already sent a response during this round.
-				// If so, skip publishing to avoid duplicate messages to the user.
-				alreadySent := false
-				if tool, ok := al.tools.Get("message"); ok {
-					if mt, ok := tool.(*tools.MessageTool); ok {
-						alreadySent = mt.HasSentInRound()
-					}
-				}
-
-				if !alreadySent {
-					al.bus.PublishOutbound(bus.OutboundMessage{
-						Channel: msg.Channel,
-						ChatID:  msg.ChatID,
-						Content: response,
-					})
-				}
-			}
+			al.dispatcher.Dispatch(ctx, msg)
 		}
 	}
 
 	return nil
 }
 
+// handleInbound processes one inbound message and publishes the response.
+func (al *AgentLoop) handleInbound(ctx context.Context, msg bus.InboundMessage) {
+	// Acknowledge only a finished turn: with a durable bus, a message cut
+	// off by a crash or shutdown is replayed on the next start.
+	defer func() {
+		if ctx.Err() == nil {
+			al.bus.AckInbound(msg)
+		}
+	}()
+
+	// Per-turn state lives in the context so concurrent turns never share it.
+	turn := tools.NewTurnState()
+	ctx = tools.WithTurnState(ctx, turn)
+
+	// Only replies published by this loop are streamed; direct callers
+	// (cron, heartbeat, CLI) receive the final response as a return value.
+	response, err := al.processMessageStream(ctx, msg, al.streaming, nil)
+	if err != nil {
+		response = fmt.Sprintf("Error processing message: %v", err)
+	}
+
+	// If the message tool already sent a response during this turn,
+	// skip publishing to avoid duplicate messages to the user, unless the
+	// reply was streamed: the chat then shows a preview of it, possibly cut
+	// off, that only the final message completes.
+	if response != "" && (!turn.MessageSent() || turn.ReplyStreamed()) {
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: response,
+		})
+	}
+}
+
+// Stop stops Run and kills the background processes of all sessions.
 func (al *AgentLoop) Stop() {
 	al.running.Store(false)
+	if al.processes != nil {
+		al.processes.Shutdown()
+	}
+	for _, profile := range al.profiles {
+		profile.Stop()
+	}
+}
+
+// EndSession kills the background processes started in the session.
+func (al *AgentLoop) EndSession(sessionKey string) {
+	if al.processes != nil {
+		al.processes.EndSession(sessionKey)
+	}
+	for _, profile := range al.profiles {
+		profile.EndSession(sessionKey)
+	}
 }
 
+// RegisterTool registers a tool with this agent and its profiles. Profiles
+// with a tool allowlist skip tools it does not name.
 func (al *AgentLoop) RegisterTool(tool tools.Tool) {
 	al.tools.Register(tool)
+	for _, profile := range al.profiles {
+		profile.RegisterTool(tool)
+	}
 }
 
+// UnregisterTool removes a tool from this agent and its profiles.
+func (al *AgentLoop) UnregisterTool(name string) {
+	al.tools.Unregister(name)
+	for _, profile := range al.profiles {
+		profile.UnregisterTool(name)
+	}
+}
+
+// SetChannelManager also passes the chat commands to channels that offer
+// them in a native command UI.
 func (al *AgentLoop) SetChannelManager(cm *channels.Manager) {
 	al.channelManager = cm
+	if cm != nil {
+		cm.SetCommands(al.commandMenu())
+	}
+	for _, profile := range al.profiles {
+		profile.SetChannelManager(cm)
+	}
 }
 
 // GetToolRegistry returns the tool registry for external tool registration
@@ -241,9 +411,34 @@ func (al *AgentLoop) ProcessDirectWithChannel(ctx context.Context, content, sess
 	return al.processMessage(ctx, msg)
 }
 
+// ProcessAPI runs a turn for the OpenAI-compatible API. The turn waits for
+// the other messages of its session, so an API request never runs at the
+// same time as another request or a chat message for that session. onDelta,
+// when set, receives the output as it is generated.
+func (al *AgentLoop) ProcessAPI(ctx context.Context, content, sessionKey, senderID string, onDelta func(delta string)) (string, error) {
+	msg := bus.InboundMessage{
+		Channel:    "api",
+		SenderID:   senderID,
+		ChatID:     sessionKey,
+		Content:    content,
+		SessionKey: sessionKey,
+	}
+
+	var response string
+	var err error
+	ran := al.dispatcher.Do(ctx, dispatchKey(msg), func(ctx context.Context) {
+		response, err = al.processMessageStream(ctx, msg, false, onDelta)
+	})
+	if !ran {
+		return "", ctx.Err()
+	}
+	return response, err
+}
+
 // ProcessHeartbeat processes a heartbeat request without session history.
 // Each heartbeat is independent and doesn't accumulate context.
 func (al *AgentLoop) ProcessHeartbeat(ctx context.Context, content, channel, chatID string) (string, error) {
+	defer al.EndSession("heartbeat")
 	return al.runAgentLoop(ctx, processOptions{
 		SessionKey:      "heartbeat",
 		Channel:         channel,
@@ -257,6 +452,12 @@ func (al *AgentLoop) ProcessHeartbeat(ctx context.Context, content, channel, cha
 }
 
 func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage) (string, error) {
+	return al.processMessageStream(ctx, msg, false, nil)
+}
+
+// processMessageStream is processMessage with optional streaming of partial
+// output, either to the message's channel (stream) or to onDelta.
+func (al *AgentLoop) processMessageStream(ctx context.Context, msg bus.InboundMessage, stream bool, onDelta func(delta string)) (string, error) {
 	// Add message preview to log (show full content for error messages)
 	var logContent string
 	if strings.Contains(msg.Content, "Error:") || strings.Contains(msg.Content, "error") {
@@ -282,15 +483,19 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 		return response, nil
 	}
 
-	// Process as user message
+	// Process as user message, in the session the chat has switched to
 	return al.runAgentLoop(ctx, processOptions{
-		SessionKey:      msg.SessionKey,
+		SessionKey:      al.activeSession(msg.SessionKey),
 		Channel:         msg.Channel,
 		ChatID:          msg.ChatID,
+		SenderID:        msg.SenderID,
 		UserMessage:     msg.Content,
 		DefaultResponse: "I've completed processing but have no response to give.",
 		EnableSummary:   true,
 		SendResponse:    false,
+		Stream:          stream && !constants.IsInternalChannel(msg.Channel),
+		OnDelta:         onDelta,
+		Media:           msg.Media,
 	})
 }
 
@@ -360,8 +565,12 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 		}
 	}
 
-	// 1. Update tool contexts
-	al.updateToolContexts(opts.Channel, opts.ChatID)
+	// 1. Attach the session, sender and channel/chatID for tools to this turn's context
+	ctx = tools.WithSession(ctx, opts.SessionKey)
+	ctx = tools.WithSender(ctx, opts.SenderID)
+	if opts.Channel != "" && opts.ChatID != "" {
+		ctx = tools.WithChannel(ctx, opts.Channel, opts.ChatID)
+	}
 
 	// 2. Build messages (skip history for heartbeat)
 	var history []providers.Message
@@ -374,13 +583,13 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 		history,
 		summary,
 		opts.UserMessage,
-		nil,
+		opts.Media,
 		opts.Channel,
 		opts.ChatID,
 	)
 
-	// 3. Save user message to session
-	al.sessions.AddMessage(opts.SessionKey, "user", opts.UserMessage)
+	// 3. Save user message to session (images are stored as file references)
+	al.sessions.AddFullMessage(opts.SessionKey, messages[len(messages)-1])
 
 	// 4. Run LLM iteration loop
 	finalContent, iteration, err := al.runLLMIteration(ctx, messages, opts)
@@ -396,7 +605,7 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 			"original_length": len(finalContent),
 			"max_length":      maxResponseLength,
 		})
-		finalContent = finalContent[:maxResponseLength] + 
+		finalContent = finalContent[:maxResponseLength] +
 			"\n\n[Response truncated due to excessive length. Please be more specific in your request.]"
 	}
 
@@ -447,6 +656,12 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 	for iteration < al.maxIterations {
 		iteration++
 
+		// Checked per iteration so a long tool loop stops once a budget is used up
+		model, err := al.budgetModel(al.modelFor(opts.SessionKey))
+		if err != nil {
+			return "", iteration, err
+		}
+
 		logger.DebugCF("agent", "LLM iteration",
 			map[string]interface{}{
 				"iteration": iteration,
@@ -456,14 +671,24 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 		// Build tool definitions
 		providerToolDefs := al.tools.ToProviderDefs()
 
+		// Text-only models fail on image parts; they get a placeholder instead
+		if !providers.SupportsVision(model, al.vision) {
+			messages = providers.WithoutImages(messages)
+		}
+
+		// Trim before calling rather than waiting for a context error
+		messages = al.fitToWindow(model, messages, providerToolDefs)
+
 		// Log LLM request details
 		logger.DebugCF("agent", "LLM request",
 			map[string]interface{}{
 				"iteration":         iteration,
-				"model":             al.model,
+				"model":             model,
 				"messages_count":    len(messages),
 				"tools_count":       len(providerToolDefs),
-				"max_tokens":        8192,
+				"tokens":            al.countTokens(model, messages, providerToolDefs),
+				"context_window":    al.contextWindowFor(model),
+				"max_tokens":        al.maxTokens,
 				"temperature":       0.7,
 				"system_prompt_len": len(messages[0].Content),
 			})
@@ -477,26 +702,27 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 			})
 
 		var response *providers.LLMResponse
-		var err error
 
 		// Retry loop for context/token errors
 		maxRetries := 2
 		for retry := 0; retry <= maxRetries; retry++ {
-			response, err = al.provider.Chat(ctx, messages, providerToolDefs, al.model, map[string]interface{}{
-				"max_tokens":  8192,
+			response, err = al.callLLM(ctx, messages, providerToolDefs, model, map[string]interface{}{
+				"max_tokens":  al.maxTokens,
 				"temperature": 0.7,
-			})
+			}, opts)
 
 			if err == nil {
+				al.recordUsage(usage.Record{
+					Session: opts.SessionKey,
+					Channel: opts.Channel,
+					Sender:  opts.SenderID,
+				}, model, response)
 				break // Success
 			}
 
-			errMsg := strings.ToLower(err.Error())
-			// Check for context window errors (provider specific, but usually contain "token" or "invalid")
-			isContextError := strings.Contains(errMsg, "token") ||
-				strings.Contains(errMsg, "context") ||
-				strings.Contains(errMsg, "invalidparameter") ||
-				strings.Contains(errMsg, "length")
+			// The token count can be off for models without an exact
+			// tokenizer, so the provider may still reject the request.
+			isContextError := providers.ClassifyError(err) == providers.ErrorContext
 
 			if isContextError && retry < maxRetries {
 				logger.WarnCF("agent", "Context window error detected, attempting compression", map[string]interface{}{
@@ -527,7 +753,7 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 					newHistory,
 					newSummary,
 					opts.UserMessage,
-					nil,
+					opts.Media,
 					opts.Channel,
 					opts.ChatID,
 				)
@@ -655,7 +881,7 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 		// Save assistant message with tool calls to session
 		al.sessions.AddFullMessage(opts.SessionKey, assistantMsg)
 
-		// Execute tool calls
+		// Execute tool calls; concurrency-safe ones run in parallel
 		for _, tc := range response.ToolCalls {
 			// Log tool call with arguments preview
 			argsJSON, _ := json.Marshal(tc.Arguments)
@@ -665,12 +891,14 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 					"tool":      tc.Name,
 					"iteration": iteration,
 				})
+		}
 
-			// Create async callback for tools that implement AsyncTool
-			// NOTE: Following openclaw's design, async tools do NOT send results directly to users.
-			// Instead, they notify the agent via PublishInbound, and the agent decides
-			// whether to forward the result to the user (in processSystemMessage).
-			asyncCallback := func(callbackCtx context.Context, result *tools.ToolResult) {
+		// Create async callback for tools that implement AsyncTool
+		// NOTE: Following openclaw's design, async tools do NOT send results directly to users.
+		// Instead, they notify the agent via PublishInbound, and the agent decides
+		// whether to forward the result to the user (in processSystemMessage).
+		asyncCallback := func(tc providers.ToolCall) tools.AsyncCallback {
+			return func(callbackCtx context.Context, result *tools.ToolResult) {
 				// Log the async completion but don't send directly to user
 				// The agent will handle user notification via processSystemMessage
 				if !result.Silent && result.ForUser != "" {
@@ -681,8 +909,14 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 						})
 				}
 			}
+		}
+
+		toolResults := al.tools.ExecuteAll(ctx, response.ToolCalls, opts.Channel, opts.ChatID, asyncCallback)
 
-			toolResult := al.tools.ExecuteWithContext(ctx, tc.Name, tc.Arguments, opts.Channel, opts.ChatID, asyncCallback)
+		// Results are handled in call order so every tool message follows
+		// the call it answers
+		for i, tc := range response.ToolCalls {
+			toolResult := toolResults[i]
 
 			// Send ForUser content to user immediately if not Silent
 			if !toolResult.Silent && toolResult.ForUser != "" && opts.SendResponse {
@@ -719,36 +953,52 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 	return finalContent, iteration, nil
 }
 
-// updateToolContexts updates the context for tools that need channel/chatID info.
-func (al *AgentLoop) updateToolContexts(channel, chatID string) {
-	// Use ContextualTool interface instead of type assertions
-	if tool, ok := al.tools.Get("message"); ok {
-		if mt, ok := tool.(tools.ContextualTool); ok {
-			mt.SetContext(channel, chatID)
-		}
+// callLLM invokes the provider for one iteration. When the turn allows it and
+// the provider implements StreamingProvider, partial text is forwarded to the
+// user's channel as it arrives.
+func (al *AgentLoop) callLLM(ctx context.Context, messages []providers.Message, toolDefs []providers.ToolDefinition, model string, llmOpts map[string]interface{}, opts processOptions) (*providers.LLMResponse, error) {
+	streamer, ok := al.provider.(providers.StreamingProvider)
+	if ok && opts.OnDelta != nil {
+		return streamer.ChatStream(ctx, messages, toolDefs, model, llmOpts, func(chunk providers.StreamChunk) {
+			if chunk.Content != "" {
+				opts.OnDelta(chunk.Content)
+			}
+		})
 	}
-	if tool, ok := al.tools.Get("spawn"); ok {
-		if st, ok := tool.(tools.ContextualTool); ok {
-			st.SetContext(channel, chatID)
-		}
+	if !ok || !opts.Stream || opts.Channel == "" || opts.ChatID == "" {
+		return al.provider.Chat(ctx, messages, toolDefs, model, llmOpts)
+	}
+
+	forwarder := newStreamForwarder(al.bus, opts.Channel, opts.ChatID, streamUpdateInterval)
+	response, err := streamer.ChatStream(ctx, messages, toolDefs, model, llmOpts, forwarder.OnChunk)
+	if err != nil {
+		return nil, err
 	}
-	if tool, ok := al.tools.Get("subagent"); ok {
-		if st, ok := tool.(tools.ContextualTool); ok {
-			st.SetContext(channel, chatID)
+
+	// The final answer is published as a regular message; only text that
+	// precedes tool calls needs an explicit flush.
+	if len(response.ToolCalls) > 0 {
+		forwarder.Flush()
+	} else if forwarder.Published() {
+		if turn := tools.TurnStateFromContext(ctx); turn != nil {
+			turn.MarkReplyStreamed()
 		}
 	}
+	return response, nil
 }
 
 // maybeSummarize triggers summarization if the session history exceeds thresholds.
 func (al *AgentLoop) maybeSummarize(sessionKey, channel, chatID string) {
 	newHistory := al.sessions.GetHistory(sessionKey)
-	tokenEstimate := al.estimateTokens(newHistory)
-	// Increased threshold to 90% for less frequent optimization
-	threshold := al.contextWindow * 90 / 100
+	model := al.modelFor(sessionKey)
+	tokenEstimate := al.countTokens(model, newHistory, nil)
+	// Summarize at 75% of the input budget, leaving room for the system
+	// prompt, tool schemas and the next turn
+	threshold := al.inputBudget(model) * 75 / 100
 	// Increased message threshold to 100 messages (was 40)
 	// This prevents frequent optimizations during normal conversation
 	needsSummarization := len(newHistory) > 100 || tokenEstimate > threshold
-	
+
 	if !needsSummarization {
 		return
 	}
@@ -798,6 +1048,10 @@ func (al *AgentLoop) forceCompression(sessionKey string) {
 	// Simplified approach for emergency: Drop first half of conversation
 	// and rely on existing summary if present, or create a placeholder.
 
+	// Tool results stay with the call that produced them
+	for mid < len(conversation) && conversation[mid].Role == "tool" {
+		mid++
+	}
 	droppedCount := mid
 	keptConversation := conversation[mid:]
 
@@ -898,193 +1152,7 @@ func formatToolsForLog(tools []providers.ToolDefinition) string {
 	return result
 }
 
-// summarizeSession summarizes the conversation history for a session.
-func (al *AgentLoop) summarizeSession(sessionKey string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
-	defer cancel()
-
-	history := al.sessions.GetHistory(sessionKey)
-	summary := al.sessions.GetSummary(sessionKey)
-
-	// Keep last 4 messages for continuity
-	if len(history) <= 4 {
-		return
-	}
-
-	toSummarize := history[:len(history)-4]
-
-	// Oversized Message Guard
-	// Skip messages larger than 50% of context window to prevent summarizer overflow
-	maxMessageTokens := al.contextWindow / 2
-	validMessages := make([]providers.Message, 0)
-	omitted := false
-
-	for _, m := range toSummarize {
-		if m.Role != "user" && m.Role != "assistant" {
-			continue
-		}
-		// Estimate tokens for this message
-		msgTokens := len(m.Content) / 2 // Use safer estimate here too (2.5 -> 2 for integer division safety)
-		if msgTokens > maxMessageTokens {
-			omitted = true
-			continue
-		}
-		validMessages = append(validMessages, m)
-	}
-
-	if len(validMessages) == 0 {
-		return
-	}
-
-	// Multi-Part Summarization
-	// Split into two parts if history is significant
-	var finalSummary string
-	if len(validMessages) > 10 {
-		mid := len(validMessages) / 2
-		part1 := validMessages[:mid]
-		part2 := validMessages[mid:]
-
-		s1, _ := al.summarizeBatch(ctx, part1, "")
-		s2, _ := al.summarizeBatch(ctx, part2, "")
-
-		// Merge them
-		mergePrompt := fmt.Sprintf("Merge these two conversation summaries into one cohesive summary:\n\n1: %s\n\n2: %s", s1, s2)
-		resp, err := al.provider.Chat(ctx, []providers.Message{{Role: "user", Content: mergePrompt}}, nil, al.model, map[string]interface{}{
-			"max_tokens":  1024,
-			"temperature": 0.3,
-		})
-		if err == nil {
-			finalSummary = resp.Content
-		} else {
-			finalSummary = s1 + " " + s2
-		}
-	} else {
-		finalSummary, _ = al.summarizeBatch(ctx, validMessages, summary)
-	}
-
-	if omitted && finalSummary != "" {
-		finalSummary += "\n[Note: Some oversized messages were omitted from this summary for efficiency.]"
-	}
-
-	if finalSummary != "" {
-		al.sessions.SetSummary(sessionKey, finalSummary)
-		al.sessions.TruncateHistory(sessionKey, 4)
-		al.sessions.Save(sessionKey)
-	}
-}
-
-// summarizeBatch summarizes a batch of messages.
-func (al *AgentLoop) summarizeBatch(ctx context.Context, batch []providers.Message, existingSummary string) (string, error) {
-	prompt := "Provide a concise summary of this conversation segment, preserving core context and key points.\n"
-	if existingSummary != "" {
-		prompt += "Existing context: " + existingSummary + "\n"
-	}
-	prompt += "\nCONVERSATION:\n"
-	for _, m := range batch {
-		prompt += fmt.Sprintf("%s: %s\n", m.Role, m.Content)
-	}
-
-	response, err := al.provider.Chat(ctx, []providers.Message{{Role: "user", Content: prompt}}, nil, al.model, map[string]interface{}{
-		"max_tokens":  1024,
-		"temperature": 0.3,
-	})
-	if err != nil {
-		return "", err
-	}
-	return response.Content, nil
-}
-
-// estimateTokens estimates the number of tokens in a message list.
-// Uses a safe heuristic of 2.5 characters per token to account for CJK and other
-// overheads better than the previous 3 chars/token.
-func (al *AgentLoop) estimateTokens(messages []providers.Message) int {
-	totalChars := 0
-	for _, m := range messages {
-		totalChars += utf8.RuneCountInString(m.Content)
-	}
-	// 2.5 chars per token = totalChars * 2 / 5
-	return totalChars * 2 / 5
-}
-
-func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage) (string, bool) {
-	content := strings.TrimSpace(msg.Content)
-	if !strings.HasPrefix(content, "/") {
-		return "", false
-	}
-
-	parts := strings.Fields(content)
-	if len(parts) == 0 {
-		return "", false
-	}
-
-	cmd := parts[0]
-	args := parts[1:]
-
-	switch cmd {
-	case "/show":
-		if len(args) < 1 {
-			return "Usage: /show [model|channel]", true
-		}
-		switch args[0] {
-		case "model":
-			return fmt.Sprintf("Current model: %s", al.model), true
-		case "channel":
-			return fmt.Sprintf("Current channel: %s", msg.Channel), true
-		default:
-			return fmt.Sprintf("Unknown show target: %s", args[0]), true
-		}
-
-	case "/list":
-		if len(args) < 1 {
-			return "Usage: /list [models|channels]", true
-		}
-		switch args[0] {
-		case "models":
-			// TODO: Fetch available models dynamically if possible
-			return "Available models: glm-4.7, claude-3-5-sonnet, gpt-4o (configured in config.json/env)", true
-		case "channels":
-			if al.channelManager == nil {
-				return "Channel manager not initialized", true
-			}
-			channels := al.channelManager.GetEnabledChannels()
-			if len(channels) == 0 {
-				return "No channels enabled", true
-			}
-			return fmt.Sprintf("Enabled channels: %s", strings.Join(channels, ", ")), true
-		default:
-			return fmt.Sprintf("Unknown list target: %s", args[0]), true
-		}
-
-	case "/switch":
-		if len(args) < 3 || args[1] != "to" {
-			return "Usage: /switch [model|channel] to <name>", true
-		}
-		target := args[0]
-		value := args[2]
-
-		switch target {
-		case "model":
-			oldModel := al.model
-			al.model = value
-			return fmt.Sprintf("Switched model from %s to %s", oldModel, value), true
-		case "channel":
-			// This changes the 'default' channel for some operations, or effectively redirects output?
-			// For now, let's just validate if the channel exists
-			if al.channelManager == nil {
-				return "Channel manager not initialized", true
-			}
-			if _, exists := al.channelManager.GetChannel(value); !exists && value != "cli" {
-				return fmt.Sprintf("Channel '%s' not found or not enabled", value), true
-			}
-
-			// If message came from CLI, maybe we want to redirect CLI output to this channel?
-			// That would require state persistence about "redirected channel"
-			// For now, just acknowledged.
-			return fmt.Sprintf("Switched target channel to %s (Note: this currently only validates existence)", value), true
-		default:
-			return fmt.Sprintf("Unknown switch target: %s", target), true
-		}
-	}
-
-	return "", false
+// currentModel returns the agent's default model.
+func (al *AgentLoop) currentModel() string {
+	return al.model
 }
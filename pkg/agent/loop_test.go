@@ -624,3 +624,166 @@ func TestAgentLoop_ContextExhaustionRetry(t *testing.T) {
 		t.Errorf("Expected history to be compressed (len < 8), got %d", len(finalHistory))
 	}
 }
+
+// streamingMockProvider streams its response in fixed chunks
+type streamingMockProvider struct {
+	chunks []string
+}
+
+func (m *streamingMockProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	return m.ChatStream(ctx, messages, tools, model, opts, nil)
+}
+
+func (m *streamingMockProvider) ChatStream(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}, onChunk providers.StreamCallback) (*providers.LLMResponse, error) {
+	content := ""
+	for _, c := range m.chunks {
+		content += c
+		if onChunk != nil {
+			onChunk(providers.StreamChunk{Content: c})
+		}
+	}
+	return &providers.LLMResponse{Content: content}, nil
+}
+
+func (m *streamingMockProvider) GetDefaultModel() string {
+	return "mock-stream-model"
+}
+
+// TestAgentLoop_StreamsPartialOutput verifies partial output is published before the final reply
+func TestAgentLoop_StreamsPartialOutput(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "agent-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         tmpDir,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+				Streaming:         true,
+			},
+		},
+	}
+
+	msgBus := bus.NewMessageBus()
+	provider := &streamingMockProvider{chunks: []string{"Hello", ", world"}}
+	al := NewAgentLoop(cfg, msgBus, provider)
+
+	al.handleInbound(context.Background(), bus.InboundMessage{
+		Channel:    "telegram",
+		SenderID:   "user1",
+		ChatID:     "chat1",
+		Content:    "hi",
+		SessionKey: "telegram:chat1",
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), responseTimeout)
+	defer cancel()
+
+	partial, ok := msgBus.SubscribeOutbound(ctx)
+	if !ok {
+		t.Fatal("Expected a partial outbound message")
+	}
+	if !partial.Partial || partial.Content != "Hello" {
+		t.Errorf("Expected partial 'Hello', got %+v", partial)
+	}
+
+	final, ok := msgBus.SubscribeOutbound(ctx)
+	if !ok {
+		t.Fatal("Expected a final outbound message")
+	}
+	if final.Partial || final.Content != "Hello, world" {
+		t.Errorf("Expected final 'Hello, world', got %+v", final)
+	}
+}
+
+// messageThenStreamProvider answers through the message tool first, then
+// streams its final reply in chunks
+type messageThenStreamProvider struct {
+	calls  int
+	chunks []string
+}
+
+func (m *messageThenStreamProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	return m.ChatStream(ctx, messages, tools, model, opts, nil)
+}
+
+func (m *messageThenStreamProvider) ChatStream(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}, onChunk providers.StreamCallback) (*providers.LLMResponse, error) {
+	m.calls++
+	if m.calls == 1 {
+		return &providers.LLMResponse{ToolCalls: []providers.ToolCall{{
+			ID:        "call_1",
+			Type:      "function",
+			Name:      "message",
+			Arguments: map[string]interface{}{"content": "Report ready"},
+		}}}, nil
+	}
+	content := ""
+	for _, c := range m.chunks {
+		content += c
+		if onChunk != nil {
+			onChunk(providers.StreamChunk{Content: c})
+		}
+	}
+	return &providers.LLMResponse{Content: content}, nil
+}
+
+func (m *messageThenStreamProvider) GetDefaultModel() string {
+	return "mock-stream-model"
+}
+
+// TestAgentLoop_StreamedReplyAfterMessageTool verifies the preview of a reply
+// streamed after the message tool answered is completed, not left cut off
+func TestAgentLoop_StreamedReplyAfterMessageTool(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+				Streaming:         true,
+			},
+		},
+	}
+
+	msgBus := bus.NewMessageBus()
+	provider := &messageThenStreamProvider{chunks: []string{"Sent", " you the", " report."}}
+	al := NewAgentLoop(cfg, msgBus, provider)
+
+	al.handleInbound(context.Background(), bus.InboundMessage{
+		Channel:    "telegram",
+		SenderID:   "user1",
+		ChatID:     "chat1",
+		Content:    "send me the report",
+		SessionKey: "telegram:chat1",
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var outbound []bus.OutboundMessage
+	for {
+		msg, ok := msgBus.SubscribeOutbound(ctx)
+		if !ok {
+			break
+		}
+		outbound = append(outbound, msg)
+	}
+
+	if len(outbound) != 3 {
+		t.Fatalf("Expected the message, a partial and the final reply, got %+v", outbound)
+	}
+	if outbound[0].Partial || outbound[0].Content != "Report ready" {
+		t.Errorf("Expected the message tool's message first, got %+v", outbound[0])
+	}
+	if !outbound[1].Partial || outbound[1].Content != "Sent" {
+		t.Errorf("Expected the throttled partial 'Sent', got %+v", outbound[1])
+	}
+	if last := outbound[2]; last.Partial || last.Content != "Sent you the report." {
+		t.Errorf("Expected the final reply to replace the preview, got %+v", last)
+	}
+}
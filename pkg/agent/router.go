@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// AddProfile registers a named agent that inbound messages can be routed to.
+// The profile shares this loop's bus and usage ledger; Run consumes messages
+// for all of them.
+func (al *AgentLoop) AddProfile(name string, profile *AgentLoop) {
+	if al.profiles == nil {
+		al.profiles = make(map[string]*AgentLoop)
+	}
+	profile.channelManager = al.channelManager
+	if al.usage != nil {
+		profile.SetUsageLedger(al.usage)
+	}
+	al.profiles[name] = profile
+}
+
+// Profiles returns the names of the registered agent profiles.
+func (al *AgentLoop) Profiles() []string {
+	names := make([]string, 0, len(al.profiles))
+	for name := range al.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// handleRouted hands an inbound message to the agent its route selects.
+func (al *AgentLoop) handleRouted(ctx context.Context, msg bus.InboundMessage) {
+	al.route(msg).handleInbound(ctx, msg)
+}
+
+// route returns the agent for msg: the profile of the first matching route,
+// or this loop when no route matches.
+func (al *AgentLoop) route(msg bus.InboundMessage) *AgentLoop {
+	for _, r := range al.routes {
+		if !routeMatches(r, msg) {
+			continue
+		}
+		if r.Profile == config.DefaultProfile {
+			return al
+		}
+		if profile, ok := al.profiles[r.Profile]; ok {
+			logger.DebugCF("agent", "Routed message to profile",
+				map[string]interface{}{
+					"profile": r.Profile,
+					"channel": msg.Channel,
+					"chat_id": msg.ChatID,
+				})
+			return profile
+		}
+		logger.WarnCF("agent", "Route names an unknown profile, using default agent",
+			map[string]interface{}{
+				"profile": r.Profile,
+			})
+		return al
+	}
+	return al
+}
+
+func routeMatches(r config.AgentRoute, msg bus.InboundMessage) bool {
+	if r.Channel != "" && r.Channel != msg.Channel {
+		return false
+	}
+	if r.ChatID != "" && r.ChatID != msg.ChatID {
+		return false
+	}
+	if r.SenderID != "" && !senderMatches(r.SenderID, msg.SenderID) {
+		return false
+	}
+	return true
+}
+
+// senderMatches compares a configured sender with a sender ID, which some
+// channels send as "id|username". Either part may be configured, and a
+// username may carry a leading "@", as in allow_from.
+func senderMatches(configured, senderID string) bool {
+	configured = strings.TrimPrefix(configured, "@")
+	if configured == senderID {
+		return true
+	}
+	id, username, ok := strings.Cut(senderID, "|")
+	if !ok {
+		return false
+	}
+	return configured == id || configured == username
+}
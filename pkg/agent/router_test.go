@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newRoutedLoop(t *testing.T) *AgentLoop {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+			Profiles: map[string]config.AgentProfile{
+				"family": {Model: "family-model"},
+				"work":   {Model: "work-model", Tools: []string{"read_file", "web_*"}},
+			},
+			Routes: []config.AgentRoute{
+				{Channel: "telegram", ChatID: "-100", SenderID: "@grandpa", Profile: config.DefaultProfile},
+				{Channel: "telegram", ChatID: "-100", Profile: "family"},
+				{Channel: "slack", Profile: "work"},
+			},
+		},
+	}
+
+	msgBus := bus.NewMessageBus()
+	al := NewAgentLoop(cfg, msgBus, &mockProvider{})
+	for _, name := range []string{"family", "work"} {
+		profileCfg, err := cfg.ForProfile(name)
+		if err != nil {
+			t.Fatalf("ForProfile(%s) failed: %v", name, err)
+		}
+		profileCfg.Agents.Defaults.Workspace = t.TempDir()
+		al.AddProfile(name, NewAgentLoop(profileCfg, msgBus, &mockProvider{}))
+	}
+	return al
+}
+
+func TestAgentLoop_RouteSelectsProfile(t *testing.T) {
+	al := newRoutedLoop(t)
+
+	tests := []struct {
+		msg   bus.InboundMessage
+		model string
+	}{
+		{bus.InboundMessage{Channel: "telegram", ChatID: "-100", SenderID: "7|alice"}, "family-model"},
+		{bus.InboundMessage{Channel: "telegram", ChatID: "-100", SenderID: "8|grandpa"}, "test-model"},
+		{bus.InboundMessage{Channel: "telegram", ChatID: "42", SenderID: "7|alice"}, "test-model"},
+		{bus.InboundMessage{Channel: "slack", ChatID: "C1", SenderID: "U1"}, "work-model"},
+		{bus.InboundMessage{Channel: "maixcam", ChatID: "default", SenderID: "cam"}, "test-model"},
+	}
+	for _, tt := range tests {
+		if got := al.route(tt.msg).currentModel(); got != tt.model {
+			t.Errorf("route(%s:%s from %s) = %s, want %s", tt.msg.Channel, tt.msg.ChatID, tt.msg.SenderID, got, tt.model)
+		}
+	}
+}
+
+func TestAgentLoop_ProfileToolAllowlist(t *testing.T) {
+	al := newRoutedLoop(t)
+	work := al.profiles["work"]
+
+	if _, ok := work.tools.Get("read_file"); !ok {
+		t.Error("Expected allowlisted read_file tool")
+	}
+	if _, ok := work.tools.Get("web_fetch"); !ok {
+		t.Error("Expected web_fetch to match the web_* pattern")
+	}
+	if _, ok := work.tools.Get("exec"); ok {
+		t.Error("Expected exec to be excluded by the allowlist")
+	}
+
+	al.RegisterTool(&mockCustomTool{})
+	if _, ok := al.profiles["family"].tools.Get("mock_custom"); !ok {
+		t.Error("Expected tools registered later to reach profiles without an allowlist")
+	}
+	if _, ok := work.tools.Get("mock_custom"); ok {
+		t.Error("Expected tools registered later to respect the allowlist")
+	}
+
+	al.UnregisterTool("mock_custom")
+	if _, ok := al.profiles["family"].tools.Get("mock_custom"); ok {
+		t.Error("Expected unregistered tools to leave the profiles")
+	}
+}
@@ -0,0 +1,432 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/session"
+)
+
+// A chat can hold several sessions. The channel gives each chat a session
+// key, such as "telegram:123" or, for a thread, "slack:C123:thread:1700.1";
+// that session is the chat's "main" session. Sessions started with
+// /session new or fork get keys "<chat key>#n". The session a chat has
+// switched to is kept in the state file, so it survives restarts.
+
+const maxSessionName = 64
+
+const sessionUsage = "Usage: /session [list [all]|new [name]|switch <n>|rename <name>|archive [n]|delete <n>|fork|export [markdown|jsonl|html]]"
+
+func (al *AgentLoop) cmdSession(ctx context.Context, req CommandRequest) string {
+	if len(req.Args) == 0 {
+		return al.sessionInfo(req)
+	}
+	arg := strings.Join(req.Args[1:], " ")
+	switch strings.ToLower(req.Args[0]) {
+	case "info":
+		return al.sessionInfo(req)
+	case "list":
+		return al.sessionList(req, strings.EqualFold(arg, "all"))
+	case "new":
+		return al.sessionNew(req, arg)
+	case "switch":
+		if arg == "" {
+			return "Usage: /session switch <n>, with n from /session list"
+		}
+		return al.sessionSwitch(req, arg)
+	case "rename":
+		if arg == "" {
+			return "Usage: /session rename <name>"
+		}
+		return al.sessionRename(req, arg)
+	case "archive":
+		return al.sessionArchive(req, arg)
+	case "delete":
+		if arg == "" {
+			return "Usage: /session delete <n>, with n from /session list"
+		}
+		return al.sessionDelete(req, arg)
+	case "fork":
+		return al.sessionFork(req)
+	case "export":
+		return al.sessionExport(req, strings.ToLower(arg))
+	default:
+		return sessionUsage
+	}
+}
+
+// activeSession returns the session a chat's messages go to.
+func (al *AgentLoop) activeSession(chatKey string) string {
+	return al.state.GetActiveSession(chatKey)
+}
+
+func (al *AgentLoop) setActiveSession(chatKey, key string) {
+	if err := al.state.SetActiveSession(chatKey, key); err != nil {
+		logger.WarnCF("agent", "Failed to record active session",
+			map[string]interface{}{
+				"chat":    chatKey,
+				"session": key,
+				"error":   err.Error(),
+			})
+	}
+}
+
+// chatSessions returns the sessions of a chat, archived ones included: its
+// main session, listed even before it has messages, then the others in the
+// order they were started. Numbers in /session list index this slice.
+func (al *AgentLoop) chatSessions(chatKey string) []session.Info {
+	infos := []session.Info{{Key: chatKey}}
+	for _, info := range al.sessions.List(chatKey) {
+		if info.Key == chatKey {
+			infos[0] = info
+		} else if strings.HasPrefix(info.Key, chatKey+"#") {
+			infos = append(infos, info)
+		}
+	}
+	others := infos[1:]
+	sort.Slice(others, func(i, j int) bool { return others[i].Created.Before(others[j].Created) })
+	return infos
+}
+
+// sessionLabel names a session in replies: its name, or "main" for the
+// chat's own session and "#n" for the others.
+func sessionLabel(chatKey string, info session.Info) string {
+	switch {
+	case info.Name != "":
+		return info.Name
+	case info.Key == chatKey:
+		return "main"
+	default:
+		return strings.TrimPrefix(info.Key, chatKey)
+	}
+}
+
+func (al *AgentLoop) sessionLabel(chatKey, key string) string {
+	for _, info := range al.chatSessions(chatKey) {
+		if info.Key == key {
+			return sessionLabel(chatKey, info)
+		}
+	}
+	return sessionLabel(chatKey, session.Info{Key: key})
+}
+
+// findSession returns the session of the chat that target names: a number
+// from /session list, a name, "main", "#n" or a session key.
+func (al *AgentLoop) findSession(chatKey, target string) (session.Info, bool) {
+	infos := al.chatSessions(chatKey)
+	if n, err := strconv.Atoi(target); err == nil {
+		if n >= 1 && n <= len(infos) {
+			return infos[n-1], true
+		}
+		return session.Info{}, false
+	}
+	for _, info := range infos {
+		if strings.EqualFold(target, sessionLabel(chatKey, info)) || target == info.Key ||
+			(target == "main" && info.Key == chatKey) || target == strings.TrimPrefix(info.Key, chatKey) {
+			return info, true
+		}
+	}
+	return session.Info{}, false
+}
+
+// checkSessionName returns why name cannot name a session of the chat, or
+// "" if it can.
+func (al *AgentLoop) checkSessionName(chatKey, name string) string {
+	if utf8.RuneCountInString(name) > maxSessionName {
+		return fmt.Sprintf("Session names can have up to %d characters.", maxSessionName)
+	}
+	if _, err := strconv.Atoi(name); err == nil || strings.HasPrefix(name, "#") || strings.EqualFold(name, "main") {
+		return fmt.Sprintf("%q is reserved; choose another name.", name)
+	}
+	if _, exists := al.findSession(chatKey, name); exists {
+		return fmt.Sprintf("A session named %q already exists in this chat.", name)
+	}
+	return ""
+}
+
+// nextSessionKey returns the first free "<chat key>#n" key.
+func (al *AgentLoop) nextSessionKey(chatKey string) string {
+	taken := make(map[string]bool)
+	for _, info := range al.chatSessions(chatKey) {
+		taken[info.Key] = true
+	}
+	for n := 2; ; n++ {
+		key := fmt.Sprintf("%s#%d", chatKey, n)
+		if !taken[key] {
+			return key
+		}
+	}
+}
+
+func (al *AgentLoop) sessionInfo(req CommandRequest) string {
+	history := al.sessions.GetHistory(req.SessionKey)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Session: %s (%s)\n", al.sessionLabel(req.ChatKey, req.SessionKey), req.SessionKey)
+	fmt.Fprintf(&sb, "Messages: %d\n", len(history))
+	if al.sessions.GetSummary(req.SessionKey) != "" {
+		sb.WriteString("Older messages are summarized\n")
+	}
+	fmt.Fprintf(&sb, "Model: %s", al.modelFor(req.SessionKey))
+	return sb.String()
+}
+
+func (al *AgentLoop) sessionList(req CommandRequest, all bool) string {
+	var sb strings.Builder
+	sb.WriteString("Sessions in this chat:\n")
+	archived := 0
+	for i, info := range al.chatSessions(req.ChatKey) {
+		if info.Archived && !all {
+			archived++
+			continue
+		}
+		marker := "  "
+		if info.Key == req.SessionKey {
+			marker = "* "
+		}
+		fmt.Fprintf(&sb, "%s%d. %s - %d messages", marker, i+1, sessionLabel(req.ChatKey, info), info.Messages)
+		if info.Model != "" {
+			fmt.Fprintf(&sb, ", model %s", info.Model)
+		}
+		if !info.Updated.IsZero() {
+			fmt.Fprintf(&sb, ", updated %s", info.Updated.Format("2006-01-02 15:04"))
+		}
+		if info.Archived {
+			sb.WriteString(" (archived)")
+		}
+		sb.WriteString("\n")
+	}
+	if archived > 0 {
+		fmt.Fprintf(&sb, "%d archived; /session list all shows them.\n", archived)
+	}
+	sb.WriteString("Switch with /session switch <n>, start one with /session new <name>.")
+	return sb.String()
+}
+
+// sessionNew starts an empty session, optionally named, and switches to it.
+func (al *AgentLoop) sessionNew(req CommandRequest, name string) string {
+	if name != "" {
+		if problem := al.checkSessionName(req.ChatKey, name); problem != "" {
+			return problem
+		}
+	}
+	key := al.nextSessionKey(req.ChatKey)
+	al.sessions.GetOrCreate(key)
+	if name != "" {
+		al.sessions.SetName(key, name)
+	}
+	if err := al.sessions.Save(key); err != nil {
+		return fmt.Sprintf("Failed to save the new session: %v", err)
+	}
+	previous := al.sessionLabel(req.ChatKey, req.SessionKey)
+	al.setActiveSession(req.ChatKey, key)
+	return fmt.Sprintf("Started session %s. Switch back with /session switch %s.", al.sessionLabel(req.ChatKey, key), previous)
+}
+
+// sessionSwitch makes the session target names the chat's active session.
+// Switching to an archived session restores it.
+func (al *AgentLoop) sessionSwitch(req CommandRequest, target string) string {
+	info, ok := al.findSession(req.ChatKey, target)
+	if !ok {
+		return fmt.Sprintf("No session %q in this chat. See /session list.", target)
+	}
+	reply := fmt.Sprintf("Switched to session %s (%d messages).", sessionLabel(req.ChatKey, info), info.Messages)
+	if info.Archived {
+		al.sessions.SetArchived(info.Key, false)
+		if err := al.sessions.Save(info.Key); err != nil {
+			return fmt.Sprintf("Failed to restore the session: %v", err)
+		}
+		reply += " It is no longer archived."
+	}
+	al.setActiveSession(req.ChatKey, info.Key)
+	return reply
+}
+
+func (al *AgentLoop) sessionRename(req CommandRequest, name string) string {
+	if problem := al.checkSessionName(req.ChatKey, name); problem != "" {
+		return problem
+	}
+	old := al.sessionLabel(req.ChatKey, req.SessionKey)
+	al.sessions.SetName(req.SessionKey, name)
+	if err := al.sessions.Save(req.SessionKey); err != nil {
+		return fmt.Sprintf("Failed to rename the session: %v", err)
+	}
+	return fmt.Sprintf("Renamed session %s to %s.", old, name)
+}
+
+// sessionArchive hides a session, the active one by default, from
+// /session list. Archiving the active session switches to main.
+func (al *AgentLoop) sessionArchive(req CommandRequest, target string) string {
+	info, ok := al.findSession(req.ChatKey, req.SessionKey)
+	if target != "" {
+		info, ok = al.findSession(req.ChatKey, target)
+	}
+	if !ok {
+		return fmt.Sprintf("No session %q in this chat. See /session list.", target)
+	}
+	if info.Key == req.ChatKey {
+		return "The main session cannot be archived; /reset clears it."
+	}
+	al.sessions.SetArchived(info.Key, true)
+	if err := al.sessions.Save(info.Key); err != nil {
+		return fmt.Sprintf("Failed to archive the session: %v", err)
+	}
+	al.EndSession(info.Key)
+
+	reply := fmt.Sprintf("Archived session %s. /session switch %s restores it.", sessionLabel(req.ChatKey, info), sessionLabel(req.ChatKey, info))
+	if info.Key == req.SessionKey {
+		al.setActiveSession(req.ChatKey, req.ChatKey)
+		reply += " Now using main."
+	}
+	return reply
+}
+
+// sessionDelete removes a session and its history. Deleting the active
+// session switches to main.
+func (al *AgentLoop) sessionDelete(req CommandRequest, target string) string {
+	info, ok := al.findSession(req.ChatKey, target)
+	if !ok {
+		return fmt.Sprintf("No session %q in this chat. See /session list.", target)
+	}
+	if info.Key == req.ChatKey {
+		return "The main session cannot be deleted; /reset clears it."
+	}
+	if err := al.sessions.Delete(info.Key); err != nil {
+		return fmt.Sprintf("Failed to delete the session: %v", err)
+	}
+	al.EndSession(info.Key)
+
+	reply := fmt.Sprintf("Deleted session %s with %d messages.", sessionLabel(req.ChatKey, info), info.Messages)
+	if info.Key == req.SessionKey {
+		al.setActiveSession(req.ChatKey, req.ChatKey)
+		reply += " Now using main."
+	}
+	return reply
+}
+
+// sessionFork copies the active session into a new one and switches to it,
+// so the conversation can go two ways.
+func (al *AgentLoop) sessionFork(req CommandRequest) string {
+	key := al.nextSessionKey(req.ChatKey)
+	if err := al.sessions.Fork(req.SessionKey, key); err != nil {
+		return fmt.Sprintf("Failed to fork the session: %v", err)
+	}
+	if err := al.sessions.Save(key); err != nil {
+		return fmt.Sprintf("Failed to save the forked session: %v", err)
+	}
+	from, to := al.sessionLabel(req.ChatKey, req.SessionKey), al.sessionLabel(req.ChatKey, key)
+	al.setActiveSession(req.ChatKey, key)
+	return fmt.Sprintf("Forked session %s into %s; now using %s. Switch back with /session switch %s.", from, to, to, from)
+}
+
+// sessionExport writes the active session to workspace/exports, as
+// Markdown unless another format is given, and sends the file to the chat.
+func (al *AgentLoop) sessionExport(req CommandRequest, format string) string {
+	history := al.sessions.GetHistory(req.SessionKey)
+	summary := al.sessions.GetSummary(req.SessionKey)
+	if len(history) == 0 && summary == "" {
+		return "The session has no messages to export."
+	}
+
+	content, err := session.Export(format, al.sessionLabel(req.ChatKey, req.SessionKey), summary, history)
+	if err != nil {
+		return err.Error()
+	}
+	dir := filepath.Join(al.workspace, "exports")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Sprintf("Failed to export the session: %v", err)
+	}
+	name := strings.NewReplacer(":", "_", "#", "_", "/", "_", `\`, "_").Replace(req.SessionKey)
+	ext, mimeType := session.FormatExtension(format)
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s%s", name, time.Now().Format("20060102-150405"), ext))
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Sprintf("Failed to export the session: %v", err)
+	}
+
+	if !constants.IsInternalChannel(req.Channel) {
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel:     req.Channel,
+			ChatID:      req.ChatID,
+			Attachments: []bus.Attachment{{Path: path, MimeType: mimeType}},
+		})
+	}
+	return fmt.Sprintf("Exported %d messages to %s.", len(history), path)
+}
+
+// OpenSessions opens the sessions of a workspace with the configured
+// backend.
+func OpenSessions(cfg *config.Config, workspace string) (*session.SessionManager, error) {
+	store, err := session.OpenStore(cfg.Sessions.Backend, filepath.Join(workspace, "sessions"))
+	if err != nil {
+		return nil, err
+	}
+	return session.NewSessionManagerWithStore(store), nil
+}
+
+// SessionRetention converts the retention settings of cfg, or returns nil
+// if they keep every session.
+func SessionRetention(cfg config.SessionsConfig) func(key string) session.Retention {
+	if cfg.Retention == (config.SessionRetention{}) && len(cfg.Overrides) == 0 {
+		return nil
+	}
+	return func(key string) session.Retention {
+		r := cfg.RetentionFor(key)
+		return session.Retention{
+			MaxAge:      time.Duration(r.MaxAgeDays) * 24 * time.Hour,
+			MaxMessages: r.MaxMessages,
+		}
+	}
+}
+
+// pruneInterval is how often the gateway applies session retention.
+const pruneInterval = 24 * time.Hour
+
+// pruneSessions applies session retention to this agent and its profiles
+// now and then every pruneInterval, until ctx is done.
+func (al *AgentLoop) pruneSessions(ctx context.Context) {
+	if al.retention == nil {
+		return
+	}
+	agents := []*AgentLoop{al}
+	for _, profile := range al.profiles {
+		agents = append(agents, profile)
+	}
+
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		for _, agent := range agents {
+			deleted, trimmed, err := agent.sessions.Prune(al.retention, time.Now())
+			if err != nil {
+				logger.WarnCF("agent", "Failed to prune sessions",
+					map[string]interface{}{
+						"workspace": agent.workspace,
+						"error":     err.Error(),
+					})
+			} else if deleted > 0 || trimmed > 0 {
+				logger.InfoCF("agent", "Pruned sessions",
+					map[string]interface{}{
+						"workspace": agent.workspace,
+						"deleted":   deleted,
+						"trimmed":   trimmed,
+					})
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
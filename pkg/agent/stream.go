@@ -0,0 +1,91 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// streamUpdateInterval throttles partial updates so channels that edit a
+// message in place stay well under platform rate limits.
+const streamUpdateInterval = 800 * time.Millisecond
+
+// streamForwarder publishes partial LLM output to the bus while a response
+// is being streamed. Each update carries the full text generated so far.
+type streamForwarder struct {
+	bus       *bus.MessageBus
+	channel   string
+	chatID    string
+	interval  time.Duration
+	mu        sync.Mutex
+	text      strings.Builder
+	published int // length of text at the last publish
+	lastSent  time.Time
+}
+
+func newStreamForwarder(msgBus *bus.MessageBus, channel, chatID string, interval time.Duration) *streamForwarder {
+	return &streamForwarder{
+		bus:      msgBus,
+		channel:  channel,
+		chatID:   chatID,
+		interval: interval,
+	}
+}
+
+// OnChunk is the providers.StreamCallback for a single LLM call.
+func (f *streamForwarder) OnChunk(chunk providers.StreamChunk) {
+	if chunk.Content == "" {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.text.WriteString(chunk.Content)
+	if time.Since(f.lastSent) >= f.interval {
+		f.publishLocked()
+	}
+}
+
+// Flush publishes any text not yet sent. It is used when the response ends
+// in tool calls, so the user sees what the model said before acting.
+func (f *streamForwarder) Flush() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.publishLocked()
+}
+
+// Published reports whether any partial update was published.
+func (f *streamForwarder) Published() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.published > 0
+}
+
+func (f *streamForwarder) publishLocked() {
+	if f.text.Len() == f.published {
+		return
+	}
+	content := strings.TrimSpace(f.text.String())
+	if content == "" {
+		return
+	}
+
+	f.published = f.text.Len()
+	f.lastSent = time.Now()
+	f.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: f.channel,
+		ChatID:  f.chatID,
+		Content: content,
+		Partial: true,
+	})
+}
@@ -0,0 +1,119 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/usage"
+)
+
+// SetUsageLedger makes this agent and its profiles record usage in ledger,
+// so budgets apply to all of them together.
+func (al *AgentLoop) SetUsageLedger(ledger *usage.Ledger) {
+	al.usage = ledger
+	for _, profile := range al.profiles {
+		profile.SetUsageLedger(ledger)
+	}
+}
+
+// budgetModel returns the model to call given the usage budget: model
+// itself while within budget, the downgrade model once a budget is used up
+// and the action is "downgrade", or a *usage.BudgetError when it is "block".
+func (al *AgentLoop) budgetModel(model string) (string, error) {
+	if al.usage == nil {
+		return model, nil
+	}
+	err := al.usage.CheckBudget(al.budget)
+	if err == nil {
+		return model, nil
+	}
+
+	if al.budget.Action == "downgrade" && al.budget.DowngradeModel != "" {
+		if model != al.budget.DowngradeModel {
+			logger.WarnCF("agent", "Usage budget exceeded, downgrading model",
+				map[string]interface{}{
+					"model":     model,
+					"downgrade": al.budget.DowngradeModel,
+					"budget":    err.Error(),
+				})
+		}
+		return al.budget.DowngradeModel, nil
+	}
+	logger.WarnCF("agent", "Usage budget exceeded, blocking request",
+		map[string]interface{}{
+			"budget": err.Error(),
+		})
+	return "", err
+}
+
+// recordUsage adds the tokens of one LLM response to the ledger.
+func (al *AgentLoop) recordUsage(record usage.Record, model string, response *providers.LLMResponse) {
+	if al.usage == nil || response == nil || response.Usage == nil {
+		return
+	}
+	record.Model = model
+	if response.Model != "" {
+		record.Model = response.Model
+	}
+	record.PromptTokens = response.Usage.PromptTokens
+	record.CompletionTokens = response.Usage.CompletionTokens
+	if err := al.usage.Record(record); err != nil {
+		logger.WarnCF("agent", "Failed to record usage",
+			map[string]interface{}{
+				"error": err.Error(),
+			})
+	}
+}
+
+// usageReport answers the /usage command.
+func (al *AgentLoop) usageReport() string {
+	if al.usage == nil {
+		return "Usage tracking is not available"
+	}
+	day, month := al.usage.Current()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Today: %s\n", formatTotals(day))
+	fmt.Fprintf(&sb, "This month: %s", formatTotals(month))
+	if limits := formatBudget(al.budget); limits != "" {
+		fmt.Fprintf(&sb, "\nBudget: %s (%s when exceeded)", limits, budgetAction(al.budget))
+		var budgetErr *usage.BudgetError
+		if err := al.usage.CheckBudget(al.budget); errors.As(err, &budgetErr) {
+			fmt.Fprintf(&sb, "\n⚠️ %s", budgetErr.Error())
+		}
+	}
+	return sb.String()
+}
+
+func formatTotals(t usage.Totals) string {
+	return fmt.Sprintf("%d requests, %d tokens (%d in, %d out), %s",
+		t.Requests, t.Tokens(), t.PromptTokens, t.CompletionTokens, usage.FormatCost(t.Cost))
+}
+
+func formatBudget(b config.BudgetConfig) string {
+	var limits []string
+	if b.DailyTokens > 0 {
+		limits = append(limits, fmt.Sprintf("%d tokens/day", b.DailyTokens))
+	}
+	if b.DailyCost > 0 {
+		limits = append(limits, usage.FormatCost(b.DailyCost)+"/day")
+	}
+	if b.MonthlyTokens > 0 {
+		limits = append(limits, fmt.Sprintf("%d tokens/month", b.MonthlyTokens))
+	}
+	if b.MonthlyCost > 0 {
+		limits = append(limits, usage.FormatCost(b.MonthlyCost)+"/month")
+	}
+	return strings.Join(limits, ", ")
+}
+
+func budgetAction(b config.BudgetConfig) string {
+	if b.Action == "downgrade" && b.DowngradeModel != "" {
+		return "downgrade to " + b.DowngradeModel
+	}
+	return "block"
+}
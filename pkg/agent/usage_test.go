@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/usage"
+)
+
+// usageProvider answers every call with fixed token usage and remembers the
+// models it was asked for.
+type usageProvider struct {
+	models []string
+}
+
+func (p *usageProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.models = append(p.models, model)
+	return &providers.LLMResponse{
+		Content: "ok",
+		Usage:   &providers.UsageInfo{PromptTokens: 600, CompletionTokens: 100, TotalTokens: 700},
+	}, nil
+}
+
+func (p *usageProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func newUsageLoop(t *testing.T, budget config.BudgetConfig) (*AgentLoop, *usageProvider) {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Usage: config.UsageConfig{
+			Prices: map[string]config.ModelPrice{"test-*": {Input: 1, Output: 2}},
+			Budget: budget,
+		},
+	}
+	provider := &usageProvider{}
+	return NewAgentLoop(cfg, bus.NewMessageBus(), provider), provider
+}
+
+func TestAgentLoop_RecordsUsage(t *testing.T) {
+	al, _ := newUsageLoop(t, config.BudgetConfig{})
+
+	msg := bus.InboundMessage{Channel: "telegram", ChatID: "42", SenderID: "7|alice", Content: "hi", SessionKey: "telegram:42"}
+	if _, err := al.processMessage(context.Background(), msg); err != nil {
+		t.Fatalf("processMessage() error: %v", err)
+	}
+
+	records, err := usage.Read(usage.Dir(al.workspace), time.Time{})
+	if err != nil || len(records) != 1 {
+		t.Fatalf("Read() = %v, %v, want one record", records, err)
+	}
+	r := records[0]
+	if r.Session != "telegram:42" || r.Channel != "telegram" || r.Sender != "7|alice" || r.Model != "test-model" {
+		t.Errorf("record = %+v, want session, channel, sender and model set", r)
+	}
+	if r.PromptTokens != 600 || r.CompletionTokens != 100 || r.Cost == 0 {
+		t.Errorf("record = %+v, want 600/100 tokens with a cost", r)
+	}
+
+	reply, _ := al.handleCommand(context.Background(), bus.InboundMessage{Content: "/usage"})
+	if !strings.Contains(reply, "1 requests, 700 tokens") {
+		t.Errorf("/usage = %q, want today's totals", reply)
+	}
+}
+
+func TestAgentLoop_BudgetBlocksOrDowngrades(t *testing.T) {
+	al, provider := newUsageLoop(t, config.BudgetConfig{DailyTokens: 500, Action: "block"})
+
+	if _, err := al.ProcessDirect(context.Background(), "first", "cli:test"); err != nil {
+		t.Fatalf("first request error: %v", err)
+	}
+	_, err := al.ProcessDirect(context.Background(), "second", "cli:test")
+	var budgetErr *usage.BudgetError
+	if !errors.As(err, &budgetErr) {
+		t.Fatalf("second request error = %v, want a BudgetError", err)
+	}
+	if len(provider.models) != 1 {
+		t.Errorf("provider called %d times, want 1", len(provider.models))
+	}
+
+	al.budget.Action = "downgrade"
+	al.budget.DowngradeModel = "test-mini"
+	if _, err := al.ProcessDirect(context.Background(), "third", "cli:test"); err != nil {
+		t.Fatalf("downgraded request error: %v", err)
+	}
+	if got := provider.models[len(provider.models)-1]; got != "test-mini" {
+		t.Errorf("downgraded request used %q, want test-mini", got)
+	}
+}
@@ -0,0 +1,130 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tokenizer"
+)
+
+// contextWindowFor returns the context window of model in tokens: the
+// configured one, or the model's known window.
+func (al *AgentLoop) contextWindowFor(model string) int {
+	if al.contextWindow > 0 {
+		return al.contextWindow
+	}
+	return tokenizer.ContextWindow(model)
+}
+
+// inputBudget returns how many tokens a request to model may use, leaving
+// room for the reply. At least half the window is always available.
+func (al *AgentLoop) inputBudget(model string) int {
+	window := al.contextWindowFor(model)
+	return max(window-al.maxTokens, window/2)
+}
+
+// countTokens returns the tokens of a request with messages and tools.
+func (al *AgentLoop) countTokens(model string, messages []providers.Message, toolDefs []providers.ToolDefinition) int {
+	return tokenizer.CountMessages(al.tokenizer.For(model), messages, toolDefs)
+}
+
+// fitToWindow trims a request that would not fit in model's input budget,
+// so it is never sent only to fail. The oldest history goes first; if the
+// current turn alone is too large, its largest tool results are shortened.
+// The system prompt and the user message that started the turn are kept.
+// Only the request is trimmed; the session history is summarized later.
+func (al *AgentLoop) fitToWindow(model string, messages []providers.Message, toolDefs []providers.ToolDefinition) []providers.Message {
+	budget := al.inputBudget(model)
+	before := al.countTokens(model, messages, toolDefs)
+	if before <= budget || len(messages) == 0 {
+		return messages
+	}
+
+	counter := al.tokenizer.For(model)
+	excess := before - budget
+
+	var head []providers.Message
+	rest := messages
+	if rest[0].Role == "system" {
+		head, rest = rest[:1], rest[1:]
+	}
+	turnStart := 0
+	for i := len(rest) - 1; i >= 0; i-- {
+		if rest[i].Role == "user" {
+			turnStart = i
+			break
+		}
+	}
+	history, turn := rest[:turnStart], rest[turnStart:]
+
+	// Drop whole messages from the front of the history, never leaving a
+	// tool result without the call that produced it.
+	dropped := 0
+	for len(history) > 0 && (excess > 0 || history[0].Role == "tool") {
+		excess -= tokenizer.CountMessage(counter, history[0])
+		history = history[1:]
+		dropped++
+	}
+
+	turn = append([]providers.Message(nil), turn...)
+	shortened := 0
+	if excess > 0 {
+		shortened = shortenToolResults(counter, turn, excess)
+	}
+
+	trimmed := make([]providers.Message, 0, len(head)+1+len(history)+len(turn))
+	trimmed = append(trimmed, head...)
+	if dropped > 0 {
+		trimmed = append(trimmed, providers.Message{
+			Role:    "system",
+			Content: fmt.Sprintf("[System: %d earlier messages were left out to fit the context window]", dropped),
+		})
+	}
+	trimmed = append(trimmed, history...)
+	trimmed = append(trimmed, turn...)
+
+	logger.WarnCF("agent", "Trimmed request to fit the context window",
+		map[string]interface{}{
+			"model":           model,
+			"budget":          budget,
+			"tokens_before":   before,
+			"tokens_after":    al.countTokens(model, trimmed, toolDefs),
+			"dropped_msgs":    dropped,
+			"shortened_tools": shortened,
+		})
+	return trimmed
+}
+
+// shortenToolResults cuts the tool results in turn, largest first, until
+// excess tokens are saved. It returns how many results it shortened.
+func shortenToolResults(counter tokenizer.Counter, turn []providers.Message, excess int) int {
+	var results []int
+	for i, m := range turn {
+		if m.Role == "tool" {
+			results = append(results, i)
+		}
+	}
+	sort.Slice(results, func(a, b int) bool {
+		return len(turn[results[a]].Content) > len(turn[results[b]].Content)
+	})
+
+	const marker = "\n[... truncated to fit the context window]"
+	shortened := 0
+	for _, i := range results {
+		if excess <= 0 {
+			break
+		}
+		content := []rune(turn[i].Content)
+		tokens := counter.Count(turn[i].Content)
+		if tokens == 0 {
+			continue
+		}
+		keep := max(tokens-excess-counter.Count(marker), 0)
+		turn[i].Content = string(content[:len(content)*keep/tokens]) + marker
+		excess -= tokens - counter.Count(turn[i].Content)
+		shortened++
+	}
+	return shortened
+}
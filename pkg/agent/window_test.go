@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func newWindowLoop(t *testing.T) *AgentLoop {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         100,
+				ContextWindow:     600,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	return NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+}
+
+func TestAgentLoop_FitToWindowDropsOldestHistory(t *testing.T) {
+	al := newWindowLoop(t)
+
+	messages := []providers.Message{{Role: "system", Content: "You are a test agent."}}
+	for i := 0; i < 10; i++ {
+		messages = append(messages,
+			providers.Message{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "c", Function: &providers.FunctionCall{Name: "exec", Arguments: "{}"}}}},
+			providers.Message{Role: "tool", Content: strings.Repeat("old output ", 10), ToolCallID: "c"},
+		)
+	}
+	messages = append(messages, providers.Message{Role: "user", Content: "What now?"})
+
+	trimmed := al.fitToWindow("test-model", messages, nil)
+	if got := al.countTokens("test-model", trimmed, nil); got > al.inputBudget("test-model") {
+		t.Errorf("trimmed request has %d tokens, budget is %d", got, al.inputBudget("test-model"))
+	}
+	if trimmed[0].Content != "You are a test agent." {
+		t.Errorf("system prompt was not kept first: %+v", trimmed[0])
+	}
+	if last := trimmed[len(trimmed)-1]; last.Content != "What now?" {
+		t.Errorf("user message was not kept last: %+v", last)
+	}
+	if !strings.Contains(trimmed[1].Content, "left out") || trimmed[2].Role == "tool" {
+		t.Errorf("expected a note followed by a complete tool call, got %+v then %+v", trimmed[1], trimmed[2])
+	}
+	if len(messages) != 22 || messages[1].Role != "assistant" {
+		t.Error("fitToWindow modified the caller's messages")
+	}
+}
+
+func TestAgentLoop_FitToWindowShortensToolResults(t *testing.T) {
+	al := newWindowLoop(t)
+
+	huge := strings.Repeat("line of output\n", 500)
+	messages := []providers.Message{
+		{Role: "system", Content: "You are a test agent."},
+		{Role: "user", Content: "Read the log"},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "c", Function: &providers.FunctionCall{Name: "read_file", Arguments: "{}"}}}},
+		{Role: "tool", Content: huge, ToolCallID: "c"},
+	}
+
+	trimmed := al.fitToWindow("test-model", messages, nil)
+	if got := al.countTokens("test-model", trimmed, nil); got > al.inputBudget("test-model") {
+		t.Errorf("trimmed request has %d tokens, budget is %d", got, al.inputBudget("test-model"))
+	}
+	if !strings.HasSuffix(trimmed[3].Content, "truncated to fit the context window]") {
+		t.Errorf("tool result was not shortened: %d bytes", len(trimmed[3].Content))
+	}
+	if messages[3].Content != huge {
+		t.Error("fitToWindow modified the caller's tool result")
+	}
+}
@@ -0,0 +1,314 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// ModelID is the model name under which the agent is listed in /v1/models.
+const ModelID = "picoclaw"
+
+// SessionHeader selects the session a request belongs to. Its value gets an
+// "api:" prefix unless the handler allows it as a session key, so API
+// clients reach chat sessions such as "telegram:123456" only when allowed.
+const SessionHeader = "X-Session-Key"
+
+const (
+	// defaultSessionKey is used when a request names no session.
+	defaultSessionKey = "api:default"
+	// defaultSender is billed for requests that name no user.
+	defaultSender = "api"
+	// maxRequestBytes bounds the size of a chat completion request body.
+	maxRequestBytes = 8 << 20
+)
+
+// Agent is the part of agent.AgentLoop used by the API.
+type Agent interface {
+	ProcessAPI(ctx context.Context, content, sessionKey, senderID string, onDelta func(delta string)) (string, error)
+}
+
+// Handler serves an OpenAI-compatible chat completions API backed by the
+// agent. Conversation history is kept by picoclaw's sessions, so only the
+// last user message of a request is passed to the agent.
+type Handler struct {
+	agent    Agent
+	token    string
+	sessions []string // session keys usable as they are, as glob patterns
+	mux      *http.ServeMux
+}
+
+// NewHandler returns a handler for /v1/chat/completions and /v1/models.
+// Every request must carry "Authorization: Bearer <token>". sessions lists
+// the session keys, as glob patterns, that SessionHeader may name without
+// an "api:" prefix.
+func NewHandler(agent Agent, token string, sessions []string) *Handler {
+	h := &Handler{
+		agent:    agent,
+		token:    token,
+		sessions: sessions,
+		mux:      http.NewServeMux(),
+	}
+	h.mux.HandleFunc("/v1/chat/completions", h.chatCompletions)
+	h.mux.HandleFunc("/v1/models", h.models)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "invalid_api_key", "Invalid or missing bearer token")
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) authorized(r *http.Request) bool {
+	if h.token == "" {
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+type chatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+type chatRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+	User     string        `json:"user"`
+}
+
+type contentPart struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// text returns the textual content of a message, which may be a plain
+// string or an array of content parts.
+func (m chatMessage) text() string {
+	var s string
+	if json.Unmarshal(m.Content, &s) == nil {
+		return s
+	}
+
+	var parts []contentPart
+	if json.Unmarshal(m.Content, &parts) != nil {
+		return ""
+	}
+	texts := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p.Type == "text" && p.Text != "" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// sessionKey maps a request to a session: the session header wins, then
+// the OpenAI "user" field, then a shared default session. Header keys stay
+// among the API's sessions unless they are allowed.
+func (h *Handler) sessionKey(r *http.Request, req *chatRequest) string {
+	if key := strings.TrimSpace(r.Header.Get(SessionHeader)); key != "" {
+		if strings.HasPrefix(key, "api:") || h.allowedSession(key) {
+			return key
+		}
+		return "api:" + key
+	}
+	if req.User != "" {
+		return "api:" + req.User
+	}
+	return defaultSessionKey
+}
+
+func (h *Handler) allowedSession(key string) bool {
+	for _, pattern := range h.sessions {
+		if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// sender returns whom a request is billed to in the usage ledger.
+func sender(req *chatRequest) string {
+	if req.User != "" {
+		return req.User
+	}
+	return defaultSender
+}
+
+func (h *Handler) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "Use POST")
+		return
+	}
+
+	var req chatRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Invalid JSON body: %v", err))
+		return
+	}
+
+	var content string
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == "user" {
+			content = req.Messages[i].text()
+			break
+		}
+	}
+	if strings.TrimSpace(content) == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "A non-empty user message is required")
+		return
+	}
+
+	model := req.Model
+	if model == "" {
+		model = ModelID
+	}
+	key := h.sessionKey(r, &req)
+
+	// Agent turns can run far longer than the server's write timeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	logger.InfoCF("api", "Chat completion request",
+		map[string]interface{}{
+			"session_key": key,
+			"stream":      req.Stream,
+		})
+
+	if req.Stream {
+		h.streamCompletion(w, r, content, key, sender(&req), model)
+		return
+	}
+
+	response, err := h.agent.ProcessAPI(r.Context(), content, key, sender(&req), nil)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":      completionID(),
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   model,
+		"choices": []map[string]interface{}{{
+			"index": 0,
+			"message": map[string]interface{}{
+				"role":    "assistant",
+				"content": response,
+			},
+			"finish_reason": "stop",
+		}},
+		"usage": map[string]int{
+			"prompt_tokens":     0,
+			"completion_tokens": 0,
+			"total_tokens":      0,
+		},
+	})
+}
+
+// streamCompletion answers with server-sent events in the OpenAI chunk format.
+func (h *Handler) streamCompletion(w http.ResponseWriter, r *http.Request, content, key, senderID, model string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	id := completionID()
+	created := time.Now().Unix()
+	rc := http.NewResponseController(w)
+
+	send := func(delta map[string]interface{}, finishReason interface{}) {
+		data, _ := json.Marshal(map[string]interface{}{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   model,
+			"choices": []map[string]interface{}{{
+				"index":         0,
+				"delta":         delta,
+				"finish_reason": finishReason,
+			}},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		rc.Flush()
+	}
+
+	send(map[string]interface{}{"role": "assistant"}, nil)
+
+	streamed := false
+	response, err := h.agent.ProcessAPI(r.Context(), content, key, senderID, func(delta string) {
+		streamed = true
+		send(map[string]interface{}{"content": delta}, nil)
+	})
+	if err != nil {
+		response = fmt.Sprintf("Error processing message: %v", err)
+		streamed = false
+	}
+
+	// Commands, errors and non-streaming providers only produce a final answer.
+	if !streamed && response != "" {
+		send(map[string]interface{}{"content": response}, nil)
+	}
+
+	send(map[string]interface{}{}, "stop")
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	rc.Flush()
+}
+
+func (h *Handler) models(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "Use GET")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"object": "list",
+		"data": []map[string]interface{}{{
+			"id":       ModelID,
+			"object":   "model",
+			"created":  0,
+			"owned_by": "picoclaw",
+		}},
+	})
+}
+
+func completionID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "chatcmpl-" + hex.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError replies with an error body in the OpenAI format.
+func writeError(w http.ResponseWriter, status int, errType, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    errType,
+		},
+	})
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeAgent struct {
+	sessionKey string
+	senderID   string
+	content    string
+	deltas     []string
+	response   string
+}
+
+func (a *fakeAgent) ProcessAPI(ctx context.Context, content, sessionKey, senderID string, onDelta func(delta string)) (string, error) {
+	a.content, a.sessionKey, a.senderID = content, sessionKey, senderID
+	if onDelta != nil {
+		for _, d := range a.deltas {
+			onDelta(d)
+		}
+	}
+	return a.response, nil
+}
+
+func doRequest(h http.Handler, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler_RequiresToken(t *testing.T) {
+	h := NewHandler(&fakeAgent{}, "secret", nil)
+
+	rec := doRequest(h, http.MethodGet, "/v1/models", "", nil)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without token, got %d", rec.Code)
+	}
+
+	rec = doRequest(h, http.MethodGet, "/v1/models", "", map[string]string{"Authorization": "Bearer wrong"})
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with wrong token, got %d", rec.Code)
+	}
+
+	rec = doRequest(h, http.MethodGet, "/v1/models", "", map[string]string{"Authorization": "Bearer secret"})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), ModelID) {
+		t.Errorf("Expected model list, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandler_ChatCompletion(t *testing.T) {
+	agent := &fakeAgent{response: "Hi there"}
+	h := NewHandler(agent, "secret", nil)
+
+	body := `{"model":"picoclaw","user":"alice","messages":[
+		{"role":"system","content":"ignored"},
+		{"role":"user","content":"first"},
+		{"role":"assistant","content":"ok"},
+		{"role":"user","content":[{"type":"text","text":"hello"}]}
+	]}`
+	rec := doRequest(h, http.MethodPost, "/v1/chat/completions", body, map[string]string{"Authorization": "Bearer secret"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if agent.content != "hello" {
+		t.Errorf("Expected last user message to be sent, got %q", agent.content)
+	}
+	if agent.sessionKey != "api:alice" {
+		t.Errorf("Expected session key from user field, got %q", agent.sessionKey)
+	}
+	if agent.senderID != "alice" {
+		t.Errorf("Expected sender from user field, got %q", agent.senderID)
+	}
+
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if len(resp.Choices) != 1 || resp.Choices[0].Message.Content != "Hi there" {
+		t.Errorf("Unexpected response body: %s", rec.Body.String())
+	}
+}
+
+func TestHandler_ChatCompletionStream(t *testing.T) {
+	agent := &fakeAgent{deltas: []string{"Hel", "lo"}, response: "Hello"}
+	h := NewHandler(agent, "secret", nil)
+
+	body := `{"stream":true,"messages":[{"role":"user","content":"hi"}]}`
+	rec := doRequest(h, http.MethodPost, "/v1/chat/completions", body, map[string]string{
+		"Authorization": "Bearer secret",
+		SessionHeader:   "telegram:42",
+	})
+
+	if agent.sessionKey != "api:telegram:42" || agent.senderID != "api" {
+		t.Errorf("Expected prefixed session key from header and sender api, got %q and %q", agent.sessionKey, agent.senderID)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected event stream, got %q", ct)
+	}
+
+	var text strings.Builder
+	var done bool
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+		}
+		json.Unmarshal([]byte(data), &chunk)
+		text.WriteString(chunk.Choices[0].Delta.Content)
+	}
+
+	if text.String() != "Hello" {
+		t.Errorf("Expected streamed text 'Hello', got %q", text.String())
+	}
+	if !done {
+		t.Error("Expected stream to end with [DONE]")
+	}
+}
+
+func TestHandler_RejectsMissingUserMessage(t *testing.T) {
+	h := NewHandler(&fakeAgent{}, "secret", nil)
+
+	rec := doRequest(h, http.MethodPost, "/v1/chat/completions", `{"messages":[]}`, map[string]string{"Authorization": "Bearer secret"})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", rec.Code)
+	}
+}
+
+func TestHandler_AllowedSessions(t *testing.T) {
+	agent := &fakeAgent{response: "ok"}
+	h := NewHandler(agent, "secret", []string{"telegram:*"})
+
+	body := `{"messages":[{"role":"user","content":"hi"}]}`
+	for header, want := range map[string]string{
+		"telegram:42": "telegram:42",
+		"api:kitchen": "api:kitchen",
+		"kitchen":     "api:kitchen",
+		"discord:7":   "api:discord:7",
+	} {
+		doRequest(h, http.MethodPost, "/v1/chat/completions", body, map[string]string{
+			"Authorization": "Bearer secret",
+			SessionHeader:   header,
+		})
+		if agent.sessionKey != want {
+			t.Errorf("Session header %q used session %q, want %q", header, agent.sessionKey, want)
+		}
+	}
+}
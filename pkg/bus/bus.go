@@ -1,23 +1,143 @@
 package bus
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	// DefaultMaxRetries is how often a failed outbound send is retried
+	// before the message is dead-lettered.
+	DefaultMaxRetries = 5
+
+	retryBaseDelay = 2 * time.Second
+	retryMaxDelay  = 5 * time.Minute
+
+	inboundJournal  = "inbound.jsonl"
+	outboundJournal = "outbound.jsonl"
+	deadLetterFile  = "dead_letter.jsonl"
 )
 
 type MessageBus struct {
-	inbound  chan InboundMessage
-	outbound chan OutboundMessage
+	inbound  *queue[InboundMessage]
+	outbound *queue[OutboundMessage]
 	handlers map[string]MessageHandler
 	closed   bool
 	mu       sync.RWMutex
+
+	nextID     atomic.Uint64
+	maxRetries int
+	retryMu    sync.Mutex
+	attempts   map[uint64]int
+	blocked    map[string]*blockedChat // by chatKey, while a send to the chat is retried
+
+	// Set only for a durable bus.
+	dir         string
+	inboundLog  *journal
+	outboundLog *journal
+}
+
+// blockedChat holds back a chat's outbound messages while its oldest
+// undelivered message, head, is retried, so replies arrive in order.
+type blockedChat struct {
+	head uint64
+	held []OutboundMessage
+}
+
+func chatKey(msg OutboundMessage) string {
+	return msg.Channel + "\x00" + msg.ChatID
+}
+
+// QueueStats reports how many messages are waiting in a bus.
+type QueueStats struct {
+	Inbound     int `json:"inbound"`
+	Outbound    int `json:"outbound"`
+	DeadLetters int `json:"dead_letters"`
 }
 
 func NewMessageBus() *MessageBus {
 	return &MessageBus{
-		inbound:  make(chan InboundMessage, 100),
-		outbound: make(chan OutboundMessage, 100),
-		handlers: make(map[string]MessageHandler),
+		inbound:    newQueue[InboundMessage](),
+		outbound:   newQueue[OutboundMessage](),
+		handlers:   make(map[string]MessageHandler),
+		maxRetries: DefaultMaxRetries,
+		attempts:   make(map[uint64]int),
+		blocked:    make(map[string]*blockedChat),
+	}
+}
+
+// NewDurableMessageBus returns a bus that journals every queued message in
+// dir. Messages published but not acknowledged before a crash or restart
+// are queued again, so inbound messages are processed at least once and
+// outbound messages are delivered at least once.
+func NewDurableMessageBus(dir string) (*MessageBus, error) {
+	inboundLog, err := openJournal(filepath.Join(dir, inboundJournal))
+	if err != nil {
+		return nil, err
+	}
+	outboundLog, err := openJournal(filepath.Join(dir, outboundJournal))
+	if err != nil {
+		inboundLog.close()
+		return nil, err
+	}
+
+	mb := NewMessageBus()
+	mb.dir = dir
+	mb.inboundLog = inboundLog
+	mb.outboundLog = outboundLog
+
+	var maxID uint64
+	for _, e := range inboundLog.entries() {
+		var msg InboundMessage
+		if json.Unmarshal(e.Msg, &msg) != nil {
+			continue
+		}
+		msg.ID = e.ID
+		mb.inbound.push(msg)
+		maxID = max(maxID, e.ID)
+	}
+	for _, e := range outboundLog.entries() {
+		var msg OutboundMessage
+		if json.Unmarshal(e.Msg, &msg) != nil {
+			continue
+		}
+		msg.ID = e.ID
+		mb.outbound.push(msg)
+		maxID = max(maxID, e.ID)
+	}
+	mb.nextID.Store(maxID)
+
+	if stats := mb.Stats(); stats.Inbound > 0 || stats.Outbound > 0 {
+		logger.InfoCF("bus", "Replaying queued messages", map[string]interface{}{
+			"inbound":  stats.Inbound,
+			"outbound": stats.Outbound,
+		})
+	}
+
+	return mb, nil
+}
+
+// SetMaxRetries sets how often a failed outbound send is retried.
+func (mb *MessageBus) SetMaxRetries(n int) {
+	mb.maxRetries = n
+}
+
+// SetSyncInterval sets how long a durable bus may wait before syncing
+// journal records to disk. Records written within one interval share a
+// sync; 0 syncs every record. It does nothing for an in-memory bus.
+func (mb *MessageBus) SetSyncInterval(d time.Duration) {
+	if mb.inboundLog != nil {
+		mb.inboundLog.setSyncInterval(d)
+		mb.outboundLog.setSyncInterval(d)
 	}
 }
 
@@ -27,36 +147,286 @@ func (mb *MessageBus) PublishInbound(msg InboundMessage) {
 	if mb.closed {
 		return
 	}
-	mb.inbound <- msg
+
+	msg.ID = mb.nextID.Add(1)
+	if mb.inboundLog != nil {
+		if err := mb.inboundLog.add(msg.ID, msg); err != nil {
+			logger.ErrorCF("bus", "Failed to journal inbound message", map[string]interface{}{
+				"channel": msg.Channel,
+				"error":   err.Error(),
+			})
+		}
+	}
+	mb.inbound.push(msg)
 }
 
 func (mb *MessageBus) ConsumeInbound(ctx context.Context) (InboundMessage, bool) {
-	select {
-	case msg := <-mb.inbound:
-		return msg, true
-	case <-ctx.Done():
-		return InboundMessage{}, false
+	return mb.inbound.pop(ctx)
+}
+
+// AckInbound marks an inbound message as processed, so it is not replayed
+// after a restart.
+func (mb *MessageBus) AckInbound(msg InboundMessage) {
+	if mb.inboundLog == nil || msg.ID == 0 {
+		return
+	}
+	if err := mb.inboundLog.ack(msg.ID); err != nil {
+		logger.ErrorCF("bus", "Failed to acknowledge inbound message", map[string]interface{}{
+			"error": err.Error(),
+		})
 	}
 }
 
+// PublishOutbound queues a message for delivery. Partial (streaming)
+// updates are best effort and never journaled.
 func (mb *MessageBus) PublishOutbound(msg OutboundMessage) {
 	mb.mu.RLock()
 	defer mb.mu.RUnlock()
 	if mb.closed {
 		return
 	}
-	mb.outbound <- msg
+
+	if !msg.Partial {
+		msg.ID = mb.nextID.Add(1)
+		if mb.outboundLog != nil {
+			if err := mb.outboundLog.add(msg.ID, msg); err != nil {
+				logger.ErrorCF("bus", "Failed to journal outbound message", map[string]interface{}{
+					"channel": msg.Channel,
+					"error":   err.Error(),
+				})
+			}
+		}
+	}
+	mb.outbound.push(msg)
 }
 
+// SubscribeOutbound waits for the next message to send. Messages to a chat
+// whose earlier message is waiting to be retried are held back until that
+// message is delivered or dead-lettered.
 func (mb *MessageBus) SubscribeOutbound(ctx context.Context) (OutboundMessage, bool) {
-	select {
-	case msg := <-mb.outbound:
-		return msg, true
-	case <-ctx.Done():
-		return OutboundMessage{}, false
+	for {
+		msg, ok := mb.outbound.pop(ctx)
+		if !ok || !mb.hold(msg) {
+			return msg, ok
+		}
+	}
+}
+
+// hold keeps msg back if its chat is blocked by another message. Partial
+// updates of a blocked chat are dropped, since they are best effort and
+// would show up before the message being retried.
+func (mb *MessageBus) hold(msg OutboundMessage) bool {
+	mb.retryMu.Lock()
+	defer mb.retryMu.Unlock()
+	b := mb.blocked[chatKey(msg)]
+	if b == nil || msg.ID == b.head {
+		return false
+	}
+	if !msg.Partial {
+		b.held = append(b.held, msg)
+	}
+	return true
+}
+
+// AckOutbound marks an outbound message as delivered (or deliberately
+// dropped).
+func (mb *MessageBus) AckOutbound(msg OutboundMessage) {
+	if msg.ID == 0 {
+		return
+	}
+
+	mb.retryMu.Lock()
+	delete(mb.attempts, msg.ID)
+	if b := mb.blocked[chatKey(msg)]; b != nil && b.head == msg.ID {
+		// The held messages were queued before anything still in the
+		// queue for this chat, so they go first.
+		delete(mb.blocked, chatKey(msg))
+		mb.outbound.pushFront(b.held...)
+	}
+	mb.retryMu.Unlock()
+
+	if mb.outboundLog == nil {
+		return
+	}
+	if err := mb.outboundLog.ack(msg.ID); err != nil {
+		logger.ErrorCF("bus", "Failed to acknowledge outbound message", map[string]interface{}{
+			"error": err.Error(),
+		})
 	}
 }
 
+// RetryOutbound schedules another delivery attempt for a message whose send
+// failed, with exponential backoff. msg may be what is left of the message
+// after a partial send; it replaces the journaled one. Later messages to
+// the same chat wait until it is delivered. Once the retries are used up
+// the message is written to the dead-letter file and acknowledged, which
+// releases them.
+func (mb *MessageBus) RetryOutbound(msg OutboundMessage, sendErr error) {
+	if msg.ID == 0 {
+		return
+	}
+	if mb.outboundLog != nil {
+		if err := mb.outboundLog.add(msg.ID, msg); err != nil {
+			logger.ErrorCF("bus", "Failed to journal outbound message", map[string]interface{}{
+				"channel": msg.Channel,
+				"error":   err.Error(),
+			})
+		}
+	}
+
+	mb.retryMu.Lock()
+	mb.attempts[msg.ID]++
+	attempt := mb.attempts[msg.ID]
+	if mb.blocked[chatKey(msg)] == nil {
+		mb.blocked[chatKey(msg)] = &blockedChat{head: msg.ID}
+	}
+	mb.retryMu.Unlock()
+
+	if attempt > mb.maxRetries {
+		mb.deadLetter(msg, sendErr, attempt)
+		mb.AckOutbound(msg)
+		return
+	}
+
+	delay := retryDelay(attempt)
+	logger.WarnCF("bus", "Outbound send failed, will retry", map[string]interface{}{
+		"channel": msg.Channel,
+		"chat_id": msg.ChatID,
+		"attempt": attempt,
+		"delay":   delay.String(),
+		"error":   sendErr.Error(),
+	})
+
+	time.AfterFunc(delay, func() {
+		mb.mu.RLock()
+		defer mb.mu.RUnlock()
+		if !mb.closed {
+			mb.outbound.push(msg)
+		}
+	})
+}
+
+// DeadLetterOutbound gives up on a message whose send failed in a way that
+// retrying would not fix.
+func (mb *MessageBus) DeadLetterOutbound(msg OutboundMessage, sendErr error) {
+	if msg.ID == 0 {
+		return
+	}
+	mb.retryMu.Lock()
+	attempts := mb.attempts[msg.ID] + 1
+	mb.retryMu.Unlock()
+	mb.deadLetter(msg, sendErr, attempts)
+	mb.AckOutbound(msg)
+}
+
+func retryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempt && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, retryMaxDelay)
+}
+
+type deadLetterRecord struct {
+	Time     time.Time       `json:"time"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	Message  OutboundMessage `json:"message"`
+}
+
+// deadLetter records a message that could not be delivered. Without a
+// journal directory the message is only logged.
+func (mb *MessageBus) deadLetter(msg OutboundMessage, sendErr error, attempts int) {
+	logger.ErrorCF("bus", "Giving up on outbound message", map[string]interface{}{
+		"channel":  msg.Channel,
+		"chat_id":  msg.ChatID,
+		"attempts": attempts,
+		"error":    sendErr.Error(),
+	})
+	if mb.dir == "" {
+		return
+	}
+
+	line, err := json.Marshal(deadLetterRecord{
+		Time:     time.Now(),
+		Attempts: attempts,
+		Error:    sendErr.Error(),
+		Message:  msg,
+	})
+	if err == nil {
+		err = appendLine(filepath.Join(mb.dir, deadLetterFile), line)
+	}
+	if err != nil {
+		logger.ErrorCF("bus", "Failed to write dead letter", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+func appendLine(path string, line []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Stats returns the number of queued messages. For a durable bus this
+// includes messages being processed but not yet acknowledged.
+func (mb *MessageBus) Stats() QueueStats {
+	if mb.inboundLog != nil {
+		deadLetters, _ := countDeadLetters(mb.dir)
+		return QueueStats{
+			Inbound:     mb.inboundLog.len(),
+			Outbound:    mb.outboundLog.len(),
+			DeadLetters: deadLetters,
+		}
+	}
+	mb.retryMu.Lock()
+	held := 0
+	for _, b := range mb.blocked {
+		held += len(b.held)
+	}
+	mb.retryMu.Unlock()
+	return QueueStats{
+		Inbound:  mb.inbound.len(),
+		Outbound: mb.outbound.len() + held,
+	}
+}
+
+// ReadQueueStats reads the queue depth of a durable bus from its journal
+// directory, without opening the bus. It works while a gateway is running.
+func ReadQueueStats(dir string) (QueueStats, error) {
+	var stats QueueStats
+
+	inbound, err := readJournal(filepath.Join(dir, inboundJournal))
+	if err != nil {
+		return stats, err
+	}
+	outbound, err := readJournal(filepath.Join(dir, outboundJournal))
+	if err != nil {
+		return stats, err
+	}
+	stats.Inbound = len(inbound)
+	stats.Outbound = len(outbound)
+
+	stats.DeadLetters, err = countDeadLetters(dir)
+	return stats, err
+}
+
+func countDeadLetters(dir string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(dir, deadLetterFile))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("reading dead letters: %w", err)
+	}
+	return bytes.Count(data, []byte{'\n'}), nil
+}
+
 func (mb *MessageBus) RegisterHandler(channel string, handler MessageHandler) {
 	mb.mu.Lock()
 	defer mb.mu.Unlock()
@@ -77,6 +447,10 @@ func (mb *MessageBus) Close() {
 		return
 	}
 	mb.closed = true
-	close(mb.inbound)
-	close(mb.outbound)
+	mb.inbound.close()
+	mb.outbound.close()
+	if mb.inboundLog != nil {
+		mb.inboundLog.close()
+		mb.outboundLog.close()
+	}
 }
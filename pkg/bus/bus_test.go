@@ -0,0 +1,181 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageBus_PublishDoesNotBlock(t *testing.T) {
+	mb := NewMessageBus()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 500; i++ {
+			mb.PublishInbound(InboundMessage{Channel: "test", Content: "hi"})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("PublishInbound blocked without a consumer")
+	}
+	if got := mb.Stats().Inbound; got != 500 {
+		t.Errorf("Expected 500 queued messages, got %d", got)
+	}
+}
+
+func TestDurableMessageBus_ReplaysUnacked(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	mb, err := NewDurableMessageBus(dir)
+	if err != nil {
+		t.Fatalf("NewDurableMessageBus() error: %v", err)
+	}
+	mb.PublishInbound(InboundMessage{Channel: "telegram", ChatID: "1", Content: "first"})
+	mb.PublishInbound(InboundMessage{Channel: "telegram", ChatID: "1", Content: "second"})
+	mb.PublishOutbound(OutboundMessage{Channel: "telegram", ChatID: "1", Content: "reply"})
+	mb.PublishOutbound(OutboundMessage{Channel: "telegram", ChatID: "1", Content: "partial", Partial: true})
+
+	first, _ := mb.ConsumeInbound(ctx)
+	mb.AckInbound(first)
+	mb.ConsumeInbound(ctx) // taken but never acknowledged: simulates a crash mid-turn
+	mb.Close()
+
+	stats, err := ReadQueueStats(dir)
+	if err != nil {
+		t.Fatalf("ReadQueueStats() error: %v", err)
+	}
+	if stats.Inbound != 1 || stats.Outbound != 1 {
+		t.Errorf("Expected 1 inbound and 1 outbound pending, got %+v", stats)
+	}
+
+	mb, err = NewDurableMessageBus(dir)
+	if err != nil {
+		t.Fatalf("Reopening bus: %v", err)
+	}
+	defer mb.Close()
+
+	msg, ok := mb.ConsumeInbound(ctx)
+	if !ok || msg.Content != "second" {
+		t.Errorf("Expected unacknowledged message to be replayed, got %+v", msg)
+	}
+	out, ok := mb.SubscribeOutbound(ctx)
+	if !ok || out.Content != "reply" {
+		t.Errorf("Expected undelivered reply to be replayed, got %+v", out)
+	}
+
+	// New messages must not reuse the IDs of replayed ones.
+	mb.PublishInbound(InboundMessage{Channel: "telegram", ChatID: "1", Content: "third"})
+	next, _ := mb.ConsumeInbound(ctx)
+	if next.ID <= msg.ID {
+		t.Errorf("Expected ID after %d, got %d", msg.ID, next.ID)
+	}
+}
+
+func TestDurableMessageBus_DeadLetter(t *testing.T) {
+	dir := t.TempDir()
+	mb, err := NewDurableMessageBus(dir)
+	if err != nil {
+		t.Fatalf("NewDurableMessageBus() error: %v", err)
+	}
+	defer mb.Close()
+	mb.SetMaxRetries(0)
+
+	mb.PublishOutbound(OutboundMessage{Channel: "slack", ChatID: "C1", Content: "lost"})
+	msg, _ := mb.SubscribeOutbound(context.Background())
+	mb.RetryOutbound(msg, errors.New("channel_not_found"))
+
+	stats := mb.Stats()
+	if stats.Outbound != 0 || stats.DeadLetters != 1 {
+		t.Errorf("Expected message to move to dead letters, got %+v", stats)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, deadLetterFile))
+	if !strings.Contains(string(data), "channel_not_found") || !strings.Contains(string(data), `"content":"lost"`) {
+		t.Errorf("Unexpected dead letter: %s", data)
+	}
+}
+
+func TestMessageBus_RetryKeepsChatOrder(t *testing.T) {
+	mb := NewMessageBus()
+	defer mb.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	mb.PublishOutbound(OutboundMessage{Channel: "telegram", ChatID: "1", Content: "one"})
+	mb.PublishOutbound(OutboundMessage{Channel: "telegram", ChatID: "1", Content: "two"})
+	mb.PublishOutbound(OutboundMessage{Channel: "telegram", ChatID: "2", Content: "other chat"})
+
+	first, _ := mb.SubscribeOutbound(ctx)
+	mb.RetryOutbound(first, errors.New("timeout"))
+	mb.PublishOutbound(OutboundMessage{Channel: "telegram", ChatID: "1", Content: "three"})
+	mb.PublishOutbound(OutboundMessage{Channel: "telegram", ChatID: "1", Content: "typing", Partial: true})
+
+	// Chat 2 is not held up while chat 1 waits for its retry.
+	if msg, _ := mb.SubscribeOutbound(ctx); msg.Content != "other chat" {
+		t.Fatalf("got %q, want the other chat's message", msg.Content)
+	}
+
+	// "one" comes back after the retry delay; nothing overtakes it.
+	var got []string
+	for len(got) < 3 {
+		msg, ok := mb.SubscribeOutbound(ctx)
+		if !ok {
+			t.Fatalf("only got %v", got)
+		}
+		got = append(got, msg.Content)
+		mb.AckOutbound(msg)
+	}
+	if strings.Join(got, ",") != "one,two,three" {
+		t.Errorf("delivered %v, want one,two,three", got)
+	}
+}
+
+func TestDurableMessageBus_SyncInterval(t *testing.T) {
+	dir := t.TempDir()
+	mb, err := NewDurableMessageBus(dir)
+	if err != nil {
+		t.Fatalf("NewDurableMessageBus() error: %v", err)
+	}
+	mb.SetSyncInterval(time.Hour)
+	mb.PublishOutbound(OutboundMessage{Channel: "slack", ChatID: "C1", Content: "batched"})
+	mb.Close()
+
+	stats, err := ReadQueueStats(dir)
+	if err != nil || stats.Outbound != 1 {
+		t.Errorf("ReadQueueStats() = %+v, %v; want the batched message journaled", stats, err)
+	}
+}
+
+func TestReadJournal_SkipsTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inbound.jsonl")
+	os.WriteFile(path, []byte(`{"op":"add","id":1,"msg":{"content":"a"}}`+"\n"+`{"op":"add","id":2,"msg":{"con`), 0600)
+
+	pending, err := readJournal(path)
+	if err != nil {
+		t.Fatalf("readJournal() error: %v", err)
+	}
+	if len(pending) != 1 {
+		t.Errorf("Expected 1 pending message, got %d", len(pending))
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	if d := retryDelay(1); d != retryBaseDelay {
+		t.Errorf("retryDelay(1) = %v, want %v", d, retryBaseDelay)
+	}
+	if d := retryDelay(3); d != 4*retryBaseDelay {
+		t.Errorf("retryDelay(3) = %v, want %v", d, 4*retryBaseDelay)
+	}
+	if d := retryDelay(100); d != retryMaxDelay {
+		t.Errorf("retryDelay(100) = %v, want %v", d, retryMaxDelay)
+	}
+}
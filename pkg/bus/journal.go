@@ -0,0 +1,240 @@
+package bus
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// compactAfter is how many records an idle journal may hold before it is
+// truncated. A journal is only truncated when nothing is pending.
+const compactAfter = 1000
+
+// journal is an append-only log of queued messages. Each line records a
+// message added to the queue or the acknowledgement of one; messages that
+// were added but never acknowledged are pending and get replayed on start.
+type journal struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	pending map[uint64]json.RawMessage
+	records int
+
+	syncEvery time.Duration // 0 syncs every record
+	syncTimer *time.Timer   // set while a sync of written records is due
+}
+
+type journalRecord struct {
+	Op  string          `json:"op"` // "add" or "ack"
+	ID  uint64          `json:"id"`
+	Msg json.RawMessage `json:"msg,omitempty"`
+}
+
+type journalEntry struct {
+	ID  uint64
+	Msg json.RawMessage
+}
+
+// readJournal returns the pending messages of the journal at path. Lines
+// that cannot be parsed, such as a record cut short by a crash, are skipped.
+func readJournal(path string) (map[uint64]json.RawMessage, error) {
+	pending := make(map[uint64]json.RawMessage)
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return pending, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var rec journalRecord
+		if json.Unmarshal(scanner.Bytes(), &rec) != nil {
+			continue
+		}
+		switch rec.Op {
+		case "add":
+			pending[rec.ID] = rec.Msg
+		case "ack":
+			delete(pending, rec.ID)
+		}
+	}
+	return pending, scanner.Err()
+}
+
+// openJournal loads the journal at path, rewrites it with only its pending
+// messages and opens it for appending.
+func openJournal(path string) (*journal, error) {
+	pending, err := readJournal(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading journal %s: %w", path, err)
+	}
+
+	j := &journal{path: path, pending: pending}
+	if err := j.rewrite(); err != nil {
+		return nil, fmt.Errorf("compacting journal %s: %w", path, err)
+	}
+
+	j.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// rewrite atomically replaces the journal file with the pending messages.
+func (j *journal) rewrite() error {
+	if err := os.MkdirAll(filepath.Dir(j.path), 0755); err != nil {
+		return err
+	}
+
+	tmp := j.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, e := range j.entries() {
+		line, _ := json.Marshal(journalRecord{Op: "add", ID: e.ID, Msg: e.Msg})
+		w.Write(append(line, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	j.records = len(j.pending)
+	return os.Rename(tmp, j.path)
+}
+
+// entries returns the pending messages in the order they were added.
+func (j *journal) entries() []journalEntry {
+	entries := make([]journalEntry, 0, len(j.pending))
+	for id, msg := range j.pending {
+		entries = append(entries, journalEntry{ID: id, Msg: msg})
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].ID < entries[b].ID })
+	return entries
+}
+
+func (j *journal) add(id uint64, msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.append(journalRecord{Op: "add", ID: id, Msg: data}); err != nil {
+		return err
+	}
+	j.pending[id] = data
+	return nil
+}
+
+func (j *journal) ack(id uint64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.pending[id]; !ok {
+		return nil
+	}
+	if err := j.append(journalRecord{Op: "ack", ID: id}); err != nil {
+		return err
+	}
+	delete(j.pending, id)
+
+	if len(j.pending) == 0 && j.records >= compactAfter {
+		if err := j.file.Truncate(0); err != nil {
+			return err
+		}
+		j.records = 0
+	}
+	return nil
+}
+
+func (j *journal) setSyncInterval(d time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.syncEvery = d
+}
+
+// append writes one record and syncs it so it survives a power loss, at
+// once or, with a sync interval, together with the records written after
+// it. A record not synced yet is still safe if only the process crashes.
+func (j *journal) append(rec journalRecord) error {
+	if j.file == nil {
+		return fmt.Errorf("journal closed")
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	j.records++
+	if j.syncEvery <= 0 {
+		return j.file.Sync()
+	}
+	if j.syncTimer == nil {
+		j.syncTimer = time.AfterFunc(j.syncEvery, j.sync)
+	}
+	return nil
+}
+
+// sync flushes the records written since the last sync.
+func (j *journal) sync() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.syncTimer = nil
+	if j.file == nil {
+		return
+	}
+	if err := j.file.Sync(); err != nil {
+		logger.ErrorCF("bus", "Failed to sync journal", map[string]interface{}{
+			"path":  j.path,
+			"error": err.Error(),
+		})
+	}
+}
+
+func (j *journal) len() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.pending)
+}
+
+func (j *journal) close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	if j.syncTimer != nil {
+		j.syncTimer.Stop()
+		j.syncTimer = nil
+		j.file.Sync()
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
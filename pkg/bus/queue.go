@@ -0,0 +1,92 @@
+package bus
+
+import (
+	"context"
+	"sync"
+)
+
+// queue is an unbounded FIFO. Publishers never block on a slow consumer;
+// messages simply wait in memory (and in the journal, when durable).
+type queue[T any] struct {
+	mu     sync.Mutex
+	items  []T
+	notify chan struct{}
+	closed bool
+}
+
+func newQueue[T any]() *queue[T] {
+	return &queue[T]{notify: make(chan struct{}, 1)}
+}
+
+func (q *queue[T]) push(item T) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return false
+	}
+	q.items = append(q.items, item)
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// pushFront puts items, in order, ahead of the queued ones.
+func (q *queue[T]) pushFront(items ...T) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return false
+	}
+	if len(items) == 0 {
+		return true
+	}
+	q.items = append(append(make([]T, 0, len(items)+len(q.items)), items...), q.items...)
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// pop waits for the next item until ctx is done or the queue is closed.
+func (q *queue[T]) pop(ctx context.Context) (T, bool) {
+	var zero T
+	for {
+		q.mu.Lock()
+		if len(q.items) > 0 {
+			item := q.items[0]
+			q.items[0] = zero
+			q.items = q.items[1:]
+			q.mu.Unlock()
+			return item, true
+		}
+		closed := q.closed
+		q.mu.Unlock()
+
+		if closed {
+			return zero, false
+		}
+		select {
+		case <-q.notify:
+		case <-ctx.Done():
+			return zero, false
+		}
+	}
+}
+
+func (q *queue[T]) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+func (q *queue[T]) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		close(q.notify)
+	}
+}
@@ -8,12 +8,39 @@ type InboundMessage struct {
 	Media      []string          `json:"media,omitempty"`
 	SessionKey string            `json:"session_key"`
 	Metadata   map[string]string `json:"metadata,omitempty"`
+	// ID is assigned by the bus when the message is published.
+	ID uint64 `json:"-"`
 }
 
 type OutboundMessage struct {
 	Channel string `json:"channel"`
 	ChatID  string `json:"chat_id"`
 	Content string `json:"content"`
+	// Partial marks an in-progress streaming update. Content holds the text
+	// generated so far; the next non-partial message replaces it.
+	Partial bool `json:"partial,omitempty"`
+	// Attachments are files sent after Content. Channels upload them with
+	// their native API or fall back to a text notice.
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// Buttons are answers the user can pick with one tap. Channels that
+	// support them send a button's Data back as the content of an inbound
+	// message; the others show only Content, which should say what to reply.
+	Buttons []Button `json:"buttons,omitempty"`
+	// ID is assigned by the bus when the message is published.
+	ID uint64 `json:"-"`
+}
+
+// Attachment is a local file sent to a chat.
+type Attachment struct {
+	Path     string `json:"path"`
+	MimeType string `json:"mime_type,omitempty"`
+	Caption  string `json:"caption,omitempty"`
+}
+
+// Button is a quick reply offered with an outbound message.
+type Button struct {
+	Text string `json:"text"`
+	Data string `json:"data"`
 }
 
 type MessageHandler func(InboundMessage) error
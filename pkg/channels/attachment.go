@@ -0,0 +1,57 @@
+package channels
+
+import (
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// attachmentMimeType returns the attachment's MIME type, guessed from the
+// file extension when the sender did not set one.
+func attachmentMimeType(a bus.Attachment) string {
+	if a.MimeType != "" {
+		return a.MimeType
+	}
+	if t := mime.TypeByExtension(strings.ToLower(filepath.Ext(a.Path))); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// attachmentKind classifies an attachment as "image", "audio", "video" or
+// "file", which is how most chat APIs pick the upload method.
+func attachmentKind(a bus.Attachment) string {
+	mimeType := attachmentMimeType(a)
+	for _, kind := range []string{"image", "audio", "video"} {
+		if strings.HasPrefix(mimeType, kind+"/") {
+			return kind
+		}
+	}
+	return "file"
+}
+
+func attachmentName(a bus.Attachment) string {
+	return filepath.Base(a.Path)
+}
+
+// attachmentNotice is the text sent in place of a file the channel cannot
+// upload.
+func attachmentNotice(a bus.Attachment) string {
+	notice := fmt.Sprintf("[file: %s]", attachmentName(a))
+	if a.Caption != "" {
+		notice += " " + a.Caption
+	}
+	return notice
+}
+
+// withAttachmentNotices appends a notice for every attachment to content,
+// for channels that can only send text.
+func withAttachmentNotices(content string, attachments []bus.Attachment) string {
+	for _, a := range attachments {
+		content = appendContent(content, attachmentNotice(a))
+	}
+	return content
+}
@@ -0,0 +1,60 @@
+package channels
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestAttachmentKind(t *testing.T) {
+	tests := []struct {
+		attachment bus.Attachment
+		want       string
+	}{
+		{bus.Attachment{Path: "/tmp/a.png"}, "image"},
+		{bus.Attachment{Path: "/tmp/a.MP3"}, "audio"},
+		{bus.Attachment{Path: "/tmp/a.mp4"}, "video"},
+		{bus.Attachment{Path: "/tmp/report.pdf"}, "file"},
+		{bus.Attachment{Path: "/tmp/noext", MimeType: "image/jpeg"}, "image"},
+	}
+
+	for _, tt := range tests {
+		if got := attachmentKind(tt.attachment); got != tt.want {
+			t.Errorf("attachmentKind(%+v) = %q, want %q", tt.attachment, got, tt.want)
+		}
+	}
+}
+
+func TestWithAttachmentNotices(t *testing.T) {
+	got := withAttachmentNotices("Done.", []bus.Attachment{
+		{Path: "/ws/report.pdf", Caption: "Q3 report"},
+		{Path: "/ws/chart.png"},
+	})
+	want := "Done.\n[file: report.pdf] Q3 report\n[file: chart.png]"
+	if got != want {
+		t.Errorf("withAttachmentNotices() = %q, want %q", got, want)
+	}
+}
+
+func TestOneBotMessage_Attachments(t *testing.T) {
+	image := filepath.Join(t.TempDir(), "cat.png")
+	os.WriteFile(image, []byte("png"), 0644)
+
+	message := oneBotMessage(bus.OutboundMessage{
+		Content: "Here you go",
+		Attachments: []bus.Attachment{
+			{Path: image, Caption: "A cat"},
+			{Path: "/ws/notes.txt"},
+		},
+	})
+
+	if !strings.Contains(message, "A cat[CQ:image,file=base64://cG5n]") {
+		t.Errorf("Expected inlined image CQ code, got %q", message)
+	}
+	if !strings.Contains(message, "[file: notes.txt]") {
+		t.Errorf("Expected text notice for non-media file, got %q", message)
+	}
+}
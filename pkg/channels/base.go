@@ -2,10 +2,16 @@ package channels
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
 type Channel interface {
@@ -17,12 +23,22 @@ type Channel interface {
 	IsAllowed(senderID string) bool
 }
 
+// StreamingChannel is implemented by channels that can show a reply while it
+// is still being generated, usually by editing one message in place.
+// SendPartial receives the text generated so far; the following Send call
+// delivers the final content and should replace the partial message.
+type StreamingChannel interface {
+	Channel
+	SendPartial(ctx context.Context, msg bus.OutboundMessage) error
+}
+
 type BaseChannel struct {
 	config    interface{}
 	bus       *bus.MessageBus
 	running   bool
 	name      string
 	allowList []string
+	mediaDir  string
 }
 
 func NewBaseChannel(name string, config interface{}, bus *bus.MessageBus, allowList []string) *BaseChannel {
@@ -43,6 +59,13 @@ func (c *BaseChannel) IsRunning() bool {
 	return c.running
 }
 
+// SetMediaDir sets the directory inbound images are kept in. Channels delete
+// their downloads once a message is published, while the agent reads images
+// later and sessions keep referring to them.
+func (c *BaseChannel) SetMediaDir(dir string) {
+	c.mediaDir = dir
+}
+
 func (c *BaseChannel) IsAllowed(senderID string) bool {
 	if len(c.allowList) == 0 {
 		return true
@@ -87,22 +110,78 @@ func (c *BaseChannel) HandleMessage(senderID, chatID, content string, media []st
 		return
 	}
 
-	// Build session key: channel:chatID
-	sessionKey := fmt.Sprintf("%s:%s", c.name, chatID)
-
 	msg := bus.InboundMessage{
 		Channel:    c.name,
 		SenderID:   senderID,
 		ChatID:     chatID,
 		Content:    content,
-		Media:      media,
-		SessionKey: sessionKey,
+		Media:      c.keepMedia(media),
+		SessionKey: c.sessionKey(chatID, metadata["thread_id"]),
 		Metadata:   metadata,
 	}
 
 	c.bus.PublishInbound(msg)
 }
 
+// sessionKey builds the session key of a chat: "channel:chatID". Messages
+// in a thread or topic, whose ID channels put in the "thread_id" metadata,
+// get a session of their own, "channel:chatID:thread:threadID". Channels
+// address threads with chat IDs like "chatID/threadID"; the thread part is
+// not repeated in the key, which must not contain "/".
+func (c *BaseChannel) sessionKey(chatID, threadID string) string {
+	if threadID == "" {
+		return fmt.Sprintf("%s:%s", c.name, chatID)
+	}
+	chatID = strings.TrimSuffix(chatID, "/"+threadID)
+	return fmt.Sprintf("%s:%s:thread:%s", c.name, chatID, threadID)
+}
+
 func (c *BaseChannel) setRunning(running bool) {
 	c.running = running
 }
+
+// keepMedia copies image files into the media directory and returns the
+// media list with their new paths. Files are named by content hash, so the
+// same image sent twice is stored once.
+func (c *BaseChannel) keepMedia(media []string) []string {
+	if c.mediaDir == "" || len(media) == 0 {
+		return media
+	}
+
+	kept := make([]string, len(media))
+	for i, path := range media {
+		kept[i] = path
+		if !utils.IsImageFile(path, "") {
+			continue
+		}
+		if stored, err := c.storeMedia(path); err != nil {
+			logger.WarnCF(c.name, "Failed to keep image", map[string]interface{}{
+				"path":  path,
+				"error": err.Error(),
+			})
+		} else {
+			kept[i] = stored
+		}
+	}
+	return kept
+}
+
+func (c *BaseChannel) storeMedia(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(c.mediaDir, 0700); err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	stored := filepath.Join(c.mediaDir, hex.EncodeToString(sum[:16])+strings.ToLower(filepath.Ext(path)))
+	if _, err := os.Stat(stored); err == nil {
+		return stored, nil
+	}
+	if err := os.WriteFile(stored, data, 0600); err != nil {
+		return "", err
+	}
+	return stored, nil
+}
@@ -1,6 +1,12 @@
 package channels
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
 
 func TestBaseChannelIsAllowed(t *testing.T) {
 	tests := []struct {
@@ -50,3 +56,49 @@ func TestBaseChannelIsAllowed(t *testing.T) {
 		})
 	}
 }
+
+func TestBaseChannelKeepsImages(t *testing.T) {
+	tmp := t.TempDir()
+	photo := filepath.Join(tmp, "photo.jpg")
+	voice := filepath.Join(tmp, "voice.ogg")
+	os.WriteFile(photo, []byte("jpeg"), 0644)
+	os.WriteFile(voice, []byte("ogg"), 0644)
+
+	msgBus := bus.NewMessageBus()
+	ch := NewBaseChannel("test", nil, msgBus, nil)
+	mediaDir := filepath.Join(tmp, "media")
+	ch.SetMediaDir(mediaDir)
+
+	media := ch.keepMedia([]string{photo, voice})
+	if filepath.Dir(media[0]) != mediaDir || filepath.Ext(media[0]) != ".jpg" {
+		t.Errorf("Expected image to be copied to %s, got %s", mediaDir, media[0])
+	}
+	if media[1] != voice {
+		t.Errorf("Expected non-image media to be left alone, got %s", media[1])
+	}
+
+	os.Remove(photo)
+	if _, err := os.Stat(media[0]); err != nil {
+		t.Errorf("Kept image should outlive the download: %v", err)
+	}
+}
+
+func TestBaseChannelThreadSessionKey(t *testing.T) {
+	tests := []struct {
+		chatID   string
+		threadID string
+		want     string
+	}{
+		{"C123", "", "slack:C123"},
+		{"C123/1700000000.0001", "1700000000.0001", "slack:C123:thread:1700000000.0001"},
+		{"-100123", "", "slack:-100123"},
+		{"-100123/42", "42", "slack:-100123:thread:42"},
+	}
+
+	ch := NewBaseChannel("slack", nil, nil, nil)
+	for _, tt := range tests {
+		if got := ch.sessionKey(tt.chatID, tt.threadID); got != tt.want {
+			t.Errorf("sessionKey(%q, %q) = %q, want %q", tt.chatID, tt.threadID, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package channels
+
+import (
+	"strings"
+	"sync"
+)
+
+// CommandInfo describes a chat command such as /reset. Commands are handled
+// by the agent for every channel; channels with a native command UI, like
+// Telegram's command menu or Discord's slash commands, only offer them and
+// turn their use into a "/name args" message.
+type CommandInfo struct {
+	Name        string // without the leading "/"
+	Description string
+}
+
+// CommandChannel is implemented by channels with a native command UI.
+// SetCommands is called before Start.
+type CommandChannel interface {
+	Channel
+	SetCommands(commands []CommandInfo)
+}
+
+// commandList keeps the commands a CommandChannel offers.
+type commandList struct {
+	mu       sync.RWMutex
+	commands []CommandInfo
+}
+
+func (l *commandList) SetCommands(commands []CommandInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.commands = append([]CommandInfo(nil), commands...)
+}
+
+func (l *commandList) Commands() []CommandInfo {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return append([]CommandInfo(nil), l.commands...)
+}
+
+// hasCommand reports whether name, with or without a leading "/", is one
+// of the commands.
+func (l *commandList) hasCommand(name string) bool {
+	name = strings.ToLower(strings.TrimPrefix(name, "/"))
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, cmd := range l.commands {
+		if cmd.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mymmrac/telego/telegoapi"
+	"github.com/slack-go/slack"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// PartialSendError is returned by Send when the text of a message and its
+// first Attachments attachments were delivered before Err, so a retry
+// sends only the rest.
+type PartialSendError struct {
+	Attachments int
+	Err         error
+}
+
+func (e *PartialSendError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PartialSendError) Unwrap() error {
+	return e.Err
+}
+
+// undelivered returns the part of msg that a failed Send did not deliver.
+func undelivered(msg bus.OutboundMessage, err error) bus.OutboundMessage {
+	var partial *PartialSendError
+	if errors.As(err, &partial) {
+		msg.Content, msg.Buttons = "", nil
+		msg.Attachments = msg.Attachments[min(partial.Attachments, len(msg.Attachments)):]
+	}
+	return msg
+}
+
+// IsTransient reports whether a send error is worth retrying: timeouts,
+// dropped connections, rate limits and server errors. Anything else, such
+// as an unknown chat or a missing file, fails the same way every time.
+func IsTransient(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var rateLimited *slack.RateLimitedError
+	if errors.As(err, &rateLimited) {
+		return true
+	}
+	var slackStatus slack.StatusCodeError
+	if errors.As(err, &slackStatus) {
+		return transientStatus(slackStatus.Code)
+	}
+	var telegramErr *telegoapi.Error
+	if errors.As(err, &telegramErr) {
+		return transientStatus(telegramErr.ErrorCode)
+	}
+	var discordErr *discordgo.RESTError
+	if errors.As(err, &discordErr) && discordErr.Response != nil {
+		return transientStatus(discordErr.Response.StatusCode)
+	}
+	return false
+}
+
+func transientStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
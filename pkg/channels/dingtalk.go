@@ -108,13 +108,16 @@ func (c *DingTalkChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		return fmt.Errorf("invalid session_webhook type for chat %s", msg.ChatID)
 	}
 
+	// Session webhooks only take text and markdown, so files become notices.
+	content := withAttachmentNotices(msg.Content, msg.Attachments)
+
 	logger.DebugCF("dingtalk", "Sending message", map[string]interface{}{
 		"chat_id": msg.ChatID,
-		"preview": utils.Truncate(msg.Content, 100),
+		"preview": utils.Truncate(content, 100),
 	})
 
 	// Use the session webhook to send the reply
-	return c.SendDirectReply(ctx, sessionWebhook, msg.Content)
+	return c.SendDirectReply(ctx, sessionWebhook, content)
 }
 
 // onChatBotMessageReceived implements the IChatBotMessageHandler function signature
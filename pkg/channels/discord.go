@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
@@ -22,10 +23,12 @@ const (
 
 type DiscordChannel struct {
 	*BaseChannel
+	commandList
 	session     *discordgo.Session
 	config      config.DiscordConfig
 	transcriber *voice.GroqTranscriber
 	ctx         context.Context
+	streaming   sync.Map // channelID -> ID of the message being streamed
 }
 
 func NewDiscordChannel(cfg config.DiscordConfig, bus *bus.MessageBus) (*DiscordChannel, error) {
@@ -61,6 +64,7 @@ func (c *DiscordChannel) Start(ctx context.Context) error {
 
 	c.ctx = ctx
 	c.session.AddHandler(c.handleMessage)
+	c.session.AddHandler(c.handleInteraction)
 
 	if err := c.session.Open(); err != nil {
 		return fmt.Errorf("failed to open discord session: %w", err)
@@ -77,9 +81,103 @@ func (c *DiscordChannel) Start(ctx context.Context) error {
 		"user_id":  botUser.ID,
 	})
 
+	if err := c.registerCommands(botUser.ID); err != nil {
+		logger.WarnCF("discord", "Failed to register slash commands", map[string]any{
+			"error": err.Error(),
+		})
+	}
+
 	return nil
 }
 
+// Discord limits slash command descriptions to 100 characters.
+const maxDiscordCommandDetail = 100
+
+// registerCommands offers the agent's commands as global slash commands,
+// each with one optional "args" option for the rest of the command line.
+// Registering replaces the bot's previous commands.
+func (c *DiscordChannel) registerCommands(appID string) error {
+	commands := c.Commands()
+	if len(commands) == 0 {
+		return nil
+	}
+
+	appCommands := make([]*discordgo.ApplicationCommand, 0, len(commands))
+	for _, cmd := range commands {
+		appCommands = append(appCommands, &discordgo.ApplicationCommand{
+			Name:        cmd.Name,
+			Description: utils.Truncate(cmd.Description, maxDiscordCommandDetail),
+			Options: []*discordgo.ApplicationCommandOption{{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "args",
+				Description: "Arguments, as after the command in a message",
+			}},
+		})
+	}
+	_, err := c.session.ApplicationCommandBulkOverwrite(appID, "", appCommands)
+	return err
+}
+
+// handleInteraction passes a slash command to the agent as a "/name args"
+// message. The interaction is answered with the command line, and the
+// agent's reply follows as a regular message.
+func (c *DiscordChannel) handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i == nil || i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+
+	user := i.User
+	if i.Member != nil && i.Member.User != nil {
+		user = i.Member.User
+	}
+	if user == nil {
+		return
+	}
+
+	data := i.ApplicationCommandData()
+	content := "/" + data.Name
+	for _, opt := range data.Options {
+		if opt.Name == "args" {
+			content = strings.TrimSpace(content + " " + opt.StringValue())
+		}
+	}
+
+	// Discord shows an error unless the interaction is answered
+	response := &discordgo.InteractionResponseData{Content: content}
+	allowed := c.IsAllowed(user.ID)
+	if !allowed {
+		logger.DebugCF("discord", "Slash command rejected by allowlist", map[string]any{
+			"user_id": user.ID,
+		})
+		response = &discordgo.InteractionResponseData{
+			Content: "You are not allowed to use this bot.",
+			Flags:   discordgo.MessageFlagsEphemeral,
+		}
+	}
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: response,
+	}); err != nil {
+		logger.ErrorCF("discord", "Failed to answer slash command", map[string]any{
+			"error": err.Error(),
+		})
+	}
+	if !allowed {
+		return
+	}
+
+	metadata := map[string]string{
+		"user_id":    user.ID,
+		"username":   user.Username,
+		"guild_id":   i.GuildID,
+		"channel_id": i.ChannelID,
+		"is_dm":      fmt.Sprintf("%t", i.GuildID == ""),
+		"is_command": "true",
+	}
+
+	c.HandleMessage(user.ID, i.ChannelID, content, nil, metadata)
+}
+
 func (c *DiscordChannel) Stop(ctx context.Context) error {
 	logger.InfoC("discord", "Stopping Discord bot")
 	c.setRunning(false)
@@ -101,12 +199,40 @@ func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 		return fmt.Errorf("channel ID is empty")
 	}
 
-	runes := []rune(msg.Content)
+	if err := c.sendText(ctx, channelID, msg.Content); err != nil {
+		return err
+	}
+
+	for i, a := range msg.Attachments {
+		if err := c.sendAttachment(ctx, channelID, a); err != nil {
+			return &PartialSendError{Attachments: i, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// sendText delivers the text of a reply, replacing any streamed preview.
+func (c *DiscordChannel) sendText(ctx context.Context, channelID, content string) error {
+	runes := []rune(content)
 	if len(runes) == 0 {
 		return nil
 	}
 
-	chunks := splitMessage(msg.Content, 1500) // Discord has a limit of 2000 characters per message, leave 500 for natural split e.g. code blocks
+	chunks := splitMessage(content, 1500) // Discord has a limit of 2000 characters per message, leave 500 for natural split e.g. code blocks
+
+	// Replace a streamed preview: edit it when the reply fits, otherwise drop it
+	if previewID, ok := c.streaming.LoadAndDelete(channelID); ok {
+		if len(chunks) == 1 {
+			return c.withSendTimeout(ctx, func() error {
+				_, err := c.session.ChannelMessageEdit(channelID, previewID.(string), content)
+				return err
+			})
+		}
+		_ = c.withSendTimeout(ctx, func() error {
+			return c.session.ChannelMessageDelete(channelID, previewID.(string))
+		})
+	}
 
 	for _, chunk := range chunks {
 		if err := c.sendChunk(ctx, channelID, chunk); err != nil {
@@ -117,6 +243,31 @@ func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 	return nil
 }
 
+// sendAttachment uploads a file, with its caption as the message text.
+func (c *DiscordChannel) sendAttachment(ctx context.Context, channelID string, a bus.Attachment) error {
+	file, err := os.Open(a.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open attachment: %w", err)
+	}
+	defer file.Close()
+
+	err = c.withSendTimeout(ctx, func() error {
+		_, err := c.session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+			Content: utils.Truncate(a.Caption, 2000),
+			Files: []*discordgo.File{{
+				Name:        attachmentName(a),
+				ContentType: attachmentMimeType(a),
+				Reader:      file,
+			}},
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send discord attachment: %w", err)
+	}
+	return nil
+}
+
 // splitMessage splits long messages into chunks, preserving code block integrity
 // Uses natural boundaries (newlines, spaces) and extends messages slightly to avoid breaking code blocks
 func splitMessage(content string, limit int) []string {
@@ -265,6 +416,59 @@ func (c *DiscordChannel) sendChunk(ctx context.Context, channelID, content strin
 	}
 }
 
+// SendPartial implements StreamingChannel by sending one preview message
+// and editing it as more text arrives.
+func (c *DiscordChannel) SendPartial(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("discord bot not running")
+	}
+
+	channelID := msg.ChatID
+	if channelID == "" {
+		return fmt.Errorf("channel ID is empty")
+	}
+
+	// Keep the preview within one message by showing the most recent text
+	content := msg.Content
+	if runes := []rune(content); len(runes) > 1900 {
+		content = "…" + string(runes[len(runes)-1900:])
+	}
+
+	if previewID, ok := c.streaming.Load(channelID); ok {
+		return c.withSendTimeout(ctx, func() error {
+			_, err := c.session.ChannelMessageEdit(channelID, previewID.(string), content)
+			return err
+		})
+	}
+
+	return c.withSendTimeout(ctx, func() error {
+		sent, err := c.session.ChannelMessageSend(channelID, content)
+		if err != nil {
+			return err
+		}
+		c.streaming.Store(channelID, sent.ID)
+		return nil
+	})
+}
+
+// withSendTimeout runs a blocking Discord API call bounded by sendTimeout.
+func (c *DiscordChannel) withSendTimeout(ctx context.Context, fn func() error) error {
+	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-sendCtx.Done():
+		return fmt.Errorf("send message timeout: %w", sendCtx.Err())
+	}
+}
+
 // appendContent 安全地追加内容到现有文本
 func appendContent(content, suffix string) string {
 	if content == "" {
@@ -356,6 +560,15 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 				mediaPaths = append(mediaPaths, attachment.URL)
 				content = appendContent(content, fmt.Sprintf("[attachment: %s]", attachment.URL))
 			}
+		} else if utils.IsImageFile(attachment.Filename, attachment.ContentType) {
+			if localPath := c.downloadAttachment(attachment.URL, attachment.Filename); localPath != "" {
+				localFiles = append(localFiles, localPath)
+				mediaPaths = append(mediaPaths, localPath)
+				content = appendContent(content, fmt.Sprintf("[image: %s]", attachment.Filename))
+			} else {
+				mediaPaths = append(mediaPaths, attachment.URL)
+				content = appendContent(content, fmt.Sprintf("[attachment: %s]", attachment.URL))
+			}
 		} else {
 			mediaPaths = append(mediaPaths, attachment.URL)
 			content = appendContent(content, fmt.Sprintf("[attachment: %s]", attachment.URL))
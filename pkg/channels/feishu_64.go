@@ -6,6 +6,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -97,7 +100,27 @@ func (c *FeishuChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 		return fmt.Errorf("chat ID is empty")
 	}
 
-	payload, err := json.Marshal(map[string]string{"text": msg.Content})
+	if msg.Content != "" || len(msg.Attachments) == 0 {
+		if err := c.sendMessage(ctx, msg.ChatID, larkim.MsgTypeText, map[string]string{"text": msg.Content}); err != nil {
+			return err
+		}
+	}
+
+	for i, a := range msg.Attachments {
+		if err := c.sendAttachment(ctx, msg.ChatID, a); err != nil {
+			return &PartialSendError{Attachments: i, Err: err}
+		}
+	}
+
+	logger.DebugCF("feishu", "Feishu message sent", map[string]interface{}{
+		"chat_id": msg.ChatID,
+	})
+
+	return nil
+}
+
+func (c *FeishuChannel) sendMessage(ctx context.Context, chatID, msgType string, content map[string]string) error {
+	payload, err := json.Marshal(content)
 	if err != nil {
 		return fmt.Errorf("failed to marshal feishu content: %w", err)
 	}
@@ -105,8 +128,8 @@ func (c *FeishuChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 	req := larkim.NewCreateMessageReqBuilder().
 		ReceiveIdType(larkim.ReceiveIdTypeChatId).
 		Body(larkim.NewCreateMessageReqBodyBuilder().
-			ReceiveId(msg.ChatID).
-			MsgType(larkim.MsgTypeText).
+			ReceiveId(chatID).
+			MsgType(msgType).
 			Content(string(payload)).
 			Uuid(fmt.Sprintf("picoclaw-%d", time.Now().UnixNano())).
 			Build()).
@@ -121,13 +144,81 @@ func (c *FeishuChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 		return fmt.Errorf("feishu api error: code=%d msg=%s", resp.Code, resp.Msg)
 	}
 
-	logger.DebugCF("feishu", "Feishu message sent", map[string]interface{}{
-		"chat_id": msg.ChatID,
-	})
+	return nil
+}
+
+// sendAttachment uploads a file and sends it as an image or file message.
+// Feishu media messages carry no caption, so it follows as text.
+func (c *FeishuChannel) sendAttachment(ctx context.Context, chatID string, a bus.Attachment) error {
+	file, err := os.Open(a.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open attachment: %w", err)
+	}
+	defer file.Close()
+
+	if attachmentKind(a) == "image" {
+		resp, err := c.client.Im.V1.Image.Create(ctx, larkim.NewCreateImageReqBuilder().
+			Body(larkim.NewCreateImageReqBodyBuilder().
+				ImageType("message").
+				Image(file).
+				Build()).
+			Build())
+		if err != nil {
+			return fmt.Errorf("failed to upload feishu image: %w", err)
+		}
+		if !resp.Success() || resp.Data == nil || resp.Data.ImageKey == nil {
+			return fmt.Errorf("feishu image upload error: code=%d msg=%s", resp.Code, resp.Msg)
+		}
+		err = c.sendMessage(ctx, chatID, larkim.MsgTypeImage, map[string]string{"image_key": *resp.Data.ImageKey})
+		if err != nil {
+			return err
+		}
+	} else {
+		resp, err := c.client.Im.V1.File.Create(ctx, larkim.NewCreateFileReqBuilder().
+			Body(larkim.NewCreateFileReqBodyBuilder().
+				FileType(feishuFileType(a.Path)).
+				FileName(attachmentName(a)).
+				File(file).
+				Build()).
+			Build())
+		if err != nil {
+			return fmt.Errorf("failed to upload feishu file: %w", err)
+		}
+		if !resp.Success() || resp.Data == nil || resp.Data.FileKey == nil {
+			return fmt.Errorf("feishu file upload error: code=%d msg=%s", resp.Code, resp.Msg)
+		}
+		err = c.sendMessage(ctx, chatID, larkim.MsgTypeFile, map[string]string{"file_key": *resp.Data.FileKey})
+		if err != nil {
+			return err
+		}
+	}
 
+	if a.Caption != "" {
+		return c.sendMessage(ctx, chatID, larkim.MsgTypeText, map[string]string{"text": a.Caption})
+	}
 	return nil
 }
 
+// feishuFileType maps a file extension to the file_type the upload API expects.
+func feishuFileType(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".opus":
+		return "opus"
+	case ".mp4":
+		return "mp4"
+	case ".pdf":
+		return "pdf"
+	case ".doc", ".docx":
+		return "doc"
+	case ".xls", ".xlsx":
+		return "xls"
+	case ".ppt", ".pptx":
+		return "ppt"
+	default:
+		return "stream"
+	}
+}
+
 func (c *FeishuChannel) handleMessageReceive(_ context.Context, event *larkim.P2MessageReceiveV1) error {
 	if event == nil || event.Event == nil || event.Event.Message == nil {
 		return nil
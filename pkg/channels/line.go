@@ -486,6 +486,9 @@ func (c *LINEChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 		return fmt.Errorf("line channel not running")
 	}
 
+	// LINE only accepts media by public HTTPS URL, so files become notices.
+	content := withAttachmentNotices(msg.Content, msg.Attachments)
+
 	// Load and consume quote token for this chat
 	var quoteToken string
 	if qt, ok := c.quoteTokens.LoadAndDelete(msg.ChatID); ok {
@@ -496,7 +499,7 @@ func (c *LINEChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	if entry, ok := c.replyTokens.LoadAndDelete(msg.ChatID); ok {
 		tokenEntry := entry.(replyTokenEntry)
 		if time.Since(tokenEntry.timestamp) < lineReplyTokenMaxAge {
-			if err := c.sendReply(ctx, tokenEntry.token, msg.Content, quoteToken); err == nil {
+			if err := c.sendReply(ctx, tokenEntry.token, content, quoteToken); err == nil {
 				logger.DebugCF("line", "Message sent via Reply API", map[string]interface{}{
 					"chat_id": msg.ChatID,
 					"quoted":  quoteToken != "",
@@ -508,7 +511,7 @@ func (c *LINEChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	}
 
 	// Fall back to Push API
-	return c.sendPush(ctx, msg.ChatID, msg.Content, quoteToken)
+	return c.sendPush(ctx, msg.ChatID, content, quoteToken)
 }
 
 // buildTextMessage creates a text message object, optionally with quoteToken.
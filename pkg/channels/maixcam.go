@@ -217,7 +217,7 @@ func (c *MaixCamChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 	response := map[string]interface{}{
 		"type":      "command",
 		"timestamp": float64(0),
-		"message":   msg.Content,
+		"message":   withAttachmentNotices(msg.Content, msg.Attachments),
 		"chat_id":   msg.ChatID,
 	}
 
@@ -9,6 +9,7 @@ package channels
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"sync"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
@@ -23,6 +24,7 @@ type Manager struct {
 	config       *config.Config
 	workspace    string
 	dispatchTask *asyncTask
+	commands     []CommandInfo // offered by channels with a native command UI
 	mu           sync.RWMutex
 }
 
@@ -178,6 +180,15 @@ func (m *Manager) initChannels() error {
 		}
 	}
 
+	// Inbound images are kept in the workspace so the agent can still read
+	// them after the channel has cleaned up its download.
+	mediaDir := filepath.Join(m.workspace, "media")
+	for _, ch := range m.channels {
+		if mc, ok := ch.(interface{ SetMediaDir(dir string) }); ok {
+			mc.SetMediaDir(mediaDir)
+		}
+	}
+
 	logger.InfoCF("channels", "Channel initialization completed", map[string]interface{}{
 		"enabled_channels": len(m.channels),
 	})
@@ -260,6 +271,7 @@ func (m *Manager) dispatchOutbound(ctx context.Context) {
 
 			// Silently skip internal channels
 			if constants.IsInternalChannel(msg.Channel) {
+				m.bus.AckOutbound(msg)
 				continue
 			}
 
@@ -271,6 +283,20 @@ func (m *Manager) dispatchOutbound(ctx context.Context) {
 				logger.WarnCF("channels", "Unknown channel for outbound message", map[string]interface{}{
 					"channel": msg.Channel,
 				})
+				m.bus.AckOutbound(msg)
+				continue
+			}
+
+			if msg.Partial {
+				// Partial updates are best effort and only go to channels that can edit in place
+				if sc, ok := channel.(StreamingChannel); ok {
+					if err := sc.SendPartial(ctx, msg); err != nil {
+						logger.DebugCF("channels", "Error sending partial message to channel", map[string]interface{}{
+							"channel": msg.Channel,
+							"error":   err.Error(),
+						})
+					}
+				}
 				continue
 			}
 
@@ -279,7 +305,16 @@ func (m *Manager) dispatchOutbound(ctx context.Context) {
 					"channel": msg.Channel,
 					"error":   err.Error(),
 				})
+				if !IsTransient(err) {
+					m.bus.DeadLetterOutbound(msg, err)
+					continue
+				}
+				// The bus retries what was not delivered with backoff and
+				// dead-letters it eventually
+				m.bus.RetryOutbound(undelivered(msg, err), err)
+				continue
 			}
+			m.bus.AckOutbound(msg)
 		}
 	}
 }
@@ -319,9 +354,25 @@ func (m *Manager) GetEnabledChannels() []string {
 func (m *Manager) RegisterChannel(name string, channel Channel) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if cc, ok := channel.(CommandChannel); ok && m.commands != nil {
+		cc.SetCommands(m.commands)
+	}
 	m.channels[name] = channel
 }
 
+// SetCommands passes the agent's chat commands to the channels that offer
+// them in a native command UI.
+func (m *Manager) SetCommands(commands []CommandInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commands = commands
+	for _, channel := range m.channels {
+		if cc, ok := channel.(CommandChannel); ok {
+			cc.SetCommands(commands)
+		}
+	}
+}
+
 func (m *Manager) UnregisterChannel(name string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
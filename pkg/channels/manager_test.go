@@ -0,0 +1,140 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+type flakyChannel struct {
+	*BaseChannel
+	mu    sync.Mutex
+	sends []bus.OutboundMessage
+	fail  func(n int, msg bus.OutboundMessage) error
+}
+
+func (c *flakyChannel) Start(ctx context.Context) error { return nil }
+func (c *flakyChannel) Stop(ctx context.Context) error  { return nil }
+
+func (c *flakyChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sends = append(c.sends, msg)
+	return c.fail(len(c.sends), msg)
+}
+
+func (c *flakyChannel) sent() []bus.OutboundMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]bus.OutboundMessage(nil), c.sends...)
+}
+
+func TestManager_RetriesOnlyUndeliveredAttachments(t *testing.T) {
+	mb := bus.NewMessageBus()
+	ch := &flakyChannel{
+		BaseChannel: NewBaseChannel("flaky", nil, mb, nil),
+		fail: func(n int, msg bus.OutboundMessage) error {
+			if n == 1 {
+				// The text and the first file went out, the second upload dropped
+				return &PartialSendError{Attachments: 1, Err: fmt.Errorf("upload b.png: %w", syscall.ECONNRESET)}
+			}
+			return nil
+		},
+	}
+	m := &Manager{channels: map[string]Channel{"flaky": ch}, bus: mb}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.dispatchOutbound(ctx)
+
+	mb.PublishOutbound(bus.OutboundMessage{
+		Channel:     "flaky",
+		ChatID:      "1",
+		Content:     "Here are the charts",
+		Attachments: []bus.Attachment{{Path: "/ws/a.png"}, {Path: "/ws/b.png"}},
+	})
+
+	deadline := time.Now().Add(10 * time.Second)
+	for len(ch.sent()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	sends := ch.sent()
+	if len(sends) != 2 {
+		t.Fatalf("Expected 2 send attempts, got %d", len(sends))
+	}
+	retry := sends[1]
+	if retry.Content != "" {
+		t.Errorf("Retry resent the text %q", retry.Content)
+	}
+	if len(retry.Attachments) != 1 || retry.Attachments[0].Path != "/ws/b.png" {
+		t.Errorf("Retry attachments = %+v, want only /ws/b.png", retry.Attachments)
+	}
+}
+
+func TestManager_DeadLettersPermanentErrors(t *testing.T) {
+	mb, err := bus.NewDurableMessageBus(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewDurableMessageBus() error: %v", err)
+	}
+	defer mb.Close()
+
+	ch := &flakyChannel{
+		BaseChannel: NewBaseChannel("flaky", nil, mb, nil),
+		fail: func(n int, msg bus.OutboundMessage) error {
+			if len(msg.Attachments) > 0 {
+				return &PartialSendError{Err: fmt.Errorf("open report.pdf: %w", os.ErrNotExist)}
+			}
+			return nil
+		},
+	}
+	m := &Manager{channels: map[string]Channel{"flaky": ch}, bus: mb}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.dispatchOutbound(ctx)
+
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "flaky", ChatID: "1", Attachments: []bus.Attachment{{Path: "/ws/report.pdf"}}})
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "flaky", ChatID: "1", Content: "next"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(ch.sent()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	sends := ch.sent()
+	if len(sends) != 2 || sends[1].Content != "next" {
+		t.Fatalf("Expected the failed message to be dropped and the next one sent, got %+v", sends)
+	}
+	if stats := mb.Stats(); stats.DeadLetters != 1 {
+		t.Errorf("Stats().DeadLetters = %d, want 1", stats.DeadLetters)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{context.DeadlineExceeded, true},
+		{fmt.Errorf("post: %w", syscall.ECONNRESET), true},
+		{&PartialSendError{Attachments: 2, Err: syscall.EPIPE}, true},
+		{slack.StatusCodeError{Code: 503, Status: "503 Service Unavailable"}, true},
+		{slack.StatusCodeError{Code: 404, Status: "404 Not Found"}, false},
+		{fmt.Errorf("open: %w", os.ErrNotExist), false},
+		{errors.New("chat not found"), false},
+	}
+
+	for _, tt := range tests {
+		if got := IsTransient(tt.err); got != tt.want {
+			t.Errorf("IsTransient(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package channels
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -257,6 +259,7 @@ func (c *OneBotChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 
 func (c *OneBotChannel) buildSendRequest(msg bus.OutboundMessage) (string, interface{}, error) {
 	chatID := msg.ChatID
+	message := oneBotMessage(msg)
 
 	if len(chatID) > 6 && chatID[:6] == "group:" {
 		groupID, err := strconv.ParseInt(chatID[6:], 10, 64)
@@ -265,7 +268,7 @@ func (c *OneBotChannel) buildSendRequest(msg bus.OutboundMessage) (string, inter
 		}
 		return "send_group_msg", oneBotSendGroupMsgParams{
 			GroupID: groupID,
-			Message: msg.Content,
+			Message: message,
 		}, nil
 	}
 
@@ -276,7 +279,7 @@ func (c *OneBotChannel) buildSendRequest(msg bus.OutboundMessage) (string, inter
 		}
 		return "send_private_msg", oneBotSendPrivateMsgParams{
 			UserID:  userID,
-			Message: msg.Content,
+			Message: message,
 		}, nil
 	}
 
@@ -287,10 +290,54 @@ func (c *OneBotChannel) buildSendRequest(msg bus.OutboundMessage) (string, inter
 
 	return "send_private_msg", oneBotSendPrivateMsgParams{
 		UserID:  userID,
-		Message: msg.Content,
+		Message: message,
 	}, nil
 }
 
+// oneBotMaxInlineBytes bounds files inlined into a message as base64.
+const oneBotMaxInlineBytes = 10 << 20
+
+// oneBotMessage returns the message text with attachments appended as CQ
+// codes. Files are inlined as base64 so that the OneBot implementation does
+// not need to share a filesystem with picoclaw; files that have no CQ code
+// become text notices.
+func oneBotMessage(msg bus.OutboundMessage) string {
+	message := msg.Content
+	for _, a := range msg.Attachments {
+		var segment string
+		switch attachmentKind(a) {
+		case "image":
+			segment = "image"
+		case "audio":
+			segment = "record"
+		case "video":
+			segment = "video"
+		default:
+			message = appendContent(message, attachmentNotice(a))
+			continue
+		}
+
+		data, err := os.ReadFile(a.Path)
+		if err == nil && len(data) > oneBotMaxInlineBytes {
+			err = fmt.Errorf("file is larger than %d bytes", oneBotMaxInlineBytes)
+		}
+		if err != nil {
+			logger.WarnCF("onebot", "Cannot attach file", map[string]interface{}{
+				"path":  a.Path,
+				"error": err.Error(),
+			})
+			message = appendContent(message, attachmentNotice(a))
+			continue
+		}
+
+		if a.Caption != "" {
+			message = appendContent(message, a.Caption)
+		}
+		message += fmt.Sprintf("[CQ:%s,file=base64://%s]", segment, base64.StdEncoding.EncodeToString(data))
+	}
+	return message
+}
+
 func (c *OneBotChannel) listen() {
 	for {
 		select {
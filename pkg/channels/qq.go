@@ -116,9 +116,9 @@ func (c *QQChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 		return fmt.Errorf("QQ bot not running")
 	}
 
-	// 构造消息
+	// 构造消息（QQ 富媒体只能通过公网 URL 上传，附件以文本提示代替）
 	msgToCreate := &dto.MessageToCreate{
-		Content: msg.Content,
+		Content: withAttachmentNotices(msg.Content, msg.Attachments),
 	}
 
 	// C2C 消息发送
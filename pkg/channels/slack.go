@@ -21,6 +21,7 @@ import (
 
 type SlackChannel struct {
 	*BaseChannel
+	commandList
 	config       config.SlackConfig
 	api          *slack.Client
 	socketClient *socketmode.Client
@@ -29,6 +30,7 @@ type SlackChannel struct {
 	ctx          context.Context
 	cancel       context.CancelFunc
 	pendingAcks  sync.Map
+	streaming    sync.Map // chatID -> slackMessageRef of the message being streamed
 }
 
 type slackMessageRef struct {
@@ -125,9 +127,33 @@ func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 		opts = append(opts, slack.MsgOptionTS(threadTS))
 	}
 
-	_, _, err := c.api.PostMessageContext(ctx, channelID, opts...)
-	if err != nil {
-		return fmt.Errorf("failed to send slack message: %w", err)
+	if len(msg.Buttons) > 0 {
+		opts = append(opts, slack.MsgOptionBlocks(slackButtonBlocks(msg)...))
+		_, _, err := c.api.PostMessageContext(ctx, channelID, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to send slack message: %w", err)
+		}
+		return nil
+	}
+
+	// Replace a streamed preview with the final text when there is one
+	if ref, ok := c.streaming.LoadAndDelete(msg.ChatID); ok {
+		msgRef := ref.(slackMessageRef)
+		_, _, _, err := c.api.UpdateMessageContext(ctx, msgRef.ChannelID, msgRef.Timestamp, slack.MsgOptionText(msg.Content, false))
+		if err != nil {
+			return fmt.Errorf("failed to update slack message: %w", err)
+		}
+	} else if msg.Content != "" || len(msg.Attachments) == 0 {
+		_, _, err := c.api.PostMessageContext(ctx, channelID, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to send slack message: %w", err)
+		}
+	}
+
+	for i, a := range msg.Attachments {
+		if err := c.uploadAttachment(ctx, channelID, threadTS, a); err != nil {
+			return &PartialSendError{Attachments: i, Err: err}
+		}
 	}
 
 	if ref, ok := c.pendingAcks.LoadAndDelete(msg.ChatID); ok {
@@ -146,6 +172,62 @@ func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 	return nil
 }
 
+// uploadAttachment shares a file in the chat, with its caption as the
+// initial comment.
+func (c *SlackChannel) uploadAttachment(ctx context.Context, channelID, threadTS string, a bus.Attachment) error {
+	info, err := os.Stat(a.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read attachment: %w", err)
+	}
+
+	_, err = c.api.UploadFileV2Context(ctx, slack.UploadFileV2Parameters{
+		File:            a.Path,
+		FileSize:        int(info.Size()),
+		Filename:        attachmentName(a),
+		Title:           attachmentName(a),
+		InitialComment:  a.Caption,
+		Channel:         channelID,
+		ThreadTimestamp: threadTS,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload slack file: %w", err)
+	}
+	return nil
+}
+
+// SendPartial implements StreamingChannel by posting one message and
+// updating it as more text arrives.
+func (c *SlackChannel) SendPartial(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("slack channel not running")
+	}
+
+	channelID, threadTS := parseSlackChatID(msg.ChatID)
+	if channelID == "" {
+		return fmt.Errorf("invalid slack chat ID: %s", msg.ChatID)
+	}
+
+	if ref, ok := c.streaming.Load(msg.ChatID); ok {
+		msgRef := ref.(slackMessageRef)
+		_, _, _, err := c.api.UpdateMessageContext(ctx, msgRef.ChannelID, msgRef.Timestamp, slack.MsgOptionText(msg.Content, false))
+		return err
+	}
+
+	opts := []slack.MsgOption{
+		slack.MsgOptionText(msg.Content, false),
+	}
+	if threadTS != "" {
+		opts = append(opts, slack.MsgOptionTS(threadTS))
+	}
+
+	respChannel, ts, err := c.api.PostMessageContext(ctx, channelID, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to send slack message: %w", err)
+	}
+	c.streaming.Store(msg.ChatID, slackMessageRef{ChannelID: respChannel, Timestamp: ts})
+	return nil
+}
+
 func (c *SlackChannel) eventLoop() {
 	for {
 		select {
@@ -161,14 +243,66 @@ func (c *SlackChannel) eventLoop() {
 			case socketmode.EventTypeSlashCommand:
 				c.handleSlashCommand(event)
 			case socketmode.EventTypeInteractive:
-				if event.Request != nil {
-					c.socketClient.Ack(*event.Request)
-				}
+				c.handleInteractive(event)
 			}
 		}
 	}
 }
 
+// slackButtonBlocks lays out the text of msg with its buttons below it.
+func slackButtonBlocks(msg bus.OutboundMessage) []slack.Block {
+	elements := make([]slack.BlockElement, len(msg.Buttons))
+	for i, b := range msg.Buttons {
+		elements[i] = slack.NewButtonBlockElement(fmt.Sprintf("button_%d", i), b.Data,
+			slack.NewTextBlockObject(slack.PlainTextType, b.Text, false, false))
+	}
+	return []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, msg.Content, false, false), nil, nil),
+		slack.NewActionBlock("buttons", elements...),
+	}
+}
+
+// handleInteractive passes a pressed button to the agent as a message with
+// the button's value.
+func (c *SlackChannel) handleInteractive(event socketmode.Event) {
+	if event.Request != nil {
+		c.socketClient.Ack(*event.Request)
+	}
+
+	callback, ok := event.Data.(slack.InteractionCallback)
+	if !ok || callback.Type != slack.InteractionTypeBlockActions {
+		return
+	}
+	if !c.IsAllowed(callback.User.ID) {
+		logger.DebugCF("slack", "Button press rejected by allowlist", map[string]interface{}{
+			"user_id": callback.User.ID,
+		})
+		return
+	}
+
+	channelID := callback.Container.ChannelID
+	if channelID == "" {
+		channelID = callback.Channel.ID
+	}
+	chatID := channelID
+	if callback.Container.ThreadTs != "" {
+		chatID = channelID + "/" + callback.Container.ThreadTs
+	}
+
+	for _, action := range callback.ActionCallback.BlockActions {
+		if action.Value == "" {
+			continue
+		}
+		metadata := map[string]string{
+			"channel_id": channelID,
+			"thread_id":  callback.Container.ThreadTs,
+			"platform":   "slack",
+			"callback":   "true",
+		}
+		c.HandleMessage(callback.User.ID, chatID, action.Value, nil, metadata)
+	}
+}
+
 func (c *SlackChannel) handleEventsAPI(event socketmode.Event) {
 	if event.Request != nil {
 		c.socketClient.Ack(*event.Request)
@@ -278,6 +412,7 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 		"message_ts": messageTS,
 		"channel_id": channelID,
 		"thread_ts":  threadTS,
+		"thread_id":  threadTS,
 		"platform":   "slack",
 	}
 
@@ -308,12 +443,12 @@ func (c *SlackChannel) handleAppMention(ev *slackevents.AppMentionEvent) {
 	threadTS := ev.ThreadTimeStamp
 	messageTS := ev.TimeStamp
 
-	var chatID string
-	if threadTS != "" {
-		chatID = channelID + "/" + threadTS
-	} else {
-		chatID = channelID + "/" + messageTS
+	// Replies to a mention start a thread under it
+	threadID := threadTS
+	if threadID == "" {
+		threadID = messageTS
 	}
+	chatID := channelID + "/" + threadID
 
 	c.api.AddReaction("eyes", slack.ItemRef{
 		Channel:   channelID,
@@ -335,6 +470,7 @@ func (c *SlackChannel) handleAppMention(ev *slackevents.AppMentionEvent) {
 		"message_ts": messageTS,
 		"channel_id": channelID,
 		"thread_ts":  threadTS,
+		"thread_id":  threadID,
 		"platform":   "slack",
 		"is_mention": "true",
 	}
@@ -362,11 +498,7 @@ func (c *SlackChannel) handleSlashCommand(event socketmode.Event) {
 	senderID := cmd.UserID
 	channelID := cmd.ChannelID
 	chatID := channelID
-	content := cmd.Text
-
-	if strings.TrimSpace(content) == "" {
-		content = "help"
-	}
+	content := c.slashCommandText(cmd.Command, cmd.Text)
 
 	metadata := map[string]string{
 		"channel_id": channelID,
@@ -384,6 +516,25 @@ func (c *SlackChannel) handleSlashCommand(event socketmode.Event) {
 	c.HandleMessage(senderID, chatID, content, nil, metadata)
 }
 
+// slashCommandText turns a slash command into the message the agent
+// handles. A command named like an agent command ("/reset now") is passed
+// on as it is. For any other command, such as a general "/picoclaw", the
+// text is a command when it starts with a command name ("/picoclaw reset"
+// becomes "/reset") and a regular message otherwise.
+func (c *SlackChannel) slashCommandText(command, text string) string {
+	text = strings.TrimSpace(text)
+	if c.hasCommand(command) {
+		return strings.TrimSpace(strings.ToLower(command) + " " + text)
+	}
+	if text == "" {
+		return "/help"
+	}
+	if first := strings.Fields(text)[0]; c.hasCommand(first) {
+		return "/" + strings.TrimPrefix(text, "/")
+	}
+	return text
+}
+
 func (c *SlackChannel) downloadSlackFile(file slack.File) string {
 	downloadURL := file.URLPrivateDownload
 	if downloadURL == "" {
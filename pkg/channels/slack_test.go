@@ -172,3 +172,24 @@ func TestSlackChannelIsAllowed(t *testing.T) {
 		}
 	})
 }
+
+func TestSlackChannel_SlashCommandText(t *testing.T) {
+	c := &SlackChannel{}
+	c.SetCommands([]CommandInfo{{Name: "reset"}, {Name: "session"}, {Name: "help"}})
+
+	tests := []struct {
+		command, text, want string
+	}{
+		{"/reset", "", "/reset"},
+		{"/session", " list ", "/session list"},
+		{"/picoclaw", "", "/help"},
+		{"/picoclaw", "session switch 2", "/session switch 2"},
+		{"/picoclaw", "/reset", "/reset"},
+		{"/picoclaw", "what's the weather?", "what's the weather?"},
+	}
+	for _, tt := range tests {
+		if got := c.slashCommandText(tt.command, tt.text); got != tt.want {
+			t.Errorf("slashCommandText(%q, %q) = %q, want %q", tt.command, tt.text, got, tt.want)
+		}
+	}
+}
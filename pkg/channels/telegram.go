@@ -20,16 +20,14 @@ import (
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/logger"
-	"github.com/sipeed/picoclaw/pkg/session"
 	"github.com/sipeed/picoclaw/pkg/utils"
 	"github.com/sipeed/picoclaw/pkg/voice"
 )
 
 type TelegramChannel struct {
 	*BaseChannel
+	commandList
 	bot             *telego.Bot
-	commands        TelegramCommander
-	cmdRegistry     *CommandRegistry
 	streamingSender *StreamingSender
 	config          *config.Config
 	chatIDs         map[string]int64
@@ -70,10 +68,7 @@ func NewTelegramChannel(cfg *config.Config, bus *bus.MessageBus, workspace strin
 	}
 
 	base := NewBaseChannel("telegram", telegramCfg, bus, telegramCfg.AllowFrom)
-	
-	// Create command registry
-	cmdRegistry := NewCommandRegistry(bot, cfg, workspace)
-	
+
 	// Create streaming sender optimized for multi-core systems
 	streamingConfig := DefaultStreamingConfig()
 	streamingConfig.ParallelWorkers = 4 // Use 4 workers for your 6 cores
@@ -81,8 +76,6 @@ func NewTelegramChannel(cfg *config.Config, bus *bus.MessageBus, workspace strin
 
 	return &TelegramChannel{
 		BaseChannel:     base,
-		commands:        &cmdAdapter{registry: cmdRegistry},
-		cmdRegistry:     cmdRegistry,
 		streamingSender: streamingSender,
 		bot:             bot,
 		config:          cfg,
@@ -100,7 +93,7 @@ func (c *TelegramChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
 // startThinking starts the typing indicator
 // Similar to OpenClaw's behavior - shows "bot is typing..." in Telegram
 // No placeholder message is sent, just the native typing indicator
-func (c *TelegramChannel) startThinking(ctx context.Context, chatID int64, chatIDStr string) {
+func (c *TelegramChannel) startThinking(ctx context.Context, chatID int64, threadID int, chatIDStr string) {
 	// Stop any previous thinking animation
 	if prevStop, ok := c.stopThinking.Load(chatIDStr); ok {
 		if cf, ok := prevStop.(*thinkingCancel); ok && cf != nil {
@@ -114,7 +107,7 @@ func (c *TelegramChannel) startThinking(ctx context.Context, chatID int64, chatI
 
 	// Send typing action (shows "typing..." in chat header)
 	// This is the native Telegram typing indicator
-	err := c.bot.SendChatAction(ctx, tu.ChatAction(tu.ID(chatID), telego.ChatActionTyping))
+	err := c.bot.SendChatAction(ctx, tu.ChatAction(tu.ID(chatID), telego.ChatActionTyping).WithMessageThreadID(threadID))
 	if err != nil {
 		logger.DebugCF("telegram", "Failed to send typing action", map[string]interface{}{
 			"error": err.Error(),
@@ -132,7 +125,7 @@ func (c *TelegramChannel) startThinking(ctx context.Context, chatID int64, chatI
 			case <-ticker.C:
 				// Check if still thinking
 				if _, ok := c.stopThinking.Load(chatIDStr); ok {
-					_ = c.bot.SendChatAction(ctx, tu.ChatAction(tu.ID(chatID), telego.ChatActionTyping))
+					_ = c.bot.SendChatAction(ctx, tu.ChatAction(tu.ID(chatID), telego.ChatActionTyping).WithMessageThreadID(threadID))
 				} else {
 					return
 				}
@@ -143,41 +136,16 @@ func (c *TelegramChannel) startThinking(ctx context.Context, chatID int64, chatI
 	}()
 }
 
-// loadCustomCommands loads custom commands from config
-func (c *TelegramChannel) loadCustomCommands() {
-	if c.cmdRegistry == nil {
-		return
-	}
-	
-	// Custom commands can be added here from config
-	// For now, we'll just log that the registry is ready
-	logger.DebugCF("telegram", "Command registry ready", map[string]interface{}{
-		"native_commands": len(c.cmdRegistry.native),
-	})
-}
-
-// SetSessionManager sets the session manager for the command registry
-func (c *TelegramChannel) SetSessionManager(sm *session.SessionManager) {
-	if c.cmdRegistry != nil {
-		c.cmdRegistry.SetSessionManager(sm)
-	}
-}
-
 func (c *TelegramChannel) Start(ctx context.Context) error {
 	logger.InfoC("telegram", "Starting Telegram bot (polling mode)...")
 
-	// Load custom commands from config
-	c.loadCustomCommands()
-
-	// Sync command menu with Telegram
-	if c.cmdRegistry != nil {
-		if err := c.cmdRegistry.SyncMenuCommands(ctx); err != nil {
-			logger.WarnCF("telegram", "Failed to sync menu commands", map[string]interface{}{
-				"error": err.Error(),
-			})
-		} else {
-			logger.InfoC("telegram", "Menu commands synced successfully")
-		}
+	// Offer the agent's commands in Telegram's command menu
+	if err := c.syncMenuCommands(ctx); err != nil {
+		logger.WarnCF("telegram", "Failed to sync menu commands", map[string]interface{}{
+			"error": err.Error(),
+		})
+	} else {
+		logger.InfoC("telegram", "Menu commands synced successfully")
 	}
 
 	updates, err := c.bot.UpdatesViaLongPolling(ctx, &telego.GetUpdatesParams{
@@ -192,40 +160,10 @@ func (c *TelegramChannel) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to create bot handler: %w", err)
 	}
 
-	// Basic commands
-	bh.HandleMessage(func(ctx *th.Context, message telego.Message) error {
-		c.commands.Help(ctx, message)
-		return nil
-	}, th.CommandEqual("help"))
-	bh.HandleMessage(func(ctx *th.Context, message telego.Message) error {
-		return c.commands.Start(ctx, message)
-	}, th.CommandEqual("start"))
-
-	// Config commands
-	bh.HandleMessage(func(ctx *th.Context, message telego.Message) error {
-		return c.commands.Show(ctx, message)
-	}, th.CommandEqual("show"))
-	bh.HandleMessage(func(ctx *th.Context, message telego.Message) error {
-		return c.commands.List(ctx, message)
-	}, th.CommandEqual("list"))
-
-	// Session management
-	bh.HandleMessage(func(ctx *th.Context, message telego.Message) error {
-		return c.commands.Reset(ctx, message)
-	}, th.CommandEqual("reset"))
-	bh.HandleMessage(func(ctx *th.Context, message telego.Message) error {
-		return c.commands.Session(ctx, message)
-	}, th.CommandEqual("session"))
-
-	// Model commands
-	bh.HandleMessage(func(ctx *th.Context, message telego.Message) error {
-		return c.commands.Model(ctx, message)
-	}, th.CommandEqual("model"))
-
-	// Status command
-	bh.HandleMessage(func(ctx *th.Context, message telego.Message) error {
-		return c.commands.Status(ctx, message)
-	}, th.CommandEqual("status"))
+	// Inline buttons, such as the answers to an approval request
+	bh.HandleCallbackQuery(func(ctx *th.Context, query telego.CallbackQuery) error {
+		return c.handleCallbackQuery(ctx, query)
+	}, th.AnyCallbackQueryWithMessage())
 
 	// Handle regular messages
 	bh.HandleMessage(func(ctx *th.Context, message telego.Message) error {
@@ -257,6 +195,7 @@ const (
 	telegramMaxMessageLength      = 4096
 	telegramMaxMessageLengthSafe  = 4000  // Leave some margin for HTML formatting
 	telegramMaxTotalContentLength = 50000 // Absolute max before heavy truncation (50KB)
+	telegramMaxCaptionLength      = 1024
 )
 
 func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
@@ -264,7 +203,7 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		return fmt.Errorf("telegram bot not running")
 	}
 
-	chatID, err := parseChatID(msg.ChatID)
+	chatID, threadID, err := parseChatID(msg.ChatID)
 	if err != nil {
 		return fmt.Errorf("invalid chat ID: %w", err)
 	}
@@ -277,7 +216,81 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		c.stopThinking.Delete(msg.ChatID)
 	}
 
+	if len(msg.Buttons) > 0 {
+		if err := c.sendWithButtons(ctx, chatID, threadID, msg); err != nil {
+			return err
+		}
+	} else if err := c.sendText(ctx, chatID, threadID, msg); err != nil {
+		return err
+	}
+	return c.sendAttachments(ctx, chatID, threadID, msg.Attachments)
+}
+
+// sendWithButtons sends the text of msg as a new message with its buttons
+// as an inline keyboard. The placeholder is left for the reply that follows.
+func (c *TelegramChannel) sendWithButtons(ctx context.Context, chatID int64, threadID int, msg bus.OutboundMessage) error {
+	buttons := make([]telego.InlineKeyboardButton, len(msg.Buttons))
+	for i, b := range msg.Buttons {
+		buttons[i] = tu.InlineKeyboardButton(b.Text).WithCallbackData(b.Data)
+	}
+	tgMsg := tu.Message(tu.ID(chatID), cleanTelegramText(msg.Content)).
+		WithMessageThreadID(threadID).
+		WithReplyMarkup(tu.InlineKeyboard(tu.InlineKeyboardRow(buttons...)))
+	_, err := c.bot.SendMessage(ctx, tgMsg)
+	return err
+}
+
+// handleCallbackQuery passes a pressed inline button to the agent as a
+// message with the button's data, and removes the keyboard so it is not
+// pressed twice.
+func (c *TelegramChannel) handleCallbackQuery(ctx context.Context, query telego.CallbackQuery) error {
+	_ = c.bot.AnswerCallbackQuery(ctx, tu.CallbackQuery(query.ID))
+
+	if query.Message == nil || query.Data == "" {
+		return nil
+	}
+
+	senderID := fmt.Sprintf("%d", query.From.ID)
+	if query.From.Username != "" {
+		senderID = fmt.Sprintf("%d|%s", query.From.ID, query.From.Username)
+	}
+	if !c.IsAllowed(senderID) {
+		logger.DebugCF("telegram", "Button press rejected by allowlist", map[string]interface{}{
+			"user_id": senderID,
+		})
+		return nil
+	}
+
+	chat := query.Message.GetChat()
+	_, _ = c.bot.EditMessageReplyMarkup(ctx, tu.EditMessageReplyMarkup(tu.ID(chat.ID), query.Message.GetMessageID(), nil))
+
+	metadata := map[string]string{
+		"user_id":  fmt.Sprintf("%d", query.From.ID),
+		"username": query.From.Username,
+		"is_group": fmt.Sprintf("%t", chat.Type != "private"),
+		"callback": "true",
+	}
+	chatIDStr := fmt.Sprintf("%d", chat.ID)
+	if threadID := topicID(query.Message.Message()); threadID != 0 {
+		chatIDStr = fmt.Sprintf("%d/%d", chat.ID, threadID)
+		metadata["thread_id"] = fmt.Sprintf("%d", threadID)
+	}
+	c.HandleMessage(fmt.Sprintf("%d", query.From.ID), chatIDStr, query.Data, nil, metadata)
+	return nil
+}
+
+// sendText delivers the text of a reply, replacing the chat's placeholder.
+func (c *TelegramChannel) sendText(ctx context.Context, chatID int64, threadID int, msg bus.OutboundMessage) error {
+	var err error
+
 	content := msg.Content
+	if content == "" && len(msg.Attachments) > 0 {
+		// Files only: the uploads replace the placeholder.
+		if pID, ok := c.placeholders.LoadAndDelete(msg.ChatID); ok {
+			_ = c.bot.DeleteMessage(ctx, tu.Delete(tu.ID(chatID), pID.(int)))
+		}
+		return nil
+	}
 	
 	// Clean up the content - remove markdown/html artifacts for plain text
 	content = cleanTelegramText(content)
@@ -288,7 +301,11 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 			"content_length": len(content),
 			"chat_id":        msg.ChatID,
 		})
-		return c.streamingSender.SendLargeMessageParallel(ctx, chatID, content)
+		// A streamed preview cannot hold the full text, so replace it with the chunks
+		if pID, ok := c.placeholders.LoadAndDelete(msg.ChatID); ok {
+			_ = c.bot.DeleteMessage(ctx, tu.Delete(tu.ID(chatID), pID.(int)))
+		}
+		return c.streamingSender.SendLargeMessageParallel(ctx, chatID, threadID, content)
 	}
 
 	// Try to edit placeholder first
@@ -303,12 +320,82 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 	}
 
 	// Send as plain text (no HTML/Markdown parsing)
-	tgMsg := tu.Message(tu.ID(chatID), content)
+	tgMsg := tu.Message(tu.ID(chatID), content).WithMessageThreadID(threadID)
 	// ParseMode empty = plain text
 	_, err = c.bot.SendMessage(ctx, tgMsg)
 	return err
 }
 
+// sendAttachments uploads files with the Telegram method matching their type.
+func (c *TelegramChannel) sendAttachments(ctx context.Context, chatID int64, threadID int, attachments []bus.Attachment) error {
+	for i, a := range attachments {
+		if err := c.sendAttachment(ctx, chatID, threadID, a); err != nil {
+			return &PartialSendError{Attachments: i, Err: fmt.Errorf("failed to send %s: %w", attachmentName(a), err)}
+		}
+	}
+	return nil
+}
+
+func (c *TelegramChannel) sendAttachment(ctx context.Context, chatID int64, threadID int, a bus.Attachment) error {
+	file, err := os.Open(a.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	id := tu.ID(chatID)
+	input := tu.File(file)
+	caption := utils.Truncate(a.Caption, telegramMaxCaptionLength)
+
+	switch attachmentKind(a) {
+	case "image":
+		_, err = c.bot.SendPhoto(ctx, tu.Photo(id, input).WithCaption(caption).WithMessageThreadID(threadID))
+	case "audio":
+		_, err = c.bot.SendAudio(ctx, tu.Audio(id, input).WithCaption(caption).WithMessageThreadID(threadID))
+	case "video":
+		_, err = c.bot.SendVideo(ctx, tu.Video(id, input).WithCaption(caption).WithMessageThreadID(threadID))
+	default:
+		_, err = c.bot.SendDocument(ctx, tu.Document(id, input).WithCaption(caption).WithMessageThreadID(threadID))
+	}
+	return err
+}
+
+// SendPartial implements StreamingChannel. The first update sends a new
+// message and remembers it as the placeholder; later updates edit it, and
+// Send finally replaces it with the complete reply.
+func (c *TelegramChannel) SendPartial(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("telegram bot not running")
+	}
+
+	chatID, threadID, err := parseChatID(msg.ChatID)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+
+	content := cleanTelegramText(msg.Content)
+	if content == "" {
+		return nil
+	}
+
+	// Keep the preview within one message by showing the most recent text
+	if runes := []rune(content); len(runes) > telegramMaxMessageLengthSafe {
+		content = "…" + string(runes[len(runes)-telegramMaxMessageLengthSafe:])
+	}
+
+	if pID, ok := c.placeholders.Load(msg.ChatID); ok {
+		_, err = c.bot.EditMessageText(ctx, tu.EditMessageText(tu.ID(chatID), pID.(int), content))
+		return err
+	}
+
+	sent, err := c.bot.SendMessage(ctx, tu.Message(tu.ID(chatID), content).WithMessageThreadID(threadID))
+	if err != nil {
+		return err
+	}
+	c.placeholders.Store(msg.ChatID, sent.MessageID)
+	return nil
+}
+
 // sendSplitMessages splits a long message into multiple Telegram messages
 func (c *TelegramChannel) sendSplitMessages(ctx context.Context, chatID int64, content string) error {
 	// Split by paragraphs first to keep context
@@ -444,7 +531,8 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 	}()
 
 	if message.Text != "" {
-		content += message.Text
+		// Commands are handled by the agent like for any other channel
+		content += telegramCommandText(message.Text, c.bot.Username())
 	}
 
 	if message.Caption != "" {
@@ -539,7 +627,11 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 	// Start thinking indicator (typing animation + placeholder message)
 	// This mimics OpenClaw's behavior - shows the bot is "typing"
 	chatIDStr := fmt.Sprintf("%d", chatID)
-	c.startThinking(ctx, chatID, chatIDStr)
+	threadID := topicID(message)
+	if threadID != 0 {
+		chatIDStr = fmt.Sprintf("%d/%d", chatID, threadID)
+	}
+	c.startThinking(ctx, chatID, threadID, chatIDStr)
 
 	metadata := map[string]string{
 		"message_id": fmt.Sprintf("%d", message.MessageID),
@@ -548,8 +640,11 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 		"first_name": user.FirstName,
 		"is_group":   fmt.Sprintf("%t", message.Chat.Type != "private"),
 	}
+	if threadID != 0 {
+		metadata["thread_id"] = fmt.Sprintf("%d", threadID)
+	}
 
-	c.HandleMessage(fmt.Sprintf("%d", user.ID), fmt.Sprintf("%d", chatID), content, mediaPaths, metadata)
+	c.HandleMessage(fmt.Sprintf("%d", user.ID), chatIDStr, content, mediaPaths, metadata)
 	return nil
 }
 
@@ -592,10 +687,30 @@ func (c *TelegramChannel) downloadFile(ctx context.Context, fileID, ext string)
 	return c.downloadFileWithInfo(file, ext)
 }
 
-func parseChatID(chatIDStr string) (int64, error) {
+// parseChatID splits a chat ID into the Telegram chat and, for forum topics
+// ("chat/topic"), the topic's message thread.
+func parseChatID(chatIDStr string) (int64, int, error) {
+	chatPart, threadPart, inTopic := strings.Cut(chatIDStr, "/")
 	var id int64
-	_, err := fmt.Sscanf(chatIDStr, "%d", &id)
-	return id, err
+	if _, err := fmt.Sscanf(chatPart, "%d", &id); err != nil {
+		return 0, 0, err
+	}
+	var threadID int
+	if inTopic {
+		if _, err := fmt.Sscanf(threadPart, "%d", &threadID); err != nil {
+			return 0, 0, err
+		}
+	}
+	return id, threadID, nil
+}
+
+// topicID returns the forum topic a message was sent in, or 0. Replies in
+// groups without topics also carry a thread ID, which is ignored.
+func topicID(message *telego.Message) int {
+	if message == nil || !message.IsTopicMessage {
+		return 0
+	}
+	return message.MessageThreadID
 }
 
 // cleanTelegramText removes markdown/html artifacts for plain text output
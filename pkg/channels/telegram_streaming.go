@@ -49,14 +49,14 @@ func NewStreamingSender(bot *telego.Bot, config StreamingConfig) *StreamingSende
 
 // SendLargeMessage sends a large message using streaming/chunking
 // This method uses parallel processing for better performance on multi-core systems
-func (s *StreamingSender) SendLargeMessage(ctx context.Context, chatID int64, content string) error {
+func (s *StreamingSender) SendLargeMessage(ctx context.Context, chatID int64, threadID int, content string) error {
 	if !s.config.Enabled {
-		return s.sendSimple(ctx, chatID, content)
+		return s.sendSimple(ctx, chatID, threadID, content)
 	}
 
 	// If content is small enough, send normally
 	if len(content) <= s.config.ChunkSize {
-		return s.sendSimple(ctx, chatID, content)
+		return s.sendSimple(ctx, chatID, threadID, content)
 	}
 
 	// Split content into chunks
@@ -80,7 +80,7 @@ func (s *StreamingSender) SendLargeMessage(ctx context.Context, chatID int64, co
 
 	// Send chunks with rate limiting
 	for i, chunk := range chunks {
-		if err := s.sendChunk(ctx, chatID, chunk, i+1, len(chunks)); err != nil {
+		if err := s.sendChunk(ctx, chatID, threadID, chunk, i+1, len(chunks)); err != nil {
 			return fmt.Errorf("failed to send chunk %d/%d: %w", i+1, len(chunks), err)
 		}
 		
@@ -95,9 +95,9 @@ func (s *StreamingSender) SendLargeMessage(ctx context.Context, chatID int64, co
 
 // SendLargeMessageParallel sends chunks in parallel for better performance
 // Uses worker pool pattern for multi-core systems
-func (s *StreamingSender) SendLargeMessageParallel(ctx context.Context, chatID int64, content string) error {
+func (s *StreamingSender) SendLargeMessageParallel(ctx context.Context, chatID int64, threadID int, content string) error {
 	if !s.config.Enabled || len(content) <= s.config.ChunkSize {
-		return s.sendSimple(ctx, chatID, content)
+		return s.sendSimple(ctx, chatID, threadID, content)
 	}
 
 	chunks := s.splitIntoChunks(content)
@@ -109,7 +109,7 @@ func (s *StreamingSender) SendLargeMessageParallel(ctx context.Context, chatID i
 
 	// For small number of chunks, sequential is faster
 	if len(chunks) <= 3 {
-		return s.SendLargeMessage(ctx, chatID, content)
+		return s.SendLargeMessage(ctx, chatID, threadID, content)
 	}
 
 	logger.InfoCF("telegram", "Streaming message (parallel)", map[string]interface{}{
@@ -146,7 +146,7 @@ func (s *StreamingSender) SendLargeMessageParallel(ctx context.Context, chatID i
 		go func() {
 			defer wg.Done()
 			for chunk := range chunkChan {
-				err := s.sendChunk(ctx, chatID, chunk.data, chunk.index+1, len(chunks))
+				err := s.sendChunk(ctx, chatID, threadID, chunk.data, chunk.index+1, len(chunks))
 				resultChan <- chunkResult{index: chunk.index, err: err}
 			}
 		}()
@@ -227,7 +227,7 @@ func (s *StreamingSender) splitIntoChunks(content string) []string {
 }
 
 // sendChunk sends a single chunk with progress indicator
-func (s *StreamingSender) sendChunk(ctx context.Context, chatID int64, chunk string, current, total int) error {
+func (s *StreamingSender) sendChunk(ctx context.Context, chatID int64, threadID int, chunk string, current, total int) error {
 	// Add progress indicator for multi-chunk messages
 	var text string
 	if total > 1 {
@@ -236,14 +236,14 @@ func (s *StreamingSender) sendChunk(ctx context.Context, chatID int64, chunk str
 		text = chunk
 	}
 	
-	msg := tu.Message(tu.ID(chatID), text)
+	msg := tu.Message(tu.ID(chatID), text).WithMessageThreadID(threadID)
 	_, err := s.bot.SendMessage(ctx, msg)
 	return err
 }
 
 // sendSimple sends a simple message without streaming
-func (s *StreamingSender) sendSimple(ctx context.Context, chatID int64, content string) error {
-	msg := tu.Message(tu.ID(chatID), content)
+func (s *StreamingSender) sendSimple(ctx context.Context, chatID int64, threadID int, content string) error {
+	msg := tu.Message(tu.ID(chatID), content).WithMessageThreadID(threadID)
 	_, err := s.bot.SendMessage(ctx, msg)
 	return err
 }
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/caarlos0/env/v11"
@@ -51,21 +53,86 @@ type Config struct {
 	Tools     ToolsConfig     `json:"tools"`
 	Heartbeat HeartbeatConfig `json:"heartbeat"`
 	Devices   DevicesConfig   `json:"devices"`
+	Bus       BusConfig       `json:"bus"`
+	Usage     UsageConfig     `json:"usage"`
+	Sessions  SessionsConfig  `json:"sessions"`
 	mu        sync.RWMutex
 }
 
 type AgentsConfig struct {
-	Defaults AgentDefaults `json:"defaults"`
+	Defaults AgentDefaults           `json:"defaults"`
+	Profiles map[string]AgentProfile `json:"profiles,omitempty"` // named agents; see ForProfile
+	Routes   []AgentRoute            `json:"routes,omitempty"`   // first matching route picks the profile
 }
 
 type AgentDefaults struct {
-	Workspace           string  `json:"workspace" env:"PICOCLAW_AGENTS_DEFAULTS_WORKSPACE"`
-	RestrictToWorkspace bool    `json:"restrict_to_workspace" env:"PICOCLAW_AGENTS_DEFAULTS_RESTRICT_TO_WORKSPACE"`
-	Provider            string  `json:"provider" env:"PICOCLAW_AGENTS_DEFAULTS_PROVIDER"`
-	Model               string  `json:"model" env:"PICOCLAW_AGENTS_DEFAULTS_MODEL"`
-	MaxTokens           int     `json:"max_tokens" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS"`
-	Temperature         float64 `json:"temperature" env:"PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
-	MaxToolIterations   int     `json:"max_tool_iterations" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
+	Workspace             string              `json:"workspace" env:"PICOCLAW_AGENTS_DEFAULTS_WORKSPACE"`
+	RestrictToWorkspace   bool                `json:"restrict_to_workspace" env:"PICOCLAW_AGENTS_DEFAULTS_RESTRICT_TO_WORKSPACE"`
+	Provider              string              `json:"provider" env:"PICOCLAW_AGENTS_DEFAULTS_PROVIDER"`
+	Model                 string              `json:"model" env:"PICOCLAW_AGENTS_DEFAULTS_MODEL"`
+	MaxTokens             int                 `json:"max_tokens" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS"`         // output cap of each LLM call
+	ContextWindow         int                 `json:"context_window" env:"PICOCLAW_AGENTS_DEFAULTS_CONTEXT_WINDOW"` // 0 looks the window up by model
+	TokenizerDir          string              `json:"tokenizer_dir" env:"PICOCLAW_AGENTS_DEFAULTS_TOKENIZER_DIR"`   // tiktoken vocabularies for exact token counts
+	Vision                map[string]bool     `json:"vision,omitempty"`                                             // whether models take images, by model name or glob pattern; others are looked up
+	Temperature           float64             `json:"temperature" env:"PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
+	MaxToolIterations     int                 `json:"max_tool_iterations" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
+	MaxConcurrentSessions int                 `json:"max_concurrent_sessions" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_CONCURRENT_SESSIONS"` // sessions processed in parallel
+	Streaming             bool                `json:"streaming" env:"PICOCLAW_AGENTS_DEFAULTS_STREAMING"`                             // stream partial replies to channels that support it
+	Tools                 []string            `json:"tools,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_TOOLS"`                           // tool allowlist (glob patterns); empty allows all
+	Routing               ModelRoutingConfig  `json:"routing"`
+	Fallbacks             []ModelTarget       `json:"fallbacks,omitempty"` // tried in order when the provider fails
+	Summarization         SummarizationConfig `json:"summarization"`
+}
+
+// SummarizationConfig controls how long conversations are compacted into
+// summaries. The model defaults to the agent's own provider and model.
+type SummarizationConfig struct {
+	Provider     string `json:"provider,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_SUMMARIZATION_PROVIDER"`
+	Model        string `json:"model,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_SUMMARIZATION_MODEL"`
+	KeepMessages int    `json:"keep_messages" env:"PICOCLAW_AGENTS_DEFAULTS_SUMMARIZATION_KEEP_MESSAGES"` // recent messages kept word for word
+	ChunkTokens  int    `json:"chunk_tokens" env:"PICOCLAW_AGENTS_DEFAULTS_SUMMARIZATION_CHUNK_TOKENS"`   // conversation summarized per call
+	MaxTiers     int    `json:"max_tiers" env:"PICOCLAW_AGENTS_DEFAULTS_SUMMARIZATION_MAX_TIERS"`         // summary levels, from detailed to condensed
+}
+
+// ModelRoutingConfig lets each LLM request go to a cheap or a strong model.
+// The strong model defaults to the agent's own provider and model.
+type ModelRoutingConfig struct {
+	Enabled            bool        `json:"enabled" env:"PICOCLAW_AGENTS_DEFAULTS_ROUTING_ENABLED"`
+	Cheap              ModelTarget `json:"cheap"`
+	Strong             ModelTarget `json:"strong"`
+	Classifier         ModelTarget `json:"classifier"`                                                                       // optional small model that rates each request
+	MaxCheapChars      int         `json:"max_cheap_chars" env:"PICOCLAW_AGENTS_DEFAULTS_ROUTING_MAX_CHEAP_CHARS"`           // longer user messages go to the strong model
+	MaxCheapIterations int         `json:"max_cheap_iterations" env:"PICOCLAW_AGENTS_DEFAULTS_ROUTING_MAX_CHEAP_ITERATIONS"` // tool iterations before escalating
+}
+
+// ModelTarget names a provider and model, as agents.defaults does.
+type ModelTarget struct {
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+}
+
+// DefaultProfile names the agent configured by AgentsConfig.Defaults. Routes
+// may use it to send a chat to the default agent ahead of a broader route.
+const DefaultProfile = "default"
+
+// AgentProfile is a named agent with its own workspace, and with that its
+// own bootstrap files (SOUL.md, IDENTITY.md, ...), sessions and memory.
+// Fields left empty inherit from AgentsConfig.Defaults.
+type AgentProfile struct {
+	Workspace         string   `json:"workspace,omitempty"` // defaults to "<defaults workspace>-<name>"
+	Provider          string   `json:"provider,omitempty"`
+	Model             string   `json:"model,omitempty"`
+	MaxToolIterations int      `json:"max_tool_iterations,omitempty"`
+	Tools             []string `json:"tools,omitempty"` // tool allowlist (glob patterns); empty inherits
+}
+
+// AgentRoute sends inbound messages to an agent profile. Every field that is
+// set must match; a route with only a profile matches everything.
+type AgentRoute struct {
+	Channel  string `json:"channel,omitempty"`
+	ChatID   string `json:"chat_id,omitempty"`
+	SenderID string `json:"sender_id,omitempty"` // an ID or username, as in allow_from
+	Profile  string `json:"profile"`
 }
 
 type ChannelsConfig struct {
@@ -161,6 +228,65 @@ type HeartbeatConfig struct {
 	Interval int  `json:"interval" env:"PICOCLAW_HEARTBEAT_INTERVAL"` // minutes, min 5
 }
 
+type BusConfig struct {
+	Durable        bool `json:"durable" env:"PICOCLAW_BUS_DURABLE"`                   // journal queued messages under state/bus
+	MaxRetries     int  `json:"max_retries" env:"PICOCLAW_BUS_MAX_RETRIES"`           // failed sends before dead-lettering
+	SyncIntervalMS int  `json:"sync_interval_ms" env:"PICOCLAW_BUS_SYNC_INTERVAL_MS"` // batch journal syncs this long; 0 syncs every record
+}
+
+type UsageConfig struct {
+	Prices map[string]ModelPrice `json:"prices,omitempty"` // by model name or glob pattern
+	Budget BudgetConfig          `json:"budget"`
+}
+
+// ModelPrice is the price of a model in USD per million tokens.
+type ModelPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// BudgetConfig limits token use and cost across all sessions. Zero limits
+// are not enforced.
+type BudgetConfig struct {
+	DailyTokens    int     `json:"daily_tokens" env:"PICOCLAW_USAGE_BUDGET_DAILY_TOKENS"`
+	MonthlyTokens  int     `json:"monthly_tokens" env:"PICOCLAW_USAGE_BUDGET_MONTHLY_TOKENS"`
+	DailyCost      float64 `json:"daily_cost" env:"PICOCLAW_USAGE_BUDGET_DAILY_COST"`
+	MonthlyCost    float64 `json:"monthly_cost" env:"PICOCLAW_USAGE_BUDGET_MONTHLY_COST"`
+	Action         string  `json:"action" env:"PICOCLAW_USAGE_BUDGET_ACTION"`                   // "block" or "downgrade"
+	DowngradeModel string  `json:"downgrade_model" env:"PICOCLAW_USAGE_BUDGET_DOWNGRADE_MODEL"` // model used once a budget is exceeded
+}
+
+type SessionsConfig struct {
+	Backend   string                      `json:"backend" env:"PICOCLAW_SESSIONS_BACKEND"` // "json" or "sqlite"
+	Retention SessionRetention            `json:"retention"`
+	Overrides map[string]SessionRetention `json:"retention_overrides,omitempty"` // by session key or glob pattern, e.g. "telegram:*"
+}
+
+// SessionRetention limits how long sessions are kept. Zero keeps everything.
+type SessionRetention struct {
+	MaxAgeDays  int `json:"max_age_days" env:"PICOCLAW_SESSIONS_RETENTION_MAX_AGE_DAYS"` // delete sessions not used for this many days
+	MaxMessages int `json:"max_messages" env:"PICOCLAW_SESSIONS_RETENTION_MAX_MESSAGES"` // keep only the newest messages of each session
+}
+
+// RetentionFor returns the retention of a session: the override for its
+// key, else the override with the longest matching pattern, else the
+// default.
+func (c SessionsConfig) RetentionFor(key string) SessionRetention {
+	if r, ok := c.Overrides[key]; ok {
+		return r
+	}
+	best := ""
+	for pattern := range c.Overrides {
+		if matched, _ := path.Match(pattern, key); matched && len(pattern) > len(best) {
+			best = pattern
+		}
+	}
+	if best != "" {
+		return c.Overrides[best]
+	}
+	return c.Retention
+}
+
 type DevicesConfig struct {
 	Enabled    bool `json:"enabled" env:"PICOCLAW_DEVICES_ENABLED"`
 	MonitorUSB bool `json:"monitor_usb" env:"PICOCLAW_DEVICES_MONITOR_USB"`
@@ -191,8 +317,10 @@ type ProviderConfig struct {
 }
 
 type GatewayConfig struct {
-	Host string `json:"host" env:"PICOCLAW_GATEWAY_HOST"`
-	Port int    `json:"port" env:"PICOCLAW_GATEWAY_PORT"`
+	Host        string   `json:"host" env:"PICOCLAW_GATEWAY_HOST"`
+	Port        int      `json:"port" env:"PICOCLAW_GATEWAY_PORT"`
+	APIToken    string   `json:"api_token" env:"PICOCLAW_GATEWAY_API_TOKEN"`                 // enables the OpenAI-compatible API when set
+	APISessions []string `json:"api_sessions,omitempty" env:"PICOCLAW_GATEWAY_API_SESSIONS"` // other sessions the API may use (glob patterns); others get an "api:" prefix
 }
 
 type BraveConfig struct {
@@ -212,32 +340,162 @@ type PerplexityConfig struct {
 	MaxResults int    `json:"max_results" env:"PICOCLAW_TOOLS_WEB_PERPLEXITY_MAX_RESULTS"`
 }
 
+// WebFetchConfig controls the web_fetch tool.
+type WebFetchConfig struct {
+	MaxChars int `json:"max_chars" env:"PICOCLAW_TOOLS_WEB_FETCH_MAX_CHARS"` // per call; longer documents are read in parts
+	CacheMB  int `json:"cache_mb" env:"PICOCLAW_TOOLS_WEB_FETCH_CACHE_MB"`   // disk cache of pages with an ETag or Last-Modified; 0 disables it
+}
+
 type WebToolsConfig struct {
 	Brave      BraveConfig      `json:"brave"`
 	DuckDuckGo DuckDuckGoConfig `json:"duckduckgo"`
 	Perplexity PerplexityConfig `json:"perplexity"`
+	Fetch      WebFetchConfig   `json:"fetch"`
 }
 
 type CronToolsConfig struct {
 	ExecTimeoutMinutes int `json:"exec_timeout_minutes" env:"PICOCLAW_TOOLS_CRON_EXEC_TIMEOUT_MINUTES"` // 0 means no timeout
 }
 
+// ExecToolsConfig configures the exec tool and cron command jobs.
+type ExecToolsConfig struct {
+	TimeoutSeconds int                          `json:"timeout_seconds" env:"PICOCLAW_TOOLS_EXEC_TIMEOUT_SECONDS"`   // 0 means no timeout; cron jobs use tools.cron
+	MaxOutputChars int                          `json:"max_output_chars" env:"PICOCLAW_TOOLS_EXEC_MAX_OUTPUT_CHARS"` // output returned to the model, 0 means unlimited
+	Shell          string                       `json:"shell" env:"PICOCLAW_TOOLS_EXEC_SHELL"`                       // sh, or powershell on Windows, when empty
+	AllowPatterns  []string                     `json:"allow_patterns,omitempty"`                                    // regexps; when set, only matching commands run
+	DenyPatterns   []string                     `json:"deny_patterns,omitempty"`                                     // regexps blocked besides the built-in ones
+	EnvAllowlist   []string                     `json:"env_allowlist,omitempty"`                                     // host variables passed to commands (globs); empty passes all, or PATH, LANG and TERM when sandboxed
+	Env            map[string]string            `json:"env,omitempty"`                                               // variables set for every command
+	Channels       map[string]ExecChannelConfig `json:"channels,omitempty"`                                          // overrides by channel name
+	Background     ExecBackgroundConfig         `json:"background"`
+	Sandbox        SandboxConfig                `json:"sandbox"`
+}
+
+// ExecBackgroundConfig limits the commands exec starts in the background,
+// which the process tool manages.
+type ExecBackgroundConfig struct {
+	Enabled            bool `json:"enabled" env:"PICOCLAW_TOOLS_EXEC_BACKGROUND_ENABLED"`
+	MaxProcesses       int  `json:"max_processes" env:"PICOCLAW_TOOLS_EXEC_BACKGROUND_MAX_PROCESSES"`               // running at once per session
+	MaxLifetimeMinutes int  `json:"max_lifetime_minutes" env:"PICOCLAW_TOOLS_EXEC_BACKGROUND_MAX_LIFETIME_MINUTES"` // killed after this, 0 means no limit
+	BufferKB           int  `json:"buffer_kb" env:"PICOCLAW_TOOLS_EXEC_BACKGROUND_BUFFER_KB"`                       // latest output kept per stream
+}
+
+// ExecChannelConfig overrides the exec settings for commands run for one
+// channel. Unset fields keep the general setting; deny patterns and env
+// variables are added to the general ones.
+type ExecChannelConfig struct {
+	Disabled       bool              `json:"disabled,omitempty"` // refuse every command
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"`
+	MaxOutputChars int               `json:"max_output_chars,omitempty"`
+	Shell          string            `json:"shell,omitempty"`
+	AllowPatterns  []string          `json:"allow_patterns,omitempty"`
+	DenyPatterns   []string          `json:"deny_patterns,omitempty"`
+	EnvAllowlist   []string          `json:"env_allowlist,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`
+}
+
+// SandboxConfig isolates shell commands in Linux namespaces: they see the
+// system directories read-only, the workspace read-write and nothing else
+// of the host, and run with resource limits and a syscall filter.
+type SandboxConfig struct {
+	Enabled       bool     `json:"enabled" env:"PICOCLAW_TOOLS_EXEC_SANDBOX_ENABLED"`
+	Backend       string   `json:"backend" env:"PICOCLAW_TOOLS_EXEC_SANDBOX_BACKEND"`             // auto, namespaces or bwrap
+	Required      bool     `json:"required" env:"PICOCLAW_TOOLS_EXEC_SANDBOX_REQUIRED"`           // refuse commands when no backend works instead of running them unsandboxed
+	Network       bool     `json:"network" env:"PICOCLAW_TOOLS_EXEC_SANDBOX_NETWORK"`             // allow network access
+	ReadOnlyPaths []string `json:"read_only_paths,omitempty"`                                     // extra host paths visible read-only
+	WritablePaths []string `json:"writable_paths,omitempty"`                                      // extra host paths visible read-write, besides the workspace
+	CPUSeconds    int      `json:"cpu_seconds" env:"PICOCLAW_TOOLS_EXEC_SANDBOX_CPU_SECONDS"`     // CPU time per command, 0 means unlimited
+	MemoryMB      int      `json:"memory_mb" env:"PICOCLAW_TOOLS_EXEC_SANDBOX_MEMORY_MB"`         // address space per process, 0 means unlimited
+	MaxFileMB     int      `json:"max_file_mb" env:"PICOCLAW_TOOLS_EXEC_SANDBOX_MAX_FILE_MB"`     // largest file a command may write, 0 means unlimited
+	MaxOutputKB   int      `json:"max_output_kb" env:"PICOCLAW_TOOLS_EXEC_SANDBOX_MAX_OUTPUT_KB"` // output kept per command, 0 means unlimited
+}
+
+// MCPServerConfig describes one Model Context Protocol server. Stdio servers
+// are started with Command/Args; remote servers are reached through URL.
+type MCPServerConfig struct {
+	Enabled        bool              `json:"enabled"`
+	Command        string            `json:"command,omitempty"`
+	Args           []string          `json:"args,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`
+	URL            string            `json:"url,omitempty"` // streamable HTTP endpoint, used when Command is empty
+	Headers        map[string]string `json:"headers,omitempty"`
+	AllowTools     []string          `json:"allow_tools,omitempty"` // empty allows every tool; entries may use glob patterns
+	DenyTools      []string          `json:"deny_tools,omitempty"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"` // per tool call, 0 means 60 seconds
+}
+
+type MCPConfig struct {
+	Servers map[string]MCPServerConfig `json:"servers"`
+}
+
 type ToolsConfig struct {
-	Web  WebToolsConfig  `json:"web"`
-	Cron CronToolsConfig `json:"cron"`
+	Web      WebToolsConfig      `json:"web"`
+	Cron     CronToolsConfig     `json:"cron"`
+	Exec     ExecToolsConfig     `json:"exec"`
+	MCP      MCPConfig           `json:"mcp"`
+	Parallel ParallelToolsConfig `json:"parallel"`
+	Approval ApprovalConfig      `json:"approval"`
+	Network  NetworkConfig       `json:"network"`
+}
+
+// ParallelToolsConfig controls how tool calls of one LLM response that are
+// safe to run concurrently, such as read_file and web_fetch, are executed.
+type ParallelToolsConfig struct {
+	MaxConcurrent  int `json:"max_concurrent" env:"PICOCLAW_TOOLS_PARALLEL_MAX_CONCURRENT"`   // 1 runs every call in turn
+	TimeoutSeconds int `json:"timeout_seconds" env:"PICOCLAW_TOOLS_PARALLEL_TIMEOUT_SECONDS"` // per call
+}
+
+// ApprovalConfig makes dangerous tool calls wait until the user approves
+// them in the chat they were made for.
+type ApprovalConfig struct {
+	Enabled        bool           `json:"enabled" env:"PICOCLAW_TOOLS_APPROVAL_ENABLED"`
+	TimeoutSeconds int            `json:"timeout_seconds" env:"PICOCLAW_TOOLS_APPROVAL_TIMEOUT_SECONDS"` // unanswered requests are denied
+	Rules          []ApprovalRule `json:"rules"`
+}
+
+// NetworkConfig limits which hosts web_fetch, web_search, media downloads
+// and skill installs may connect to. Loopback, private, link-local and
+// other special-purpose addresses are blocked unless allowed here.
+type NetworkConfig struct {
+	AllowPrivate bool     `json:"allow_private" env:"PICOCLAW_TOOLS_NETWORK_ALLOW_PRIVATE"` // reach every address not denied
+	AllowHosts   []string `json:"allow_hosts" env:"PICOCLAW_TOOLS_NETWORK_ALLOW_HOSTS"`     // host names ("*.lan" for subdomains), IPs or CIDRs reachable even when private
+	DenyHosts    []string `json:"deny_hosts" env:"PICOCLAW_TOOLS_NETWORK_DENY_HOSTS"`       // host names, IPs or CIDRs never reachable
+	Proxy        string   `json:"proxy" env:"PICOCLAW_TOOLS_NETWORK_PROXY"`                 // proxy URL, or "direct"; empty or "env" uses HTTP(S)_PROXY
+}
+
+// ApprovalRule selects tool calls that need approval: calls of tools
+// matching Tool, optionally only those whose argument Arg matches Pattern.
+type ApprovalRule struct {
+	Tool    string `json:"tool"`              // glob pattern on the tool name
+	Arg     string `json:"arg,omitempty"`     // argument to match; empty matches all arguments as JSON
+	Pattern string `json:"pattern,omitempty"` // regular expression; empty matches every call
 }
 
 func DefaultConfig() *Config {
 	return &Config{
 		Agents: AgentsConfig{
 			Defaults: AgentDefaults{
-				Workspace:           "~/.picoclaw/workspace",
-				RestrictToWorkspace: true,
-				Provider:            "",
-				Model:               "glm-4.7",
-				MaxTokens:           65536, // 64K tokens - optimized for Kimi K2.5 (256K context window)
-				Temperature:         0.7,
-				MaxToolIterations:   20,
+				Workspace:             "~/.picoclaw/workspace",
+				RestrictToWorkspace:   true,
+				Provider:              "",
+				Model:                 "glm-4.7",
+				MaxTokens:             8192,
+				ContextWindow:         0,
+				TokenizerDir:          "~/.picoclaw/tokenizers",
+				Temperature:           0.7,
+				MaxToolIterations:     20,
+				MaxConcurrentSessions: 4,
+				Streaming:             true,
+				Routing: ModelRoutingConfig{
+					Enabled:            false,
+					MaxCheapChars:      2000,
+					MaxCheapIterations: 5,
+				},
+				Summarization: SummarizationConfig{
+					KeepMessages: 8,
+					ChunkTokens:  4000,
+					MaxTiers:     3,
+				},
 			},
 		},
 		Channels: ChannelsConfig{
@@ -338,10 +596,50 @@ func DefaultConfig() *Config {
 					APIKey:     "",
 					MaxResults: 5,
 				},
+				Fetch: WebFetchConfig{
+					MaxChars: 20000,
+					CacheMB:  50,
+				},
 			},
 			Cron: CronToolsConfig{
 				ExecTimeoutMinutes: 5, // default 5 minutes for LLM operations
 			},
+			Exec: ExecToolsConfig{
+				TimeoutSeconds: 60,
+				MaxOutputChars: 10000,
+				Background: ExecBackgroundConfig{
+					Enabled:            true,
+					MaxProcesses:       4,
+					MaxLifetimeMinutes: 60,
+					BufferKB:           256,
+				},
+				Sandbox: SandboxConfig{
+					Enabled:     false,
+					Backend:     "auto",
+					Network:     true,
+					CPUSeconds:  60,
+					MemoryMB:    512,
+					MaxFileMB:   100,
+					MaxOutputKB: 1024,
+				},
+			},
+			MCP: MCPConfig{
+				Servers: map[string]MCPServerConfig{},
+			},
+			Parallel: ParallelToolsConfig{
+				MaxConcurrent:  4,
+				TimeoutSeconds: 60,
+			},
+			Approval: ApprovalConfig{
+				Enabled:        false,
+				TimeoutSeconds: 300,
+				Rules: []ApprovalRule{
+					{Tool: "exec"},
+					{Tool: "write_file"},
+					{Tool: "edit_file"},
+					{Tool: "append_file"},
+				},
+			},
 		},
 		Heartbeat: HeartbeatConfig{
 			Enabled:  true,
@@ -351,6 +649,20 @@ func DefaultConfig() *Config {
 			Enabled:    false,
 			MonitorUSB: true,
 		},
+		Bus: BusConfig{
+			Durable:        false,
+			MaxRetries:     5,
+			SyncIntervalMS: 100,
+		},
+		Usage: UsageConfig{
+			Prices: map[string]ModelPrice{},
+			Budget: BudgetConfig{
+				Action: "block",
+			},
+		},
+		Sessions: SessionsConfig{
+			Backend: "json",
+		},
 	}
 }
 
@@ -373,6 +685,10 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
+	if err := cfg.ValidateAgents(); err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
 }
 
@@ -399,6 +715,99 @@ func (c *Config) WorkspacePath() string {
 	return expandHome(c.Agents.Defaults.Workspace)
 }
 
+// TokenizerPath returns the directory of the BPE vocabularies.
+func (c *Config) TokenizerPath() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return expandHome(c.Agents.Defaults.TokenizerDir)
+}
+
+// ForProfile returns the configuration of the named agent profile: a copy
+// of c whose Agents.Defaults carry the profile's overrides.
+func (c *Config) ForProfile(name string) (*Config, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	profile, ok := c.Agents.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown agent profile %q", name)
+	}
+
+	defaults := c.Agents.Defaults
+	if profile.Workspace != "" {
+		defaults.Workspace = profile.Workspace
+	} else {
+		defaults.Workspace = strings.TrimRight(defaults.Workspace, "/") + "-" + name
+	}
+	if profile.Provider != "" {
+		defaults.Provider = profile.Provider
+	}
+	if profile.Model != "" {
+		defaults.Model = profile.Model
+	}
+	if profile.MaxToolIterations > 0 {
+		defaults.MaxToolIterations = profile.MaxToolIterations
+	}
+	if len(profile.Tools) > 0 {
+		defaults.Tools = profile.Tools
+	}
+
+	return c.withDefaults(defaults), nil
+}
+
+// ForModel returns a copy of c that uses the given provider and model,
+// without model routing. An empty provider keeps the configured one.
+func (c *Config) ForModel(target ModelTarget) *Config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	defaults := c.Agents.Defaults
+	if target.Provider != "" {
+		defaults.Provider = target.Provider
+	}
+	if target.Model != "" {
+		defaults.Model = target.Model
+	}
+	defaults.Routing.Enabled = false
+	return c.withDefaults(defaults)
+}
+
+// withDefaults copies c with other agent defaults and without profiles.
+// The caller holds c.mu.
+func (c *Config) withDefaults(defaults AgentDefaults) *Config {
+	return &Config{
+		Agents:    AgentsConfig{Defaults: defaults},
+		Channels:  c.Channels,
+		Providers: c.Providers,
+		Gateway:   c.Gateway,
+		Tools:     c.Tools,
+		Heartbeat: c.Heartbeat,
+		Devices:   c.Devices,
+		Bus:       c.Bus,
+		Usage:     c.Usage,
+		Sessions:  c.Sessions,
+	}
+}
+
+// ValidateAgents checks that every route names a configured profile.
+func (c *Config) ValidateAgents() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if _, ok := c.Agents.Profiles[DefaultProfile]; ok {
+		return fmt.Errorf("agent profile name %q is reserved", DefaultProfile)
+	}
+	for i, route := range c.Agents.Routes {
+		if route.Profile == "" {
+			return fmt.Errorf("agent route %d has no profile", i+1)
+		}
+		if _, ok := c.Agents.Profiles[route.Profile]; !ok && route.Profile != DefaultProfile {
+			return fmt.Errorf("agent route %d: unknown profile %q", i+1, route.Profile)
+		}
+	}
+	return nil
+}
+
 func (c *Config) GetAPIKey() string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -204,3 +204,54 @@ func TestConfig_Complete(t *testing.T) {
 		t.Error("Heartbeat should be enabled by default")
 	}
 }
+
+// TestConfig_ForProfile verifies profile overrides and inherited defaults
+func TestConfig_ForProfile(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Agents.Profiles = map[string]AgentProfile{
+		"family": {Model: "family-model", MaxToolIterations: 5},
+		"work":   {Workspace: "/srv/work", Provider: "anthropic"},
+	}
+
+	family, err := cfg.ForProfile("family")
+	if err != nil {
+		t.Fatalf("ForProfile failed: %v", err)
+	}
+	d := family.Agents.Defaults
+	if d.Model != "family-model" || d.MaxToolIterations != 5 {
+		t.Errorf("Profile overrides not applied: %+v", d)
+	}
+	if d.Workspace != "~/.picoclaw/workspace-family" {
+		t.Errorf("Expected derived workspace, got %q", d.Workspace)
+	}
+	if d.MaxTokens != cfg.Agents.Defaults.MaxTokens {
+		t.Error("Expected MaxTokens to be inherited from defaults")
+	}
+
+	work, _ := cfg.ForProfile("work")
+	if work.WorkspacePath() != "/srv/work" || work.Agents.Defaults.Model != cfg.Agents.Defaults.Model {
+		t.Errorf("Unexpected work profile: %+v", work.Agents.Defaults)
+	}
+
+	if _, err := cfg.ForProfile("missing"); err == nil {
+		t.Error("Expected error for unknown profile")
+	}
+}
+
+// TestConfig_ValidateAgents verifies routes must name known profiles
+func TestConfig_ValidateAgents(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Agents.Profiles = map[string]AgentProfile{"family": {}}
+	cfg.Agents.Routes = []AgentRoute{
+		{Channel: "telegram", Profile: "family"},
+		{Channel: "slack", Profile: DefaultProfile},
+	}
+	if err := cfg.ValidateAgents(); err != nil {
+		t.Errorf("Expected valid routes, got %v", err)
+	}
+
+	cfg.Agents.Routes = append(cfg.Agents.Routes, AgentRoute{Channel: "discord", Profile: "work"})
+	if err := cfg.ValidateAgents(); err == nil {
+		t.Error("Expected error for route to unknown profile")
+	}
+}
@@ -65,6 +65,8 @@ type CronService struct {
 	running   bool
 	stopChan  chan struct{}
 	gronx     *gronx.Gronx
+	storeMod  time.Time // modification time and size of the store file as last read or written
+	storeSize int64
 }
 
 func NewCronService(storePath string, onJob JobHandler) *CronService {
@@ -138,6 +140,7 @@ func (cs *CronService) checkJobs() {
 		cs.mu.Unlock()
 		return
 	}
+	cs.reloadIfChangedUnsafe()
 
 	now := time.Now().UnixMilli()
 	var dueJobIDs []string
@@ -161,8 +164,10 @@ func (cs *CronService) checkJobs() {
 		}
 	}
 
-	if err := cs.saveStoreUnsafe(); err != nil {
-		log.Printf("[cron] failed to save store: %v", err)
+	if len(dueJobIDs) > 0 {
+		if err := cs.saveStoreUnsafe(); err != nil {
+			log.Printf("[cron] failed to save store: %v", err)
+		}
 	}
 
 	cs.mu.Unlock()
@@ -200,6 +205,7 @@ func (cs *CronService) executeJobByID(jobID string) {
 	// Now acquire lock to update state
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
+	cs.reloadIfChangedUnsafe()
 
 	var job *CronJob
 	for i := range cs.store.Jobs {
@@ -313,22 +319,52 @@ func (cs *CronService) SetOnJob(handler JobHandler) {
 }
 
 func (cs *CronService) loadStore() error {
-	cs.store = &CronStore{
-		Version: 1,
-		Jobs:    []CronJob{},
+	if cs.store == nil {
+		cs.store = &CronStore{
+			Version: 1,
+			Jobs:    []CronJob{},
+		}
 	}
 
-	data, err := os.ReadFile(cs.storePath)
+	info, err := os.Stat(cs.storePath)
 	if err != nil {
 		if os.IsNotExist(err) {
+			cs.store = &CronStore{Version: 1, Jobs: []CronJob{}}
 			return nil
 		}
 		return err
 	}
+	data, err := os.ReadFile(cs.storePath)
+	if err != nil {
+		return err
+	}
 
-	return json.Unmarshal(data, cs.store)
+	// A file that cannot be parsed leaves the jobs in memory as they are
+	store := &CronStore{Version: 1, Jobs: []CronJob{}}
+	if err := json.Unmarshal(data, store); err != nil {
+		return err
+	}
+	cs.store = store
+	cs.storeMod, cs.storeSize = info.ModTime(), info.Size()
+	return nil
 }
 
+// reloadIfChangedUnsafe reads the store again when another process, such
+// as "picoclaw cron add" or "picoclaw mcp serve", changed the file since
+// this service last read or wrote it, so their jobs run and are not
+// overwritten by the next save.
+func (cs *CronService) reloadIfChangedUnsafe() {
+	info, err := os.Stat(cs.storePath)
+	if err != nil || (info.ModTime().Equal(cs.storeMod) && info.Size() == cs.storeSize) {
+		return
+	}
+	if err := cs.loadStore(); err != nil {
+		log.Printf("[cron] failed to reload store: %v", err)
+	}
+}
+
+// saveStoreUnsafe replaces the store file in one step, so other processes
+// never read it half-written.
 func (cs *CronService) saveStoreUnsafe() error {
 	dir := filepath.Dir(cs.storePath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -340,12 +376,24 @@ func (cs *CronService) saveStoreUnsafe() error {
 		return err
 	}
 
-	return os.WriteFile(cs.storePath, data, 0600)
+	tmp := cs.storePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, cs.storePath); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if info, err := os.Stat(cs.storePath); err == nil {
+		cs.storeMod, cs.storeSize = info.ModTime(), info.Size()
+	}
+	return nil
 }
 
 func (cs *CronService) AddJob(name string, schedule CronSchedule, message string, deliver bool, channel, to string) (*CronJob, error) {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
+	cs.reloadIfChangedUnsafe()
 
 	now := time.Now().UnixMilli()
 
@@ -383,6 +431,7 @@ func (cs *CronService) AddJob(name string, schedule CronSchedule, message string
 func (cs *CronService) UpdateJob(job *CronJob) error {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
+	cs.reloadIfChangedUnsafe()
 
 	for i := range cs.store.Jobs {
 		if cs.store.Jobs[i].ID == job.ID {
@@ -397,6 +446,7 @@ func (cs *CronService) UpdateJob(job *CronJob) error {
 func (cs *CronService) RemoveJob(jobID string) bool {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
+	cs.reloadIfChangedUnsafe()
 
 	return cs.removeJobUnsafe(jobID)
 }
@@ -424,6 +474,7 @@ func (cs *CronService) removeJobUnsafe(jobID string) bool {
 func (cs *CronService) EnableJob(jobID string, enabled bool) *CronJob {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
+	cs.reloadIfChangedUnsafe()
 
 	for i := range cs.store.Jobs {
 		job := &cs.store.Jobs[i]
@@ -448,8 +499,9 @@ func (cs *CronService) EnableJob(jobID string, enabled bool) *CronJob {
 }
 
 func (cs *CronService) ListJobs(includeDisabled bool) []CronJob {
-	cs.mu.RLock()
-	defer cs.mu.RUnlock()
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.reloadIfChangedUnsafe()
 
 	if includeDisabled {
 		return cs.store.Jobs
@@ -466,8 +518,9 @@ func (cs *CronService) ListJobs(includeDisabled bool) []CronJob {
 }
 
 func (cs *CronService) Status() map[string]interface{} {
-	cs.mu.RLock()
-	defer cs.mu.RUnlock()
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.reloadIfChangedUnsafe()
 
 	var enabledCount int
 	for _, job := range cs.store.Jobs {
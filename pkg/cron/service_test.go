@@ -33,6 +33,30 @@ func TestSaveStore_FilePermissions(t *testing.T) {
 	}
 }
 
+func TestCronService_PicksUpJobsFromOtherProcesses(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "cron", "jobs.json")
+	gateway := NewCronService(storePath, nil)
+	if _, err := gateway.AddJob("gateway", CronSchedule{Kind: "every", EveryMS: int64Ptr(60000)}, "a", false, "cli", "direct"); err != nil {
+		t.Fatalf("AddJob failed: %v", err)
+	}
+
+	// Another process, such as "picoclaw mcp serve", adds a job to the file
+	other := NewCronService(storePath, nil)
+	if _, err := other.AddJob("other", CronSchedule{Kind: "every", EveryMS: int64Ptr(60000)}, "b", false, "cli", "direct"); err != nil {
+		t.Fatalf("AddJob failed: %v", err)
+	}
+
+	if jobs := gateway.ListJobs(true); len(jobs) != 2 {
+		t.Fatalf("gateway sees %d jobs, want 2", len(jobs))
+	}
+	if _, err := gateway.AddJob("third", CronSchedule{Kind: "every", EveryMS: int64Ptr(60000)}, "c", false, "cli", "direct"); err != nil {
+		t.Fatalf("AddJob failed: %v", err)
+	}
+	if jobs := other.ListJobs(true); len(jobs) != 3 {
+		t.Errorf("the other process sees %d jobs after the gateway saved, want 3", len(jobs))
+	}
+}
+
 func int64Ptr(v int64) *int64 {
 	return &v
 }
@@ -0,0 +1,132 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// defaultCallTimeout bounds a tool call when the server config sets no timeout.
+const defaultCallTimeout = 60 * time.Second
+
+// clientInfo is sent to servers during initialization.
+var clientInfo = Implementation{Name: "picoclaw", Version: "1.0"}
+
+// Client is a connection to one MCP server that has completed the
+// initialize handshake.
+type Client struct {
+	name        string
+	transport   transport
+	callTimeout time.Duration
+	serverInfo  Implementation
+}
+
+// Connect starts or dials the server described by cfg and performs the
+// initialize handshake.
+func Connect(ctx context.Context, name string, cfg config.MCPServerConfig) (*Client, error) {
+	var t transport
+	switch {
+	case cfg.Command != "":
+		st, err := startStdioTransport(name, cfg.Command, cfg.Args, cfg.Env)
+		if err != nil {
+			return nil, err
+		}
+		t = st
+	case cfg.URL != "":
+		t = newHTTPTransport(name, cfg.URL, cfg.Headers)
+	default:
+		return nil, fmt.Errorf("MCP server %q has neither command nor url", name)
+	}
+
+	c := &Client{
+		name:        name,
+		transport:   t,
+		callTimeout: defaultCallTimeout,
+	}
+	if cfg.TimeoutSeconds > 0 {
+		c.callTimeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+
+	if err := c.initialize(ctx); err != nil {
+		t.Close()
+		return nil, fmt.Errorf("MCP server %q: initialize failed: %w", name, err)
+	}
+	return c, nil
+}
+
+func (c *Client) initialize(ctx context.Context) error {
+	raw, err := c.transport.Call(ctx, "initialize", initializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]interface{}{},
+		ClientInfo:      clientInfo,
+	})
+	if err != nil {
+		return err
+	}
+
+	var result initializeResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return fmt.Errorf("invalid initialize result: %w", err)
+	}
+	c.serverInfo = result.ServerInfo
+
+	return c.transport.Notify(ctx, "notifications/initialized", nil)
+}
+
+// ServerInfo returns the name and version reported by the server.
+func (c *Client) ServerInfo() Implementation {
+	return c.serverInfo
+}
+
+// ListTools returns every tool offered by the server, following pagination.
+func (c *Client) ListTools(ctx context.Context) ([]ToolInfo, error) {
+	var all []ToolInfo
+	cursor := ""
+	for {
+		raw, err := c.transport.Call(ctx, "tools/list", listToolsParams{Cursor: cursor})
+		if err != nil {
+			return nil, err
+		}
+
+		var result listToolsResult
+		if err := json.Unmarshal(raw, &result); err != nil {
+			return nil, fmt.Errorf("invalid tools/list result: %w", err)
+		}
+		all = append(all, result.Tools...)
+
+		if result.NextCursor == "" {
+			return all, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// CallTool invokes a remote tool. A tool that reports failure is returned
+// as a result with IsError set, not as an error.
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]interface{}) (*CallToolResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.callTimeout)
+	defer cancel()
+
+	raw, err := c.transport.Call(ctx, "tools/call", callToolParams{Name: name, Arguments: args})
+	if err != nil {
+		return nil, err
+	}
+
+	var result CallToolResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("invalid tools/call result: %w", err)
+	}
+	return &result, nil
+}
+
+// Done is closed when the connection to the server is lost.
+func (c *Client) Done() <-chan struct{} {
+	return c.transport.Done()
+}
+
+func (c *Client) Close() error {
+	return c.transport.Close()
+}
@@ -0,0 +1,207 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// httpTransport implements the streamable HTTP transport: every message is
+// POSTed to a single endpoint and the response arrives either as JSON or as
+// a short server-sent event stream.
+type httpTransport struct {
+	name      string
+	url       string
+	headers   map[string]string
+	client    *http.Client
+	nextID    atomic.Int64
+	mu        sync.Mutex
+	sessionID string
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newHTTPTransport(name, url string, headers map[string]string) *httpTransport {
+	return &httpTransport{
+		name:    name,
+		url:     url,
+		headers: headers,
+		// Timeouts come from the per-call context.
+		client: &http.Client{},
+		done:   make(chan struct{}),
+	}
+}
+
+func (t *httpTransport) Call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	id := strconv.FormatInt(t.nextID.Add(1), 10)
+
+	resp, err := t.post(ctx, method, json.RawMessage(id), params)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var msg *jsonrpcMessage
+	if strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
+		msg, err = readSSEResponse(resp.Body, id)
+	} else {
+		msg = &jsonrpcMessage{}
+		err = json.NewDecoder(resp.Body).Decode(msg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MCP response: %w", err)
+	}
+
+	if msg.Error != nil {
+		return nil, msg.Error
+	}
+	return msg.Result, nil
+}
+
+func (t *httpTransport) Notify(ctx context.Context, method string, params interface{}) error {
+	resp, err := t.post(ctx, method, nil, params)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (t *httpTransport) Done() <-chan struct{} {
+	return t.done
+}
+
+// Close ends the session on the server, if one was assigned.
+func (t *httpTransport) Close() error {
+	t.closeOnce.Do(func() { close(t.done) })
+
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.mu.Unlock()
+	if sessionID == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	t.setHeaders(req, sessionID)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (t *httpTransport) post(ctx context.Context, method string, id json.RawMessage, params interface{}) (*http.Response, error) {
+	select {
+	case <-t.done:
+		return nil, errTransportClosed
+	default:
+	}
+
+	msg := jsonrpcMessage{JSONRPC: "2.0", ID: id, Method: method}
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal params: %w", err)
+		}
+		msg.Params = raw
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.mu.Unlock()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	t.setHeaders(req, sessionID)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if sid := resp.Header.Get("Mcp-Session-Id"); sid != "" {
+		t.mu.Lock()
+		t.sessionID = sid
+		t.mu.Unlock()
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound && sessionID != "":
+		// The server dropped our session; the connection has to be set up again.
+		resp.Body.Close()
+		t.closeOnce.Do(func() { close(t.done) })
+		return nil, fmt.Errorf("MCP session expired")
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, fmt.Errorf("MCP request failed:\n  Status: %d\n  Body:   %s", resp.StatusCode, string(data))
+	}
+
+	return resp, nil
+}
+
+func (t *httpTransport) setHeaders(req *http.Request, sessionID string) {
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	if sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", sessionID)
+	}
+}
+
+// readSSEResponse reads server-sent events until the response with the
+// given id arrives. Other messages on the stream are ignored.
+func readSSEResponse(body io.Reader, id string) (*jsonrpcMessage, error) {
+	reader := bufio.NewReader(body)
+	var data strings.Builder
+
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, "data:") {
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+
+		// A blank line ends an event; so does the end of the stream.
+		if (line == "" || err != nil) && data.Len() > 0 {
+			var msg jsonrpcMessage
+			if json.Unmarshal([]byte(data.String()), &msg) == nil && msg.isResponse() && string(msg.ID) == id {
+				return &msg, nil
+			}
+			data.Reset()
+		}
+
+		if err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("stream ended without a response")
+			}
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestHTTPTransport_SessionAndSSE(t *testing.T) {
+	var sawSession bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("Expected configured header, got %q", r.Header.Get("Authorization"))
+		}
+
+		var msg jsonrpcMessage
+		json.NewDecoder(r.Body).Decode(&msg)
+
+		switch msg.Method {
+		case "initialize":
+			w.Header().Set("Mcp-Session-Id", "abc")
+			w.Header().Set("Content-Type", "application/json")
+			result, _ := json.Marshal(initializeResult{ProtocolVersion: ProtocolVersion, ServerInfo: Implementation{Name: "remote"}})
+			json.NewEncoder(w).Encode(jsonrpcMessage{JSONRPC: "2.0", ID: msg.ID, Result: result})
+		case "notifications/initialized":
+			w.WriteHeader(http.StatusAccepted)
+		case "tools/list":
+			sawSession = r.Header.Get("Mcp-Session-Id") == "abc"
+			w.Header().Set("Content-Type", "text/event-stream")
+			// A progress notification precedes the actual response.
+			fmt.Fprint(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\n")
+			fmt.Fprintf(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"id\":%s,\"result\":{\"tools\":[{\"name\":\"search\",\"inputSchema\":{\"type\":\"object\"}}]}}\n\n", msg.ID)
+		}
+	}))
+	defer server.Close()
+
+	client, err := Connect(context.Background(), "remote", config.MCPServerConfig{
+		URL:     server.URL,
+		Headers: map[string]string{"Authorization": "Bearer token"},
+	})
+	if err != nil {
+		t.Fatalf("Connect() error: %v", err)
+	}
+	defer client.Close()
+
+	if client.ServerInfo().Name != "remote" {
+		t.Errorf("ServerInfo().Name = %q, want %q", client.ServerInfo().Name, "remote")
+	}
+
+	infos, err := client.ListTools(context.Background())
+	if err != nil {
+		t.Fatalf("ListTools() error: %v", err)
+	}
+	if len(infos) != 1 || infos[0].Name != "search" {
+		t.Errorf("ListTools() = %+v, want one tool named search", infos)
+	}
+	if !sawSession {
+		t.Error("Expected Mcp-Session-Id to be sent after initialize")
+	}
+}
+
+func TestContentText(t *testing.T) {
+	result := &CallToolResult{Content: []Content{
+		{Type: "text", Text: "line one"},
+		{Type: "image", MimeType: "image/png", Data: "aGVsbG8="},
+		{Type: "resource", Resource: &ResourceContents{URI: "file:///a.txt", Text: "file body"}},
+		{Type: "resource_link", URI: "file:///b.bin"},
+	}}
+
+	want := "line one\n[image: image/png, 8 bytes base64]\nfile body\n[resource: file:///b.bin]"
+	if got := contentText(result); got != want {
+		t.Errorf("contentText() = %q, want %q", got, want)
+	}
+}
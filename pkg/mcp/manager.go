@@ -0,0 +1,241 @@
+package mcp
+
+import (
+	"context"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+const (
+	// connectTimeout bounds starting a server and listing its tools.
+	connectTimeout = 30 * time.Second
+	// Restart backoff for servers that crash or fail to start.
+	minRestartDelay = time.Second
+	maxRestartDelay = time.Minute
+	// stableUptime resets the backoff once a server has stayed up this long.
+	stableUptime = time.Minute
+)
+
+// server holds the configuration and live connection of one MCP server.
+type server struct {
+	name   string
+	cfg    config.MCPServerConfig
+	mu     sync.RWMutex
+	client *Client
+	tools  map[string]bool // registered tool names; guarded by Manager.mu
+}
+
+func (s *server) current() *Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.client
+}
+
+func (s *server) setClient(c *Client) {
+	s.mu.Lock()
+	s.client = c
+	s.mu.Unlock()
+}
+
+// allowed applies the server's allow and deny lists to a remote tool name.
+func (s *server) allowed(tool string) bool {
+	if len(s.cfg.AllowTools) > 0 && !matchAny(s.cfg.AllowTools, tool) {
+		return false
+	}
+	return !matchAny(s.cfg.DenyTools, tool)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Manager starts the configured MCP servers, registers their tools and
+// restarts servers that exit.
+type Manager struct {
+	register   func(tools.Tool)
+	unregister func(name string)
+	servers    []*server
+	mu         sync.Mutex
+	toolSet    map[string]bool
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewManager returns a manager that hands server tools to register, such as
+// agent.AgentLoop.RegisterTool, which passes them on to the agent profiles.
+// Tools a restarted server no longer offers are removed with unregister.
+func NewManager(cfg config.MCPConfig, register func(tools.Tool), unregister func(name string)) *Manager {
+	names := make([]string, 0, len(cfg.Servers))
+	for name, sc := range cfg.Servers {
+		if sc.Enabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	servers := make([]*server, 0, len(names))
+	for _, name := range names {
+		servers = append(servers, &server{name: name, cfg: cfg.Servers[name]})
+	}
+
+	return &Manager{
+		register:   register,
+		unregister: unregister,
+		servers:    servers,
+		toolSet:    make(map[string]bool),
+	}
+}
+
+// Start connects to every enabled server and registers its tools. Servers
+// that fail to start are logged and retried in the background.
+func (m *Manager) Start(ctx context.Context) {
+	ctx, m.cancel = context.WithCancel(ctx)
+
+	var wg sync.WaitGroup
+	for _, s := range m.servers {
+		wg.Add(1)
+		go func(s *server) {
+			defer wg.Done()
+			if err := m.connect(ctx, s); err != nil {
+				logger.WarnCF("mcp", "Failed to start MCP server",
+					map[string]interface{}{
+						"server": s.name,
+						"error":  err.Error(),
+					})
+			}
+		}(s)
+	}
+	wg.Wait()
+
+	for _, s := range m.servers {
+		m.wg.Add(1)
+		go m.supervise(ctx, s)
+	}
+}
+
+// Stop shuts down every server.
+func (m *Manager) Stop() {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.wg.Wait()
+}
+
+// ToolCount returns the number of MCP tools currently registered.
+func (m *Manager) ToolCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.toolSet)
+}
+
+// connect starts the server, lists its tools and registers the allowed ones.
+func (m *Manager) connect(ctx context.Context, s *server) error {
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+
+	client, err := Connect(ctx, s.name, s.cfg)
+	if err != nil {
+		return err
+	}
+
+	infos, err := client.ListTools(ctx)
+	if err != nil {
+		client.Close()
+		return err
+	}
+
+	offered := make(map[string]bool)
+	for _, info := range infos {
+		if !s.allowed(info.Name) {
+			continue
+		}
+		tool := newTool(s, info)
+		m.register(tool)
+		offered[tool.Name()] = true
+	}
+
+	// After a restart, drop the tools the server no longer offers
+	m.mu.Lock()
+	for name := range s.tools {
+		if !offered[name] {
+			m.unregister(name)
+			delete(m.toolSet, name)
+		}
+	}
+	for name := range offered {
+		m.toolSet[name] = true
+	}
+	s.tools = offered
+	registered := len(offered)
+	m.mu.Unlock()
+
+	s.setClient(client)
+
+	logger.InfoCF("mcp", "MCP server connected",
+		map[string]interface{}{
+			"server":  s.name,
+			"remote":  client.ServerInfo().Name,
+			"tools":   registered,
+			"offered": len(infos),
+		})
+	return nil
+}
+
+// supervise waits for the server's connection to drop and reconnects with
+// exponential backoff until ctx is canceled.
+func (m *Manager) supervise(ctx context.Context, s *server) {
+	defer m.wg.Done()
+
+	delay := minRestartDelay
+	for {
+		if client := s.current(); client != nil {
+			started := time.Now()
+			select {
+			case <-ctx.Done():
+				client.Close()
+				s.setClient(nil)
+				return
+			case <-client.Done():
+			}
+			s.setClient(nil)
+			client.Close()
+			if time.Since(started) >= stableUptime {
+				delay = minRestartDelay
+			}
+			logger.WarnCF("mcp", "MCP server stopped, restarting",
+				map[string]interface{}{
+					"server": s.name,
+					"delay":  delay.String(),
+				})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		if err := m.connect(ctx, s); err != nil {
+			logger.WarnCF("mcp", "Failed to restart MCP server",
+				map[string]interface{}{
+					"server": s.name,
+					"error":  err.Error(),
+				})
+		}
+		delay *= 2
+		if delay > maxRestartDelay {
+			delay = maxRestartDelay
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// TestHelperProcess is not a real test. It acts as a stdio MCP server when
+// the test binary is started by helperServerConfig.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("PICOCLAW_MCP_HELPER") != "1" {
+		return
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var msg jsonrpcMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil || len(msg.ID) == 0 {
+			continue
+		}
+
+		var result interface{}
+		switch msg.Method {
+		case "initialize":
+			result = initializeResult{
+				ProtocolVersion: ProtocolVersion,
+				Capabilities:    map[string]interface{}{"tools": map[string]interface{}{}},
+				ServerInfo:      Implementation{Name: "helper", Version: "0.1"},
+			}
+		case "tools/list":
+			result = listToolsResult{Tools: []ToolInfo{
+				{Name: "echo", Description: "Echo text", InputSchema: map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"text": map[string]interface{}{"type": "string"}},
+				}},
+				{Name: "fail"},
+				{Name: "crash"},
+				{Name: "secret"},
+			}}
+		case "tools/call":
+			var params callToolParams
+			json.Unmarshal(msg.Params, &params)
+			switch params.Name {
+			case "echo":
+				result = CallToolResult{Content: []Content{{Type: "text", Text: fmt.Sprint(params.Arguments["text"])}}}
+			case "fail":
+				result = CallToolResult{Content: []Content{{Type: "text", Text: "it broke"}}, IsError: true}
+			case "crash":
+				os.Exit(1)
+			}
+		}
+
+		data, _ := json.Marshal(result)
+		reply, _ := json.Marshal(jsonrpcMessage{JSONRPC: "2.0", ID: msg.ID, Result: data})
+		fmt.Println(string(reply))
+	}
+	os.Exit(0)
+}
+
+func helperServerConfig() config.MCPServerConfig {
+	return config.MCPServerConfig{
+		Enabled: true,
+		Command: os.Args[0],
+		Args:    []string{"-test.run=TestHelperProcess"},
+		Env:     map[string]string{"PICOCLAW_MCP_HELPER": "1"},
+	}
+}
+
+func startHelperManager(t *testing.T, sc config.MCPServerConfig) (*Manager, *tools.ToolRegistry) {
+	t.Helper()
+
+	registry := tools.NewToolRegistry()
+	m := NewManager(config.MCPConfig{Servers: map[string]config.MCPServerConfig{"helper": sc}}, registry.Register, registry.Unregister)
+	m.Start(context.Background())
+	t.Cleanup(m.Stop)
+	return m, registry
+}
+
+func TestManager_RegistersAndCallsTools(t *testing.T) {
+	sc := helperServerConfig()
+	sc.DenyTools = []string{"secret"}
+	m, registry := startHelperManager(t, sc)
+
+	if m.ToolCount() != 3 {
+		t.Fatalf("Expected 3 registered tools, got %d", m.ToolCount())
+	}
+	if _, ok := registry.Get("mcp_helper_secret"); ok {
+		t.Error("Expected denied tool to be skipped")
+	}
+
+	tool, ok := registry.Get("mcp_helper_echo")
+	if !ok {
+		t.Fatal("Expected mcp_helper_echo to be registered")
+	}
+	props, _ := tool.Parameters()["properties"].(map[string]interface{})
+	if _, ok := props["text"]; !ok {
+		t.Errorf("Expected the server schema as parameters, got %v", tool.Parameters())
+	}
+
+	result := registry.Execute(context.Background(), "mcp_helper_echo", map[string]interface{}{"text": "hello"})
+	if result.IsError || result.ForLLM != "hello" {
+		t.Errorf("Expected echo result 'hello', got %+v", result)
+	}
+
+	result = registry.Execute(context.Background(), "mcp_helper_fail", nil)
+	if !result.IsError || result.ForLLM != "it broke" {
+		t.Errorf("Expected error result 'it broke', got %+v", result)
+	}
+}
+
+func TestManager_AllowList(t *testing.T) {
+	sc := helperServerConfig()
+	sc.AllowTools = []string{"ec*"}
+	_, registry := startHelperManager(t, sc)
+
+	if _, ok := registry.Get("mcp_helper_echo"); !ok {
+		t.Error("Expected allowed tool to be registered")
+	}
+	if _, ok := registry.Get("mcp_helper_fail"); ok {
+		t.Error("Expected tool outside the allow list to be skipped")
+	}
+}
+
+func TestManager_RestartsCrashedServer(t *testing.T) {
+	_, registry := startHelperManager(t, helperServerConfig())
+
+	result := registry.Execute(context.Background(), "mcp_helper_crash", nil)
+	if !result.IsError {
+		t.Fatalf("Expected crash call to fail, got %+v", result)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		result = registry.Execute(context.Background(), "mcp_helper_echo", map[string]interface{}{"text": "back"})
+		if !result.IsError {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if result.IsError || result.ForLLM != "back" {
+		t.Errorf("Expected server to be restarted, got %+v", result)
+	}
+}
+
+func TestToolName(t *testing.T) {
+	if got := toolName("my server", "read.file"); got != "mcp_my_server_read_file" {
+		t.Errorf("toolName() = %q, want %q", got, "mcp_my_server_read_file")
+	}
+
+	long := toolName("server", string(make([]byte, 100)))
+	if len(long) != maxToolNameLength {
+		t.Errorf("Expected name truncated to %d characters, got %d", maxToolNameLength, len(long))
+	}
+}
@@ -0,0 +1,130 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ProtocolVersion is the MCP revision spoken by picoclaw.
+const ProtocolVersion = "2025-03-26"
+
+// supportedVersions lists the revisions the server accepts from clients.
+var supportedVersions = []string{"2025-06-18", ProtocolVersion, "2024-11-05"}
+
+// JSON-RPC error codes used by MCP.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// jsonrpcMessage is the wire form of every JSON-RPC 2.0 message: requests
+// carry Method and ID, notifications only Method, responses ID and either
+// Result or Error.
+type jsonrpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+func (m *jsonrpcMessage) isResponse() bool {
+	return m.Method == "" && len(m.ID) > 0
+}
+
+func (m *jsonrpcMessage) isNotification() bool {
+	return m.Method != "" && len(m.ID) == 0
+}
+
+// RPCError is a JSON-RPC error object returned by the remote side.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("MCP error %d: %s", e.Code, e.Message)
+}
+
+// Implementation identifies a client or server during initialization.
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type initializeParams struct {
+	ProtocolVersion string                 `json:"protocolVersion"`
+	Capabilities    map[string]interface{} `json:"capabilities"`
+	ClientInfo      Implementation         `json:"clientInfo"`
+}
+
+type initializeResult struct {
+	ProtocolVersion string                 `json:"protocolVersion"`
+	Capabilities    map[string]interface{} `json:"capabilities"`
+	ServerInfo      Implementation         `json:"serverInfo"`
+	Instructions    string                 `json:"instructions,omitempty"`
+}
+
+// ToolInfo describes a tool as advertised by tools/list.
+type ToolInfo struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+	Annotations *ToolAnnotations       `json:"annotations,omitempty"`
+}
+
+// ToolAnnotations are hints about a tool's behavior. Only the hints
+// picoclaw uses are listed.
+type ToolAnnotations struct {
+	ReadOnlyHint bool `json:"readOnlyHint,omitempty"` // the tool does not modify its environment
+}
+
+type listToolsParams struct {
+	Cursor string `json:"cursor,omitempty"`
+}
+
+type listToolsResult struct {
+	Tools      []ToolInfo `json:"tools"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
+type callToolParams struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+}
+
+// Content is a single content block of a tool result.
+type Content struct {
+	Type     string            `json:"type"` // text, image, audio, resource or resource_link
+	Text     string            `json:"text,omitempty"`
+	Data     string            `json:"data,omitempty"` // base64, for image and audio
+	MimeType string            `json:"mimeType,omitempty"`
+	URI      string            `json:"uri,omitempty"` // for resource_link
+	Name     string            `json:"name,omitempty"`
+	Resource *ResourceContents `json:"resource,omitempty"`
+}
+
+// ResourceContents is the payload of an embedded resource block.
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// CallToolResult is the result of tools/call.
+type CallToolResult struct {
+	Content           []Content       `json:"content"`
+	StructuredContent json.RawMessage `json:"structuredContent,omitempty"`
+	IsError           bool            `json:"isError,omitempty"`
+}
+
+// TextContent returns a text content block.
+func TextContent(text string) Content {
+	return Content{Type: "text", Text: text}
+}
@@ -0,0 +1,265 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// Server exposes the tools of a tools.ToolRegistry to MCP clients over
+// newline-delimited JSON-RPC (the stdio transport).
+type Server struct {
+	registry *tools.ToolRegistry
+	info     Implementation
+
+	writeMu sync.Mutex
+	out     io.Writer
+
+	mu       sync.Mutex
+	inflight map[string]context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func NewServer(registry *tools.ToolRegistry, info Implementation) *Server {
+	return &Server{
+		registry: registry,
+		info:     info,
+		inflight: make(map[string]context.CancelFunc),
+	}
+}
+
+// Serve handles requests read from in and writes responses to out until in
+// is closed or ctx is canceled. Tool calls run concurrently; Serve waits for
+// them to finish before returning.
+func (s *Server) Serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	s.out = out
+	defer s.wg.Wait()
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(in)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				select {
+				case lines <- line:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			return err
+		case line := <-lines:
+			s.handleLine(ctx, line)
+		}
+	}
+}
+
+func (s *Server) handleLine(ctx context.Context, line []byte) {
+	var msg jsonrpcMessage
+	if err := json.Unmarshal(line, &msg); err != nil {
+		s.replyError(json.RawMessage("null"), codeParseError, "parse error")
+		return
+	}
+	if msg.JSONRPC != "2.0" || msg.Method == "" {
+		if len(msg.ID) > 0 && !msg.isResponse() {
+			s.replyError(msg.ID, codeInvalidRequest, "invalid request")
+		}
+		return
+	}
+
+	if msg.isNotification() {
+		s.handleNotification(&msg)
+		return
+	}
+
+	switch msg.Method {
+	case "initialize":
+		s.handleInitialize(&msg)
+	case "ping":
+		s.reply(msg.ID, struct{}{})
+	case "tools/list":
+		s.handleListTools(&msg)
+	case "tools/call":
+		s.startCall(ctx, &msg)
+	default:
+		s.replyError(msg.ID, codeMethodNotFound, "method not found: "+msg.Method)
+	}
+}
+
+func (s *Server) handleNotification(msg *jsonrpcMessage) {
+	if msg.Method != "notifications/cancelled" {
+		return
+	}
+
+	var params struct {
+		RequestID json.RawMessage `json:"requestId"`
+	}
+	if json.Unmarshal(msg.Params, &params) != nil {
+		return
+	}
+
+	s.mu.Lock()
+	cancel, ok := s.inflight[string(params.RequestID)]
+	s.mu.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+func (s *Server) handleInitialize(msg *jsonrpcMessage) {
+	var params initializeParams
+	json.Unmarshal(msg.Params, &params)
+
+	// Answer with the client's revision when we speak it, otherwise offer ours.
+	version := ProtocolVersion
+	for _, v := range supportedVersions {
+		if v == params.ProtocolVersion {
+			version = v
+			break
+		}
+	}
+
+	logger.InfoCF("mcp", "MCP client connected",
+		map[string]interface{}{
+			"client":  params.ClientInfo.Name,
+			"version": version,
+		})
+
+	s.reply(msg.ID, initializeResult{
+		ProtocolVersion: version,
+		Capabilities: map[string]interface{}{
+			"tools": map[string]interface{}{"listChanged": false},
+		},
+		ServerInfo: s.info,
+	})
+}
+
+func (s *Server) handleListTools(msg *jsonrpcMessage) {
+	names := s.registry.List()
+	sort.Strings(names)
+
+	infos := make([]ToolInfo, 0, len(names))
+	for _, name := range names {
+		tool, ok := s.registry.Get(name)
+		if !ok {
+			continue
+		}
+		info := ToolInfo{
+			Name:        tool.Name(),
+			Description: tool.Description(),
+			InputSchema: tool.Parameters(),
+		}
+		if tools.IsConcurrencySafe(tool) {
+			info.Annotations = &ToolAnnotations{ReadOnlyHint: true}
+		}
+		infos = append(infos, info)
+	}
+
+	s.reply(msg.ID, listToolsResult{Tools: infos})
+}
+
+// startCall runs a tools/call request in the background so that slow tools
+// do not block other requests or cancellation notifications.
+func (s *Server) startCall(ctx context.Context, msg *jsonrpcMessage) {
+	var params callToolParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil || params.Name == "" {
+		s.replyError(msg.ID, codeInvalidParams, "invalid tools/call params")
+		return
+	}
+	if _, ok := s.registry.Get(params.Name); !ok {
+		s.replyError(msg.ID, codeInvalidParams, fmt.Sprintf("unknown tool: %s", params.Name))
+		return
+	}
+	if params.Arguments == nil {
+		params.Arguments = map[string]interface{}{}
+	}
+
+	callCtx, cancel := context.WithCancel(ctx)
+	key := string(msg.ID)
+	s.mu.Lock()
+	s.inflight[key] = cancel
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.inflight, key)
+			s.mu.Unlock()
+			cancel()
+		}()
+
+		result := s.registry.Execute(callCtx, params.Name, params.Arguments)
+		if callCtx.Err() != nil {
+			// The client gave up on this request; no response is expected.
+			return
+		}
+		s.reply(msg.ID, toCallToolResult(result))
+	}()
+}
+
+// toCallToolResult maps a local tool result onto MCP content. Only ForLLM
+// is returned: ForUser is meant for chat channels, not for MCP clients.
+func toCallToolResult(result *tools.ToolResult) CallToolResult {
+	text := result.ForLLM
+	if text == "" && result.Err != nil {
+		text = result.Err.Error()
+	}
+	return CallToolResult{
+		Content: []Content{TextContent(text)},
+		IsError: result.IsError,
+	}
+}
+
+func (s *Server) reply(id json.RawMessage, result interface{}) {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		s.replyError(id, codeInternalError, err.Error())
+		return
+	}
+	s.write(&jsonrpcMessage{JSONRPC: "2.0", ID: id, Result: raw})
+}
+
+func (s *Server) replyError(id json.RawMessage, code int, message string) {
+	s.write(&jsonrpcMessage{JSONRPC: "2.0", ID: id, Error: &RPCError{Code: code, Message: message}})
+}
+
+func (s *Server) write(msg *jsonrpcMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if _, err := s.out.Write(append(data, '\n')); err != nil {
+		logger.ErrorCF("mcp", "Failed to write MCP response",
+			map[string]interface{}{
+				"error": err.Error(),
+			})
+	}
+}
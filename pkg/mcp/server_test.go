@@ -0,0 +1,129 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+type upperTool struct{}
+
+func (t *upperTool) Name() string        { return "upper" }
+func (t *upperTool) Description() string { return "Upper-case text" }
+func (t *upperTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"text": map[string]interface{}{"type": "string"}},
+		"required":   []string{"text"},
+	}
+}
+func (t *upperTool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	text, ok := args["text"].(string)
+	if !ok {
+		return tools.ErrorResult("text is required")
+	}
+	return tools.UserResult(strings.ToUpper(text))
+}
+
+func serveLines(t *testing.T, lines ...string) []jsonrpcMessage {
+	t.Helper()
+
+	registry := tools.NewToolRegistry()
+	registry.Register(&upperTool{})
+	server := NewServer(registry, Implementation{Name: "picoclaw", Version: "test"})
+
+	var out strings.Builder
+	in := strings.NewReader(strings.Join(lines, "\n") + "\n")
+	if err := server.Serve(context.Background(), in, &out); err != nil {
+		t.Fatalf("Serve() error: %v", err)
+	}
+
+	var msgs []jsonrpcMessage
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var msg jsonrpcMessage
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("Invalid response line %q: %v", line, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func TestServer_InitializeAndListTools(t *testing.T) {
+	msgs := serveLines(t,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+	)
+	if len(msgs) != 2 {
+		t.Fatalf("Expected 2 responses, got %d", len(msgs))
+	}
+
+	var init initializeResult
+	json.Unmarshal(msgs[0].Result, &init)
+	if init.ProtocolVersion != "2024-11-05" {
+		t.Errorf("Expected negotiated version 2024-11-05, got %q", init.ProtocolVersion)
+	}
+	if init.ServerInfo.Name != "picoclaw" {
+		t.Errorf("Expected server name picoclaw, got %q", init.ServerInfo.Name)
+	}
+
+	var list listToolsResult
+	json.Unmarshal(msgs[1].Result, &list)
+	if len(list.Tools) != 1 || list.Tools[0].Name != "upper" {
+		t.Fatalf("Expected tool list [upper], got %+v", list.Tools)
+	}
+	if list.Tools[0].InputSchema["required"] == nil {
+		t.Errorf("Expected tool schema to be passed through, got %v", list.Tools[0].InputSchema)
+	}
+}
+
+func TestServer_CallTool(t *testing.T) {
+	msgs := serveLines(t,
+		`{"jsonrpc":"2.0","id":"a","method":"tools/call","params":{"name":"upper","arguments":{"text":"hi"}}}`,
+	)
+	if len(msgs) != 1 || string(msgs[0].ID) != `"a"` {
+		t.Fatalf("Expected one response with id \"a\", got %+v", msgs)
+	}
+
+	var result CallToolResult
+	json.Unmarshal(msgs[0].Result, &result)
+	if result.IsError || len(result.Content) != 1 || result.Content[0].Text != "HI" {
+		t.Errorf("Expected text result HI, got %+v", result)
+	}
+}
+
+func TestServer_CallToolErrors(t *testing.T) {
+	msgs := serveLines(t,
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"upper","arguments":{}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"missing"}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"resources/list"}`,
+		`not json`,
+	)
+	if len(msgs) != 4 {
+		t.Fatalf("Expected 4 responses, got %d", len(msgs))
+	}
+
+	byID := make(map[string]jsonrpcMessage)
+	for _, m := range msgs {
+		byID[string(m.ID)] = m
+	}
+
+	var result CallToolResult
+	json.Unmarshal(byID["1"].Result, &result)
+	if !result.IsError || result.Content[0].Text != "text is required" {
+		t.Errorf("Expected tool error to be an isError result, got %+v", result)
+	}
+	if e := byID["2"].Error; e == nil || e.Code != codeInvalidParams {
+		t.Errorf("Expected invalid params error for unknown tool, got %+v", e)
+	}
+	if e := byID["3"].Error; e == nil || e.Code != codeMethodNotFound {
+		t.Errorf("Expected method not found error, got %+v", e)
+	}
+	if e := byID["null"].Error; e == nil || e.Code != codeParseError {
+		t.Errorf("Expected parse error, got %+v", e)
+	}
+}
@@ -0,0 +1,135 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// maxToolNameLength is the longest function name accepted by the LLM APIs.
+const maxToolNameLength = 64
+
+// Tool exposes one remote MCP tool through the local tools.Tool interface.
+// Calls go to whichever connection the server currently has, so the tool
+// keeps working after the server is restarted.
+type Tool struct {
+	server *server
+	name   string
+	info   ToolInfo
+}
+
+func newTool(s *server, info ToolInfo) *Tool {
+	return &Tool{
+		server: s,
+		name:   toolName(s.name, info.Name),
+		info:   info,
+	}
+}
+
+// toolName builds the registry name "mcp_<server>_<tool>", keeping only the
+// characters that LLM function names allow.
+func toolName(server, tool string) string {
+	name := sanitizeName("mcp_" + server + "_" + tool)
+	if len(name) > maxToolNameLength {
+		name = name[:maxToolNameLength]
+	}
+	return name
+}
+
+func sanitizeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
+
+func (t *Tool) Name() string {
+	return t.name
+}
+
+func (t *Tool) Description() string {
+	if t.info.Description != "" {
+		return t.info.Description
+	}
+	return fmt.Sprintf("Tool %s provided by MCP server %s", t.info.Name, t.server.name)
+}
+
+// ConcurrencySafe lets calls of tools the server marks read-only run in
+// parallel.
+func (t *Tool) ConcurrencySafe() bool {
+	return t.info.Annotations != nil && t.info.Annotations.ReadOnlyHint
+}
+
+func (t *Tool) Parameters() map[string]interface{} {
+	schema := t.info.InputSchema
+	if schema == nil {
+		schema = map[string]interface{}{"type": "object"}
+	}
+	if _, ok := schema["properties"]; !ok {
+		// Some LLM APIs reject object schemas without properties.
+		copied := make(map[string]interface{}, len(schema)+1)
+		for k, v := range schema {
+			copied[k] = v
+		}
+		copied["properties"] = map[string]interface{}{}
+		schema = copied
+	}
+	return schema
+}
+
+func (t *Tool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	client := t.server.current()
+	if client == nil {
+		return tools.ErrorResult(fmt.Sprintf("MCP server %q is not running", t.server.name))
+	}
+
+	result, err := client.CallTool(ctx, t.info.Name, args)
+	if err != nil {
+		return tools.ErrorResult(fmt.Sprintf("MCP tool %s failed: %v", t.info.Name, err)).WithError(err)
+	}
+
+	text := contentText(result)
+	if result.IsError {
+		return tools.ErrorResult(text)
+	}
+	return tools.SilentResult(text)
+}
+
+// contentText flattens MCP content blocks into the text handed to the LLM.
+// Binary blocks are described rather than inlined.
+func contentText(result *CallToolResult) string {
+	parts := make([]string, 0, len(result.Content))
+	for _, c := range result.Content {
+		switch c.Type {
+		case "text":
+			parts = append(parts, c.Text)
+		case "image", "audio":
+			parts = append(parts, fmt.Sprintf("[%s: %s, %d bytes base64]", c.Type, c.MimeType, len(c.Data)))
+		case "resource":
+			if c.Resource == nil {
+				continue
+			}
+			if c.Resource.Text != "" {
+				parts = append(parts, c.Resource.Text)
+			} else {
+				parts = append(parts, fmt.Sprintf("[resource: %s (%s)]", c.Resource.URI, c.Resource.MimeType))
+			}
+		case "resource_link":
+			parts = append(parts, fmt.Sprintf("[resource: %s]", c.URI))
+		}
+	}
+
+	if len(parts) == 0 && len(result.StructuredContent) > 0 {
+		return string(result.StructuredContent)
+	}
+	if len(parts) == 0 {
+		return "(no output)"
+	}
+	return strings.Join(parts, "\n")
+}
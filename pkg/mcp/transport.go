@@ -0,0 +1,257 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// errTransportClosed is returned for calls made after the server went away.
+var errTransportClosed = errors.New("MCP server connection closed")
+
+// transport carries JSON-RPC messages to one MCP server.
+type transport interface {
+	// Call sends a request and waits for the matching response.
+	Call(ctx context.Context, method string, params interface{}) (json.RawMessage, error)
+	// Notify sends a notification, which has no response.
+	Notify(ctx context.Context, method string, params interface{}) error
+	// Done is closed once the connection is lost and cannot be used again.
+	Done() <-chan struct{}
+	Close() error
+}
+
+// stdioTransport talks to a server started as a child process, exchanging
+// newline-delimited JSON-RPC messages over its stdin and stdout.
+type stdioTransport struct {
+	name    string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	writeMu sync.Mutex
+	nextID  atomic.Int64
+	mu      sync.Mutex
+	pending map[int64]chan *jsonrpcMessage
+	done    chan struct{}
+	closing atomic.Bool
+}
+
+func startStdioTransport(name, command string, args []string, env map[string]string) (*stdioTransport, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stdout: %w", err)
+	}
+	cmd.Stderr = &stderrLogger{name: name}
+	// Do not hang in Wait if a grandchild keeps stderr open.
+	cmd.WaitDelay = 2 * time.Second
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", command, err)
+	}
+
+	t := &stdioTransport{
+		name:    name,
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[int64]chan *jsonrpcMessage),
+		done:    make(chan struct{}),
+	}
+
+	go t.readLoop(stdout)
+
+	return t, nil
+}
+
+func (t *stdioTransport) Call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	id := t.nextID.Add(1)
+	ch := make(chan *jsonrpcMessage, 1)
+
+	t.mu.Lock()
+	t.pending[id] = ch
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+	}()
+
+	if err := t.write(method, json.RawMessage(strconv.FormatInt(id, 10)), params); err != nil {
+		return nil, err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return nil, resp.Error
+		}
+		return resp.Result, nil
+	case <-t.done:
+		return nil, errTransportClosed
+	case <-ctx.Done():
+		// Tell the server to stop working on the abandoned request.
+		t.write("notifications/cancelled", nil, map[string]interface{}{
+			"requestId": id,
+			"reason":    ctx.Err().Error(),
+		})
+		return nil, ctx.Err()
+	}
+}
+
+func (t *stdioTransport) Notify(ctx context.Context, method string, params interface{}) error {
+	return t.write(method, nil, params)
+}
+
+func (t *stdioTransport) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *stdioTransport) Close() error {
+	t.closing.Store(true)
+	t.stdin.Close()
+	if t.cmd.Process != nil {
+		t.cmd.Process.Kill()
+	}
+	<-t.done
+	return nil
+}
+
+func (t *stdioTransport) write(method string, id json.RawMessage, params interface{}) error {
+	msg := jsonrpcMessage{JSONRPC: "2.0", ID: id, Method: method}
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("failed to marshal params: %w", err)
+		}
+		msg.Params = raw
+	}
+	return t.send(&msg)
+}
+
+func (t *stdioTransport) send(msg *jsonrpcMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-t.done:
+		return errTransportClosed
+	default:
+	}
+
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	if _, err := t.stdin.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write to MCP server: %w", err)
+	}
+	return nil
+}
+
+// readLoop dispatches messages from the server until stdout is closed,
+// which happens when the process exits.
+func (t *stdioTransport) readLoop(stdout io.Reader) {
+	defer func() {
+		err := t.cmd.Wait()
+		if !t.closing.Load() {
+			logger.WarnCF("mcp", "MCP server process exited",
+				map[string]interface{}{
+					"server": t.name,
+					"error":  fmt.Sprint(err),
+				})
+		}
+		close(t.done)
+	}()
+
+	reader := bufio.NewReader(stdout)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			t.handleLine(line)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (t *stdioTransport) handleLine(line []byte) {
+	var msg jsonrpcMessage
+	if err := json.Unmarshal(line, &msg); err != nil {
+		logger.DebugCF("mcp", "Ignoring non JSON-RPC output",
+			map[string]interface{}{
+				"server": t.name,
+				"line":   string(line),
+			})
+		return
+	}
+
+	switch {
+	case msg.isResponse():
+		id, err := strconv.ParseInt(string(msg.ID), 10, 64)
+		if err != nil {
+			return
+		}
+		t.mu.Lock()
+		ch, ok := t.pending[id]
+		t.mu.Unlock()
+		if ok {
+			ch <- &msg
+		}
+	case msg.isNotification():
+		logger.DebugCF("mcp", "MCP notification",
+			map[string]interface{}{
+				"server": t.name,
+				"method": msg.Method,
+			})
+	default:
+		// Server-initiated request. Only ping is supported; sampling and
+		// roots are not advertised in our capabilities.
+		reply := &jsonrpcMessage{JSONRPC: "2.0", ID: msg.ID}
+		if msg.Method == "ping" {
+			reply.Result = json.RawMessage("{}")
+		} else {
+			reply.Error = &RPCError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}
+		}
+		t.send(reply)
+	}
+}
+
+// stderrLogger forwards a server's stderr to the debug log.
+type stderrLogger struct {
+	name string
+}
+
+func (l *stderrLogger) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		logger.DebugCF("mcp", "MCP server stderr",
+			map[string]interface{}{
+				"server": l.name,
+				"line":   line,
+			})
+	}
+	return len(p), nil
+}
@@ -0,0 +1,399 @@
+// Package netguard keeps HTTP requests made on behalf of the agent, such as
+// web_fetch, media downloads and skill installs, away from the host's own
+// network. Addresses are checked when connecting, after DNS resolution, so
+// redirects and DNS rebinding cannot reach a blocked address either.
+//
+// By default loopback, private, link-local (including the cloud metadata
+// endpoint 169.254.169.254), carrier-grade NAT and other special-purpose
+// ranges are blocked. Hosts can be allowed or denied by name or CIDR.
+//
+// Requests can go through an HTTP proxy. The proxy resolves and connects
+// to the requested host, so that host is checked before the request is
+// handed to the proxy, and the proxy itself may be on a private address.
+package netguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// ErrBlocked is wrapped by the errors of connections the policy refuses.
+var ErrBlocked = errors.New("blocked by network policy")
+
+// blockedRanges are the special-purpose ranges not covered by the net.IP
+// predicates used in reason.
+var blockedRanges = []struct {
+	cidr   string
+	reason string
+}{
+	{"0.0.0.0/8", "a local network address"},
+	{"100.64.0.0/10", "a carrier-grade NAT address"}, // includes Alibaba Cloud's metadata endpoint
+	{"192.0.0.0/24", "a special-purpose address"},
+	{"198.18.0.0/15", "a benchmarking address"},
+	{"240.0.0.0/4", "a reserved address"},
+}
+
+// nat64Prefix embeds IPv4 addresses in IPv6 ones; the embedded address is
+// checked instead.
+var nat64Prefix = mustParseCIDR("64:ff9b::/96")
+
+// Policy decides which hosts and addresses outbound requests may reach.
+type Policy struct {
+	allowPrivate bool
+	allowHosts   []string // host names, "*." matches subdomains
+	allowNets    []*net.IPNet
+	denyHosts    []string
+	denyNets     []*net.IPNet
+	blocked      []*net.IPNet
+	reasons      []string // of blocked, by index
+
+	proxyURL   func(*http.Request) (*url.URL, error) // nil connects directly
+	proxyHosts []string                              // hosts of the proxies, reachable even when private
+
+	transport *http.Transport
+}
+
+// New returns the policy configured by cfg.
+func New(cfg config.NetworkConfig) (*Policy, error) {
+	p := &Policy{allowPrivate: cfg.AllowPrivate}
+
+	var err error
+	if p.allowHosts, p.allowNets, err = parseHosts(cfg.AllowHosts); err != nil {
+		return nil, fmt.Errorf("allow_hosts: %w", err)
+	}
+	if p.denyHosts, p.denyNets, err = parseHosts(cfg.DenyHosts); err != nil {
+		return nil, fmt.Errorf("deny_hosts: %w", err)
+	}
+	for _, r := range blockedRanges {
+		p.blocked = append(p.blocked, mustParseCIDR(r.cidr))
+		p.reasons = append(p.reasons, r.reason)
+	}
+
+	if err := p.setProxy(cfg.Proxy); err != nil {
+		return nil, fmt.Errorf("proxy: %w", err)
+	}
+
+	p.transport = &http.Transport{
+		DialContext:           p.DialContext,
+		Proxy:                 p.proxy,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+		TLSHandshakeTimeout:   15 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	return p, nil
+}
+
+// setProxy configures the proxy: a URL, "direct" for none, or empty or
+// "env" for the one in the HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables.
+func (p *Policy) setProxy(proxy string) error {
+	var proxies []string
+	switch proxy = strings.TrimSpace(proxy); proxy {
+	case "direct":
+		return nil
+	case "", "env":
+		// Read now rather than through http.ProxyFromEnvironment, which
+		// caches the variables on first use.
+		env := httpproxy.FromEnvironment()
+		if env.HTTPProxy == "" && env.HTTPSProxy == "" {
+			return nil
+		}
+		proxyFunc := env.ProxyFunc()
+		p.proxyURL = func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
+		}
+		for _, v := range []string{env.HTTPProxy, env.HTTPSProxy} {
+			if v != "" {
+				proxies = append(proxies, v)
+			}
+		}
+	default:
+		u, err := url.Parse(proxy)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("invalid URL %q", proxy)
+		}
+		p.proxyURL = http.ProxyURL(u)
+		proxies = append(proxies, proxy)
+	}
+
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "://") {
+			proxy = "http://" + proxy
+		}
+		if u, err := url.Parse(proxy); err == nil && u.Hostname() != "" {
+			p.proxyHosts = append(p.proxyHosts, normalizeHost(u.Hostname()))
+		}
+	}
+	return nil
+}
+
+// parseHosts splits entries into host name patterns and networks. A plain
+// IP address is a network of one address.
+func parseHosts(entries []string) ([]string, []*net.IPNet, error) {
+	var hosts []string
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		entry = normalizeHost(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			_, ipNet, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid CIDR %q", entry)
+			}
+			nets = append(nets, ipNet)
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		if name, _ := strings.CutPrefix(entry, "*."); name == "" || strings.Contains(name, "*") {
+			return nil, nil, fmt.Errorf("invalid host %q: only a leading \"*.\" is supported", entry)
+		}
+		hosts = append(hosts, entry)
+	}
+	return hosts, nets, nil
+}
+
+func normalizeHost(host string) string {
+	host = strings.TrimSpace(strings.ToLower(host))
+	host = strings.TrimSuffix(host, ".")
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
+// matchHost reports whether host matches one of the patterns. "*.lan"
+// matches the subdomains of lan, not lan itself.
+func matchHost(host string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if domain, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func matchNets(ip net.IP, nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckHost checks a host name or IP address before it is resolved. Host
+// names pass unless denied; their addresses are checked by CheckIP.
+func (p *Policy) CheckHost(host string) error {
+	return p.checkHost(normalizeHost(host), false)
+}
+
+func (p *Policy) checkHost(host string, allowed bool) error {
+	if matchHost(host, p.denyHosts) {
+		return fmt.Errorf("%w: %s is denied", ErrBlocked, host)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return p.CheckIP(ip, allowed)
+	}
+	return nil
+}
+
+// CheckIP checks an address a request is about to connect to. Addresses of
+// allowed hosts skip the built-in ranges, but not deny_hosts.
+func (p *Policy) CheckIP(ip net.IP, hostAllowed bool) error {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	} else if nat64Prefix.Contains(ip) {
+		ip = ip[12:16]
+	}
+	if matchNets(ip, p.denyNets) {
+		return fmt.Errorf("%w: %s is denied", ErrBlocked, ip)
+	}
+	if hostAllowed || p.allowPrivate || matchNets(ip, p.allowNets) {
+		return nil
+	}
+	if reason := p.reason(ip); reason != "" {
+		return fmt.Errorf("%w: %s is %s", ErrBlocked, ip, reason)
+	}
+	return nil
+}
+
+// reason returns why ip is in a blocked range, or "" if it is not.
+func (p *Policy) reason(ip net.IP) string {
+	switch {
+	case ip.IsLoopback():
+		return "a loopback address"
+	case ip.IsPrivate():
+		return "a private address"
+	case ip.IsLinkLocalUnicast(), ip.IsLinkLocalMulticast():
+		return "a link-local address"
+	case ip.IsUnspecified():
+		return "an unspecified address"
+	case ip.IsMulticast():
+		return "a multicast address"
+	}
+	for i, n := range p.blocked {
+		if n.Contains(ip) {
+			return p.reasons[i]
+		}
+	}
+	return ""
+}
+
+// DialContext connects like net.Dialer.DialContext, refusing addresses
+// the policy blocks. Every address tried is checked after resolution.
+func (p *Policy) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	name := normalizeHost(host)
+	allowed := matchHost(name, p.allowHosts) || matchHost(name, p.proxyHosts)
+	if err := p.checkHost(name, allowed); err != nil {
+		logBlocked(host, err)
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			ipStr, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(ipStr)
+			if ip == nil {
+				return fmt.Errorf("%w: cannot parse address %q", ErrBlocked, ipStr)
+			}
+			if err := p.CheckIP(ip, allowed); err != nil {
+				logBlocked(host, err)
+				return err
+			}
+			return nil
+		},
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+func logBlocked(host string, err error) {
+	logger.WarnCF("netguard", "Blocked outbound connection",
+		map[string]interface{}{
+			"host":   host,
+			"reason": err.Error(),
+		})
+}
+
+// proxy returns the proxy to use for req, if any. The requested host is
+// checked first, since only the proxy's address reaches DialContext: its
+// name is checked and, if it resolves here, so are its addresses. Names
+// that do not resolve locally are left to the proxy.
+func (p *Policy) proxy(req *http.Request) (*url.URL, error) {
+	if p.proxyURL == nil {
+		return nil, nil
+	}
+	proxyURL, err := p.proxyURL(req)
+	if err != nil || proxyURL == nil {
+		return proxyURL, err
+	}
+
+	host := req.URL.Hostname()
+	if err := p.CheckHost(host); err != nil {
+		logBlocked(host, err)
+		return nil, err
+	}
+	if net.ParseIP(normalizeHost(host)) == nil {
+		allowed := matchHost(normalizeHost(host), p.allowHosts)
+		addrs, err := net.DefaultResolver.LookupIPAddr(req.Context(), host)
+		if err != nil {
+			return proxyURL, nil
+		}
+		for _, addr := range addrs {
+			if err := p.CheckIP(addr.IP, allowed); err != nil {
+				logBlocked(host, err)
+				return nil, err
+			}
+		}
+	}
+	return proxyURL, nil
+}
+
+// Transport returns an HTTP transport that connects through the policy
+// and the configured proxy, if any. Proxy environment variables are only
+// used with the "env" proxy setting.
+func (p *Policy) Transport() *http.Transport {
+	return p.transport
+}
+
+// Client returns an HTTP client with the given timeout that connects
+// through the policy.
+func (p *Policy) Client(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: p.transport}
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultPolicy *Policy
+)
+
+// SetDefault replaces the policy used by Default, normally with the one in
+// config.json.
+func SetDefault(p *Policy) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultPolicy = p
+}
+
+// Default returns the policy set by SetDefault, or the built-in one, which
+// blocks the special-purpose ranges and allows everything else.
+func Default() *Policy {
+	defaultMu.RLock()
+	p := defaultPolicy
+	defaultMu.RUnlock()
+	if p != nil {
+		return p
+	}
+
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultPolicy == nil {
+		defaultPolicy, _ = New(config.NetworkConfig{})
+	}
+	return defaultPolicy
+}
+
+// Client returns an HTTP client using the default policy.
+func Client(timeout time.Duration) *http.Client {
+	return Default().Client(timeout)
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}
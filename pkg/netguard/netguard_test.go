@@ -0,0 +1,174 @@
+package netguard
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestPolicy_CheckIP(t *testing.T) {
+	policy, err := New(config.NetworkConfig{
+		AllowHosts: []string{"192.168.1.0/24", "nas.lan"},
+		DenyHosts:  []string{"203.0.113.7", "*.tracker.example"},
+	})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	tests := []struct {
+		ip          string
+		hostAllowed bool
+		blocked     bool
+	}{
+		{"93.184.216.34", false, false},
+		{"2606:2800:220:1::1", false, false},
+		{"127.0.0.1", false, true},
+		{"::1", false, true},
+		{"10.1.2.3", false, true},
+		{"172.16.0.1", false, true},
+		{"169.254.169.254", false, true},
+		{"100.100.100.200", false, true},
+		{"0.0.0.0", false, true},
+		{"fd00:ec2::254", false, true},
+		{"::ffff:127.0.0.1", false, true},
+		{"64:ff9b::a9fe:a9fe", false, true}, // NAT64 of 169.254.169.254
+		{"192.168.1.20", false, false},      // allowed CIDR
+		{"192.168.2.20", false, true},
+		{"10.0.0.5", true, false},   // address of an allowed host name
+		{"203.0.113.7", true, true}, // denied even for allowed hosts
+		{"203.0.113.8", false, false},
+	}
+	for _, tt := range tests {
+		err := policy.CheckIP(net.ParseIP(tt.ip), tt.hostAllowed)
+		if blocked := err != nil; blocked != tt.blocked {
+			t.Errorf("CheckIP(%s, %v) = %v, want blocked %v", tt.ip, tt.hostAllowed, err, tt.blocked)
+		}
+		if err != nil && !errors.Is(err, ErrBlocked) {
+			t.Errorf("CheckIP(%s) error %v does not wrap ErrBlocked", tt.ip, err)
+		}
+	}
+
+	for host, blocked := range map[string]bool{
+		"example.com":         false,
+		"a.tracker.example":   true,
+		"A.Tracker.Example.":  true,
+		"127.0.0.1":           true,
+		"[::1]":               true,
+		"tracker.example.net": false,
+	} {
+		if err := policy.CheckHost(host); (err != nil) != blocked {
+			t.Errorf("CheckHost(%q) = %v, want blocked %v", host, err, blocked)
+		}
+	}
+
+	open, _ := New(config.NetworkConfig{AllowPrivate: true, DenyHosts: []string{"169.254.0.0/16"}})
+	if err := open.CheckIP(net.ParseIP("10.1.2.3"), false); err != nil {
+		t.Errorf("allow_private CheckIP(10.1.2.3) = %v, want nil", err)
+	}
+	if err := open.CheckIP(net.ParseIP("169.254.169.254"), false); err == nil {
+		t.Error("allow_private should not override deny_hosts")
+	}
+
+	if _, err := New(config.NetworkConfig{DenyHosts: []string{"10.0.0.0/33"}}); err == nil {
+		t.Error("New() with an invalid CIDR should fail")
+	}
+}
+
+func TestPolicy_Proxy(t *testing.T) {
+	// The proxy runs on loopback, which requests may not reach directly.
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "proxied %s", r.URL)
+	}))
+	defer proxy.Close()
+
+	policy, err := New(config.NetworkConfig{Proxy: proxy.URL, DenyHosts: []string{"denied.example"}})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	client := policy.Client(5 * time.Second)
+
+	resp, err := client.Get("http://picoclaw.invalid/page")
+	if err != nil {
+		t.Fatalf("Get through the proxy: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "proxied http://picoclaw.invalid/page" {
+		t.Errorf("proxy answered %q", body)
+	}
+
+	for _, target := range []string{"http://127.0.0.1:9/", "http://169.254.169.254/latest/", "http://localhost/", "http://denied.example/"} {
+		if _, err := client.Get(target); !errors.Is(err, ErrBlocked) {
+			t.Errorf("Get(%s) through the proxy = %v, want blocked", target, err)
+		}
+	}
+
+	if _, err := New(config.NetworkConfig{Proxy: "not a url"}); err == nil {
+		t.Error("New() with an invalid proxy should fail")
+	}
+}
+
+func TestPolicy_ProxyFromEnvironment(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "proxied %s", r.URL)
+	}))
+	defer proxy.Close()
+	t.Setenv("HTTP_PROXY", proxy.URL)
+	t.Setenv("NO_PROXY", "")
+
+	// Without a proxy setting the environment applies, as for a plain http.Client.
+	policy, err := New(config.NetworkConfig{})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	resp, err := policy.Client(5 * time.Second).Get("http://picoclaw.invalid/page")
+	if err != nil {
+		t.Fatalf("Get through the environment proxy: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "proxied http://picoclaw.invalid/page" {
+		t.Errorf("proxy answered %q", body)
+	}
+
+	direct, err := New(config.NetworkConfig{Proxy: "direct"})
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	if _, err := direct.Client(5 * time.Second).Get("http://picoclaw.invalid/page"); err == nil {
+		t.Error("Get with proxy \"direct\" should not use the environment proxy")
+	}
+}
+
+func TestMatchHost(t *testing.T) {
+	patterns := []string{"*.example.com", "nas.lan"}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"www.example.com", true},
+		{"a.b.example.com", true},
+		{"example.com", false},
+		{"evilexample.com", false},
+		{"nas.lan", true},
+		{"xnas.lan", false},
+	}
+	for _, tt := range tests {
+		if got := matchHost(tt.host, patterns); got != tt.want {
+			t.Errorf("matchHost(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+
+	for _, entry := range []string{"*example.com", "*", "*.", "www.*.com", "*.*.com"} {
+		if _, err := New(config.NetworkConfig{DenyHosts: []string{entry}}); err == nil {
+			t.Errorf("New() with deny_hosts %q should fail", entry)
+		}
+	}
+}
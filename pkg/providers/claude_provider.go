@@ -52,10 +52,83 @@ func (p *ClaudeProvider) Chat(ctx context.Context, messages []Message, tools []T
 	return parseClaudeResponse(resp), nil
 }
 
+// ChatStream implements StreamingProvider using the Messages streaming API.
+func (p *ClaudeProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onChunk StreamCallback) (*LLMResponse, error) {
+	var opts []option.RequestOption
+	if p.tokenSource != nil {
+		tok, err := p.tokenSource()
+		if err != nil {
+			return nil, fmt.Errorf("refreshing token: %w", err)
+		}
+		opts = append(opts, option.WithAuthToken(tok))
+	}
+
+	params, err := buildClaudeParams(messages, tools, model, options)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := p.client.Messages.NewStreaming(ctx, params, opts...)
+	defer stream.Close()
+
+	message := anthropic.Message{}
+	for stream.Next() {
+		event := stream.Current()
+		if err := message.Accumulate(event); err != nil {
+			return nil, fmt.Errorf("claude stream: %w", err)
+		}
+		if onChunk == nil {
+			continue
+		}
+
+		switch event.Type {
+		case "content_block_start":
+			if event.ContentBlock.Type == "tool_use" {
+				onChunk(StreamChunk{ToolCall: &ToolCallDelta{
+					Index: int(event.Index),
+					ID:    event.ContentBlock.ID,
+					Name:  event.ContentBlock.Name,
+				}})
+			}
+		case "content_block_delta":
+			switch event.Delta.Type {
+			case "text_delta":
+				onChunk(StreamChunk{Content: event.Delta.Text})
+			case "input_json_delta":
+				onChunk(StreamChunk{ToolCall: &ToolCallDelta{
+					Index:          int(event.Index),
+					ArgumentsDelta: event.Delta.PartialJSON,
+				}})
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, fmt.Errorf("claude API call: %w", err)
+	}
+
+	return parseClaudeResponse(&message), nil
+}
+
 func (p *ClaudeProvider) GetDefaultModel() string {
 	return "claude-sonnet-4-5-20250929"
 }
 
+// claudeContentBlocks converts message parts into text and base64 image blocks.
+func claudeContentBlocks(msg Message) []anthropic.ContentBlockParamUnion {
+	var blocks []anthropic.ContentBlockParamUnion
+	for _, part := range loadParts(msg.Parts) {
+		if part.Type == "image" {
+			blocks = append(blocks, anthropic.NewImageBlockBase64(part.MediaType, part.Data))
+		} else {
+			blocks = append(blocks, anthropic.NewTextBlock(part.Text))
+		}
+	}
+	if len(blocks) == 0 {
+		blocks = append(blocks, anthropic.NewTextBlock(msg.Content))
+	}
+	return blocks
+}
+
 func buildClaudeParams(messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (anthropic.MessageNewParams, error) {
 	var system []anthropic.TextBlockParam
 	var anthropicMessages []anthropic.MessageParam
@@ -69,6 +142,10 @@ func buildClaudeParams(messages []Message, tools []ToolDefinition, model string,
 				anthropicMessages = append(anthropicMessages,
 					anthropic.NewUserMessage(anthropic.NewToolResultBlock(msg.ToolCallID, msg.Content, false)),
 				)
+			} else if len(msg.Parts) > 0 {
+				anthropicMessages = append(anthropicMessages,
+					anthropic.NewUserMessage(claudeContentBlocks(msg)...),
+				)
 			} else {
 				anthropicMessages = append(anthropicMessages,
 					anthropic.NewUserMessage(anthropic.NewTextBlock(msg.Content)),
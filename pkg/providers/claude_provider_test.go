@@ -208,3 +208,28 @@ func createAnthropicTestClient(baseURL, token string) *anthropic.Client {
 	)
 	return &c
 }
+
+func TestBuildClaudeParams_ImageParts(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "describe", Parts: []ContentPart{
+			TextPart("describe"),
+			{Type: "image", MediaType: "image/png", Data: "aGVsbG8="},
+		}},
+	}
+	params, err := buildClaudeParams(messages, nil, "claude-sonnet-4-5-20250929", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("buildClaudeParams() error: %v", err)
+	}
+
+	blocks := params.Messages[0].Content
+	if len(blocks) != 2 {
+		t.Fatalf("len(Content) = %d, want 2", len(blocks))
+	}
+	image := blocks[1].OfImage
+	if image == nil || image.Source.OfBase64 == nil {
+		t.Fatalf("Expected base64 image block, got %+v", blocks[1])
+	}
+	if image.Source.OfBase64.Data != "aGVsbG8=" || string(image.Source.OfBase64.MediaType) != "image/png" {
+		t.Errorf("Unexpected image source: %+v", image.Source.OfBase64)
+	}
+}
@@ -182,6 +182,32 @@ func resolveCodexModel(model string) (string, string) {
 	return codexDefaultModel, "unsupported model family"
 }
 
+// codexContentList converts message parts into Responses API input text and
+// input image items.
+func codexContentList(msg Message) responses.ResponseInputMessageContentListParam {
+	var list responses.ResponseInputMessageContentListParam
+	for _, part := range loadParts(msg.Parts) {
+		if part.Type == "image" {
+			list = append(list, responses.ResponseInputContentUnionParam{
+				OfInputImage: &responses.ResponseInputImageParam{
+					Detail:   responses.ResponseInputImageDetailAuto,
+					ImageURL: openai.String(dataURL(part)),
+				},
+			})
+		} else {
+			list = append(list, responses.ResponseInputContentUnionParam{
+				OfInputText: &responses.ResponseInputTextParam{Text: part.Text},
+			})
+		}
+	}
+	if len(list) == 0 {
+		list = append(list, responses.ResponseInputContentUnionParam{
+			OfInputText: &responses.ResponseInputTextParam{Text: msg.Content},
+		})
+	}
+	return list
+}
+
 func buildCodexParams(messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) responses.ResponseNewParams {
 	var inputItems responses.ResponseInputParam
 	var instructions string
@@ -198,6 +224,13 @@ func buildCodexParams(messages []Message, tools []ToolDefinition, model string,
 						Output: responses.ResponseInputItemFunctionCallOutputOutputUnionParam{OfString: openai.Opt(msg.Content)},
 					},
 				})
+			} else if len(msg.Parts) > 0 {
+				inputItems = append(inputItems, responses.ResponseInputItemUnionParam{
+					OfMessage: &responses.EasyInputMessageParam{
+						Role:    responses.EasyInputMessageRoleUser,
+						Content: responses.EasyInputMessageContentUnionParam{OfInputItemContentList: codexContentList(msg)},
+					},
+				})
 			} else {
 				inputItems = append(inputItems, responses.ResponseInputItemUnionParam{
 					OfMessage: &responses.EasyInputMessageParam{
@@ -517,3 +517,25 @@ func writeCompletedSSE(w http.ResponseWriter, response map[string]interface{}) {
 	fmt.Fprintf(w, "data: %s\n\n", string(b))
 	fmt.Fprintf(w, "data: [DONE]\n\n")
 }
+
+func TestBuildCodexParams_ImageParts(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "describe", Parts: []ContentPart{
+			TextPart("describe"),
+			{Type: "image", MediaType: "image/jpeg", Data: "aGVsbG8="},
+		}},
+	}
+	params := buildCodexParams(messages, nil, "gpt-4o", map[string]interface{}{})
+
+	content := params.Input.OfInputItemList[0].OfMessage.Content.OfInputItemContentList
+	if len(content) != 2 {
+		t.Fatalf("len(content) = %d, want 2", len(content))
+	}
+	if content[0].OfInputText == nil || content[0].OfInputText.Text != "describe" {
+		t.Errorf("Expected input text first, got %+v", content[0])
+	}
+	image := content[1].OfInputImage
+	if image == nil || image.ImageURL.Or("") != "data:image/jpeg;base64,aGVsbG8=" {
+		t.Errorf("Expected input image data URL, got %+v", content[1])
+	}
+}
@@ -0,0 +1,159 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/openai/openai-go/v3"
+)
+
+// ErrorKind classifies a failed LLM call by what the caller can do about it.
+type ErrorKind string
+
+const (
+	ErrorRateLimit ErrorKind = "rate_limit" // retry later, ideally after Retry-After
+	ErrorServer    ErrorKind = "server"     // backend down or failing (5xx, connection errors)
+	ErrorAuth      ErrorKind = "auth"       // bad or expired credentials
+	ErrorTimeout   ErrorKind = "timeout"    // request took too long
+	ErrorContext   ErrorKind = "context"    // request exceeds the model's context window
+	ErrorOther     ErrorKind = "other"
+)
+
+// APIError is a non-200 response from an HTTP provider.
+type APIError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration // from the Retry-After header; 0 if absent
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API request failed:\n  Status: %d\n  Body:   %s", e.StatusCode, e.Body)
+}
+
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an
+// HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// ClassifyError returns the kind of a provider error. HTTP status codes are
+// used when the error carries one; otherwise the message is inspected.
+func ClassifyError(err error) ErrorKind {
+	if err == nil {
+		return ""
+	}
+
+	// Rate limits on tokens per minute mention tokens too, so the status
+	// is checked before the message.
+	status, _ := statusOf(err)
+	if status == http.StatusTooManyRequests {
+		return ErrorRateLimit
+	}
+	message := strings.ToLower(err.Error())
+	if isContextMessage(message) {
+		return ErrorContext
+	}
+
+	if status != 0 {
+		switch {
+		case status == http.StatusUnauthorized || status == http.StatusForbidden:
+			return ErrorAuth
+		case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+			return ErrorTimeout
+		case status == http.StatusRequestEntityTooLarge:
+			return ErrorContext
+		case status >= 500:
+			return ErrorServer
+		}
+		return ErrorOther
+	}
+
+	var netErr net.Error
+	isNetErr := errors.As(err, &netErr)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), isNetErr && netErr.Timeout():
+		return ErrorTimeout
+	case isNetErr, strings.Contains(message, "failed to send request"), strings.Contains(message, "connection refused"):
+		return ErrorServer
+	case strings.Contains(message, "rate limit"), strings.Contains(message, "too many requests"), strings.Contains(message, "status 429"):
+		return ErrorRateLimit
+	case strings.Contains(message, "unauthorized"), strings.Contains(message, "invalid api key"), strings.Contains(message, "status 401"):
+		return ErrorAuth
+	}
+	return ErrorOther
+}
+
+// contextMessages are phrases providers use when a request does not fit
+// the model's context window.
+var contextMessages = []string{
+	"context length", "context_length", "context window", "maximum context",
+	"too many tokens", "prompt is too long", "input is too long",
+	"exceeds max length",
+}
+
+func isContextMessage(message string) bool {
+	for _, s := range contextMessages {
+		if strings.Contains(message, s) {
+			return true
+		}
+	}
+	// e.g. "Total tokens of image and text exceed max message tokens"
+	return strings.Contains(message, "token") && strings.Contains(message, "exceed")
+}
+
+// RetryAfter returns how long the backend asked callers to wait, or 0.
+func RetryAfter(err error) time.Duration {
+	_, retryAfter := statusOf(err)
+	return retryAfter
+}
+
+// statusOf extracts the HTTP status and Retry-After delay from the error
+// types the providers return.
+func statusOf(err error) (int, time.Duration) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode, apiErr.RetryAfter
+	}
+	var claudeErr *anthropic.Error
+	if errors.As(err, &claudeErr) {
+		return claudeErr.StatusCode, responseRetryAfter(claudeErr.Response)
+	}
+	var openaiErr *openai.Error
+	if errors.As(err, &openaiErr) {
+		return openaiErr.StatusCode, responseRetryAfter(openaiErr.Response)
+	}
+	return 0, 0
+}
+
+func responseRetryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	return parseRetryAfter(resp.Header.Get("Retry-After"))
+}
@@ -0,0 +1,284 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	// breakerThreshold is how many failures in a row open a backend's
+	// circuit for server errors and timeouts.
+	breakerThreshold = 3
+	breakerCooldown  = time.Minute
+	// authCooldown is long because bad credentials rarely fix themselves.
+	authCooldown = 10 * time.Minute
+	// maxRetryAfterWait bounds how long a request waits for a backend when
+	// every backend is unavailable.
+	maxRetryAfterWait = 30 * time.Second
+)
+
+// StatusReporter is implemented by providers that spread requests over
+// several backends. Status describes which backends are in use.
+type StatusReporter interface {
+	Status() string
+}
+
+// FallbackBackend is one entry of a FallbackProvider's chain.
+type FallbackBackend struct {
+	Name     string // shown in logs and /show model, e.g. "zhipu/glm-4.7"
+	Provider LLMProvider
+	Model    string
+}
+
+// FallbackProvider tries an ordered list of backends until one answers.
+// Each backend has a circuit breaker: rate limits open it until the
+// Retry-After delay passes, auth errors open it for authCooldown, and
+// repeated server errors or timeouts open it for breakerCooldown. Backends
+// with an open circuit are skipped. Context-window errors are returned at
+// once, since the caller has to shorten the request.
+type FallbackProvider struct {
+	backends []*fallbackBackend
+	now      func() time.Time
+
+	mu     sync.Mutex
+	active string
+}
+
+type fallbackBackend struct {
+	FallbackBackend
+	failures  int
+	openUntil time.Time
+	lastKind  ErrorKind
+}
+
+func NewFallbackProvider(backends ...FallbackBackend) *FallbackProvider {
+	f := &FallbackProvider{now: time.Now}
+	for _, b := range backends {
+		f.backends = append(f.backends, &fallbackBackend{FallbackBackend: b})
+	}
+	if len(backends) > 0 {
+		f.active = backends[0].Name
+	}
+	return f
+}
+
+// createFallbackProvider creates the configured provider, wrapped in a
+// FallbackProvider when agents.defaults.fallbacks lists other backends.
+func createFallbackProvider(cfg *config.Config) (LLMProvider, error) {
+	primary, err := createProvider(cfg)
+	if err != nil || len(cfg.Agents.Defaults.Fallbacks) == 0 {
+		return primary, err
+	}
+
+	defaults := cfg.Agents.Defaults
+	backends := []FallbackBackend{{
+		Name:     backendName(config.ModelTarget{Provider: defaults.Provider, Model: defaults.Model}),
+		Provider: primary,
+	}}
+	for _, target := range defaults.Fallbacks {
+		fallbackCfg := cfg.ForModel(target)
+		p, err := createProvider(fallbackCfg)
+		if err != nil {
+			return nil, fmt.Errorf("creating fallback provider %s: %w", backendName(target), err)
+		}
+		backends = append(backends, FallbackBackend{
+			Name:     backendName(target),
+			Provider: p,
+			Model:    fallbackCfg.Agents.Defaults.Model,
+		})
+	}
+	return NewFallbackProvider(backends...), nil
+}
+
+func backendName(target config.ModelTarget) string {
+	if target.Provider == "" {
+		return target.Model
+	}
+	return target.Provider + "/" + target.Model
+}
+
+func (f *FallbackProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	return f.chat(ctx, messages, tools, model, options, nil)
+}
+
+func (f *FallbackProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onChunk StreamCallback) (*LLMResponse, error) {
+	return f.chat(ctx, messages, tools, model, options, onChunk)
+}
+
+func (f *FallbackProvider) GetDefaultModel() string {
+	return f.backends[0].Provider.GetDefaultModel()
+}
+
+// chat sends the request down the chain. The first backend, which has no
+// model of its own, gets the model the caller asked for.
+func (f *FallbackProvider) chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onChunk StreamCallback) (*LLMResponse, error) {
+	var lastErr error
+	for _, b := range f.backends {
+		if !f.available(b) {
+			continue
+		}
+		response, err := f.call(ctx, b, messages, tools, model, options, onChunk)
+		if err == nil || ctx.Err() != nil || ClassifyError(err) == ErrorContext {
+			return response, err
+		}
+		lastErr = err
+	}
+
+	// Every backend failed or is open. Wait for the one that reopens first
+	// if that is soon, as a rate-limited backend asks us to.
+	b, wait := f.nextReopen()
+	if b == nil || wait > maxRetryAfterWait {
+		if lastErr != nil {
+			return nil, fmt.Errorf("all providers failed: %w", lastErr)
+		}
+		return nil, fmt.Errorf("all providers unavailable, next retry in %s", wait.Round(time.Second))
+	}
+
+	logger.InfoCF("provider.fallback", "Waiting for provider to become available",
+		map[string]interface{}{
+			"backend": b.Name,
+			"wait":    wait.String(),
+		})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(wait):
+	}
+	return f.call(ctx, b, messages, tools, model, options, onChunk)
+}
+
+func (f *FallbackProvider) call(ctx context.Context, b *fallbackBackend, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onChunk StreamCallback) (*LLMResponse, error) {
+	if b.Model != "" {
+		model = b.Model
+	}
+
+	var response *LLMResponse
+	var err error
+	if streamer, ok := b.Provider.(StreamingProvider); ok && onChunk != nil {
+		response, err = streamer.ChatStream(ctx, messages, tools, model, options, onChunk)
+	} else {
+		response, err = b.Provider.Chat(ctx, messages, tools, model, options)
+		if err == nil && onChunk != nil && response.Content != "" {
+			onChunk(StreamChunk{Content: response.Content})
+		}
+	}
+
+	if err == nil {
+		if response.Model == "" {
+			response.Model = model
+		}
+		f.succeeded(b)
+	} else if ctx.Err() == nil && ClassifyError(err) != ErrorContext {
+		f.failed(b, err)
+	}
+	return response, err
+}
+
+// available reports whether b's circuit is closed. A circuit whose cooldown
+// has passed lets the next request try the backend again.
+func (f *FallbackProvider) available(b *fallbackBackend) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !f.now().Before(b.openUntil)
+}
+
+func (f *FallbackProvider) succeeded(b *fallbackBackend) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+	if f.active != b.Name {
+		logger.InfoCF("provider.fallback", "Switched active provider",
+			map[string]interface{}{
+				"from": f.active,
+				"to":   b.Name,
+			})
+		f.active = b.Name
+	}
+}
+
+func (f *FallbackProvider) failed(b *fallbackBackend, err error) {
+	kind := ClassifyError(err)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b.failures++
+	b.lastKind = kind
+
+	var cooldown time.Duration
+	switch kind {
+	case ErrorRateLimit:
+		cooldown = RetryAfter(err)
+		if cooldown == 0 {
+			cooldown = breakerCooldown
+		}
+	case ErrorAuth:
+		cooldown = authCooldown
+	case ErrorServer, ErrorTimeout:
+		if b.failures >= breakerThreshold {
+			cooldown = breakerCooldown
+		}
+	}
+
+	fields := map[string]interface{}{
+		"backend":  b.Name,
+		"kind":     string(kind),
+		"failures": b.failures,
+		"error":    err.Error(),
+	}
+	if cooldown > 0 {
+		b.openUntil = f.now().Add(cooldown)
+		fields["cooldown"] = cooldown.String()
+		logger.WarnCF("provider.fallback", "Provider circuit opened", fields)
+		return
+	}
+	logger.WarnCF("provider.fallback", "Provider call failed", fields)
+}
+
+// nextReopen returns the open backend whose circuit closes first and how
+// long that takes, or nil if no circuit is open.
+func (f *FallbackProvider) nextReopen() (*fallbackBackend, time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	var next *fallbackBackend
+	for _, b := range f.backends {
+		if !now.Before(b.openUntil) {
+			continue
+		}
+		if next == nil || b.openUntil.Before(next.openUntil) {
+			next = b
+		}
+	}
+	if next == nil {
+		return nil, 0
+	}
+	return next, next.openUntil.Sub(now)
+}
+
+// Status lists the backends in order, marking the active one and those
+// with an open circuit.
+func (f *FallbackProvider) Status() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parts := make([]string, 0, len(f.backends))
+	for _, b := range f.backends {
+		state := b.Name
+		switch {
+		case f.now().Before(b.openUntil):
+			state += fmt.Sprintf(" (circuit open after %s, retry in %s)", b.lastKind, b.openUntil.Sub(f.now()).Round(time.Second))
+		case b.Name == f.active:
+			state += " (active)"
+		}
+		parts = append(parts, state)
+	}
+	return strings.Join(parts, ", ")
+}
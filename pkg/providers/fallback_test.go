@@ -0,0 +1,116 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorKind
+	}{
+		{&APIError{StatusCode: 429}, ErrorRateLimit},
+		{&APIError{StatusCode: 503}, ErrorServer},
+		{&APIError{StatusCode: 401}, ErrorAuth},
+		{&APIError{StatusCode: 504}, ErrorTimeout},
+		{&APIError{StatusCode: 400, Body: `{"error":"maximum context length is 8192 tokens"}`}, ErrorContext},
+		{&APIError{StatusCode: 400, Body: "bad request"}, ErrorOther},
+		{&APIError{StatusCode: 413}, ErrorContext},
+		{errors.New("InvalidParameter: Total tokens of image and text exceed max message tokens"), ErrorContext},
+		{&APIError{StatusCode: 429, Body: "tokens per minute limit exceeded"}, ErrorRateLimit},
+		{fmt.Errorf("claude API call: %w", context.DeadlineExceeded), ErrorTimeout},
+		{errors.New("failed to send request: dial tcp: connection refused"), ErrorServer},
+		{errors.New("claude cli error: Rate limit exceeded"), ErrorRateLimit},
+	}
+	for _, tt := range tests {
+		if got := ClassifyError(tt.err); got != tt.want {
+			t.Errorf("ClassifyError(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestHTTPProvider_ReturnsAPIErrorWithRetryAfter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":"slow down"}`))
+	}))
+	defer server.Close()
+
+	_, err := NewHTTPProvider("key", server.URL, "").Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "m", nil)
+	if ClassifyError(err) != ErrorRateLimit || RetryAfter(err) != 7*time.Second {
+		t.Errorf("Expected rate limit with 7s Retry-After, got %v (%s)", err, RetryAfter(err))
+	}
+}
+
+func TestFallbackProvider_FallsThroughAndOpensCircuit(t *testing.T) {
+	primary := &scriptedProvider{err: &APIError{StatusCode: 429, RetryAfter: time.Minute}}
+	local := &scriptedProvider{responses: []*LLMResponse{{Content: "from ollama"}}}
+	f := NewFallbackProvider(
+		FallbackBackend{Name: "zhipu/glm-4.7", Provider: primary},
+		FallbackBackend{Name: "ollama/llama3.2", Provider: local, Model: "llama3.2"},
+	)
+	now := time.Now()
+	f.now = func() time.Time { return now }
+
+	resp, err := f.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "glm-4.7", nil)
+	if err != nil || resp.Content != "from ollama" {
+		t.Fatalf("Expected fallback answer, got %v, %v", resp, err)
+	}
+	if local.models[0] != "llama3.2" || primary.models[0] != "glm-4.7" {
+		t.Errorf("Unexpected models: primary %v, fallback %v", primary.models, local.models)
+	}
+
+	// The primary's circuit stays open until Retry-After passes.
+	f.Chat(context.Background(), []Message{{Role: "user", Content: "again"}}, nil, "glm-4.7", nil)
+	if primary.calls != 1 || local.calls != 2 {
+		t.Errorf("Expected open circuit to skip primary, got primary=%d fallback=%d", primary.calls, local.calls)
+	}
+	if status := f.Status(); !strings.Contains(status, "zhipu/glm-4.7 (circuit open after rate_limit") || !strings.Contains(status, "ollama/llama3.2 (active)") {
+		t.Errorf("Unexpected status: %s", status)
+	}
+
+	now = now.Add(2 * time.Minute)
+	primary.err = nil
+	f.Chat(context.Background(), []Message{{Role: "user", Content: "later"}}, nil, "glm-4.7", nil)
+	if primary.calls != 2 || !strings.Contains(f.Status(), "zhipu/glm-4.7 (active)") {
+		t.Errorf("Expected primary to be retried after cooldown, status: %s", f.Status())
+	}
+}
+
+func TestFallbackProvider_ServerErrorsNeedThreshold(t *testing.T) {
+	primary := &scriptedProvider{err: &APIError{StatusCode: 502}}
+	backup := &scriptedProvider{}
+	f := NewFallbackProvider(
+		FallbackBackend{Name: "primary", Provider: primary},
+		FallbackBackend{Name: "backup", Provider: backup, Model: "b"},
+	)
+
+	for i := 0; i < breakerThreshold+1; i++ {
+		f.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "a", nil)
+	}
+	if primary.calls != breakerThreshold {
+		t.Errorf("Expected circuit to open after %d failures, primary called %d times", breakerThreshold, primary.calls)
+	}
+}
+
+func TestFallbackProvider_ContextErrorIsReturned(t *testing.T) {
+	primary := &scriptedProvider{err: &APIError{StatusCode: 400, Body: "context length exceeded"}}
+	backup := &scriptedProvider{}
+	f := NewFallbackProvider(
+		FallbackBackend{Name: "primary", Provider: primary},
+		FallbackBackend{Name: "backup", Provider: backup},
+	)
+
+	_, err := f.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "a", nil)
+	if ClassifyError(err) != ErrorContext || backup.calls != 0 {
+		t.Errorf("Expected context error without fallback, got %v (backup calls %d)", err, backup.calls)
+	}
+}
@@ -49,6 +49,31 @@ func NewHTTPProvider(apiKey, apiBase, proxy string) *HTTPProvider {
 }
 
 func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	req, err := p.newChatRequest(ctx, messages, tools, model, options, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp, body)
+	}
+
+	return p.parseResponse(body)
+}
+
+// newChatRequest builds the /chat/completions request shared by Chat and ChatStream.
+func (p *HTTPProvider) newChatRequest(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, stream bool) (*http.Request, error) {
 	if p.apiBase == "" {
 		return nil, fmt.Errorf("API base not configured")
 	}
@@ -63,7 +88,12 @@ func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []Too
 
 	requestBody := map[string]interface{}{
 		"model":    model,
-		"messages": messages,
+		"messages": openaiMessages(messages),
+	}
+
+	if stream {
+		requestBody["stream"] = true
+		requestBody["stream_options"] = map[string]interface{}{"include_usage": true}
 	}
 
 	if len(tools) > 0 {
@@ -101,26 +131,14 @@ func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []Too
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
 	if p.apiKey != "" {
 		req.Header.Set("Authorization", "Bearer "+p.apiKey)
 	}
 
-	resp, err := p.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed:\n  Status: %d\n  Body:   %s", resp.StatusCode, string(body))
-	}
-
-	return p.parseResponse(body)
+	return req, nil
 }
 
 func (p *HTTPProvider) parseResponse(body []byte) (*LLMResponse, error) {
@@ -219,7 +237,17 @@ func createCodexAuthProvider() (LLMProvider, error) {
 	return NewCodexProviderWithTokenSource(cred.AccessToken, cred.AccountID, createCodexTokenSource()), nil
 }
 
+// CreateProvider creates the provider for cfg's agent defaults. With model
+// routing enabled, it returns a RouterProvider over the configured models;
+// with fallbacks configured, a FallbackProvider.
 func CreateProvider(cfg *config.Config) (LLMProvider, error) {
+	if cfg.Agents.Defaults.Routing.Enabled {
+		return createRouterProvider(cfg)
+	}
+	return createFallbackProvider(cfg)
+}
+
+func createProvider(cfg *config.Config) (LLMProvider, error) {
 	model := cfg.Agents.Defaults.Model
 	providerName := strings.ToLower(cfg.Agents.Defaults.Provider)
 
@@ -460,3 +488,46 @@ func CreateProvider(cfg *config.Config) (LLMProvider, error) {
 
 	return NewHTTPProvider(apiKey, apiBase, proxy), nil
 }
+
+// openaiMessage is a chat completions message whose content is either a
+// string or an array of content parts.
+type openaiMessage struct {
+	Role       string      `json:"role"`
+	Content    interface{} `json:"content"`
+	ToolCalls  []ToolCall  `json:"tool_calls,omitempty"`
+	ToolCallID string      `json:"tool_call_id,omitempty"`
+}
+
+// openaiMessages encodes messages for OpenAI-compatible APIs. Messages with
+// content parts use the vision format, with images sent as data: URLs.
+func openaiMessages(messages []Message) []openaiMessage {
+	out := make([]openaiMessage, 0, len(messages))
+	for _, msg := range messages {
+		om := openaiMessage{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			ToolCalls:  msg.ToolCalls,
+			ToolCallID: msg.ToolCallID,
+		}
+
+		if len(msg.Parts) > 0 {
+			var parts []map[string]interface{}
+			for _, part := range loadParts(msg.Parts) {
+				if part.Type == "image" {
+					parts = append(parts, map[string]interface{}{
+						"type":      "image_url",
+						"image_url": map[string]interface{}{"url": dataURL(part)},
+					})
+				} else {
+					parts = append(parts, map[string]interface{}{"type": "text", "text": part.Text})
+				}
+			}
+			if len(parts) > 0 {
+				om.Content = parts
+			}
+		}
+
+		out = append(out, om)
+	}
+	return out
+}
@@ -0,0 +1,193 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package providers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ChatStream implements StreamingProvider using OpenAI-compatible SSE.
+func (p *HTTPProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onChunk StreamCallback) (*LLMResponse, error) {
+	req, err := p.newChatRequest(ctx, messages, tools, model, options, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// Streams can legitimately outlive the client timeout used for whole
+	// responses; cancellation is driven by ctx instead.
+	client := *p.httpClient
+	client.Timeout = 0
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp, body)
+	}
+
+	// Some OpenAI-compatible servers ignore "stream" and answer with plain JSON.
+	if !strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		result, err := p.parseResponse(body)
+		if err != nil {
+			return nil, err
+		}
+		if result.Content != "" && onChunk != nil {
+			onChunk(StreamChunk{Content: result.Content})
+		}
+		return result, nil
+	}
+
+	return parseSSEStream(resp.Body, onChunk)
+}
+
+// sseToolCall accumulates the fragments of one streamed tool call.
+type sseToolCall struct {
+	id        string
+	name      string
+	arguments strings.Builder
+}
+
+// parseSSEStream reads an OpenAI-style chat completion stream, forwarding
+// deltas to onChunk and assembling the final LLMResponse.
+func parseSSEStream(body io.Reader, onChunk StreamCallback) (*LLMResponse, error) {
+	var content strings.Builder
+	var finishReason string
+	var usage *UsageInfo
+	calls := make(map[int]*sseToolCall)
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var event struct {
+			Choices []struct {
+				Delta struct {
+					Content   string `json:"content"`
+					ToolCalls []struct {
+						Index    int    `json:"index"`
+						ID       string `json:"id"`
+						Function struct {
+							Name      string `json:"name"`
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+					} `json:"tool_calls"`
+				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage *UsageInfo `json:"usage"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			continue
+		}
+		if event.Error != nil {
+			return nil, fmt.Errorf("stream error: %s", event.Error.Message)
+		}
+		if event.Usage != nil {
+			usage = event.Usage
+		}
+
+		for _, choice := range event.Choices {
+			if choice.Delta.Content != "" {
+				content.WriteString(choice.Delta.Content)
+				if onChunk != nil {
+					onChunk(StreamChunk{Content: choice.Delta.Content})
+				}
+			}
+
+			for _, tc := range choice.Delta.ToolCalls {
+				call, ok := calls[tc.Index]
+				if !ok {
+					call = &sseToolCall{}
+					calls[tc.Index] = call
+				}
+				if tc.ID != "" {
+					call.id = tc.ID
+				}
+				if tc.Function.Name != "" {
+					call.name = tc.Function.Name
+				}
+				call.arguments.WriteString(tc.Function.Arguments)
+
+				if onChunk != nil {
+					onChunk(StreamChunk{ToolCall: &ToolCallDelta{
+						Index:          tc.Index,
+						ID:             tc.ID,
+						Name:           tc.Function.Name,
+						ArgumentsDelta: tc.Function.Arguments,
+					}})
+				}
+			}
+
+			if choice.FinishReason != nil && *choice.FinishReason != "" {
+				finishReason = *choice.FinishReason
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	indexes := make([]int, 0, len(calls))
+	for idx := range calls {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	toolCalls := make([]ToolCall, 0, len(calls))
+	for _, idx := range indexes {
+		call := calls[idx]
+		arguments := make(map[string]interface{})
+		if raw := call.arguments.String(); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &arguments); err != nil {
+				arguments["raw"] = raw
+			}
+		}
+		toolCalls = append(toolCalls, ToolCall{
+			ID:        call.id,
+			Name:      call.name,
+			Arguments: arguments,
+		})
+	}
+
+	if finishReason == "" {
+		finishReason = "stop"
+	}
+
+	return &LLMResponse{
+		Content:      content.String(),
+		ToolCalls:    toolCalls,
+		FinishReason: finishReason,
+		Usage:        usage,
+	}, nil
+}
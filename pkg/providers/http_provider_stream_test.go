@@ -0,0 +1,95 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPProvider_ChatStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&reqBody)
+		if reqBody["stream"] != true {
+			t.Errorf("Expected stream=true in request, got %v", reqBody["stream"])
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			`{"choices":[{"delta":{"content":"Hel"}}]}`,
+			`{"choices":[{"delta":{"content":"lo"}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"read_file","arguments":"{\"pa"}}]}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"th\":\"a.txt\"}"}}]}}]}`,
+			`{"choices":[{"delta":{},"finish_reason":"tool_calls"}]}`,
+			`{"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`,
+		}
+		for _, e := range events {
+			fmt.Fprintf(w, "data: %s\n\n", e)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	p := NewHTTPProvider("test-key", server.URL, "")
+
+	var text strings.Builder
+	var toolDeltas int
+	resp, err := p.ChatStream(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, "gpt-4o", map[string]interface{}{}, func(chunk StreamChunk) {
+		text.WriteString(chunk.Content)
+		if chunk.ToolCall != nil {
+			toolDeltas++
+		}
+	})
+	if err != nil {
+		t.Fatalf("ChatStream() error: %v", err)
+	}
+
+	if text.String() != "Hello" {
+		t.Errorf("streamed text = %q, want %q", text.String(), "Hello")
+	}
+	if toolDeltas != 2 {
+		t.Errorf("tool call deltas = %d, want 2", toolDeltas)
+	}
+	if resp.Content != "Hello" {
+		t.Errorf("Content = %q, want %q", resp.Content, "Hello")
+	}
+	if resp.FinishReason != "tool_calls" {
+		t.Errorf("FinishReason = %q, want %q", resp.FinishReason, "tool_calls")
+	}
+	if len(resp.ToolCalls) != 1 {
+		t.Fatalf("len(ToolCalls) = %d, want 1", len(resp.ToolCalls))
+	}
+	if resp.ToolCalls[0].Name != "read_file" || resp.ToolCalls[0].Arguments["path"] != "a.txt" {
+		t.Errorf("ToolCalls[0] = %+v, want read_file(path=a.txt)", resp.ToolCalls[0])
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 15 {
+		t.Errorf("Usage = %+v, want total 15", resp.Usage)
+	}
+}
+
+func TestHTTPProvider_ChatStream_NonStreamingServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"whole answer"},"finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	p := NewHTTPProvider("test-key", server.URL, "")
+
+	var chunks []string
+	resp, err := p.ChatStream(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, "gpt-4o", nil, func(chunk StreamChunk) {
+		chunks = append(chunks, chunk.Content)
+	})
+	if err != nil {
+		t.Fatalf("ChatStream() error: %v", err)
+	}
+	if resp.Content != "whole answer" {
+		t.Errorf("Content = %q, want %q", resp.Content, "whole answer")
+	}
+	if len(chunks) != 1 || chunks[0] != "whole answer" {
+		t.Errorf("chunks = %v, want one chunk with the whole answer", chunks)
+	}
+}
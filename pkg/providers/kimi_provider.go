@@ -72,7 +72,7 @@ func (p *KimiProvider) Chat(ctx context.Context, messages []Message, tools []Too
 
 	requestBody := map[string]interface{}{
 		"model":    resolvedModel,
-		"messages": messages,
+		"messages": openaiMessages(messages),
 	}
 
 	if len(tools) > 0 {
@@ -135,7 +135,7 @@ func (p *KimiProvider) Chat(ctx context.Context, messages []Message, tools []Too
 			"status_code": resp.StatusCode,
 			"body":        string(body),
 		})
-		return nil, fmt.Errorf("Kimi API request failed (status %d): %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("Kimi %w", newAPIError(resp, body))
 	}
 
 	return p.parseResponse(body)
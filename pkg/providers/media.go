@@ -0,0 +1,138 @@
+package providers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// maxImageBytes bounds the size of an image file inlined into a request.
+const maxImageBytes = 20 << 20
+
+var imageMediaTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// ImageMediaType returns the media type of an image file judged by its
+// extension, or "" if the file is not an image providers accept.
+func ImageMediaType(path string) string {
+	return imageMediaTypes[strings.ToLower(filepath.Ext(path))]
+}
+
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: "text", Text: text}
+}
+
+// ImagePart references a local image file. The file is read when a request
+// is built, so the part stays small in memory and in session files.
+func ImagePart(path string) ContentPart {
+	return ContentPart{Type: "image", Path: path, MediaType: ImageMediaType(path)}
+}
+
+// ImageData returns the media type and base64 data of an image part,
+// reading the referenced file when the part carries no inline data.
+func (p ContentPart) ImageData() (mediaType, data string, err error) {
+	if p.Data != "" {
+		mediaType = p.MediaType
+		if mediaType == "" {
+			mediaType = "image/png"
+		}
+		return mediaType, p.Data, nil
+	}
+	if p.Path == "" {
+		return "", "", fmt.Errorf("image part has neither data nor path")
+	}
+
+	info, err := os.Stat(p.Path)
+	if err != nil {
+		return "", "", err
+	}
+	if info.Size() > maxImageBytes {
+		return "", "", fmt.Errorf("image %s is too large (%d bytes)", p.Path, info.Size())
+	}
+	raw, err := os.ReadFile(p.Path)
+	if err != nil {
+		return "", "", err
+	}
+
+	mediaType = p.MediaType
+	if mediaType == "" {
+		mediaType = http.DetectContentType(raw)
+	}
+	return mediaType, base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// dataURL returns a loaded image part as a data: URL, the form OpenAI-style
+// APIs take.
+func dataURL(part ContentPart) string {
+	return "data:" + part.MediaType + ";base64," + part.Data
+}
+
+// placeholder is the text that stands in for an image a provider cannot see.
+func (p ContentPart) placeholder() string {
+	if p.Path != "" {
+		return fmt.Sprintf("[image: %s]", filepath.Base(p.Path))
+	}
+	return "[image]"
+}
+
+// loadParts prepares message parts for a request: image parts get their
+// data loaded, and images that cannot be read degrade to a text placeholder
+// so that a missing file never fails the whole request.
+func loadParts(parts []ContentPart) []ContentPart {
+	loaded := make([]ContentPart, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			if part.Text != "" {
+				loaded = append(loaded, part)
+			}
+		case "image":
+			mediaType, data, err := part.ImageData()
+			if err != nil {
+				logger.WarnCF("provider", "Skipping unreadable image",
+					map[string]interface{}{
+						"path":  part.Path,
+						"error": err.Error(),
+					})
+				loaded = append(loaded, TextPart(part.placeholder()))
+				continue
+			}
+			part.MediaType, part.Data = mediaType, data
+			loaded = append(loaded, part)
+		}
+	}
+	return loaded
+}
+
+// WithoutInlineData returns a copy of msg that is safe to persist: image
+// parts keep only their file reference, and images that exist only as
+// inline data are replaced by a text placeholder.
+func WithoutInlineData(msg Message) Message {
+	if len(msg.Parts) == 0 {
+		return msg
+	}
+
+	parts := make([]ContentPart, len(msg.Parts))
+	for i, part := range msg.Parts {
+		if part.Type == "image" && part.Data != "" {
+			if part.Path == "" {
+				part = TextPart(part.placeholder())
+			} else {
+				part.Data = ""
+			}
+		}
+		parts[i] = part
+	}
+	msg.Parts = parts
+	return msg
+}
@@ -0,0 +1,122 @@
+package providers
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestImage(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "photo.png")
+	if err := os.WriteFile(path, []byte("\x89PNG\r\n\x1a\nfake"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOpenAIMessages_ImageParts(t *testing.T) {
+	path := writeTestImage(t)
+	messages := []Message{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "what is this?", Parts: []ContentPart{TextPart("what is this?"), ImagePart(path)}},
+	}
+
+	data, _ := json.Marshal(openaiMessages(messages))
+	var decoded []struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	}
+	json.Unmarshal(data, &decoded)
+
+	if string(decoded[0].Content) != `"sys"` {
+		t.Errorf("Expected plain string content for text-only message, got %s", decoded[0].Content)
+	}
+
+	var parts []struct {
+		Type     string `json:"type"`
+		Text     string `json:"text"`
+		ImageURL struct {
+			URL string `json:"url"`
+		} `json:"image_url"`
+	}
+	if err := json.Unmarshal(decoded[1].Content, &parts); err != nil {
+		t.Fatalf("Expected content array, got %s", decoded[1].Content)
+	}
+	if len(parts) != 2 || parts[0].Text != "what is this?" || parts[1].Type != "image_url" {
+		t.Fatalf("Unexpected parts: %+v", parts)
+	}
+	if !strings.HasPrefix(parts[1].ImageURL.URL, "data:image/png;base64,") {
+		t.Errorf("Expected PNG data URL, got %q", parts[1].ImageURL.URL)
+	}
+	if strings.Contains(string(data), `"parts"`) {
+		t.Error("Internal parts field must not be sent to the API")
+	}
+}
+
+func TestLoadParts_MissingImage(t *testing.T) {
+	parts := loadParts([]ContentPart{TextPart("hi"), ImagePart("/nonexistent/cat.jpg")})
+	if len(parts) != 2 || parts[1].Type != "text" || parts[1].Text != "[image: cat.jpg]" {
+		t.Errorf("Expected missing image to become a placeholder, got %+v", parts)
+	}
+}
+
+func TestWithoutInlineData(t *testing.T) {
+	msg := Message{Role: "user", Content: "look", Parts: []ContentPart{
+		TextPart("look"),
+		{Type: "image", Path: "/media/a.png", MediaType: "image/png", Data: "aGVsbG8="},
+		{Type: "image", MediaType: "image/png", Data: "aGVsbG8="},
+	}}
+
+	stored := WithoutInlineData(msg)
+	if stored.Parts[1].Data != "" || stored.Parts[1].Path != "/media/a.png" {
+		t.Errorf("Expected image with path to keep only its reference, got %+v", stored.Parts[1])
+	}
+	if stored.Parts[2].Type != "text" {
+		t.Errorf("Expected inline-only image to become text, got %+v", stored.Parts[2])
+	}
+	if msg.Parts[1].Data == "" {
+		t.Error("WithoutInlineData must not modify the original message")
+	}
+}
+
+func TestSupportsVision(t *testing.T) {
+	overrides := map[string]bool{"glm-4.7": true, "my-vl-*": true, "gpt-4o-mini": false}
+	for model, want := range map[string]bool{
+		"glm-4.7":                                true,
+		"glm-4.6":                                false,
+		"glm-4.5v":                               true,
+		"gpt-4o":                                 true,
+		"gpt-4o-mini":                            false,
+		"openrouter/anthropic/claude-sonnet-4-5": true,
+		"qwen2.5-vl-7b-instruct":                 true,
+		"qwen2.5-7b-instruct":                    false,
+		"deepseek-chat":                          false,
+		"my-vl-large":                            true,
+	} {
+		if got := SupportsVision(model, overrides); got != want {
+			t.Errorf("SupportsVision(%q) = %v, want %v", model, got, want)
+		}
+	}
+}
+
+func TestWithoutImages(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "what is this?", Parts: []ContentPart{TextPart("what is this?"), ImagePart("/media/cat.jpg")}},
+		{Role: "user", Content: "[image: photo]", Parts: []ContentPart{ImagePart("/media/dog.jpg")}},
+		{Role: "assistant", Content: "a cat"},
+	}
+
+	text := WithoutImages(messages)
+	if text[0].Content != "what is this?\n[image: cat.jpg]" || text[0].Parts != nil {
+		t.Errorf("first message = %+v, want the text and a placeholder", text[0])
+	}
+	if text[1].Content != "[image: photo]" || text[1].Parts != nil {
+		t.Errorf("second message = %+v, want its own placeholder kept", text[1])
+	}
+	if messages[0].Parts == nil {
+		t.Error("WithoutImages must not modify the original messages")
+	}
+}
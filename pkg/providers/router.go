@@ -0,0 +1,378 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// maxRouteTurns bounds the per-turn routing state a RouterProvider keeps.
+const maxRouteTurns = 256
+
+const classifierPrompt = `Classify the request below for an AI assistant.
+Answer SIMPLE for small talk, short factual questions and simple single-step tasks.
+Answer COMPLEX for multi-step work, coding, planning, analysis or long documents.
+Answer with one word.
+
+Request:
+`
+
+// RouterTier is one provider and model a RouterProvider can send requests to.
+type RouterTier struct {
+	Name     string // "cheap", "strong" or "classifier", used in logs
+	Provider LLMProvider
+	Model    string
+}
+
+// RouterOptions tunes when a RouterProvider prefers the strong model.
+type RouterOptions struct {
+	MaxCheapChars      int // user messages longer than this go to the strong model
+	MaxCheapIterations int // tool iterations in one turn before escalating
+}
+
+// RouterProvider sends each request to a cheap or a strong model. Short
+// requests, requests without tools and requests a classifier model rates
+// as simple go to the cheap model. A turn escalates to the strong model,
+// for the rest of the turn, when the cheap model fails, returns nothing,
+// repeats a tool call or uses too many tool iterations.
+type RouterProvider struct {
+	cheap      RouterTier
+	strong     RouterTier
+	classifier *RouterTier
+	opts       RouterOptions
+
+	mu    sync.Mutex
+	turns map[string]*routeTurn
+}
+
+// routeTurn is the routing state of one user turn.
+type routeTurn struct {
+	escalated  bool
+	classified bool
+	complex    bool
+}
+
+func NewRouterProvider(cheap, strong RouterTier, classifier *RouterTier, opts RouterOptions) *RouterProvider {
+	return &RouterProvider{
+		cheap:      cheap,
+		strong:     strong,
+		classifier: classifier,
+		opts:       opts,
+		turns:      make(map[string]*routeTurn),
+	}
+}
+
+// createRouterProvider builds a RouterProvider from cfg's routing settings.
+// The strong tier defaults to the agent's own provider and model.
+func createRouterProvider(cfg *config.Config) (LLMProvider, error) {
+	routing := cfg.Agents.Defaults.Routing
+	if routing.Cheap.Model == "" {
+		return nil, fmt.Errorf("model routing is enabled but routing.cheap.model is not set")
+	}
+
+	cheapCfg := cfg.ForModel(routing.Cheap)
+	cheap, err := createProvider(cheapCfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating cheap routing provider: %w", err)
+	}
+	strongCfg := cfg.ForModel(routing.Strong)
+	strong, err := createFallbackProvider(strongCfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating strong routing provider: %w", err)
+	}
+
+	var classifier *RouterTier
+	if routing.Classifier.Model != "" {
+		classifierCfg := cfg.ForModel(routing.Classifier)
+		p, err := createProvider(classifierCfg)
+		if err != nil {
+			return nil, fmt.Errorf("creating routing classifier: %w", err)
+		}
+		classifier = &RouterTier{Name: "classifier", Provider: p, Model: classifierCfg.Agents.Defaults.Model}
+	}
+
+	return NewRouterProvider(
+		RouterTier{Name: "cheap", Provider: cheap, Model: cheapCfg.Agents.Defaults.Model},
+		RouterTier{Name: "strong", Provider: strong, Model: strongCfg.Agents.Defaults.Model},
+		classifier,
+		RouterOptions{
+			MaxCheapChars:      routing.MaxCheapChars,
+			MaxCheapIterations: routing.MaxCheapIterations,
+		},
+	), nil
+}
+
+func (r *RouterProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	return r.chat(ctx, messages, tools, model, options, nil)
+}
+
+func (r *RouterProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onChunk StreamCallback) (*LLMResponse, error) {
+	return r.chat(ctx, messages, tools, model, options, onChunk)
+}
+
+// GetDefaultModel returns the strong model, which agents are configured with.
+func (r *RouterProvider) GetDefaultModel() string {
+	return r.strong.Model
+}
+
+// Status names both tiers, with the state of the strong tier's fallback
+// chain if it has one.
+func (r *RouterProvider) Status() string {
+	status := fmt.Sprintf("routing between %s (cheap) and %s (strong)", r.cheap.Model, r.strong.Model)
+	if reporter, ok := r.strong.Provider.(StatusReporter); ok {
+		status += "; strong: " + reporter.Status()
+	}
+	return status
+}
+
+func (r *RouterProvider) chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onChunk StreamCallback) (*LLMResponse, error) {
+	key := turnKey(messages)
+	tier, reason, auto := r.choose(ctx, key, messages, tools, model)
+	r.logRoute(tier, reason, messages)
+
+	response, err := callTier(ctx, tier, messages, tools, options, onChunk)
+	if !auto || tier.Name != r.cheap.Name || ctx.Err() != nil {
+		return response, err
+	}
+
+	why := escalationReason(messages, response, err)
+	if why == "" {
+		return response, nil
+	}
+	if err != nil {
+		logger.WarnCF("provider.router", "Cheap model failed, escalating",
+			map[string]interface{}{
+				"model": tier.Model,
+				"error": err.Error(),
+			})
+	}
+	r.escalate(key)
+	r.logRoute(r.strong, why, messages)
+	return callTier(ctx, r.strong, messages, tools, options, onChunk)
+}
+
+// choose picks the tier for one request. auto is false when the caller
+// asked for a specific model, in which case the request never escalates.
+func (r *RouterProvider) choose(ctx context.Context, key string, messages []Message, tools []ToolDefinition, model string) (tier RouterTier, reason string, auto bool) {
+	switch model {
+	case "", r.strong.Model:
+	case r.cheap.Model:
+		return r.cheap, "requested model", false
+	default:
+		tier = r.strong
+		tier.Model = model
+		return tier, "requested model", false
+	}
+
+	turn := r.turn(key)
+	if turn.escalated {
+		return r.strong, "escalated", true
+	}
+	if len(tools) == 0 {
+		return r.cheap, "no tools", true
+	}
+	if r.opts.MaxCheapIterations > 0 && toolIterations(messages) >= r.opts.MaxCheapIterations {
+		r.escalate(key)
+		return r.strong, "tool iterations", true
+	}
+
+	text := lastUserText(messages)
+	if r.opts.MaxCheapChars > 0 && len(text) > r.opts.MaxCheapChars {
+		return r.strong, "long message", true
+	}
+	if r.classifier != nil && text != "" {
+		if r.classify(ctx, key, turn, text) {
+			return r.strong, "classifier", true
+		}
+		return r.cheap, "classifier", true
+	}
+	return r.cheap, "short message", true
+}
+
+// classify asks the classifier model whether text needs the strong model.
+// The answer is kept for the rest of the turn; errors count as simple.
+func (r *RouterProvider) classify(ctx context.Context, key string, turn routeTurn, text string) bool {
+	if turn.classified {
+		return turn.complex
+	}
+
+	response, err := r.classifier.Provider.Chat(ctx, []Message{{Role: "user", Content: classifierPrompt + text}}, nil, r.classifier.Model, map[string]interface{}{
+		"max_tokens":  8,
+		"temperature": 0.0,
+	})
+	isComplex := false
+	if err != nil {
+		logger.WarnCF("provider.router", "Routing classifier failed",
+			map[string]interface{}{
+				"model": r.classifier.Model,
+				"error": err.Error(),
+			})
+	} else {
+		isComplex = strings.Contains(strings.ToUpper(response.Content), "COMPLEX")
+	}
+
+	r.update(key, func(t *routeTurn) {
+		t.classified = true
+		t.complex = isComplex
+	})
+	return isComplex
+}
+
+func (r *RouterProvider) turn(key string) routeTurn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.turns[key]; ok {
+		return *t
+	}
+	return routeTurn{}
+}
+
+func (r *RouterProvider) escalate(key string) {
+	r.update(key, func(t *routeTurn) { t.escalated = true })
+}
+
+func (r *RouterProvider) update(key string, fn func(t *routeTurn)) {
+	if key == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.turns[key]
+	if !ok {
+		if len(r.turns) >= maxRouteTurns {
+			r.turns = make(map[string]*routeTurn)
+		}
+		t = &routeTurn{}
+		r.turns[key] = t
+	}
+	fn(t)
+}
+
+func (r *RouterProvider) logRoute(tier RouterTier, reason string, messages []Message) {
+	logger.InfoCF("provider.router", "Model route selected",
+		map[string]interface{}{
+			"tier":      tier.Name,
+			"model":     tier.Model,
+			"reason":    reason,
+			"iteration": toolIterations(messages) + 1,
+		})
+}
+
+// callTier sends a request to one tier, streaming when asked to and the
+// tier's provider can. A tier that cannot stream delivers its text as a
+// single chunk.
+func callTier(ctx context.Context, tier RouterTier, messages []Message, tools []ToolDefinition, options map[string]interface{}, onChunk StreamCallback) (*LLMResponse, error) {
+	var response *LLMResponse
+	var err error
+	if streamer, ok := tier.Provider.(StreamingProvider); ok && onChunk != nil {
+		response, err = streamer.ChatStream(ctx, messages, tools, tier.Model, options, onChunk)
+	} else {
+		response, err = tier.Provider.Chat(ctx, messages, tools, tier.Model, options)
+		if err == nil && onChunk != nil && response.Content != "" {
+			onChunk(StreamChunk{Content: response.Content})
+		}
+	}
+
+	if err == nil && response.Model == "" {
+		response.Model = tier.Model
+	}
+	return response, err
+}
+
+// escalationReason reports why a cheap model's answer should be retried on
+// the strong model, or "" when the answer is fine.
+func escalationReason(messages []Message, response *LLMResponse, err error) string {
+	switch {
+	case err != nil:
+		return "cheap model error"
+	case response.Content == "" && len(response.ToolCalls) == 0:
+		return "empty response"
+	case repeatsToolCall(messages, response.ToolCalls):
+		return "repeated tool call"
+	}
+	return ""
+}
+
+// lastUserIndex returns the index of the message that started the turn.
+func lastUserIndex(messages []Message) int {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return i
+		}
+	}
+	return -1
+}
+
+func lastUserText(messages []Message) string {
+	if i := lastUserIndex(messages); i >= 0 {
+		return messages[i].Content
+	}
+	return ""
+}
+
+// turnKey identifies the user turn a request belongs to: every iteration of
+// a turn shares the same messages up to and including the user message.
+func turnKey(messages []Message) string {
+	i := lastUserIndex(messages)
+	if i < 0 {
+		return ""
+	}
+	h := fnv.New64a()
+	for _, m := range messages[:i+1] {
+		h.Write([]byte(m.Role))
+		h.Write([]byte(m.Content))
+	}
+	return fmt.Sprintf("%d:%x", i, h.Sum64())
+}
+
+// toolIterations counts the tool-calling assistant messages of this turn.
+func toolIterations(messages []Message) int {
+	n := 0
+	for _, m := range messages[lastUserIndex(messages)+1:] {
+		if m.Role == "assistant" && len(m.ToolCalls) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// repeatsToolCall reports whether any of calls was already made, with the
+// same arguments, earlier in this turn: a sign the model is looping.
+func repeatsToolCall(messages []Message, calls []ToolCall) bool {
+	if len(calls) == 0 {
+		return false
+	}
+	seen := make(map[string]bool)
+	for _, m := range messages[lastUserIndex(messages)+1:] {
+		for _, tc := range m.ToolCalls {
+			seen[toolCallSignature(tc)] = true
+		}
+	}
+	for _, tc := range calls {
+		if seen[toolCallSignature(tc)] {
+			return true
+		}
+	}
+	return false
+}
+
+// toolCallSignature returns the name and canonical JSON arguments of a call,
+// which may carry them either parsed or as a function payload.
+func toolCallSignature(tc ToolCall) string {
+	if tc.Function != nil {
+		var args map[string]interface{}
+		if json.Unmarshal([]byte(tc.Function.Arguments), &args) == nil {
+			data, _ := json.Marshal(args)
+			return tc.Function.Name + string(data)
+		}
+		return tc.Function.Name + tc.Function.Arguments
+	}
+	data, _ := json.Marshal(tc.Arguments)
+	return tc.Name + string(data)
+}
@@ -0,0 +1,121 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type scriptedProvider struct {
+	responses []*LLMResponse
+	err       error
+	calls     int
+	models    []string
+}
+
+func (p *scriptedProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	p.calls++
+	p.models = append(p.models, model)
+	if p.err != nil {
+		return nil, p.err
+	}
+	if len(p.responses) == 0 {
+		return &LLMResponse{Content: "ok"}, nil
+	}
+	resp := p.responses[0]
+	if len(p.responses) > 1 {
+		p.responses = p.responses[1:]
+	}
+	return resp, nil
+}
+
+func (p *scriptedProvider) GetDefaultModel() string { return "" }
+
+var routerTestTools = []ToolDefinition{{Type: "function", Function: ToolFunctionDefinition{Name: "exec"}}}
+
+func newTestRouter(cheap, strong *scriptedProvider, classifier *RouterTier) *RouterProvider {
+	return NewRouterProvider(
+		RouterTier{Name: "cheap", Provider: cheap, Model: "small"},
+		RouterTier{Name: "strong", Provider: strong, Model: "large"},
+		classifier,
+		RouterOptions{MaxCheapChars: 100, MaxCheapIterations: 3},
+	)
+}
+
+func TestRouterProvider_Heuristics(t *testing.T) {
+	cheap, strong := &scriptedProvider{}, &scriptedProvider{}
+	r := newTestRouter(cheap, strong, nil)
+	ctx := context.Background()
+
+	r.Chat(ctx, []Message{{Role: "user", Content: "hi"}}, routerTestTools, "large", nil)
+	if cheap.calls != 1 || strong.calls != 0 {
+		t.Errorf("Expected short message on cheap model, got cheap=%d strong=%d", cheap.calls, strong.calls)
+	}
+
+	r.Chat(ctx, []Message{{Role: "user", Content: strings.Repeat("a", 200)}}, routerTestTools, "large", nil)
+	if strong.calls != 1 {
+		t.Errorf("Expected long message on strong model, got strong=%d", strong.calls)
+	}
+
+	r.Chat(ctx, []Message{{Role: "user", Content: "hi"}}, routerTestTools, "custom-model", nil)
+	if strong.calls != 2 || strong.models[1] != "custom-model" {
+		t.Errorf("Expected requested model on strong provider, got %v", strong.models)
+	}
+}
+
+func TestRouterProvider_EscalatesOnFailureForTheTurn(t *testing.T) {
+	cheap := &scriptedProvider{err: errors.New("rate limited")}
+	strong := &scriptedProvider{responses: []*LLMResponse{{Content: "done"}}}
+	r := newTestRouter(cheap, strong, nil)
+	ctx := context.Background()
+
+	messages := []Message{{Role: "user", Content: "hi"}}
+	resp, err := r.Chat(ctx, messages, routerTestTools, "", nil)
+	if err != nil || resp.Content != "done" {
+		t.Fatalf("Expected strong model answer, got %v, %v", resp, err)
+	}
+
+	// The next iteration of the same turn stays on the strong model.
+	messages = append(messages,
+		Message{Role: "assistant", ToolCalls: []ToolCall{{ID: "1", Name: "exec", Arguments: map[string]interface{}{"command": "ls"}}}},
+		Message{Role: "tool", Content: "file", ToolCallID: "1"},
+	)
+	r.Chat(ctx, messages, routerTestTools, "", nil)
+	if cheap.calls != 1 || strong.calls != 2 {
+		t.Errorf("Expected turn to stay escalated, got cheap=%d strong=%d", cheap.calls, strong.calls)
+	}
+}
+
+func TestRouterProvider_EscalatesOnRepeatedToolCall(t *testing.T) {
+	repeat := &LLMResponse{ToolCalls: []ToolCall{{ID: "2", Name: "exec", Arguments: map[string]interface{}{"command": "ls"}}}}
+	cheap := &scriptedProvider{responses: []*LLMResponse{repeat}}
+	strong := &scriptedProvider{}
+	r := newTestRouter(cheap, strong, nil)
+
+	messages := []Message{
+		{Role: "user", Content: "list files"},
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "1", Type: "function", Function: &FunctionCall{Name: "exec", Arguments: `{"command":"ls"}`}}}},
+		{Role: "tool", Content: "file", ToolCallID: "1"},
+	}
+	resp, _ := r.Chat(context.Background(), messages, routerTestTools, "", nil)
+	if strong.calls != 1 || resp.Content != "ok" {
+		t.Errorf("Expected repeated tool call to escalate, got strong=%d", strong.calls)
+	}
+}
+
+func TestRouterProvider_Classifier(t *testing.T) {
+	cheap, strong := &scriptedProvider{}, &scriptedProvider{}
+	classifier := &scriptedProvider{responses: []*LLMResponse{{Content: "COMPLEX"}}}
+	r := newTestRouter(cheap, strong, &RouterTier{Name: "classifier", Provider: classifier, Model: "tiny"})
+
+	messages := []Message{{Role: "user", Content: "plan my week"}}
+	r.Chat(context.Background(), messages, routerTestTools, "", nil)
+	r.Chat(context.Background(), messages, routerTestTools, "", nil)
+	if strong.calls != 2 || cheap.calls != 0 {
+		t.Errorf("Expected classifier to pick strong model, got cheap=%d strong=%d", cheap.calls, strong.calls)
+	}
+	if classifier.calls != 1 {
+		t.Errorf("Expected one classifier call per turn, got %d", classifier.calls)
+	}
+}
@@ -20,6 +20,7 @@ type LLMResponse struct {
 	ToolCalls    []ToolCall `json:"tool_calls,omitempty"`
 	FinishReason string     `json:"finish_reason"`
 	Usage        *UsageInfo `json:"usage,omitempty"`
+	Model        string     `json:"model,omitempty"` // model that answered, set by providers that pick one
 }
 
 type UsageInfo struct {
@@ -28,11 +29,26 @@ type UsageInfo struct {
 	TotalTokens      int `json:"total_tokens"`
 }
 
+// Message is a chat message. Content always holds the plain-text form of
+// the message; Parts, when set, carries the same message as typed content
+// (text and images) for providers that accept multimodal input.
 type Message struct {
-	Role       string     `json:"role"`
-	Content    string     `json:"content"`
-	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
-	ToolCallID string     `json:"tool_call_id,omitempty"`
+	Role       string        `json:"role"`
+	Content    string        `json:"content"`
+	Parts      []ContentPart `json:"parts,omitempty"`
+	ToolCalls  []ToolCall    `json:"tool_calls,omitempty"`
+	ToolCallID string        `json:"tool_call_id,omitempty"`
+}
+
+// ContentPart is one piece of multimodal message content.
+// An image part references a local file by Path, carries base64 Data, or
+// both; Data is never persisted to session files.
+type ContentPart struct {
+	Type      string `json:"type"` // "text" or "image"
+	Text      string `json:"text,omitempty"`
+	MediaType string `json:"media_type,omitempty"` // e.g. "image/png"
+	Path      string `json:"path,omitempty"`
+	Data      string `json:"data,omitempty"` // base64, without data: prefix
 }
 
 type LLMProvider interface {
@@ -40,6 +56,34 @@ type LLMProvider interface {
 	GetDefaultModel() string
 }
 
+// StreamChunk is an incremental piece of a streamed LLM response.
+// Exactly one of Content or ToolCall is set.
+type StreamChunk struct {
+	Content  string         `json:"content,omitempty"`
+	ToolCall *ToolCallDelta `json:"tool_call,omitempty"`
+}
+
+// ToolCallDelta is a fragment of a tool call being generated.
+// ID and Name arrive with the first fragment of a call; ArgumentsDelta
+// carries the next piece of the JSON-encoded arguments.
+type ToolCallDelta struct {
+	Index          int    `json:"index"`
+	ID             string `json:"id,omitempty"`
+	Name           string `json:"name,omitempty"`
+	ArgumentsDelta string `json:"arguments_delta,omitempty"`
+}
+
+// StreamCallback receives chunks as they arrive from the provider.
+type StreamCallback func(chunk StreamChunk)
+
+// StreamingProvider is an optional interface for providers that can yield
+// incremental output. ChatStream calls onChunk for every delta and returns
+// the complete response once the stream ends, exactly as Chat would.
+type StreamingProvider interface {
+	LLMProvider
+	ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onChunk StreamCallback) (*LLMResponse, error)
+}
+
 type ToolDefinition struct {
 	Type     string                 `json:"type"`
 	Function ToolFunctionDefinition `json:"function"`
@@ -0,0 +1,96 @@
+package providers
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// visionModels lists well-known models that accept images, as glob
+// patterns matched against the model name without its provider prefix.
+var visionModels = []string{
+	"gpt-4o*",
+	"gpt-4.1*",
+	"gpt-4-turbo*",
+	"gpt-5*",
+	"chatgpt-4o*",
+	"o3",
+	"o3-pro*",
+	"o4-mini*",
+	"claude-3*",
+	"claude-*-4*",
+	"claude-sonnet-*",
+	"claude-opus-*",
+	"claude-haiku-*",
+	"gemini*",
+	"gemma-3*",
+	"gemma3*",
+	"glm-4v*",
+	"glm-4.[0-9]v*",
+	"qwen-vl*",
+	"qwen*-vl*",
+	"qvq*",
+	"llava*",
+	"pixtral*",
+	"llama-3.2-*vision*",
+	"llama3.2-vision*",
+	"llama-4*",
+	"grok-*vision*",
+	"grok-4*",
+	"kimi-vl*",
+	"moonshot-v1-*-vision*",
+	"minicpm-v*",
+}
+
+// SupportsVision reports whether model accepts images. overrides, by model
+// name or glob pattern, take precedence over the list of known models;
+// unknown models are assumed to take text only.
+func SupportsVision(model string, overrides map[string]bool) bool {
+	if vision, ok := overrides[model]; ok {
+		return vision
+	}
+	patterns := make([]string, 0, len(overrides))
+	for pattern := range overrides {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, model); matched {
+			return overrides[pattern]
+		}
+	}
+
+	name := strings.ToLower(path.Base(model))
+	for _, pattern := range visionModels {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// WithoutImages returns copies of messages for a model that takes text
+// only: content parts are dropped and each image is named by its text
+// placeholder, unless the message text already mentions one.
+func WithoutImages(messages []Message) []Message {
+	result := make([]Message, len(messages))
+	for i, msg := range messages {
+		if len(msg.Parts) > 0 {
+			content := msg.Content
+			if !strings.Contains(content, "[image") {
+				for _, part := range msg.Parts {
+					if part.Type != "image" {
+						continue
+					}
+					if content != "" {
+						content += "\n"
+					}
+					content += part.placeholder()
+				}
+			}
+			msg.Content, msg.Parts = content, nil
+		}
+		result[i] = msg
+	}
+	return result
+}
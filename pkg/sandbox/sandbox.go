@@ -0,0 +1,295 @@
+// Package sandbox runs shell commands isolated from the host. On Linux,
+// commands get their own user, mount, PID, IPC and UTS namespaces, and a
+// network namespace unless network access is allowed. They see the system
+// directories read-only, the workspace read-write and nothing else, and
+// run with resource limits, no capabilities and a syscall filter.
+//
+// Two backends set this up without root: "namespaces" is built in and
+// needs unprivileged user namespaces, "bwrap" uses bubblewrap, which some
+// distributions allow where plain user namespaces are restricted.
+//
+// The built-in backend re-executes the running binary to prepare the
+// namespaces, so programs using it must call Init first thing in main.
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	BackendNamespaces = "namespaces"
+	BackendBwrap      = "bwrap"
+)
+
+// ErrUnsupported is returned when no sandbox backend works on this system.
+var ErrUnsupported = errors.New("sandbox not supported on this system")
+
+// defaultReadOnlyPaths are the host paths commands need to run programs,
+// resolve names and verify TLS certificates. Missing ones are skipped.
+var defaultReadOnlyPaths = []string{
+	"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32",
+	"/etc/alternatives", "/etc/ssl", "/etc/ca-certificates", "/etc/pki",
+	"/etc/resolv.conf", "/etc/hosts", "/etc/nsswitch.conf", "/etc/passwd", "/etc/group",
+	"/etc/ld.so.cache", "/etc/ld.so.conf", "/etc/ld.so.conf.d", "/etc/localtime",
+}
+
+// Mount is a host path made visible inside the sandbox at the same path.
+type Mount struct {
+	Source   string `json:"source"` // host path with symlinks resolved
+	Target   string `json:"target"`
+	Writable bool   `json:"writable,omitempty"`
+	Link     string `json:"link,omitempty"` // recreate Target as a symlink to Link instead of mounting it
+}
+
+// Limits are resource limits of each sandboxed command.
+type Limits struct {
+	CPUSeconds  uint64 `json:"cpu_seconds,omitempty"`
+	MemoryBytes uint64 `json:"memory_bytes,omitempty"`
+	FileBytes   uint64 `json:"file_bytes,omitempty"`
+}
+
+// Sandbox runs shell commands with one backend and one set of mounts and
+// limits. A nil *Sandbox is valid and runs commands on the host.
+type Sandbox struct {
+	backend     string
+	bwrap       string // path of the bwrap binary
+	workspace   string
+	mounts      []Mount
+	limits      Limits
+	network     bool
+	outputLimit int
+	err         error // set when the sandbox is required but unavailable
+}
+
+var (
+	probeMu sync.Mutex
+	probed  = make(map[string]error) // probe results by backend and mounts
+)
+
+// New returns the sandbox configured by cfg for commands in workspace. It
+// returns nil when the sandbox is disabled, or when no backend works and
+// the sandbox is not required; commands then run on the host. When it is
+// required, the returned sandbox refuses every command.
+func New(cfg config.SandboxConfig, workspace string) *Sandbox {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	s := &Sandbox{
+		workspace:   workspace,
+		network:     cfg.Network,
+		outputLimit: cfg.MaxOutputKB * 1024,
+		limits: Limits{
+			CPUSeconds:  uint64(max(cfg.CPUSeconds, 0)),
+			MemoryBytes: uint64(max(cfg.MemoryMB, 0)) << 20,
+			FileBytes:   uint64(max(cfg.MaxFileMB, 0)) << 20,
+		},
+	}
+	s.mounts = mounts(workspace, cfg.ReadOnlyPaths, cfg.WritablePaths)
+
+	err := s.selectBackend(cfg.Backend)
+	if err == nil {
+		logger.InfoCF("sandbox", "Shell commands run in a sandbox",
+			map[string]interface{}{
+				"backend": s.backend,
+				"network": s.network,
+			})
+		return s
+	}
+
+	if cfg.Required {
+		logger.ErrorCF("sandbox", "Sandbox required but unavailable, shell commands are disabled",
+			map[string]interface{}{
+				"error": err.Error(),
+			})
+		return &Sandbox{err: err}
+	}
+	logger.WarnCF("sandbox", "Sandbox unavailable, shell commands run WITHOUT isolation",
+		map[string]interface{}{
+			"error": err.Error(),
+		})
+	return nil
+}
+
+// selectBackend picks the first backend of the configured ones that works.
+func (s *Sandbox) selectBackend(backend string) error {
+	var candidates []string
+	switch backend {
+	case "", "auto":
+		candidates = []string{BackendNamespaces, BackendBwrap}
+	case BackendNamespaces, BackendBwrap:
+		candidates = []string{backend}
+	default:
+		return fmt.Errorf("unknown sandbox backend %q", backend)
+	}
+
+	var errs []string
+	for _, candidate := range candidates {
+		s.backend = candidate
+		if candidate == BackendBwrap {
+			path, err := exec.LookPath("bwrap")
+			if err != nil {
+				errs = append(errs, "bwrap: not installed")
+				continue
+			}
+			s.bwrap = path
+		}
+		err := s.probe()
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", candidate, err))
+	}
+	s.backend = ""
+	return fmt.Errorf("%w (%s)", ErrUnsupported, strings.Join(errs, "; "))
+}
+
+// probe runs an empty command to check that the backend works with these
+// mounts. Results are cached, since every exec tool builds its own sandbox.
+func (s *Sandbox) probe() error {
+	key := fmt.Sprintf("%s %v %v", s.backend, s.network, s.mounts)
+	probeMu.Lock()
+	defer probeMu.Unlock()
+	if err, ok := probed[key]; ok {
+		return err
+	}
+
+	dir := "/"
+	if len(s.mounts) > 0 {
+		dir = s.mounts[0].Target
+	}
+	cmd, err := s.Command(context.Background(), []string{"/bin/sh", "-c", "exit 0"}, dir, nil)
+	if err == nil {
+		var out []byte
+		out, err = cmd.CombinedOutput()
+		if err != nil && len(out) > 0 {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+		}
+	}
+	probed[key] = err
+	return err
+}
+
+// Command returns a command that runs args in the sandbox, starting in
+// dir, which must be inside one of the mounted paths. args[0] is looked up
+// in PATH inside the sandbox. A nil env passes on Environ.
+func (s *Sandbox) Command(ctx context.Context, args []string, dir string, env []string) (*exec.Cmd, error) {
+	if s.err != nil {
+		return nil, fmt.Errorf("the sandbox is required but unavailable: %w", s.err)
+	}
+	if len(args) == 0 {
+		return nil, errors.New("no command")
+	}
+	if env == nil {
+		env = s.Environ()
+	}
+	return s.command(ctx, args, dir, env)
+}
+
+// Environ returns the environment sandboxed commands start from: PATH,
+// LANG and TERM of this process, and HOME set to the workspace. Nothing
+// else of the host's environment, such as API keys, is passed on.
+func (s *Sandbox) Environ() []string {
+	var env []string
+	for _, name := range []string{"PATH", "LANG", "TERM"} {
+		if v, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+v)
+		}
+	}
+	if s.workspace != "" {
+		env = append(env, "HOME="+s.workspace)
+	}
+	return env
+}
+
+// Backend returns the name of the backend in use, or "" if there is none.
+func (s *Sandbox) Backend() string {
+	if s == nil {
+		return ""
+	}
+	return s.backend
+}
+
+// OutputLimit returns how many bytes of output to keep per command, or 0
+// for no limit.
+func (s *Sandbox) OutputLimit() int {
+	if s == nil {
+		return 0
+	}
+	return s.outputLimit
+}
+
+// mounts returns the workspace, the extra writable paths and the read-only
+// paths that exist on the host, the workspace first.
+func mounts(workspace string, readOnly, writable []string) []Mount {
+	var result []Mount
+	seen := make(map[string]bool)
+	add := func(path string, rw bool) {
+		path = filepath.Clean(path)
+		if path == "/" || seen[path] {
+			return
+		}
+		source, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return
+		}
+		seen[path] = true
+		result = append(result, Mount{Source: source, Target: path, Writable: rw})
+	}
+
+	if workspace != "" {
+		if abs, err := filepath.Abs(workspace); err == nil {
+			add(abs, true)
+		}
+	}
+	for _, path := range writable {
+		add(expandHome(path), true)
+	}
+	for _, path := range append(append([]string(nil), defaultReadOnlyPaths...), readOnly...) {
+		add(expandHome(path), false)
+	}
+
+	// A symlink into another mounted path, such as /bin -> usr/bin on
+	// merged-/usr systems, is recreated rather than mounted twice.
+	for i, m := range result {
+		if m.Source == m.Target {
+			continue
+		}
+		link, err := os.Readlink(m.Target)
+		if err != nil {
+			continue
+		}
+		for _, other := range result {
+			if other.Source == other.Target && isWithin(m.Source, other.Target) {
+				result[i].Link = link
+				break
+			}
+		}
+	}
+	return result
+}
+
+// isWithin reports whether path is dir or inside it.
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return home + rest
+		}
+	}
+	return path
+}
@@ -0,0 +1,481 @@
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// specEnv carries the spec from the parent to the re-executed binary.
+	specEnv = "PICOCLAW_SANDBOX_SPEC"
+	// initName is argv[0] of the re-executed binary, as shown by ps.
+	initName = "picoclaw-sandbox"
+
+	capSetPCAP   = 8
+	capNetAdmin  = 12
+	capSysAdmin  = 21
+	prCapAmbient = 47
+	prCapBSDrop  = 24
+	prNoNewPrivs = 38
+	ambientClear = 4
+)
+
+// spec tells the re-executed binary how to set up the sandbox before it
+// runs Args.
+type spec struct {
+	Args     []string `json:"args"`
+	Dir      string   `json:"dir"`
+	Isolate  bool     `json:"isolate"` // set up the mounts in fresh namespaces
+	Mounts   []Mount  `json:"mounts,omitempty"`
+	Network  bool     `json:"network,omitempty"`
+	Limits   Limits   `json:"limits"`
+	Seccomp  bool     `json:"seccomp,omitempty"`
+	HostUID  int      `json:"host_uid"`
+	HostGID  int      `json:"host_gid"`
+	Hostname string   `json:"hostname,omitempty"`
+}
+
+func (s *Sandbox) command(ctx context.Context, args []string, dir string, env []string) (*exec.Cmd, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("cannot find own executable: %w", err)
+	}
+
+	sp := spec{
+		Dir:     dir,
+		Limits:  s.limits,
+		Network: s.network,
+		HostUID: os.Getuid(),
+		HostGID: os.Getgid(),
+	}
+	cmd := exec.CommandContext(ctx, self)
+
+	switch s.backend {
+	case BackendNamespaces:
+		sp.Isolate = true
+		sp.Mounts = s.mounts
+		sp.Seccomp = seccompSupported
+		sp.Hostname = "sandbox"
+		sp.Args = args
+
+		flags := syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+		if !s.network {
+			flags |= syscall.CLONE_NEWNET
+		}
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			Cloneflags:                 uintptr(flags),
+			UidMappings:                []syscall.SysProcIDMap{{ContainerID: sp.HostUID, HostID: sp.HostUID, Size: 1}},
+			GidMappings:                []syscall.SysProcIDMap{{ContainerID: sp.HostGID, HostID: sp.HostGID, Size: 1}},
+			GidMappingsEnableSetgroups: false,
+			// Capabilities within the new namespaces to set them up;
+			// they are dropped before the command runs.
+			AmbientCaps: []uintptr{capSysAdmin, capSetPCAP, capNetAdmin},
+			Pdeathsig:   syscall.SIGKILL,
+		}
+
+	case BackendBwrap:
+		bwrapArgs, filter, err := s.bwrapArgs(args, dir)
+		if err != nil {
+			return nil, err
+		}
+		sp.Args = bwrapArgs
+		if filter != nil {
+			cmd.ExtraFiles = []*os.File{filter}
+		}
+		cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+
+	default:
+		return nil, ErrUnsupported
+	}
+
+	data, err := json.Marshal(sp)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Args = []string{initName}
+	cmd.Env = append(env[:len(env):len(env)], specEnv+"="+string(data))
+	return cmd, nil
+}
+
+// bwrapArgs returns the bwrap command line for command, and the seccomp
+// filter to pass as file descriptor 3.
+func (s *Sandbox) bwrapArgs(command []string, dir string) ([]string, *os.File, error) {
+	args := []string{
+		s.bwrap,
+		"--die-with-parent", "--new-session",
+		"--unshare-user", "--unshare-pid", "--unshare-ipc", "--unshare-uts", "--unshare-cgroup-try",
+		"--hostname", "sandbox",
+		"--cap-drop", "ALL",
+	}
+	if !s.network {
+		args = append(args, "--unshare-net")
+	}
+	for _, m := range s.mounts {
+		switch {
+		case m.Link != "":
+			args = append(args, "--symlink", m.Link, m.Target)
+		case m.Writable:
+			args = append(args, "--bind", m.Source, m.Target)
+		default:
+			args = append(args, "--ro-bind", m.Source, m.Target)
+		}
+	}
+	args = append(args, "--proc", "/proc", "--dev", "/dev", "--tmpfs", "/tmp", "--chdir", dir)
+
+	var filter *os.File
+	if seccompSupported {
+		f, err := seccompFile()
+		if err != nil {
+			return nil, nil, err
+		}
+		filter = f
+		args = append(args, "--seccomp", "3")
+	}
+	args = append(append(args, "--"), command...)
+	return args, filter, nil
+}
+
+// seccompFile writes the syscall filter to an unlinked temporary file.
+func seccompFile() (*os.File, error) {
+	f, err := os.CreateTemp("", "picoclaw-seccomp-")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(f.Name())
+	filter := seccompFilter()
+	size := len(filter) * int(unsafe.Sizeof(sockFilter{}))
+	if _, err := f.Write(unsafe.Slice((*byte)(unsafe.Pointer(&filter[0])), size)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Init runs the sandbox setup when the process is the re-executed binary
+// of a sandboxed command, and never returns in that case. Otherwise it
+// returns at once. Call it first thing in main.
+func Init() {
+	data, ok := os.LookupEnv(specEnv)
+	if !ok {
+		return
+	}
+	os.Unsetenv(specEnv)
+
+	var sp spec
+	if err := json.Unmarshal([]byte(data), &sp); err != nil {
+		fail(fmt.Errorf("invalid spec: %w", err))
+	}
+	// Capabilities, no_new_privs and the syscall filter are per thread;
+	// the thread that sets them up must be the one that executes.
+	runtime.LockOSThread()
+	fail(run(sp))
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "picoclaw sandbox: %v\n", err)
+	os.Exit(126)
+}
+
+// run sets up the sandbox described by sp and executes its command.
+func run(sp spec) error {
+	if sp.Isolate {
+		if err := isolate(sp); err != nil {
+			return err
+		}
+	}
+	if err := setLimits(sp.Limits); err != nil {
+		return err
+	}
+	if sp.Isolate {
+		if err := dropCapabilities(); err != nil {
+			return err
+		}
+	}
+	if sp.Seccomp {
+		if err := installSeccomp(); err != nil {
+			return err
+		}
+	}
+
+	path := sp.Args[0]
+	if !strings.Contains(path, "/") {
+		resolved, err := exec.LookPath(path)
+		if err != nil {
+			return err
+		}
+		path = resolved
+	}
+	return syscall.Exec(path, sp.Args, os.Environ())
+}
+
+// isolate builds the sandbox's file system: a fresh tmpfs root with the
+// mounts bound into it, /proc, a minimal /dev and an empty /tmp.
+func isolate(sp spec) error {
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %w", err)
+	}
+
+	// The new root is a tmpfs mounted over /tmp; the old root stays
+	// reachable at /oldroot until the binds are done.
+	if err := syscall.Mount("tmpfs", "/tmp", "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=0755"); err != nil {
+		return fmt.Errorf("mount root: %w", err)
+	}
+	if err := os.Mkdir("/tmp/oldroot", 0700); err != nil {
+		return err
+	}
+	if err := syscall.PivotRoot("/tmp", "/tmp/oldroot"); err != nil {
+		return fmt.Errorf("pivot root: %w", err)
+	}
+	if err := os.Chdir("/"); err != nil {
+		return err
+	}
+
+	// /tmp comes first, so mounts below it, such as a workspace in /tmp,
+	// are not hidden by it.
+	if err := os.MkdirAll("/tmp", 0755); err != nil {
+		return err
+	}
+	if err := syscall.Mount("tmpfs", "/tmp", "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=1777"); err != nil {
+		return fmt.Errorf("mount /tmp: %w", err)
+	}
+
+	for _, m := range sp.Mounts {
+		if err := bind(m); err != nil {
+			return fmt.Errorf("mount %s: %w", m.Target, err)
+		}
+	}
+
+	if err := os.MkdirAll("/proc", 0755); err != nil {
+		return err
+	}
+	if err := syscall.Mount("proc", "/proc", "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mount /proc: %w", err)
+	}
+	if err := makeDev(); err != nil {
+		return fmt.Errorf("populate /dev: %w", err)
+	}
+
+	if err := syscall.Unmount("/oldroot", syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("detach old root: %w", err)
+	}
+	os.Remove("/oldroot")
+	if err := syscall.Mount("", "/", "", syscall.MS_REMOUNT|syscall.MS_BIND|syscall.MS_RDONLY, ""); err != nil {
+		return fmt.Errorf("make root read-only: %w", err)
+	}
+
+	if sp.Hostname != "" {
+		syscall.Sethostname([]byte(sp.Hostname))
+	}
+	if !sp.Network {
+		if err := loopbackUp(); err != nil {
+			return fmt.Errorf("bring up loopback: %w", err)
+		}
+	}
+	return os.Chdir(sp.Dir)
+}
+
+// bind makes m visible in the new root.
+func bind(m Mount) error {
+	if err := os.MkdirAll(filepath.Dir(m.Target), 0755); err != nil {
+		return err
+	}
+	if m.Link != "" {
+		return os.Symlink(m.Link, m.Target)
+	}
+
+	source := filepath.Join("/oldroot", m.Source)
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		err = os.MkdirAll(m.Target, 0755)
+	} else {
+		err = os.WriteFile(m.Target, nil, 0644)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := syscall.Mount(source, m.Target, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return err
+	}
+	if m.Writable {
+		return nil
+	}
+	// Remounting must keep the flags the host mount is locked with.
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(m.Target, &st); err != nil {
+		return err
+	}
+	flags := uintptr(syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY) | lockedFlags(uint64(st.Flags))
+	return syscall.Mount("", m.Target, "", flags, "")
+}
+
+// lockedFlags converts statfs flags to the mount flags a remount must keep.
+func lockedFlags(statfs uint64) uintptr {
+	const (
+		stNoSuid      = 0x2
+		stNoDev       = 0x4
+		stNoExec      = 0x8
+		stNoAtime     = 0x400
+		stNoDirAtime  = 0x800
+		stRelAtime    = 0x1000
+		msRelAtime    = 1 << 21
+		msNoDirAtime  = syscall.MS_NODIRATIME
+		msNoAtime     = syscall.MS_NOATIME
+		msNoExec      = syscall.MS_NOEXEC
+		msNoDev       = syscall.MS_NODEV
+		msNoSuid      = syscall.MS_NOSUID
+		msStrictAtime = 1 << 24
+	)
+	var flags uintptr
+	for _, f := range []struct {
+		st uint64
+		ms uintptr
+	}{
+		{stNoSuid, msNoSuid},
+		{stNoDev, msNoDev},
+		{stNoExec, msNoExec},
+		{stNoAtime, msNoAtime},
+		{stNoDirAtime, msNoDirAtime},
+		{stRelAtime, msRelAtime},
+	} {
+		if statfs&f.st != 0 {
+			flags |= f.ms
+		}
+	}
+	if flags&(msNoAtime|msRelAtime) == 0 {
+		flags |= msStrictAtime
+	}
+	return flags
+}
+
+// makeDev creates /dev with the harmless character devices bound from the
+// host and the usual symlinks.
+func makeDev() error {
+	if err := os.MkdirAll("/dev", 0755); err != nil {
+		return err
+	}
+	for _, name := range []string{"null", "zero", "full", "random", "urandom", "tty"} {
+		target := "/dev/" + name
+		if err := os.WriteFile(target, nil, 0666); err != nil {
+			return err
+		}
+		if err := syscall.Mount("/oldroot/dev/"+name, target, "", syscall.MS_BIND, ""); err != nil {
+			return err
+		}
+	}
+	for link, target := range map[string]string{
+		"/dev/fd":     "/proc/self/fd",
+		"/dev/stdin":  "/proc/self/fd/0",
+		"/dev/stdout": "/proc/self/fd/1",
+		"/dev/stderr": "/proc/self/fd/2",
+	} {
+		if err := os.Symlink(target, link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loopbackUp brings up the loopback interface of a new network namespace,
+// so commands can still reach servers they start on localhost.
+func loopbackUp() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	var req struct {
+		name  [syscall.IFNAMSIZ]byte
+		flags uint16
+		_     [22]byte
+	}
+	copy(req.name[:], "lo")
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCGIFFLAGS, uintptr(unsafe.Pointer(&req))); errno != 0 {
+		return errno
+	}
+	req.flags |= syscall.IFF_UP
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCSIFFLAGS, uintptr(unsafe.Pointer(&req))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func setLimits(l Limits) error {
+	for _, limit := range []struct {
+		resource int
+		value    uint64
+	}{
+		{syscall.RLIMIT_CPU, l.CPUSeconds},
+		{syscall.RLIMIT_AS, l.MemoryBytes},
+		{syscall.RLIMIT_FSIZE, l.FileBytes},
+	} {
+		if limit.value == 0 {
+			continue
+		}
+		rl := &syscall.Rlimit{Cur: limit.value, Max: limit.value}
+		if err := syscall.Setrlimit(limit.resource, rl); err != nil {
+			return fmt.Errorf("set resource limit %d: %w", limit.resource, err)
+		}
+	}
+	return nil
+}
+
+// dropCapabilities removes every capability from this thread and from the
+// bounding set, so the command cannot regain any, even running as root
+// inside the namespace.
+func dropCapabilities() error {
+	last := 40
+	if data, err := os.ReadFile("/proc/sys/kernel/cap_last_cap"); err == nil {
+		if n, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+			last = n
+		}
+	}
+	for c := 0; c <= last; c++ {
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prCapBSDrop, uintptr(c), 0); errno != 0 && errno != syscall.EINVAL {
+			return fmt.Errorf("drop capability %d: %w", c, errno)
+		}
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prCapAmbient, ambientClear, 0); errno != 0 {
+		return fmt.Errorf("clear ambient capabilities: %w", errno)
+	}
+
+	header := struct {
+		version uint32
+		pid     int32
+	}{version: 0x20080522} // _LINUX_CAPABILITY_VERSION_3
+	var data [2]struct{ effective, permitted, inheritable uint32 }
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data[0])), 0); errno != 0 {
+		return fmt.Errorf("clear capabilities: %w", errno)
+	}
+	return nil
+}
+
+// installSeccomp sets no_new_privs and loads the syscall filter.
+func installSeccomp() error {
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prNoNewPrivs, 1, 0, 0, 0, 0); errno != 0 {
+		return fmt.Errorf("set no_new_privs: %w", errno)
+	}
+	filter := seccompFilter()
+	prog := sockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_SECCOMP, seccompModeFilter, uintptr(unsafe.Pointer(&prog))); errno != 0 {
+		return fmt.Errorf("load seccomp filter: %w", errno)
+	}
+	return nil
+}
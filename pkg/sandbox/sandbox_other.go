@@ -0,0 +1,15 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"context"
+	"os/exec"
+)
+
+func (s *Sandbox) command(ctx context.Context, args []string, dir string, env []string) (*exec.Cmd, error) {
+	return nil, ErrUnsupported
+}
+
+// Init does nothing on systems without sandbox support.
+func Init() {}
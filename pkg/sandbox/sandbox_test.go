@@ -0,0 +1,144 @@
+package sandbox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// The test binary re-executes itself for the namespaces backend.
+func TestMain(m *testing.M) {
+	Init()
+	os.Exit(m.Run())
+}
+
+func newTestSandbox(t *testing.T, backend string) (*Sandbox, string) {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("sandbox needs Linux")
+	}
+	workspace := t.TempDir()
+	cfg := config.SandboxConfig{
+		Enabled:    true,
+		Backend:    backend,
+		CPUSeconds: 10,
+		MemoryMB:   256,
+		MaxFileMB:  1,
+	}
+	sb := New(cfg, workspace)
+	if sb == nil {
+		t.Skipf("%s sandbox unavailable on this system", backend)
+	}
+	return sb, workspace
+}
+
+func runIn(t *testing.T, sb *Sandbox, command, dir string) (string, error) {
+	t.Helper()
+	cmd, err := sb.Command(context.Background(), []string{"sh", "-c", command}, dir, nil)
+	if err != nil {
+		t.Fatalf("Command() error: %v", err)
+	}
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+func TestSandbox_Isolation(t *testing.T) {
+	sb, workspace := newTestSandbox(t, BackendNamespaces)
+
+	out, err := runIn(t, sb, "echo hi > note.txt && cat note.txt && pwd", workspace)
+	if err != nil || out != "hi\n"+workspace+"\n" {
+		t.Fatalf("workspace command = %q, %v", out, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(workspace, "note.txt")); string(data) != "hi\n" {
+		t.Errorf("file written in the sandbox = %q, want it in the workspace", data)
+	}
+
+	home, _ := os.UserHomeDir()
+	for _, path := range []string{home, "/root", "/var"} {
+		if isWithin(workspace, path) {
+			continue
+		}
+		if out, err := runIn(t, sb, "ls "+path, workspace); err == nil {
+			t.Errorf("%s is visible in the sandbox: %q", path, out)
+		}
+	}
+	if _, err := runIn(t, sb, "touch /usr/picoclaw-sandbox-test", workspace); err == nil {
+		t.Error("/usr is writable in the sandbox")
+	}
+
+	out, _ = runIn(t, sb, "grep -E '^(Seccomp|CapEff):' /proc/self/status", workspace)
+	if !strings.Contains(out, "CapEff:\t0000000000000000") {
+		t.Errorf("command has capabilities: %q", out)
+	}
+	if seccompSupported && !strings.Contains(out, "Seccomp:\t2") {
+		t.Errorf("command runs without the syscall filter: %q", out)
+	}
+	if out, err := runIn(t, sb, "unshare -r true", workspace); err == nil && !strings.Contains(out, "not found") {
+		t.Error("unshare succeeded in the sandbox")
+	}
+
+	if _, err := runIn(t, sb, "head -c 2000000 /dev/zero > big", workspace); err == nil {
+		t.Error("writing past the file size limit succeeded")
+	}
+}
+
+func TestSandbox_Environment(t *testing.T) {
+	sb, workspace := newTestSandbox(t, BackendNamespaces)
+	t.Setenv("PICOCLAW_TEST_SECRET", "hunter2")
+
+	out, err := runIn(t, sb, "env", workspace)
+	if err != nil {
+		t.Fatalf("env in the sandbox: %v: %q", err, out)
+	}
+	if strings.Contains(out, "PICOCLAW_TEST_SECRET") {
+		t.Errorf("host variable reached the sandbox: %q", out)
+	}
+	if !strings.Contains(out, "HOME="+workspace+"\n") {
+		t.Errorf("HOME is not the workspace: %q", out)
+	}
+
+	out, _ = runIn(t, sb, "echo $PATH", workspace)
+	if strings.TrimSpace(out) != os.Getenv("PATH") {
+		t.Errorf("PATH in the sandbox = %q, want %q", out, os.Getenv("PATH"))
+	}
+}
+
+func TestSandbox_RequiredButUnavailable(t *testing.T) {
+	sb := New(config.SandboxConfig{Enabled: true, Backend: "nope", Required: true}, t.TempDir())
+	if sb == nil {
+		t.Fatal("New() = nil for a required sandbox, want one that refuses commands")
+	}
+	if _, err := sb.Command(context.Background(), []string{"true"}, "/", nil); err == nil {
+		t.Error("Command() succeeded without a working backend")
+	}
+	if New(config.SandboxConfig{Enabled: true, Backend: "nope"}, t.TempDir()) != nil {
+		t.Error("New() for an optional unavailable sandbox should return nil")
+	}
+}
+
+func TestMounts(t *testing.T) {
+	dir := t.TempDir()
+	real := filepath.Join(dir, "real")
+	link := filepath.Join(dir, "link")
+	os.Mkdir(real, 0o755)
+	os.Symlink("real", link)
+
+	got := mounts(filepath.Join(dir, "ws"), []string{real, link, filepath.Join(dir, "missing")}, nil)
+	var targets []string
+	for _, m := range got {
+		if strings.HasPrefix(m.Target, dir) {
+			targets = append(targets, m.Target)
+			if m.Target == link && m.Link != "real" {
+				t.Errorf("symlink mount = %+v, want it recreated as a link", m)
+			}
+		}
+	}
+	if len(targets) != 2 || targets[0] != real || targets[1] != link {
+		t.Errorf("mounts under %s = %v, want the existing paths only", dir, targets)
+	}
+}
@@ -0,0 +1,70 @@
+package sandbox
+
+import "syscall"
+
+const (
+	seccompModeFilter = 2
+	seccompRetAllow   = 0x7fff0000
+	seccompRetErrno   = 0x00050000
+
+	bpfLdWAbs  = 0x20 // BPF_LD | BPF_W | BPF_ABS
+	bpfJeqK    = 0x15 // BPF_JMP | BPF_JEQ | BPF_K
+	bpfJgeK    = 0x35 // BPF_JMP | BPF_JGE | BPF_K
+	bpfRetK    = 0x06 // BPF_RET | BPF_K
+	offsetNr   = 0    // offsetof(struct seccomp_data, nr)
+	offsetArch = 4    // offsetof(struct seccomp_data, arch)
+)
+
+type sockFilter struct {
+	Code uint16
+	Jt   uint8
+	Jf   uint8
+	K    uint32
+}
+
+type sockFprog struct {
+	Len    uint16
+	Filter *sockFilter
+}
+
+// deniedSyscalls are the calls a sandboxed command has no use for that
+// could reach the kernel or other processes beyond its namespaces: mounts,
+// namespaces, modules, kernel keyrings, tracing, BPF and the clock.
+var deniedSyscalls = append([]uint32{
+	syscall.SYS_MOUNT, syscall.SYS_UMOUNT2, syscall.SYS_PIVOT_ROOT,
+	syscall.SYS_UNSHARE, syscall.SYS_SWAPON, syscall.SYS_SWAPOFF,
+	syscall.SYS_REBOOT, syscall.SYS_KEXEC_LOAD,
+	syscall.SYS_INIT_MODULE, syscall.SYS_DELETE_MODULE,
+	syscall.SYS_ACCT, syscall.SYS_SETTIMEOFDAY, syscall.SYS_CLOCK_SETTIME,
+	syscall.SYS_KEYCTL, syscall.SYS_ADD_KEY, syscall.SYS_REQUEST_KEY,
+	syscall.SYS_PTRACE, syscall.SYS_PERF_EVENT_OPEN,
+}, archDeniedSyscalls...)
+
+// seccompFilter returns a BPF program that fails the denied syscalls with
+// EPERM, and every syscall of a foreign architecture or ABI.
+func seccompFilter() []sockFilter {
+	n := len(deniedSyscalls)
+	filter := make([]sockFilter, 0, n+6)
+	// Index of the final "deny" instruction, which every match jumps to.
+	deny := 3 + n + 1
+	if denyX32 {
+		deny++
+	}
+	// Jumps are relative to the instruction after the one being appended.
+	jumpTo := func(target int) uint8 { return uint8(target - len(filter) - 1) }
+
+	filter = append(filter, sockFilter{Code: bpfLdWAbs, K: offsetArch})
+	filter = append(filter, sockFilter{Code: bpfJeqK, K: auditArch, Jf: jumpTo(deny)})
+	filter = append(filter, sockFilter{Code: bpfLdWAbs, K: offsetNr})
+	if denyX32 {
+		filter = append(filter, sockFilter{Code: bpfJgeK, K: x32SyscallBit, Jt: jumpTo(deny)})
+	}
+	for _, nr := range deniedSyscalls {
+		filter = append(filter, sockFilter{Code: bpfJeqK, K: nr, Jt: jumpTo(deny)})
+	}
+	filter = append(filter,
+		sockFilter{Code: bpfRetK, K: seccompRetAllow},
+		sockFilter{Code: bpfRetK, K: seccompRetErrno | uint32(syscall.EPERM)},
+	)
+	return filter
+}
@@ -0,0 +1,20 @@
+package sandbox
+
+const (
+	seccompSupported = true
+	auditArch        = 0xc000003e // AUDIT_ARCH_X86_64
+	// x32 syscalls reach the same kernel code under other numbers.
+	denyX32       = true
+	x32SyscallBit = 0x40000000
+)
+
+var archDeniedSyscalls = []uint32{
+	303, // name_to_handle_at
+	304, // open_by_handle_at
+	308, // setns
+	310, // process_vm_readv
+	311, // process_vm_writev
+	313, // finit_module
+	321, // bpf
+	323, // userfaultfd
+}
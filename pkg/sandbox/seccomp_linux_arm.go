@@ -0,0 +1,18 @@
+package sandbox
+
+import "syscall"
+
+const (
+	seccompSupported = true
+	auditArch        = 0x40000028 // AUDIT_ARCH_ARM
+	denyX32          = false
+	x32SyscallBit    = 0
+)
+
+var archDeniedSyscalls = []uint32{
+	syscall.SYS_NAME_TO_HANDLE_AT, syscall.SYS_OPEN_BY_HANDLE_AT,
+	syscall.SYS_SETNS, syscall.SYS_PROCESS_VM_READV, syscall.SYS_PROCESS_VM_WRITEV,
+	379, // finit_module
+	386, // bpf
+	388, // userfaultfd
+}
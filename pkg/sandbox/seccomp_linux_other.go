@@ -0,0 +1,14 @@
+//go:build linux && !amd64 && !arm64 && !arm && !riscv64
+
+package sandbox
+
+// The syscall filter is only built for the architectures above; elsewhere
+// commands are isolated by namespaces and limits alone.
+const (
+	seccompSupported = false
+	auditArch        = 0
+	denyX32          = false
+	x32SyscallBit    = 0
+)
+
+var archDeniedSyscalls []uint32
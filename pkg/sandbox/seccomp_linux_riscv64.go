@@ -0,0 +1,17 @@
+package sandbox
+
+import "syscall"
+
+const (
+	seccompSupported = true
+	auditArch        = 0xc00000f3 // AUDIT_ARCH_RISCV64
+	denyX32          = false
+	x32SyscallBit    = 0
+)
+
+var archDeniedSyscalls = []uint32{
+	syscall.SYS_NAME_TO_HANDLE_AT, syscall.SYS_OPEN_BY_HANDLE_AT,
+	syscall.SYS_SETNS, syscall.SYS_PROCESS_VM_READV, syscall.SYS_PROCESS_VM_WRITEV,
+	syscall.SYS_FINIT_MODULE, syscall.SYS_BPF,
+	282, // userfaultfd
+}
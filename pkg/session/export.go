@@ -0,0 +1,208 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// Export formats.
+const (
+	FormatMarkdown = "markdown"
+	FormatJSONL    = "jsonl" // OpenAI chat format, one session per line
+	FormatHTML     = "html"
+)
+
+// maxExportedResult caps tool results in transcripts meant for reading.
+// JSONL exports keep them whole.
+const maxExportedResult = 2000
+
+// summaryPrefix starts the system message that carries a session's summary
+// in JSONL exports, so imports can restore it.
+const summaryPrefix = "Summary of earlier messages: "
+
+// Export renders a session in one of the export formats.
+func Export(format, title, summary string, history []providers.Message) (string, error) {
+	switch format {
+	case "", FormatMarkdown, "md":
+		return Markdown(title, summary, history), nil
+	case FormatJSONL:
+		line, err := json.Marshal(chatExport{Messages: chatMessages(summary, history)})
+		if err != nil {
+			return "", err
+		}
+		return string(line) + "\n", nil
+	case FormatHTML:
+		return HTML(title, summary, history)
+	default:
+		return "", fmt.Errorf("unknown export format %q (use markdown, jsonl or html)", format)
+	}
+}
+
+// FormatExtension returns the file extension and MIME type for an export
+// format.
+func FormatExtension(format string) (ext, mimeType string) {
+	switch format {
+	case FormatJSONL:
+		return ".jsonl", "application/jsonl"
+	case FormatHTML:
+		return ".html", "text/html"
+	default:
+		return ".md", "text/markdown"
+	}
+}
+
+// chatExport is one line of a JSONL export, as used for OpenAI fine-tuning
+// data.
+type chatExport struct {
+	Messages []chatMessage `json:"messages"`
+}
+
+// chatMessage is a message in the OpenAI chat format. Content is a string
+// or, in imports, a list of parts.
+type chatMessage struct {
+	Role       string         `json:"role"`
+	Content    interface{}    `json:"content"`
+	ToolCalls  []chatToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+}
+
+type chatToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+func chatMessages(summary string, history []providers.Message) []chatMessage {
+	messages := make([]chatMessage, 0, len(history)+1)
+	if summary != "" {
+		messages = append(messages, chatMessage{Role: "system", Content: summaryPrefix + summary})
+	}
+	for _, m := range history {
+		cm := chatMessage{Role: m.Role, Content: m.Content, ToolCallID: m.ToolCallID}
+		for _, tc := range m.ToolCalls {
+			var call chatToolCall
+			call.ID, call.Type = tc.ID, "function"
+			call.Function.Name, call.Function.Arguments = toolCall(tc)
+			cm.ToolCalls = append(cm.ToolCalls, call)
+		}
+		if m.Content == "" && len(cm.ToolCalls) > 0 {
+			cm.Content = nil
+		}
+		messages = append(messages, cm)
+	}
+	return messages
+}
+
+// toolCall returns the name and JSON arguments of a tool call, which
+// providers fill in either directly or through Function.
+func toolCall(tc providers.ToolCall) (name, args string) {
+	if tc.Function != nil {
+		return tc.Function.Name, tc.Function.Arguments
+	}
+	if tc.Arguments != nil {
+		data, _ := json.Marshal(tc.Arguments)
+		args = string(data)
+	}
+	return tc.Name, args
+}
+
+// imagePaths returns the files of the images attached to a message.
+func imagePaths(m providers.Message) []string {
+	var paths []string
+	for _, p := range m.Parts {
+		if p.Type == "image" && p.Path != "" {
+			paths = append(paths, p.Path)
+		}
+	}
+	return paths
+}
+
+type htmlMessage struct {
+	Role    string // CSS class: user, assistant or tool
+	Label   string
+	Content string
+	Images  []string
+	Calls   []htmlToolCall
+}
+
+type htmlToolCall struct {
+	Name string
+	Args string
+}
+
+var htmlTemplate = template.Must(template.New("session").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Session {{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 50rem; margin: 2rem auto; padding: 0 1rem; color: #222; }
+.meta { color: #777; }
+.message { margin: 1rem 0; padding: .75rem 1rem; border-radius: .5rem; }
+.user { background: #e8f0fe; }
+.assistant { background: #f4f4f4; }
+.summary { background: #fff8e1; }
+.label { font-weight: bold; margin-bottom: .25rem; }
+.content { white-space: pre-wrap; overflow-wrap: anywhere; }
+details { margin: .5rem 0; }
+summary { cursor: pointer; color: #555; }
+pre { background: #fafafa; border: 1px solid #ddd; padding: .5rem; overflow-x: auto; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>Session {{.Title}}</h1>
+<p class="meta">Exported {{.Exported}}</p>
+{{if .Summary}}<div class="message summary"><div class="label">Summary of earlier messages</div><div class="content">{{.Summary}}</div></div>
+{{end}}{{range .Messages}}{{if eq .Role "tool"}}<details><summary>Result</summary><pre>{{.Content}}</pre></details>
+{{else}}<div class="message {{.Role}}"><div class="label">{{.Label}}</div>{{if .Content}}<div class="content">{{.Content}}</div>{{end}}{{range .Images}}
+<p class="meta">Image: {{.}}</p>{{end}}{{range .Calls}}
+<details><summary>Called {{.Name}}</summary><pre>{{.Args}}</pre></details>{{end}}</div>
+{{end}}{{end}}</body>
+</html>
+`))
+
+// HTML renders a session as a self-contained page. Tool calls and results
+// are collapsed.
+func HTML(title, summary string, history []providers.Message) (string, error) {
+	data := struct {
+		Title    string
+		Exported string
+		Summary  string
+		Messages []htmlMessage
+	}{
+		Title:    title,
+		Exported: time.Now().Format("2006-01-02 15:04"),
+		Summary:  summary,
+	}
+	for _, m := range history {
+		switch m.Role {
+		case "user":
+			data.Messages = append(data.Messages, htmlMessage{Role: "user", Label: "User", Content: m.Content, Images: imagePaths(m)})
+		case "assistant":
+			hm := htmlMessage{Role: "assistant", Label: "Assistant", Content: m.Content}
+			for _, tc := range m.ToolCalls {
+				name, args := toolCall(tc)
+				hm.Calls = append(hm.Calls, htmlToolCall{Name: name, Args: args})
+			}
+			data.Messages = append(data.Messages, hm)
+		case "tool":
+			data.Messages = append(data.Messages, htmlMessage{Role: "tool", Content: utils.Truncate(m.Content, maxExportedResult)})
+		}
+	}
+
+	var sb strings.Builder
+	if err := htmlTemplate.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
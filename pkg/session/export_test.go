@@ -0,0 +1,162 @@
+package session
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func exportHistory() []providers.Message {
+	return []providers.Message{
+		{Role: "user", Content: "What is in <notes>?"},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{
+			ID:       "call_1",
+			Type:     "function",
+			Function: &providers.FunctionCall{Name: "read_file", Arguments: `{"path":"notes.md"}`},
+		}}},
+		{Role: "tool", ToolCallID: "call_1", Content: "buy milk\n```\ncode\n```"},
+		{Role: "assistant", Content: "Your notes say: buy milk."},
+	}
+}
+
+func TestExport_Formats(t *testing.T) {
+	history := exportHistory()
+
+	md, err := Export(FormatMarkdown, "cli:1", "talked about groceries", history)
+	if err != nil {
+		t.Fatalf("Export(markdown) failed: %v", err)
+	}
+	for _, want := range []string{
+		"talked about groceries",
+		"**User:**\n\nWhat is in <notes>?",
+		"_Called read_file_\n\n```json\n{\"path\":\"notes.md\"}\n```",
+		"_Result:_\n\n````\nbuy milk\n```\ncode\n```\n````",
+		"**Assistant:**\n\nYour notes say: buy milk.",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Markdown export lacks %q:\n%s", want, md)
+		}
+	}
+
+	page, err := Export(FormatHTML, "cli:1", "talked about groceries", history)
+	if err != nil {
+		t.Fatalf("Export(html) failed: %v", err)
+	}
+	if strings.Contains(page, "<notes>") || !strings.Contains(page, "What is in &lt;notes&gt;?") {
+		t.Error("HTML export does not escape message content")
+	}
+	if !strings.Contains(page, "<summary>Called read_file</summary>") || !strings.Contains(page, "talked about groceries") {
+		t.Errorf("HTML export lacks the tool call or summary:\n%s", page)
+	}
+
+	line, err := Export(FormatJSONL, "cli:1", "talked about groceries", history)
+	if err != nil {
+		t.Fatalf("Export(jsonl) failed: %v", err)
+	}
+	if strings.Count(line, "\n") != 1 {
+		t.Errorf("JSONL export is not a single line: %q", line)
+	}
+	var decoded struct {
+		Messages []map[string]interface{} `json:"messages"`
+	}
+	if err := json.Unmarshal([]byte(line), &decoded); err != nil {
+		t.Fatalf("JSONL export is not JSON: %v", err)
+	}
+	if len(decoded.Messages) != 5 || decoded.Messages[0]["role"] != "system" || decoded.Messages[2]["content"] != nil {
+		t.Errorf("JSONL messages = %+v, want the summary first and null content for the tool call", decoded.Messages)
+	}
+
+	if _, err := Export("pdf", "cli:1", "", history); err == nil {
+		t.Error("Export accepted an unknown format")
+	}
+}
+
+func TestImport_OpenAIRoundTrip(t *testing.T) {
+	line, _ := Export(FormatJSONL, "cli:1", "talked about groceries", exportHistory())
+	convs, format, err := ParseConversations([]byte(line+line), ImportAuto)
+	if err != nil || format != ImportOpenAI || len(convs) != 2 {
+		t.Fatalf("ParseConversations = %d conversations, %q, %v", len(convs), format, err)
+	}
+
+	sm := NewSessionManagerWithStore(NewJSONStore(t.TempDir()))
+	if err := sm.Import("telegram:5", convs[0]); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if sm.GetSummary("telegram:5") != "talked about groceries" {
+		t.Errorf("imported summary = %q", sm.GetSummary("telegram:5"))
+	}
+	history := sm.GetHistory("telegram:5")
+	if len(history) != 4 || history[1].ToolCalls[0].Function.Name != "read_file" || history[2].ToolCallID != "call_1" {
+		t.Errorf("imported history = %+v", history)
+	}
+	if err := sm.Import("telegram:5", convs[1]); err == nil {
+		t.Error("Import overwrote a session with messages")
+	}
+}
+
+func TestImport_ChatGPT(t *testing.T) {
+	// "b" was regenerated as "b2"; current_node follows the second answer.
+	data := `[{
+		"title": "Trip planning",
+		"conversation_id": "c-1",
+		"create_time": 1700000000.5,
+		"current_node": "b2",
+		"mapping": {
+			"root": {"message": null, "parent": null},
+			"sys": {"parent": "root", "message": {"author": {"role": "system"}, "content": {"content_type": "text", "parts": [""]}, "metadata": {"is_visually_hidden_from_conversation": true}}},
+			"a": {"parent": "sys", "message": {"author": {"role": "user"}, "content": {"content_type": "text", "parts": ["Plan a trip to Lyon"]}}},
+			"b": {"parent": "a", "message": {"author": {"role": "assistant"}, "content": {"content_type": "text", "parts": ["First answer"]}}},
+			"b2": {"parent": "a", "message": {"author": {"role": "assistant"}, "content": {"content_type": "text", "parts": ["Second answer"]}, "recipient": "all"}}
+		}
+	}, {"title": "Other", "conversation_id": "c-2", "current_node": "", "mapping": {}}]`
+
+	convs, format, err := ParseConversations([]byte(data), ImportAuto)
+	if err != nil || format != ImportChatGPT || len(convs) != 2 {
+		t.Fatalf("ParseConversations = %d conversations, %q, %v", len(convs), format, err)
+	}
+	selected := SelectConversations(convs, []string{"Trip planning"})
+	if len(selected) != 1 || selected[0].ID != "c-1" {
+		t.Fatalf("SelectConversations = %+v", selected)
+	}
+	conv := selected[0]
+	if len(conv.Messages) != 2 || conv.Messages[0].Content != "Plan a trip to Lyon" || conv.Messages[1].Content != "Second answer" {
+		t.Errorf("messages = %+v, want the question and the current answer", conv.Messages)
+	}
+	if conv.Created.Unix() != 1700000000 {
+		t.Errorf("created = %v", conv.Created)
+	}
+}
+
+func TestImport_OpenClaw(t *testing.T) {
+	data := strings.Join([]string{
+		`{"type":"session","id":"s-9","timestamp":"2025-11-02T10:00:00Z","cwd":"/home/me"}`,
+		`{"type":"message","id":"e1","message":{"role":"user","content":[{"type":"text","text":"old question"}]}}`,
+		`{"type":"message","id":"e2","message":{"role":"assistant","content":[{"type":"text","text":"old answer"}]}}`,
+		`{"type":"message","id":"e3","message":{"role":"user","content":"list my files"}}`,
+		`{"type":"compaction","id":"e4","summary":"asked an old question","firstKeptEntryId":"e3"}`,
+		`{"type":"message","id":"e5","message":{"role":"assistant","content":[{"type":"thinking","thinking":"use exec"},{"type":"toolCall","id":"t1","name":"exec","arguments":{"command":"ls"}}]}}`,
+		`{"type":"message","id":"e6","message":{"role":"toolResult","toolCallId":"t1","toolName":"exec","content":[{"type":"text","text":"a.txt"}]}}`,
+		`{"type":"message","id":"e7","message":{"role":"assistant","content":[{"type":"text","text":"You have a.txt."}]}}`,
+	}, "\n")
+
+	convs, format, err := ParseConversations([]byte(data), ImportAuto)
+	if err != nil || format != ImportOpenClaw || len(convs) != 1 {
+		t.Fatalf("ParseConversations = %d conversations, %q, %v", len(convs), format, err)
+	}
+	conv := convs[0]
+	if conv.ID != "s-9" || conv.Summary != "asked an old question" {
+		t.Errorf("conversation = %q with summary %q", conv.ID, conv.Summary)
+	}
+	if len(conv.Messages) != 4 || conv.Messages[0].Content != "list my files" {
+		t.Fatalf("messages = %+v, want those kept by the compaction", conv.Messages)
+	}
+	call := conv.Messages[1]
+	if call.Content != "" || len(call.ToolCalls) != 1 || call.ToolCalls[0].Function.Arguments != `{"command":"ls"}` {
+		t.Errorf("tool call message = %+v", call)
+	}
+	if result := conv.Messages[2]; result.Role != "tool" || result.ToolCallID != "t1" || result.Content != "a.txt" {
+		t.Errorf("tool result message = %+v", result)
+	}
+}
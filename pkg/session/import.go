@@ -0,0 +1,416 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// Import formats.
+const (
+	ImportAuto     = "auto"
+	ImportOpenAI   = "openai"   // JSONL with a {"messages": [...]} object per line, as written by Export
+	ImportChatGPT  = "chatgpt"  // conversations.json from a ChatGPT data export
+	ImportOpenClaw = "openclaw" // an OpenClaw session transcript (.jsonl)
+)
+
+// Conversation is a conversation read from another tool, ready to become
+// a session.
+type Conversation struct {
+	ID       string
+	Title    string
+	Summary  string
+	Messages []providers.Message
+	Created  time.Time
+}
+
+// ParseConversations reads the conversations in data. With ImportAuto the
+// format is detected from the first value; the format used is returned.
+func ParseConversations(data []byte, format string) ([]Conversation, string, error) {
+	if format == "" || format == ImportAuto {
+		format = detectFormat(data)
+		if format == "" {
+			return nil, "", errors.New("unrecognized file; use --format openai, chatgpt or openclaw")
+		}
+	}
+
+	var convs []Conversation
+	var err error
+	switch format {
+	case ImportOpenAI:
+		convs, err = parseOpenAI(data)
+	case ImportChatGPT:
+		convs, err = parseChatGPT(data)
+	case ImportOpenClaw:
+		convs, err = parseOpenClaw(data)
+	default:
+		return nil, "", fmt.Errorf("unknown import format %q (use openai, chatgpt or openclaw)", format)
+	}
+	if err != nil {
+		return nil, format, fmt.Errorf("reading %s conversations: %w", format, err)
+	}
+	return convs, format, nil
+}
+
+// detectFormat looks at the first JSON value of data.
+func detectFormat(data []byte) string {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("[")) {
+		return ImportChatGPT
+	}
+	var first struct {
+		Type     string          `json:"type"`
+		Messages json.RawMessage `json:"messages"`
+		Mapping  json.RawMessage `json:"mapping"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&first); err != nil {
+		return ""
+	}
+	switch {
+	case first.Mapping != nil:
+		return ImportChatGPT
+	case first.Messages != nil:
+		return ImportOpenAI
+	case first.Type != "":
+		return ImportOpenClaw
+	}
+	return ""
+}
+
+// decodeAll calls fn with each JSON value in data, which may be JSONL or a
+// sequence of indented objects.
+func decodeAll(data []byte, fn func(raw json.RawMessage) error) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(raw); err != nil {
+			return err
+		}
+	}
+}
+
+func parseOpenAI(data []byte) ([]Conversation, error) {
+	var convs []Conversation
+	err := decodeAll(data, func(raw json.RawMessage) error {
+		var line chatExport
+		if err := json.Unmarshal(raw, &line); err != nil {
+			return err
+		}
+		conv := Conversation{ID: strconv.Itoa(len(convs) + 1)}
+		for _, cm := range line.Messages {
+			content := partsText(cm.Content)
+			switch cm.Role {
+			case "system", "developer":
+				// The agent brings its own system prompt; only a
+				// summary is kept.
+				if strings.HasPrefix(content, summaryPrefix) {
+					conv.Summary = strings.TrimPrefix(content, summaryPrefix)
+				}
+			case "user", "assistant", "tool":
+				m := providers.Message{Role: cm.Role, Content: content, ToolCallID: cm.ToolCallID}
+				for _, call := range cm.ToolCalls {
+					m.ToolCalls = append(m.ToolCalls, providers.ToolCall{
+						ID:   call.ID,
+						Type: "function",
+						Function: &providers.FunctionCall{
+							Name:      call.Function.Name,
+							Arguments: call.Function.Arguments,
+						},
+					})
+				}
+				conv.Messages = append(conv.Messages, m)
+			}
+		}
+		convs = append(convs, conv)
+		return nil
+	})
+	return convs, err
+}
+
+// partsText returns the text of OpenAI message content, a string or a
+// list of parts.
+func partsText(content interface{}) string {
+	switch c := content.(type) {
+	case string:
+		return c
+	case []interface{}:
+		var texts []string
+		for _, p := range c {
+			part, _ := p.(map[string]interface{})
+			if text, ok := part["text"].(string); ok && text != "" {
+				texts = append(texts, text)
+			}
+		}
+		return strings.Join(texts, "\n\n")
+	}
+	return ""
+}
+
+type chatGPTConversation struct {
+	ID             string                 `json:"id"`
+	ConversationID string                 `json:"conversation_id"`
+	Title          string                 `json:"title"`
+	CreateTime     float64                `json:"create_time"`
+	CurrentNode    string                 `json:"current_node"`
+	Mapping        map[string]chatGPTNode `json:"mapping"`
+}
+
+type chatGPTNode struct {
+	Parent  string `json:"parent"`
+	Message *struct {
+		Author struct {
+			Role string `json:"role"`
+		} `json:"author"`
+		Content struct {
+			ContentType string        `json:"content_type"`
+			Parts       []interface{} `json:"parts"`
+		} `json:"content"`
+		Recipient string `json:"recipient"`
+		Metadata  struct {
+			Hidden bool `json:"is_visually_hidden_from_conversation"`
+		} `json:"metadata"`
+	} `json:"message"`
+}
+
+// parseChatGPT reads the conversations.json of a ChatGPT export. Each
+// conversation is a tree of edits and regenerations; the branch that was
+// shown last, ending at current_node, is kept. Only the text of user and
+// assistant messages is imported.
+func parseChatGPT(data []byte) ([]Conversation, error) {
+	var list []chatGPTConversation
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, err
+		}
+	} else {
+		var one chatGPTConversation
+		if err := json.Unmarshal(data, &one); err != nil {
+			return nil, err
+		}
+		list = append(list, one)
+	}
+
+	convs := make([]Conversation, 0, len(list))
+	for i, c := range list {
+		conv := Conversation{ID: c.ConversationID, Title: c.Title}
+		if conv.ID == "" {
+			conv.ID = c.ID
+		}
+		if conv.ID == "" {
+			conv.ID = strconv.Itoa(i + 1)
+		}
+		if c.CreateTime > 0 {
+			conv.Created = time.Unix(int64(c.CreateTime), 0)
+		}
+
+		// Walk from the last node up to the root, then reverse. The step
+		// limit stops on cycles in a damaged file.
+		var branch []providers.Message
+		for id, steps := c.CurrentNode, 0; id != "" && steps <= len(c.Mapping); steps++ {
+			node, ok := c.Mapping[id]
+			if !ok {
+				break
+			}
+			if m := node.Message; m != nil && !m.Metadata.Hidden &&
+				(m.Author.Role == "user" || m.Author.Role == "assistant") &&
+				(m.Recipient == "" || m.Recipient == "all") &&
+				(m.Content.ContentType == "text" || m.Content.ContentType == "multimodal_text") {
+				var texts []string
+				for _, p := range m.Content.Parts {
+					if text, ok := p.(string); ok && strings.TrimSpace(text) != "" {
+						texts = append(texts, text)
+					}
+				}
+				if len(texts) > 0 {
+					branch = append(branch, providers.Message{Role: m.Author.Role, Content: strings.Join(texts, "\n\n")})
+				}
+			}
+			id = node.Parent
+		}
+		for j := len(branch) - 1; j >= 0; j-- {
+			conv.Messages = append(conv.Messages, branch[j])
+		}
+		convs = append(convs, conv)
+	}
+	return convs, nil
+}
+
+type openClawEntry struct {
+	Type             string `json:"type"`
+	ID               string `json:"id"`
+	Timestamp        string `json:"timestamp"`
+	Summary          string `json:"summary"`
+	FirstKeptEntryID string `json:"firstKeptEntryId"`
+	Message          *struct {
+		Role       string          `json:"role"`
+		Content    json.RawMessage `json:"content"`
+		ToolCallID string          `json:"toolCallId"`
+	} `json:"message"`
+}
+
+type openClawBlock struct {
+	Type      string                 `json:"type"`
+	Text      string                 `json:"text"`
+	ID        string                 `json:"id"`
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// parseOpenClaw reads an OpenClaw session transcript: a "session" header
+// followed by one entry per line. Thinking blocks are left out. A
+// compaction entry becomes the summary and drops the messages it replaced.
+func parseOpenClaw(data []byte) ([]Conversation, error) {
+	var conv Conversation
+	var entryIDs []string // entry ID of each message in conv.Messages
+	err := decodeAll(data, func(raw json.RawMessage) error {
+		var e openClawEntry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return err
+		}
+		switch e.Type {
+		case "session":
+			conv.ID = e.ID
+			if t, err := time.Parse(time.RFC3339, e.Timestamp); err == nil {
+				conv.Created = t
+			}
+		case "compaction":
+			conv.Summary = e.Summary
+			keep := len(conv.Messages)
+			for i, id := range entryIDs {
+				if id == e.FirstKeptEntryID {
+					keep = len(conv.Messages) - i
+					break
+				}
+			}
+			conv.Messages = conv.Messages[len(conv.Messages)-keep:]
+			entryIDs = entryIDs[len(entryIDs)-keep:]
+		case "message":
+			if e.Message == nil {
+				return nil
+			}
+			m, ok := openClawMessage(e.Message.Role, e.Message.Content, e.Message.ToolCallID)
+			if ok {
+				conv.Messages = append(conv.Messages, m)
+				entryIDs = append(entryIDs, e.ID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if conv.ID == "" {
+		conv.ID = "1"
+	}
+	return []Conversation{conv}, nil
+}
+
+func openClawMessage(role string, content json.RawMessage, toolCallID string) (providers.Message, bool) {
+	var text string
+	var blocks []openClawBlock
+	if err := json.Unmarshal(content, &text); err != nil {
+		if err := json.Unmarshal(content, &blocks); err != nil {
+			return providers.Message{}, false
+		}
+	}
+
+	m := providers.Message{Content: text}
+	switch role {
+	case "user", "assistant":
+		m.Role = role
+	case "toolResult":
+		m.Role, m.ToolCallID = "tool", toolCallID
+	default:
+		return m, false
+	}
+
+	var texts []string
+	if text != "" {
+		texts = append(texts, text)
+	}
+	for _, b := range blocks {
+		switch b.Type {
+		case "text":
+			if b.Text != "" {
+				texts = append(texts, b.Text)
+			}
+		case "toolCall":
+			args, _ := json.Marshal(b.Arguments)
+			m.ToolCalls = append(m.ToolCalls, providers.ToolCall{
+				ID:   b.ID,
+				Type: "function",
+				Function: &providers.FunctionCall{
+					Name:      b.Name,
+					Arguments: string(args),
+				},
+			})
+		}
+	}
+	m.Content = strings.Join(texts, "\n\n")
+	return m, m.Content != "" || len(m.ToolCalls) > 0 || m.Role == "tool"
+}
+
+// Import stores a conversation as a new session under key. It fails if
+// the session already has messages. The session counts as updated now, so
+// retention applies from the import on.
+func (sm *SessionManager) Import(key string, conv Conversation) error {
+	sm.load(key)
+
+	sm.mu.Lock()
+	if existing, ok := sm.sessions[key]; ok && (len(existing.Messages) > 0 || existing.Summary != "") {
+		sm.mu.Unlock()
+		return fmt.Errorf("session %s already exists", key)
+	}
+	now := time.Now()
+	created := conv.Created
+	if created.IsZero() {
+		created = now
+	}
+	messages := make([]providers.Message, len(conv.Messages))
+	copy(messages, conv.Messages)
+	sm.sessions[key] = &Session{
+		Key:       key,
+		Messages:  messages,
+		Summary:   conv.Summary,
+		Name:      conv.Title,
+		Created:   created,
+		Updated:   now,
+		rewritten: true,
+	}
+	sm.mu.Unlock()
+
+	return sm.Save(key)
+}
+
+// SelectConversations returns the conversations whose ID or title is
+// in want, in file order, or all of them if want is empty.
+func SelectConversations(convs []Conversation, want []string) []Conversation {
+	if len(want) == 0 {
+		return convs
+	}
+	wanted := make(map[string]bool, len(want))
+	for _, w := range want {
+		wanted[w] = true
+	}
+	var selected []Conversation
+	for _, c := range convs {
+		if wanted[c.ID] || (c.Title != "" && wanted[c.Title]) {
+			selected = append(selected, c)
+		}
+	}
+	return selected
+}
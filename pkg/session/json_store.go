@@ -0,0 +1,253 @@
+package session
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// JSONStore keeps each session in a JSON file named after its key. Every
+// save rewrites the whole file.
+type JSONStore struct {
+	dir string
+}
+
+func NewJSONStore(dir string) *JSONStore {
+	os.MkdirAll(dir, 0755)
+	return &JSONStore{dir: dir}
+}
+
+// sanitizeFilename converts a session key into a cross-platform safe filename.
+// Session keys use "channel:chatID" (e.g. "telegram:123456") but ':' is the
+// volume separator on Windows, so filepath.Base would misinterpret the key.
+// We replace it with '_'. The original key is preserved inside the JSON file,
+// so Load can tell keys that map to the same file apart.
+func sanitizeFilename(key string) string {
+	return strings.ReplaceAll(key, ":", "_")
+}
+
+// path returns the file of a session, or os.ErrInvalid for keys that would
+// not name a file directly inside the store's directory.
+func (s *JSONStore) path(key string) (string, error) {
+	filename := sanitizeFilename(key)
+
+	// filepath.IsLocal rejects empty names, "..", absolute paths, and
+	// OS-reserved device names (NUL, COM1 … on Windows).
+	// The extra checks reject "." and any directory separators so that
+	// the session file is always written directly inside the directory.
+	if filename == "." || !filepath.IsLocal(filename) || strings.ContainsAny(filename, `/\`) {
+		return "", os.ErrInvalid
+	}
+	return filepath.Join(s.dir, filename+".json"), nil
+}
+
+func (s *JSONStore) Load(key string) (*Session, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, nil
+	}
+	session, err := readSessionFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.Key != key {
+		return nil, nil
+	}
+	return session, nil
+}
+
+func readSessionFile(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	if session.Messages == nil {
+		session.Messages = []providers.Message{}
+	}
+	return &session, nil
+}
+
+// Save writes the session to a temporary file and renames it over the
+// session's file, so a crash never leaves a partial file behind.
+func (s *JSONStore) Save(session *Session, update Update) error {
+	sessionPath, err := s.path(session.Key)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp(s.dir, "session-*.tmp")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := tmpFile.Name()
+	cleanup := true
+	defer func() {
+		if cleanup {
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmpFile.Write(data); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Chmod(0644); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, sessionPath); err != nil {
+		return err
+	}
+	cleanup = false
+	return nil
+}
+
+func (s *JSONStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// sessions reads the sessions whose key starts with prefix. Files that
+// cannot be read are skipped.
+func (s *JSONStore) sessions(prefix string) ([]*Session, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	filePrefix := sanitizeFilename(prefix)
+	var sessions []*Session
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || filepath.Ext(name) != ".json" || !strings.HasPrefix(name, filePrefix) {
+			continue
+		}
+		session, err := readSessionFile(filepath.Join(s.dir, name))
+		if err != nil || !strings.HasPrefix(session.Key, prefix) {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+func (s *JSONStore) List(prefix string) ([]Info, error) {
+	sessions, err := s.sessions(prefix)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]Info, len(sessions))
+	for i, session := range sessions {
+		infos[i] = session.info()
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	return infos, nil
+}
+
+// Search reads every session file. Messages have no time of their own, so
+// matches carry the time their session was last updated.
+func (s *JSONStore) Search(query string, limit int) ([]Match, error) {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return nil, nil
+	}
+	sessions, err := s.sessions("")
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Updated.After(sessions[j].Updated) })
+
+	var matches []Match
+	for _, session := range sessions {
+		for i := len(session.Messages) - 1; i >= 0; i-- {
+			m := session.Messages[i]
+			if !containsAll(strings.ToLower(m.Content), words) {
+				continue
+			}
+			matches = append(matches, Match{
+				Key:     session.Key,
+				Role:    m.Role,
+				Snippet: snippet(m.Content, words[0]),
+				Time:    session.Updated,
+			})
+			if limit > 0 && len(matches) >= limit {
+				return matches, nil
+			}
+		}
+	}
+	return matches, nil
+}
+
+func (s *JSONStore) Trim(key string, keep int) (int, error) {
+	session, err := s.Load(key)
+	if err != nil || session == nil || len(session.Messages) <= keep {
+		return 0, err
+	}
+	dropped := len(session.Messages) - keep
+	session.Messages = session.Messages[dropped:]
+	return dropped, s.Save(session, Update{Rewritten: true})
+}
+
+func (s *JSONStore) Close() error {
+	return nil
+}
+
+func containsAll(text string, words []string) bool {
+	for _, word := range words {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// snippet returns about 80 characters of text around the first occurrence
+// of word, which is lower case.
+func snippet(text, word string) string {
+	const radius = 40
+	text = strings.Join(strings.Fields(text), " ")
+	start := strings.Index(strings.ToLower(text), word) - radius
+	if start <= 0 || start >= len(text) {
+		return utils.Truncate(text, 2*radius)
+	}
+	for !utf8.RuneStart(text[start]) {
+		start--
+	}
+	return "..." + utils.Truncate(text[start:], 2*radius)
+}
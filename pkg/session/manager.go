@@ -1,45 +1,133 @@
 package session
 
 import (
-	"encoding/json"
-	"os"
-	"path/filepath"
+	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
 )
 
 type Session struct {
-	Key      string              `json:"key"`
-	Messages []providers.Message `json:"messages"`
-	Summary  string              `json:"summary,omitempty"`
-	Created  time.Time           `json:"created"`
-	Updated  time.Time           `json:"updated"`
+	Key       string              `json:"key"`
+	Messages  []providers.Message `json:"messages"`
+	Summary   string              `json:"summary,omitempty"`   // the summaries joined, as the model sees them
+	Summaries []SummaryPart       `json:"summaries,omitempty"` // set by Compact; empty if Summary was set directly
+	Model     string              `json:"model,omitempty"`     // overrides the agent's model; set with /model
+	Name      string              `json:"name,omitempty"`      // given with /session new or rename
+	Archived  bool                `json:"archived,omitempty"`
+	Created   time.Time           `json:"created"`
+	Updated   time.Time           `json:"updated"`
+
+	// Changes since the session was loaded or saved, for Store.Save
+	stored    int  // leading messages that are in the store
+	dropped   int  // stored messages removed from the start
+	rewritten bool // the history was replaced
 }
 
+// SummaryPart is one summary of a session's compacted messages. Tier 0
+// parts each cover a chunk of messages; once a tier has too many parts,
+// its oldest are merged into one part of the next tier, so older
+// conversation is condensed further. Parts are kept oldest first.
+type SummaryPart struct {
+	Tier     int    `json:"tier"`
+	Text     string `json:"text"`
+	Messages int    `json:"messages"` // compacted messages it covers
+}
+
+// joinSummaries returns the text of parts, oldest first.
+func joinSummaries(parts []SummaryPart) string {
+	texts := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if text := strings.TrimSpace(p.Text); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+func (s *Session) info() Info {
+	return Info{
+		Key:      s.Key,
+		Name:     s.Name,
+		Messages: len(s.Messages),
+		Model:    s.Model,
+		Archived: s.Archived,
+		Created:  s.Created,
+		Updated:  s.Updated,
+	}
+}
+
+// SessionManager holds the sessions in use. Sessions are loaded from the
+// store when first used; without a store they live in memory only.
 type SessionManager struct {
 	sessions map[string]*Session
 	mu       sync.RWMutex
-	storage  string
+	store    Store
+	saveMu   sync.Mutex // keeps saves of a session in order
 }
 
+// NewSessionManager keeps sessions as JSON files in storage, or in memory
+// if storage is empty.
 func NewSessionManager(storage string) *SessionManager {
-	sm := &SessionManager{
+	if storage == "" {
+		return NewSessionManagerWithStore(nil)
+	}
+	return NewSessionManagerWithStore(NewJSONStore(storage))
+}
+
+func NewSessionManagerWithStore(store Store) *SessionManager {
+	return &SessionManager{
 		sessions: make(map[string]*Session),
-		storage:  storage,
+		store:    store,
+	}
+}
+
+// Close closes the store.
+func (sm *SessionManager) Close() error {
+	if sm.store == nil {
+		return nil
+	}
+	return sm.store.Close()
+}
+
+// load makes sure a stored session is in memory. It must be called without
+// sm.mu held.
+func (sm *SessionManager) load(key string) {
+	sm.mu.RLock()
+	_, ok := sm.sessions[key]
+	sm.mu.RUnlock()
+	if ok || sm.store == nil {
+		return
 	}
 
-	if storage != "" {
-		os.MkdirAll(storage, 0755)
-		sm.loadSessions()
+	session, err := sm.store.Load(key)
+	if err != nil {
+		logger.WarnCF("session", "Failed to load session",
+			map[string]interface{}{
+				"session_key": key,
+				"error":       err.Error(),
+			})
+		return
 	}
+	if session == nil {
+		return
+	}
+	session.stored = len(session.Messages)
 
-	return sm
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if _, ok := sm.sessions[key]; !ok {
+		sm.sessions[key] = session
+	}
 }
 
 func (sm *SessionManager) GetOrCreate(key string) *Session {
+	sm.load(key)
+
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
@@ -69,24 +157,19 @@ func (sm *SessionManager) AddMessage(sessionKey, role, content string) {
 // AddFullMessage adds a complete message with tool calls and tool call ID to the session.
 // This is used to save the full conversation flow including tool calls and tool results.
 func (sm *SessionManager) AddFullMessage(sessionKey string, msg providers.Message) {
+	session := sm.GetOrCreate(sessionKey)
+
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	session, ok := sm.sessions[sessionKey]
-	if !ok {
-		session = &Session{
-			Key:      sessionKey,
-			Messages: []providers.Message{},
-			Created:  time.Now(),
-		}
-		sm.sessions[sessionKey] = session
-	}
-
-	session.Messages = append(session.Messages, msg)
+	// Keep image references only; inline image data would bloat session files.
+	session.Messages = append(session.Messages, providers.WithoutInlineData(msg))
 	session.Updated = time.Now()
 }
 
 func (sm *SessionManager) GetHistory(key string) []providers.Message {
+	sm.load(key)
+
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
@@ -101,6 +184,8 @@ func (sm *SessionManager) GetHistory(key string) []providers.Message {
 }
 
 func (sm *SessionManager) GetSummary(key string) string {
+	sm.load(key)
+
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
@@ -111,162 +196,295 @@ func (sm *SessionManager) GetSummary(key string) string {
 	return session.Summary
 }
 
+// SetSummary replaces the summary of a session and drops its summary
+// parts.
 func (sm *SessionManager) SetSummary(key string, summary string) {
+	sm.load(key)
+
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
 	session, ok := sm.sessions[key]
 	if ok {
 		session.Summary = summary
+		session.Summaries = nil
 		session.Updated = time.Now()
 	}
 }
 
-func (sm *SessionManager) TruncateHistory(key string, keepLast int) {
+// GetSummaries returns the summary parts of a session, oldest first.
+func (sm *SessionManager) GetSummaries(key string) []SummaryPart {
+	sm.load(key)
+
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[key]
+	if !ok || len(session.Summaries) == 0 {
+		return nil
+	}
+	parts := make([]SummaryPart, len(session.Summaries))
+	copy(parts, session.Summaries)
+	return parts
+}
+
+// Compact replaces the messages in compacted, which must still start the
+// session's history, by the summary parts. It reports false, changing
+// nothing, if the history changed since compacted was read from it.
+func (sm *SessionManager) Compact(key string, compacted []providers.Message, parts []SummaryPart) bool {
+	sm.load(key)
+
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
 	session, ok := sm.sessions[key]
-	if !ok {
-		return
+	if !ok || len(session.Messages) < len(compacted) {
+		return false
 	}
-
-	if keepLast <= 0 {
-		session.Messages = []providers.Message{}
-		session.Updated = time.Now()
-		return
+	for i, m := range compacted {
+		current := session.Messages[i]
+		if current.Role != m.Role || current.Content != m.Content || current.ToolCallID != m.ToolCallID {
+			return false
+		}
 	}
 
-	if len(session.Messages) <= keepLast {
-		return
+	session.Summaries = append([]SummaryPart(nil), parts...)
+	session.Summary = joinSummaries(parts)
+	sm.dropOldest(session, len(compacted))
+	return true
+}
+
+// GetModel returns the model chosen for a session, or "" for the agent's
+// default.
+func (sm *SessionManager) GetModel(key string) string {
+	sm.load(key)
+
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		return ""
 	}
+	return session.Model
+}
 
-	session.Messages = session.Messages[len(session.Messages)-keepLast:]
+// SetModel sets the model of a session, creating it if needed. An empty
+// model restores the agent's default.
+func (sm *SessionManager) SetModel(key string, model string) {
+	session := sm.GetOrCreate(key)
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	session.Model = model
 	session.Updated = time.Now()
 }
 
-// sanitizeFilename converts a session key into a cross-platform safe filename.
-// Session keys use "channel:chatID" (e.g. "telegram:123456") but ':' is the
-// volume separator on Windows, so filepath.Base would misinterpret the key.
-// We replace it with '_'. The original key is preserved inside the JSON file,
-// so loadSessions still maps back to the right in-memory key.
-func sanitizeFilename(key string) string {
-	return strings.ReplaceAll(key, ":", "_")
+// SetName names a session, creating it if needed.
+func (sm *SessionManager) SetName(key string, name string) {
+	session := sm.GetOrCreate(key)
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	session.Name = name
+	session.Updated = time.Now()
 }
 
-func (sm *SessionManager) Save(key string) error {
-	if sm.storage == "" {
-		return nil
-	}
+// SetArchived archives or restores a session. Archived sessions keep their
+// history but are left out of /session list.
+func (sm *SessionManager) SetArchived(key string, archived bool) {
+	sm.load(key)
 
-	filename := sanitizeFilename(key)
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 
-	// filepath.IsLocal rejects empty names, "..", absolute paths, and
-	// OS-reserved device names (NUL, COM1 … on Windows).
-	// The extra checks reject "." and any directory separators so that
-	// the session file is always written directly inside sm.storage.
-	if filename == "." || !filepath.IsLocal(filename) || strings.ContainsAny(filename, `/\`) {
-		return os.ErrInvalid
+	if session, ok := sm.sessions[key]; ok {
+		session.Archived = archived
+		session.Updated = time.Now()
 	}
+}
 
-	// Snapshot under read lock, then perform slow file I/O after unlock.
-	sm.mu.RLock()
-	stored, ok := sm.sessions[key]
-	if !ok {
-		sm.mu.RUnlock()
+// Delete removes a session and its stored messages.
+func (sm *SessionManager) Delete(key string) error {
+	sm.mu.Lock()
+	delete(sm.sessions, key)
+	sm.mu.Unlock()
+
+	if sm.store == nil {
 		return nil
 	}
+	return sm.store.Delete(key)
+}
 
-	snapshot := Session{
-		Key:     stored.Key,
-		Summary: stored.Summary,
-		Created: stored.Created,
-		Updated: stored.Updated,
+// Info describes a session without its messages.
+type Info struct {
+	Key      string
+	Name     string
+	Messages int
+	Model    string
+	Archived bool
+	Created  time.Time
+	Updated  time.Time
+}
+
+// List returns the sessions whose key starts with prefix, sorted by key:
+// the stored ones and those in memory that were not saved yet.
+func (sm *SessionManager) List(prefix string) []Info {
+	byKey := make(map[string]Info)
+	if sm.store != nil {
+		stored, err := sm.store.List(prefix)
+		if err != nil {
+			logger.WarnCF("session", "Failed to list sessions",
+				map[string]interface{}{
+					"prefix": prefix,
+					"error":  err.Error(),
+				})
+		}
+		for _, info := range stored {
+			byKey[info.Key] = info
+		}
 	}
-	if len(stored.Messages) > 0 {
-		snapshot.Messages = make([]providers.Message, len(stored.Messages))
-		copy(snapshot.Messages, stored.Messages)
-	} else {
-		snapshot.Messages = []providers.Message{}
+
+	sm.mu.RLock()
+	for key, session := range sm.sessions {
+		if strings.HasPrefix(key, prefix) {
+			byKey[key] = session.info()
+		}
 	}
 	sm.mu.RUnlock()
 
-	data, err := json.MarshalIndent(snapshot, "", "  ")
-	if err != nil {
-		return err
+	infos := make([]Info, 0, len(byKey))
+	for _, info := range byKey {
+		infos = append(infos, info)
 	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	return infos
+}
 
-	sessionPath := filepath.Join(sm.storage, filename+".json")
-	tmpFile, err := os.CreateTemp(sm.storage, "session-*.tmp")
-	if err != nil {
-		return err
+// Search finds stored messages containing the words of query, newest
+// first.
+func (sm *SessionManager) Search(query string, limit int) ([]Match, error) {
+	if sm.store == nil {
+		return nil, nil
 	}
+	return sm.store.Search(query, limit)
+}
 
-	tmpPath := tmpFile.Name()
-	cleanup := true
-	defer func() {
-		if cleanup {
-			_ = os.Remove(tmpPath)
-		}
-	}()
+// Fork copies the history, summary and model of session src into a new
+// session dst. It fails if dst already exists. The name is not copied.
+func (sm *SessionManager) Fork(src, dst string) error {
+	sm.load(src)
+	sm.load(dst)
 
-	if _, err := tmpFile.Write(data); err != nil {
-		_ = tmpFile.Close()
-		return err
-	}
-	if err := tmpFile.Chmod(0644); err != nil {
-		_ = tmpFile.Close()
-		return err
-	}
-	if err := tmpFile.Sync(); err != nil {
-		_ = tmpFile.Close()
-		return err
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if _, exists := sm.sessions[dst]; exists {
+		return fmt.Errorf("session %s already exists", dst)
 	}
-	if err := tmpFile.Close(); err != nil {
-		return err
+	now := time.Now()
+	forked := &Session{
+		Key:      dst,
+		Messages: []providers.Message{},
+		Created:  now,
+		Updated:  now,
 	}
-
-	if err := os.Rename(tmpPath, sessionPath); err != nil {
-		return err
+	if source, ok := sm.sessions[src]; ok {
+		forked.Messages = make([]providers.Message, len(source.Messages))
+		copy(forked.Messages, source.Messages)
+		forked.Summary = source.Summary
+		forked.Summaries = append([]SummaryPart(nil), source.Summaries...)
+		forked.Model = source.Model
 	}
-	cleanup = false
+	sm.sessions[dst] = forked
 	return nil
 }
 
-func (sm *SessionManager) loadSessions() error {
-	files, err := os.ReadDir(sm.storage)
-	if err != nil {
-		return err
+func (sm *SessionManager) TruncateHistory(key string, keepLast int) {
+	sm.load(key)
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		return
 	}
 
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
+	if keepLast < 0 {
+		keepLast = 0
+	}
+	if len(session.Messages) <= keepLast {
+		return
+	}
+	sm.dropOldest(session, len(session.Messages)-keepLast)
+}
 
-		if filepath.Ext(file.Name()) != ".json" {
-			continue
-		}
+// dropOldest removes the first n messages of a session. The caller holds
+// sm.mu.
+func (sm *SessionManager) dropOldest(session *Session, n int) {
+	if n == len(session.Messages) {
+		session.Messages = []providers.Message{}
+	} else {
+		session.Messages = session.Messages[n:]
+	}
+	stored := min(n, session.stored)
+	session.dropped += stored
+	session.stored -= stored
+	session.Updated = time.Now()
+}
 
-		sessionPath := filepath.Join(sm.storage, file.Name())
-		data, err := os.ReadFile(sessionPath)
-		if err != nil {
-			continue
-		}
+// Save stores a session. Stores that support it write only the changes
+// since the last save.
+func (sm *SessionManager) Save(key string) error {
+	if sm.store == nil {
+		return nil
+	}
 
-		var session Session
-		if err := json.Unmarshal(data, &session); err != nil {
-			continue
-		}
+	sm.saveMu.Lock()
+	defer sm.saveMu.Unlock()
 
-		sm.sessions[session.Key] = &session
+	// Snapshot under the lock, then store without it. The change counters
+	// restart from the snapshot; a failed save forces a full rewrite.
+	sm.mu.Lock()
+	stored, ok := sm.sessions[key]
+	if !ok {
+		sm.mu.Unlock()
+		return nil
+	}
+	snapshot := &Session{
+		Key:       stored.Key,
+		Messages:  make([]providers.Message, len(stored.Messages)),
+		Summary:   stored.Summary,
+		Summaries: append([]SummaryPart(nil), stored.Summaries...),
+		Model:     stored.Model,
+		Name:      stored.Name,
+		Archived:  stored.Archived,
+		Created:   stored.Created,
+		Updated:   stored.Updated,
 	}
+	copy(snapshot.Messages, stored.Messages)
+	update := Update{
+		Dropped:   stored.dropped,
+		Appended:  len(stored.Messages) - stored.stored,
+		Rewritten: stored.rewritten,
+	}
+	stored.stored, stored.dropped, stored.rewritten = len(stored.Messages), 0, false
+	sm.mu.Unlock()
 
-	return nil
+	err := sm.store.Save(snapshot, update)
+	if err != nil {
+		sm.mu.Lock()
+		stored.stored, stored.dropped, stored.rewritten = 0, 0, true
+		sm.mu.Unlock()
+	}
+	return err
 }
 
 // SetHistory updates the messages of a session.
 func (sm *SessionManager) SetHistory(key string, history []providers.Message) {
+	sm.load(key)
+
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
@@ -277,6 +495,58 @@ func (sm *SessionManager) SetHistory(key string, history []providers.Message) {
 		msgs := make([]providers.Message, len(history))
 		copy(msgs, history)
 		session.Messages = msgs
+		session.stored, session.dropped, session.rewritten = 0, 0, true
 		session.Updated = time.Now()
 	}
 }
+
+// Retention limits how long a session is kept. Zero values keep
+// everything.
+type Retention struct {
+	MaxAge      time.Duration // delete sessions not updated for this long
+	MaxMessages int           // delete all but the newest messages
+}
+
+// Prune applies retention to every session and returns how many sessions
+// it deleted and how many it trimmed.
+func (sm *SessionManager) Prune(retention func(key string) Retention, now time.Time) (deleted, trimmed int, err error) {
+	for _, info := range sm.List("") {
+		r := retention(info.Key)
+		if r.MaxAge > 0 && now.Sub(info.Updated) > r.MaxAge {
+			if err := sm.Delete(info.Key); err != nil {
+				return deleted, trimmed, err
+			}
+			deleted++
+			continue
+		}
+		if r.MaxMessages <= 0 {
+			continue
+		}
+
+		// Sessions in memory are trimmed there too; the others only in
+		// the store, without loading them.
+		sm.mu.RLock()
+		_, inMemory := sm.sessions[info.Key]
+		sm.mu.RUnlock()
+
+		changed := false
+		if inMemory && info.Messages > r.MaxMessages {
+			sm.TruncateHistory(info.Key, r.MaxMessages)
+			if err := sm.Save(info.Key); err != nil {
+				return deleted, trimmed, err
+			}
+			changed = true
+		}
+		if sm.store != nil {
+			n, err := sm.store.Trim(info.Key, r.MaxMessages)
+			if err != nil {
+				return deleted, trimmed, err
+			}
+			changed = changed || n > 0
+		}
+		if changed {
+			trimmed++
+		}
+	}
+	return deleted, trimmed, nil
+}
@@ -3,7 +3,10 @@ package session
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
 )
 
 func TestSanitizeFilename(t *testing.T) {
@@ -72,3 +75,31 @@ func TestSave_RejectsPathTraversal(t *testing.T) {
 		}
 	}
 }
+
+func TestSave_StoresImageReferences(t *testing.T) {
+	tmpDir := t.TempDir()
+	sm := NewSessionManager(tmpDir)
+
+	key := "telegram:1"
+	sm.AddFullMessage(key, providers.Message{
+		Role:    "user",
+		Content: "look",
+		Parts: []providers.ContentPart{
+			{Type: "image", Path: "/media/a.png", MediaType: "image/png", Data: "aGVsbG8="},
+		},
+	})
+	if err := sm.Save(key); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, "telegram_1.json"))
+	if err != nil {
+		t.Fatalf("Session file not written: %v", err)
+	}
+	if strings.Contains(string(data), "aGVsbG8=") {
+		t.Error("Session file should not contain inline image data")
+	}
+	if !strings.Contains(string(data), "/media/a.png") {
+		t.Error("Session file should keep the image path")
+	}
+}
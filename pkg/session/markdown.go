@@ -0,0 +1,53 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// Markdown renders a session as a transcript. Tool calls show their
+// arguments and tool results follow in code blocks, cut to
+// maxExportedResult characters.
+func Markdown(title, summary string, history []providers.Message) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Session %s\n\nExported %s\n", title, time.Now().Format("2006-01-02 15:04"))
+	if summary != "" {
+		fmt.Fprintf(&sb, "\n## Summary of earlier messages\n\n%s\n", summary)
+	}
+	for _, m := range history {
+		switch m.Role {
+		case "user":
+			fmt.Fprintf(&sb, "\n**User:**\n\n%s\n", m.Content)
+			for _, path := range imagePaths(m) {
+				fmt.Fprintf(&sb, "\n_Image: %s_\n", path)
+			}
+		case "assistant":
+			if m.Content != "" {
+				fmt.Fprintf(&sb, "\n**Assistant:**\n\n%s\n", m.Content)
+			}
+			for _, tc := range m.ToolCalls {
+				name, args := toolCall(tc)
+				fmt.Fprintf(&sb, "\n_Called %s_\n", name)
+				if args != "" && args != "{}" {
+					fmt.Fprintf(&sb, "\n%s\n", codeBlock(args, "json"))
+				}
+			}
+		case "tool":
+			fmt.Fprintf(&sb, "\n_Result:_\n\n%s\n", codeBlock(utils.Truncate(m.Content, maxExportedResult), ""))
+		}
+	}
+	return sb.String()
+}
+
+// codeBlock fences text with more backticks than any run inside it.
+func codeBlock(text, lang string) string {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	return fence + lang + "\n" + strings.TrimRight(text, "\n") + "\n" + fence
+}
@@ -0,0 +1,13 @@
+//go:build !(linux && mips64) && !(freebsd && (arm || riscv64))
+
+package session
+
+import (
+	"database/sql"
+
+	_ "modernc.org/sqlite"
+)
+
+func openSQLite(dsn string) (*sql.DB, error) {
+	return sql.Open("sqlite", dsn)
+}
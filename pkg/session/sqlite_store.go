@@ -0,0 +1,296 @@
+package session
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// SQLiteStore keeps sessions in an SQLite database. Saves append the new
+// messages instead of rewriting the session, and messages that leave the
+// history, through summarization or /reset, stay in the database, where
+// Search finds them, until retention deletes them.
+//
+// The driver is pure Go, so the store works in builds without cgo. On
+// platforms it does not support, opening the store fails.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// Each session's history is its messages with seq >= first_seq.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	key       TEXT PRIMARY KEY,
+	name      TEXT NOT NULL DEFAULT '',
+	summary   TEXT NOT NULL DEFAULT '',
+	summaries TEXT NOT NULL DEFAULT '',
+	model     TEXT NOT NULL DEFAULT '',
+	archived  INTEGER NOT NULL DEFAULT 0,
+	first_seq INTEGER NOT NULL DEFAULT 0,
+	next_seq  INTEGER NOT NULL DEFAULT 0,
+	created   INTEGER NOT NULL,
+	updated   INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS messages (
+	id          INTEGER PRIMARY KEY,
+	session_key TEXT NOT NULL,
+	seq         INTEGER NOT NULL,
+	role        TEXT NOT NULL,
+	content     TEXT NOT NULL,
+	message     TEXT NOT NULL,
+	created     INTEGER NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS messages_session_seq ON messages(session_key, seq);
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(content);
+CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+	INSERT INTO messages_fts(rowid, content) VALUES (new.id, new.content);
+END;
+CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+	DELETE FROM messages_fts WHERE rowid = old.id;
+END;
+`
+
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := openSQLite(path + "?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// One connection serializes writers and keeps memory use low.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Load(key string) (*Session, error) {
+	session := &Session{Key: key, Messages: []providers.Message{}}
+	var archived int
+	var summaries string
+	var firstSeq, created, updated int64
+	err := s.db.QueryRow(`SELECT name, summary, summaries, model, archived, first_seq, created, updated FROM sessions WHERE key = ?`, key).
+		Scan(&session.Name, &session.Summary, &summaries, &session.Model, &archived, &firstSeq, &created, &updated)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if summaries != "" {
+		if err := json.Unmarshal([]byte(summaries), &session.Summaries); err != nil {
+			return nil, err
+		}
+	}
+	session.Archived = archived != 0
+	session.Created = time.Unix(0, created)
+	session.Updated = time.Unix(0, updated)
+
+	rows, err := s.db.Query(`SELECT message FROM messages WHERE session_key = ? AND seq >= ? ORDER BY seq`, key, firstSeq)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var msg providers.Message
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			return nil, err
+		}
+		session.Messages = append(session.Messages, msg)
+	}
+	return session, rows.Err()
+}
+
+func (s *SQLiteStore) Save(session *Session, update Update) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var firstSeq, nextSeq int64
+	err = tx.QueryRow(`SELECT first_seq, next_seq FROM sessions WHERE key = ?`, session.Key).Scan(&firstSeq, &nextSeq)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	added := session.Messages
+	if update.Rewritten {
+		if _, err := tx.Exec(`DELETE FROM messages WHERE session_key = ? AND seq >= ?`, session.Key, firstSeq); err != nil {
+			return err
+		}
+		nextSeq = firstSeq
+	} else {
+		firstSeq += int64(update.Dropped)
+		added = session.Messages[len(session.Messages)-update.Appended:]
+	}
+
+	now := time.Now().UnixNano()
+	insert, err := tx.Prepare(`INSERT INTO messages (session_key, seq, role, content, message, created) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+	for _, msg := range added {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		if _, err := insert.Exec(session.Key, nextSeq, msg.Role, msg.Content, string(data), now); err != nil {
+			return err
+		}
+		nextSeq++
+	}
+
+	summaries := ""
+	if len(session.Summaries) > 0 {
+		data, err := json.Marshal(session.Summaries)
+		if err != nil {
+			return err
+		}
+		summaries = string(data)
+	}
+	_, err = tx.Exec(`INSERT INTO sessions (key, name, summary, summaries, model, archived, first_seq, next_seq, created, updated)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET name = excluded.name, summary = excluded.summary, summaries = excluded.summaries,
+			model = excluded.model, archived = excluded.archived, first_seq = excluded.first_seq, next_seq = excluded.next_seq,
+			updated = excluded.updated`,
+		session.Key, session.Name, session.Summary, summaries, session.Model, session.Archived, firstSeq, nextSeq,
+		session.Created.UnixNano(), session.Updated.UnixNano())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) Delete(key string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM messages WHERE session_key = ?`, key); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE key = ?`, key); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) List(prefix string) ([]Info, error) {
+	rows, err := s.db.Query(`SELECT key, name, model, archived, next_seq - first_seq, created, updated
+		FROM sessions WHERE substr(key, 1, length(?)) = ? ORDER BY key`, prefix, prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var infos []Info
+	for rows.Next() {
+		var info Info
+		var archived int
+		var created, updated int64
+		if err := rows.Scan(&info.Key, &info.Name, &info.Model, &archived, &info.Messages, &created, &updated); err != nil {
+			return nil, err
+		}
+		info.Archived = archived != 0
+		info.Created = time.Unix(0, created)
+		info.Updated = time.Unix(0, updated)
+		infos = append(infos, info)
+	}
+	return infos, rows.Err()
+}
+
+// Search uses the full-text index, so it matches whole words; "deploy*"
+// matches words starting with "deploy".
+func (s *SQLiteStore) Search(query string, limit int) ([]Match, error) {
+	query = ftsQuery(query)
+	if query == "" {
+		return nil, nil
+	}
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := s.db.Query(`SELECT m.session_key, m.role, snippet(messages_fts, 0, '', '', '...', 12), m.created
+		FROM messages_fts JOIN messages m ON m.id = messages_fts.rowid
+		WHERE messages_fts MATCH ? ORDER BY m.id DESC LIMIT ?`, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []Match
+	for rows.Next() {
+		var m Match
+		var created int64
+		if err := rows.Scan(&m.Key, &m.Role, &m.Snippet, &created); err != nil {
+			return nil, err
+		}
+		m.Time = time.Unix(0, created)
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// ftsQuery turns the words of query into an FTS5 query matching all of
+// them. Each word is quoted, so punctuation is not read as query syntax;
+// a trailing "*" still matches words starting with it.
+func ftsQuery(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		prefix := strings.HasSuffix(word, "*")
+		word = strings.TrimRight(word, "*")
+		if word == "" {
+			continue
+		}
+		term := `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(terms, " ")
+}
+
+func (s *SQLiteStore) Trim(key string, keep int) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var firstSeq, nextSeq int64
+	err = tx.QueryRow(`SELECT first_seq, next_seq FROM sessions WHERE key = ?`, key).Scan(&firstSeq, &nextSeq)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := nextSeq - int64(keep)
+	result, err := tx.Exec(`DELETE FROM messages WHERE session_key = ? AND seq < ?`, key, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	if cutoff > firstSeq {
+		if _, err := tx.Exec(`UPDATE sessions SET first_seq = ? WHERE key = ?`, cutoff, key); err != nil {
+			return 0, err
+		}
+	}
+	deleted, _ := result.RowsAffected()
+	return int(deleted), tx.Commit()
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,14 @@
+//go:build (linux && mips64) || (freebsd && (arm || riscv64))
+
+package session
+
+import (
+	"database/sql"
+	"fmt"
+	"runtime"
+)
+
+// The SQLite driver does not support this platform.
+func openSQLite(string) (*sql.DB, error) {
+	return nil, fmt.Errorf("the sqlite session backend is not available on %s/%s", runtime.GOOS, runtime.GOARCH)
+}
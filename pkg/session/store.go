@@ -0,0 +1,112 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Store keeps sessions on disk. SessionManager loads a session from its
+// store when it is first used and saves it after each turn, so only the
+// chats in use are held in memory.
+type Store interface {
+	// Load returns a stored session, or nil if there is none.
+	Load(key string) (*Session, error)
+	// Save stores a session. update says what changed since it was loaded
+	// or last saved, so stores can write only the new messages.
+	Save(session *Session, update Update) error
+	// Delete removes a session and all its messages.
+	Delete(key string) error
+	// List describes the stored sessions whose key starts with prefix.
+	List(prefix string) ([]Info, error)
+	// Search finds stored messages containing all words of query, newest
+	// first.
+	Search(query string, limit int) ([]Match, error)
+	// Trim deletes all but the newest keep messages of a session, including
+	// messages no longer in its history, and returns how many it deleted.
+	Trim(key string, keep int) (int, error)
+	Close() error
+}
+
+// Update describes the changes to a session's history since it was last
+// stored.
+type Update struct {
+	Dropped   int  // stored messages removed from the start of the history
+	Appended  int  // messages added at the end of the history
+	Rewritten bool // the history was replaced; Dropped and Appended do not apply
+}
+
+// Match is a message found by Store.Search.
+type Match struct {
+	Key     string // session key
+	Role    string
+	Snippet string // the text around the match
+	Time    time.Time
+}
+
+// Store backends.
+const (
+	BackendJSON   = "json"
+	BackendSQLite = "sqlite"
+)
+
+// sqliteFile is the database of the SQLite store in the sessions directory.
+const sqliteFile = "sessions.db"
+
+// OpenStore opens the sessions in dir with the given backend. A new SQLite
+// store starts with a copy of the JSON sessions in dir; the JSON files are
+// left in place.
+func OpenStore(backend, dir string) (Store, error) {
+	switch backend {
+	case "", BackendJSON:
+		return NewJSONStore(dir), nil
+	case BackendSQLite:
+		path := filepath.Join(dir, sqliteFile)
+		_, statErr := os.Stat(path)
+		store, err := NewSQLiteStore(path)
+		if err != nil {
+			return nil, err
+		}
+		if os.IsNotExist(statErr) {
+			if err := importSessions(NewJSONStore(dir), store); err != nil {
+				store.Close()
+				os.Remove(path)
+				return nil, fmt.Errorf("importing JSON sessions: %w", err)
+			}
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown session backend %q (use json or sqlite)", backend)
+	}
+}
+
+// importSessions copies every session of src into dst.
+func importSessions(src, dst Store) error {
+	infos, err := src.List("")
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		session, err := src.Load(info.Key)
+		if err != nil || session == nil {
+			logger.WarnCF("session", "Skipping unreadable session",
+				map[string]interface{}{
+					"session_key": info.Key,
+				})
+			continue
+		}
+		if err := dst.Save(session, Update{Rewritten: true}); err != nil {
+			return err
+		}
+	}
+	if len(infos) > 0 {
+		logger.InfoCF("session", "Imported JSON sessions",
+			map[string]interface{}{
+				"count": len(infos),
+			})
+	}
+	return nil
+}
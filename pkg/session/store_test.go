@@ -0,0 +1,230 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testStores opens each backend in its own directory.
+func testStores(t *testing.T) map[string]func() Store {
+	t.Helper()
+	jsonDir, sqliteDir := t.TempDir(), t.TempDir()
+	open := func(backend, dir string) func() Store {
+		return func() Store {
+			store, err := OpenStore(backend, dir)
+			if err != nil {
+				t.Fatalf("OpenStore(%s) failed: %v", backend, err)
+			}
+			t.Cleanup(func() { store.Close() })
+			return store
+		}
+	}
+	return map[string]func() Store{
+		BackendJSON:   open(BackendJSON, jsonDir),
+		BackendSQLite: open(BackendSQLite, sqliteDir),
+	}
+}
+
+func TestStore_SavesChangesAcrossRestarts(t *testing.T) {
+	for backend, open := range testStores(t) {
+		t.Run(backend, func(t *testing.T) {
+			sm := NewSessionManagerWithStore(open())
+			key := "telegram:1"
+			for i := 1; i <= 6; i++ {
+				sm.AddMessage(key, "user", fmt.Sprintf("message %d", i))
+				if i%2 == 0 {
+					if err := sm.Save(key); err != nil {
+						t.Fatalf("Save failed: %v", err)
+					}
+				}
+			}
+			sm.SetSummary(key, "counting")
+			sm.TruncateHistory(key, 2)
+			sm.AddMessage(key, "assistant", "message 7")
+			sm.SetName(key, "numbers")
+			if err := sm.Save(key); err != nil {
+				t.Fatalf("Save failed: %v", err)
+			}
+
+			reopened := NewSessionManagerWithStore(open())
+			history := reopened.GetHistory(key)
+			var contents []string
+			for _, m := range history {
+				contents = append(contents, m.Content)
+			}
+			if got := strings.Join(contents, ","); got != "message 5,message 6,message 7" {
+				t.Errorf("history after reopening = %s", got)
+			}
+			if reopened.GetSummary(key) != "counting" {
+				t.Errorf("summary = %q, want counting", reopened.GetSummary(key))
+			}
+			infos := reopened.List("telegram:")
+			if len(infos) != 1 || infos[0].Name != "numbers" || infos[0].Messages != 3 {
+				t.Errorf("List = %+v, want one session named numbers with 3 messages", infos)
+			}
+
+			// A replaced history is stored as a whole
+			reopened.SetHistory(key, history[2:])
+			if err := reopened.Save(key); err != nil {
+				t.Fatalf("Save failed: %v", err)
+			}
+			if got := NewSessionManagerWithStore(open()).GetHistory(key); len(got) != 1 || got[0].Content != "message 7" {
+				t.Errorf("history after SetHistory = %+v", got)
+			}
+		})
+	}
+}
+
+func TestStore_Search(t *testing.T) {
+	for backend, open := range testStores(t) {
+		t.Run(backend, func(t *testing.T) {
+			sm := NewSessionManagerWithStore(open())
+			sm.AddMessage("slack:C1", "user", "Book the train to Lyon for Friday")
+			sm.AddMessage("slack:C1", "assistant", "Which train do you prefer?")
+			sm.AddMessage("cli:1", "user", "Restart the homelab router")
+			sm.Save("slack:C1")
+			sm.Save("cli:1")
+
+			matches, err := sm.Search("train lyon", 10)
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			if len(matches) != 1 || matches[0].Key != "slack:C1" || matches[0].Role != "user" ||
+				!strings.Contains(matches[0].Snippet, "Lyon") {
+				t.Errorf("Search(train lyon) = %+v", matches)
+			}
+			if matches, _ := sm.Search("train", 1); len(matches) != 1 {
+				t.Errorf("Search with limit 1 returned %d matches", len(matches))
+			}
+		})
+	}
+}
+
+func TestStore_Prune(t *testing.T) {
+	for backend, open := range testStores(t) {
+		t.Run(backend, func(t *testing.T) {
+			sm := NewSessionManagerWithStore(open())
+			for i := 0; i < 5; i++ {
+				sm.AddMessage("telegram:old", "user", "old")
+				sm.AddMessage("telegram:long", "user", fmt.Sprintf("long %d", i))
+			}
+			sm.Save("telegram:old")
+			sm.Save("telegram:long")
+
+			// Retention applies to sessions that are not in memory too
+			sm = NewSessionManagerWithStore(open())
+			retention := func(key string) Retention {
+				if key == "telegram:old" {
+					return Retention{MaxAge: time.Hour}
+				}
+				return Retention{MaxMessages: 2}
+			}
+			deleted, trimmed, err := sm.Prune(retention, time.Now().Add(2*time.Hour))
+			if err != nil || deleted != 1 || trimmed != 1 {
+				t.Fatalf("Prune = %d, %d, %v, want 1 deleted and 1 trimmed", deleted, trimmed, err)
+			}
+
+			reopened := NewSessionManagerWithStore(open())
+			if infos := reopened.List("telegram:"); len(infos) != 1 || infos[0].Key != "telegram:long" {
+				t.Errorf("sessions after Prune = %+v, want only telegram:long", infos)
+			}
+			if history := reopened.GetHistory("telegram:long"); len(history) != 2 || history[0].Content != "long 3" {
+				t.Errorf("trimmed history = %+v, want the last 2 messages", history)
+			}
+		})
+	}
+}
+
+func TestStore_KeepsSummaryParts(t *testing.T) {
+	for backend, open := range testStores(t) {
+		t.Run(backend, func(t *testing.T) {
+			sm := NewSessionManagerWithStore(open())
+			key := "telegram:3"
+			for i := 0; i < 4; i++ {
+				sm.AddMessage(key, "user", fmt.Sprintf("message %d", i))
+			}
+			sm.Save(key)
+
+			history := sm.GetHistory(key)
+			parts := []SummaryPart{{Tier: 1, Text: "long ago", Messages: 10}, {Tier: 0, Text: "recently", Messages: 3}}
+			if !sm.Compact(key, history[:3], parts) {
+				t.Fatal("Compact refused an unchanged history")
+			}
+			if sm.Compact(key, history[:3], parts) {
+				t.Error("Compact accepted messages that are no longer in the history")
+			}
+			if err := sm.Save(key); err != nil {
+				t.Fatalf("Save failed: %v", err)
+			}
+
+			reopened := NewSessionManagerWithStore(open())
+			if got := reopened.GetSummaries(key); len(got) != 2 || got[0] != parts[0] || got[1] != parts[1] {
+				t.Errorf("summary parts after reopening = %+v", got)
+			}
+			if got := reopened.GetSummary(key); got != "long ago\n\nrecently" {
+				t.Errorf("summary = %q", got)
+			}
+			if got := reopened.GetHistory(key); len(got) != 1 || got[0].Content != "message 3" {
+				t.Errorf("history after Compact = %+v", got)
+			}
+		})
+	}
+}
+
+func TestSQLiteStore_KeepsDroppedMessagesSearchable(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenStore(BackendSQLite, dir)
+	if err != nil {
+		t.Fatalf("OpenStore failed: %v", err)
+	}
+	defer store.Close()
+
+	sm := NewSessionManagerWithStore(store)
+	sm.AddMessage("cli:1", "user", "the wifi password is on the fridge")
+	sm.Save("cli:1")
+	sm.TruncateHistory("cli:1", 0)
+	sm.Save("cli:1")
+
+	if history := sm.GetHistory("cli:1"); len(history) != 0 {
+		t.Errorf("history after truncating = %+v, want empty", history)
+	}
+	if matches, _ := sm.Search("fridge", 10); len(matches) != 1 {
+		t.Errorf("Search(fridge) = %+v, want the dropped message", matches)
+	}
+	if _, err := store.Trim("cli:1", 0); err != nil {
+		t.Fatalf("Trim failed: %v", err)
+	}
+	if matches, _ := sm.Search("fridge", 10); len(matches) != 0 {
+		t.Errorf("Search(fridge) after Trim = %+v, want nothing", matches)
+	}
+}
+
+func TestOpenStore_ImportsJSONSessions(t *testing.T) {
+	dir := t.TempDir()
+	sm := NewSessionManager(dir)
+	sm.AddMessage("discord:9", "user", "hello")
+	sm.SetModel("discord:9", "small-model")
+	if err := sm.Save("discord:9"); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	store, err := OpenStore(BackendSQLite, dir)
+	if err != nil {
+		t.Fatalf("OpenStore failed: %v", err)
+	}
+	defer store.Close()
+	imported := NewSessionManagerWithStore(store)
+	if history := imported.GetHistory("discord:9"); len(history) != 1 || history[0].Content != "hello" {
+		t.Errorf("imported history = %+v", history)
+	}
+	if model := imported.GetModel("discord:9"); model != "small-model" {
+		t.Errorf("imported model = %q", model)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "discord_9.json")); err != nil {
+		t.Errorf("JSON session file should be left in place: %v", err)
+	}
+}
@@ -19,6 +19,11 @@ type State struct {
 	// LastChatID is the last chat ID used for communication
 	LastChatID string `json:"last_chat_id,omitempty"`
 
+	// ActiveSessions maps the session key a channel gives a chat to the
+	// session the chat has switched to. Chats using their own session are
+	// not listed.
+	ActiveSessions map[string]string `json:"active_sessions,omitempty"`
+
 	// Timestamp is the last time this state was updated
 	Timestamp time.Time `json:"timestamp"`
 }
@@ -100,6 +105,43 @@ func (sm *Manager) SetLastChatID(chatID string) error {
 	return nil
 }
 
+// SetActiveSession atomically records the session a chat's messages go
+// to. Setting the chat's own session key removes the entry.
+func (sm *Manager) SetActiveSession(chatKey, sessionKey string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sessionKey == chatKey {
+		if _, ok := sm.state.ActiveSessions[chatKey]; !ok {
+			return nil
+		}
+		delete(sm.state.ActiveSessions, chatKey)
+	} else {
+		if sm.state.ActiveSessions == nil {
+			sm.state.ActiveSessions = make(map[string]string)
+		}
+		sm.state.ActiveSessions[chatKey] = sessionKey
+	}
+	sm.state.Timestamp = time.Now()
+
+	if err := sm.saveAtomic(); err != nil {
+		return fmt.Errorf("failed to save state atomically: %w", err)
+	}
+
+	return nil
+}
+
+// GetActiveSession returns the session a chat has switched to, or the
+// chat's own session key.
+func (sm *Manager) GetActiveSession(chatKey string) string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	if key, ok := sm.state.ActiveSessions[chatKey]; ok {
+		return key
+	}
+	return chatKey
+}
+
 // GetLastChannel returns the last channel from the state.
 func (sm *Manager) GetLastChannel() string {
 	sm.mu.RLock()
@@ -214,3 +214,28 @@ func TestNewManager_EmptyWorkspace(t *testing.T) {
 		t.Error("Expected zero timestamp for new state")
 	}
 }
+
+func TestSetActiveSession(t *testing.T) {
+	tmpDir := t.TempDir()
+	sm := NewManager(tmpDir)
+
+	if got := sm.GetActiveSession("telegram:1"); got != "telegram:1" {
+		t.Errorf("GetActiveSession() = %q, want the chat's own session", got)
+	}
+	if err := sm.SetActiveSession("telegram:1", "telegram:1#2"); err != nil {
+		t.Fatalf("SetActiveSession failed: %v", err)
+	}
+
+	// The pointer survives a restart
+	sm2 := NewManager(tmpDir)
+	if got := sm2.GetActiveSession("telegram:1"); got != "telegram:1#2" {
+		t.Errorf("GetActiveSession() after reload = %q, want telegram:1#2", got)
+	}
+
+	if err := sm2.SetActiveSession("telegram:1", "telegram:1"); err != nil {
+		t.Fatalf("SetActiveSession failed: %v", err)
+	}
+	if got := NewManager(tmpDir).GetActiveSession("telegram:1"); got != "telegram:1" {
+		t.Errorf("GetActiveSession() after switching back = %q, want telegram:1", got)
+	}
+}
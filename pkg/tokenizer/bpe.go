@@ -0,0 +1,179 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BPE is a byte-pair encoding tokenizer using a tiktoken vocabulary.
+type BPE struct {
+	ranks map[string]int
+	split []*regexp.Regexp // pre-tokenizer alternatives, tried in order; nil is the whitespace lookahead rule
+}
+
+// Pre-tokenizer patterns of the tiktoken encodings. Go's regexp has no
+// lookahead, so the `\s+(?!\S)` alternative is a nil entry that splitPiece
+// implements by hand, and its `\s` only covers ASCII, so space is spelled
+// out as Unicode whitespace.
+const (
+	space        = `\t\n\v\f\r \x{85}\p{Z}`
+	contractions = `(?i:'s|'t|'re|'ve|'m|'ll|'d)`
+)
+
+var (
+	cl100kSplit = []*regexp.Regexp{
+		regexp.MustCompile(`^` + contractions),
+		regexp.MustCompile(`^[^\r\n\p{L}\p{N}]?\p{L}+`),
+		regexp.MustCompile(`^\p{N}{1,3}`),
+		regexp.MustCompile(`^ ?[^` + space + `\p{L}\p{N}]+[\r\n]*`),
+		regexp.MustCompile(`^[` + space + `]*[\r\n]+`),
+		nil,
+		regexp.MustCompile(`^[` + space + `]+`),
+	}
+
+	o200kSplit = []*regexp.Regexp{
+		regexp.MustCompile(`^[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+` + contractions + `?`),
+		regexp.MustCompile(`^[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*` + contractions + `?`),
+		regexp.MustCompile(`^\p{N}{1,3}`),
+		regexp.MustCompile(`^ ?[^` + space + `\p{L}\p{N}]+[\r\n/]*`),
+		regexp.MustCompile(`^[` + space + `]*[\r\n]+`),
+		nil,
+		regexp.MustCompile(`^[` + space + `]+`),
+	}
+)
+
+// LoadBPE reads a vocabulary in tiktoken format: one base64-encoded token
+// and its rank per line. encoding selects the pre-tokenizer and is
+// "cl100k_base" or "o200k_base".
+func LoadBPE(file, encoding string) (*BPE, error) {
+	var split []*regexp.Regexp
+	switch encoding {
+	case "cl100k_base":
+		split = cl100kSplit
+	case "o200k_base":
+		split = o200kSplit
+	default:
+		return nil, fmt.Errorf("unknown BPE encoding %q", encoding)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := bytes.Fields(scanner.Bytes())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected token and rank", file, line)
+		}
+		token, err := base64.StdEncoding.DecodeString(string(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", file, line, err)
+		}
+		rank, err := strconv.Atoi(string(fields[1]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", file, line, err)
+		}
+		ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("%s: empty vocabulary", file)
+	}
+	return &BPE{ranks: ranks, split: split}, nil
+}
+
+// Count returns the number of tokens text encodes to.
+func (b *BPE) Count(text string) int {
+	n := 0
+	for text != "" {
+		piece := b.splitPiece(text)
+		n += b.countPiece(piece)
+		text = text[len(piece):]
+	}
+	return n
+}
+
+// splitPiece returns the pre-tokenizer piece at the start of text.
+func (b *BPE) splitPiece(text string) string {
+	for _, re := range b.split {
+		if re == nil {
+			if piece := trailingSpaceRun(text); piece != "" {
+				return piece
+			}
+			continue
+		}
+		if loc := re.FindStringIndex(text); loc != nil && loc[1] > 0 {
+			return text[:loc[1]]
+		}
+	}
+	// Unreachable for valid patterns, which end with `\s+` after matching
+	// every non-space start; consume one rune to make progress regardless.
+	_, size := utf8.DecodeRuneInString(text)
+	return text[:size]
+}
+
+// trailingSpaceRun implements `\s+(?!\S)`: the whitespace at the start of
+// text, minus its last character when non-space text follows.
+func trailingSpaceRun(text string) string {
+	end, last := 0, 0
+	for end < len(text) {
+		r, size := utf8.DecodeRuneInString(text[end:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		last = end
+		end += size
+	}
+	switch {
+	case end == 0:
+		return ""
+	case end == len(text):
+		return text
+	default:
+		return text[:last]
+	}
+}
+
+// countPiece merges the bytes of piece by rank until no pair is in the
+// vocabulary and returns the number of parts left.
+func (b *BPE) countPiece(piece string) int {
+	if _, ok := b.ranks[piece]; ok {
+		return 1
+	}
+
+	// bounds[i] is the start of part i; the last entry is len(piece).
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		best, bestRank := -1, 0
+		for i := 0; i+2 < len(bounds); i++ {
+			rank, ok := b.ranks[piece[bounds[i]:bounds[i+2]]]
+			if ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+	}
+	return len(bounds) - 1
+}
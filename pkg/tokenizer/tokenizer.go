@@ -0,0 +1,188 @@
+// Package tokenizer counts the tokens of LLM requests. Each model family
+// has its own Counter: OpenAI models use their BPE vocabulary when it is
+// installed, other families use approximations.
+package tokenizer
+
+import (
+	"encoding/json"
+	"path"
+	"path/filepath"
+	"sync"
+	"unicode"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+const (
+	// messageOverhead covers the role and delimiters every message adds.
+	messageOverhead = 4
+	// replyOverhead covers the tokens that prime the assistant's reply.
+	replyOverhead = 3
+	// imageTokens is a rough cost of one image, which providers bill by size.
+	imageTokens = 1000
+)
+
+// Counter counts the tokens of a piece of text for one model family.
+type Counter interface {
+	Count(text string) int
+}
+
+// Approximation estimates tokens from character counts. Scripts without
+// spaces between words, such as CJK, cost about one token per character on
+// every tokenizer, so they are counted apart from the rest.
+type Approximation struct {
+	CharsPerToken float64 // for Latin script, code and punctuation
+	TokensPerWide float64 // for each CJK character
+}
+
+func (a Approximation) Count(text string) int {
+	narrow, wide := 0, 0
+	for _, r := range text {
+		if isWide(r) {
+			wide++
+		} else {
+			narrow++
+		}
+	}
+	n := float64(narrow)/a.CharsPerToken + float64(wide)*a.TokensPerWide
+	if n > 0 && n < 1 {
+		return 1
+	}
+	return int(n + 0.5)
+}
+
+func isWide(r rune) bool {
+	return r >= 0x1100 && (unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		r >= 0xFF00 && r <= 0xFFEF)
+}
+
+// Typical ratios of each family's tokenizer on English prose, code and
+// Chinese chat.
+var (
+	openAIApprox  = Approximation{CharsPerToken: 4.0, TokensPerWide: 1.0}
+	claudeApprox  = Approximation{CharsPerToken: 3.5, TokensPerWide: 1.2}
+	genericApprox = Approximation{CharsPerToken: 3.0, TokensPerWide: 1.0}
+)
+
+type family struct {
+	pattern string
+	counter func() Counter
+}
+
+// Registry picks the Counter for a model by matching its name against glob
+// patterns. Registered families are tried before the built-in ones.
+type Registry struct {
+	vocabDir string
+
+	mu      sync.Mutex
+	custom  []family
+	builtin []family
+	vocabs  map[string]Counter
+}
+
+// NewRegistry returns a registry with the built-in model families. BPE
+// vocabularies in tiktoken format are loaded from vocabDir, e.g.
+// vocabDir/o200k_base.tiktoken; without them OpenAI models are approximated.
+func NewRegistry(vocabDir string) *Registry {
+	r := &Registry{vocabDir: vocabDir, vocabs: make(map[string]Counter)}
+	for _, pattern := range []string{"gpt-4o*", "gpt-4.1*", "gpt-5*", "o1*", "o3*", "o4*", "chatgpt-*"} {
+		r.builtin = append(r.builtin, family{pattern, r.bpe("o200k_base", openAIApprox)})
+	}
+	for _, pattern := range []string{"gpt-4*", "gpt-3.5*", "text-embedding-*"} {
+		r.builtin = append(r.builtin, family{pattern, r.bpe("cl100k_base", openAIApprox)})
+	}
+	r.builtin = append(r.builtin, family{"claude*", func() Counter { return claudeApprox }})
+	return r
+}
+
+// Register adds a model family, matched by a glob pattern on the model name.
+// Families are tried in the order they were registered.
+func (r *Registry) Register(pattern string, counter func() Counter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.custom = append(r.custom, family{pattern: pattern, counter: counter})
+}
+
+// For returns the Counter for model. A provider prefix such as
+// "openrouter/openai/gpt-4o" is ignored.
+func (r *Registry) For(model string) Counter {
+	name := path.Base(model)
+
+	r.mu.Lock()
+	families := append(append([]family(nil), r.custom...), r.builtin...)
+	r.mu.Unlock()
+
+	for _, f := range families {
+		if matched, _ := path.Match(f.pattern, name); matched {
+			return f.counter()
+		}
+	}
+	return genericApprox
+}
+
+// bpe returns a factory for the named BPE vocabulary, loaded on first use.
+// A missing vocabulary falls back to approx.
+func (r *Registry) bpe(name string, approx Counter) func() Counter {
+	return func() Counter {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if c, ok := r.vocabs[name]; ok {
+			return c
+		}
+
+		var c Counter = approx
+		if r.vocabDir != "" {
+			file := filepath.Join(r.vocabDir, name+".tiktoken")
+			encoding, err := LoadBPE(file, name)
+			if err == nil {
+				c = encoding
+			} else {
+				logger.DebugCF("tokenizer", "BPE vocabulary not available, approximating",
+					map[string]interface{}{
+						"vocabulary": file,
+						"error":      err.Error(),
+					})
+			}
+		}
+		r.vocabs[name] = c
+		return c
+	}
+}
+
+// CountMessages returns the tokens a request with messages and tools takes
+// up in the context window: message text, images, tool calls and results,
+// tool schemas and the per-message framing.
+func CountMessages(c Counter, messages []providers.Message, tools []providers.ToolDefinition) int {
+	total := replyOverhead
+	for _, m := range messages {
+		total += CountMessage(c, m)
+	}
+	if len(tools) > 0 {
+		data, _ := json.Marshal(tools)
+		total += c.Count(string(data))
+	}
+	return total
+}
+
+// CountMessage returns the tokens of one message.
+func CountMessage(c Counter, m providers.Message) int {
+	total := messageOverhead + c.Count(m.Content)
+	for _, part := range m.Parts {
+		if part.Type == "image" {
+			total += imageTokens
+		}
+	}
+	for _, tc := range m.ToolCalls {
+		if tc.Function != nil {
+			total += c.Count(tc.Function.Name) + c.Count(tc.Function.Arguments)
+			continue
+		}
+		args, _ := json.Marshal(tc.Arguments)
+		total += c.Count(tc.Name) + c.Count(string(args))
+	}
+	if m.ToolCallID != "" {
+		total += c.Count(m.ToolCallID)
+	}
+	return total
+}
@@ -0,0 +1,147 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// writeVocab writes a tiktoken vocabulary with every byte of the given
+// text as a token, followed by merges in rank order.
+func writeVocab(t *testing.T, dir, name, bytesOf string, merges ...string) {
+	t.Helper()
+	var sb strings.Builder
+	rank := 0
+	seen := make(map[byte]bool)
+	for i := 0; i < len(bytesOf); i++ {
+		if !seen[bytesOf[i]] {
+			seen[bytesOf[i]] = true
+			fmt.Fprintf(&sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{bytesOf[i]}), rank)
+			rank++
+		}
+	}
+	for _, m := range merges {
+		fmt.Fprintf(&sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(m)), rank)
+		rank++
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".tiktoken"), []byte(sb.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBPE_Count(t *testing.T) {
+	dir := t.TempDir()
+	writeVocab(t, dir, "cl100k_base", "hello world", "he", "ll", "hell", "hello", " w", "or")
+
+	bpe, err := LoadBPE(filepath.Join(dir, "cl100k_base.tiktoken"), "cl100k_base")
+	if err != nil {
+		t.Fatalf("LoadBPE() error: %v", err)
+	}
+
+	// "hello" is one token; " world" merges to " w", "or", "l", "d"
+	if got := bpe.Count("hello world"); got != 5 {
+		t.Errorf("Count(hello world) = %d, want 5", got)
+	}
+	if got := bpe.Count(""); got != 0 {
+		t.Errorf("Count(\"\") = %d, want 0", got)
+	}
+}
+
+func TestBPE_Split(t *testing.T) {
+	bpe := &BPE{split: cl100kSplit}
+
+	var pieces []string
+	for text := "I'm  here\n\n123456 ok"; text != ""; {
+		piece := bpe.splitPiece(text)
+		pieces = append(pieces, piece)
+		text = text[len(piece):]
+	}
+	want := []string{"I", "'m", " ", " here", "\n\n", "123", "456", " ok"}
+	if !reflect.DeepEqual(pieces, want) {
+		t.Errorf("pieces = %q, want %q", pieces, want)
+	}
+}
+
+func TestRegistry_For(t *testing.T) {
+	dir := t.TempDir()
+	writeVocab(t, dir, "o200k_base", "abc")
+	r := NewRegistry(dir)
+
+	if _, ok := r.For("openrouter/openai/gpt-4o-mini").(*BPE); !ok {
+		t.Error("gpt-4o should use the o200k BPE vocabulary")
+	}
+	if got := r.For("gpt-4-turbo"); got != Counter(openAIApprox) {
+		t.Errorf("gpt-4-turbo without cl100k vocabulary = %#v, want the OpenAI approximation", got)
+	}
+	if got := r.For("claude-sonnet-4-5"); got != Counter(claudeApprox) {
+		t.Errorf("claude = %#v, want the Claude approximation", got)
+	}
+	if got := r.For("glm-4.7"); got != Counter(genericApprox) {
+		t.Errorf("glm-4.7 = %#v, want the generic approximation", got)
+	}
+
+	custom := Approximation{CharsPerToken: 2, TokensPerWide: 2}
+	r.Register("glm-*", func() Counter { return custom })
+	if got := r.For("glm-4.7"); got != Counter(custom) {
+		t.Errorf("glm-4.7 after Register = %#v, want the registered counter", got)
+	}
+}
+
+func TestApproximation_Count(t *testing.T) {
+	a := Approximation{CharsPerToken: 4, TokensPerWide: 1}
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"abcdefgh", 2},
+		{"你好世界", 4},
+		{"abcd你好", 3},
+	}
+	for _, tt := range tests {
+		if got := a.Count(tt.text); got != tt.want {
+			t.Errorf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCountMessages_IncludesToolCalls(t *testing.T) {
+	c := Approximation{CharsPerToken: 1, TokensPerWide: 1}
+	plain := []providers.Message{{Role: "user", Content: "hi"}}
+	withCall := []providers.Message{
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "1", Function: &providers.FunctionCall{Name: "exec", Arguments: `{"command":"ls"}`}}}},
+		{Role: "tool", Content: "a.txt", ToolCallID: "1"},
+	}
+	tools := []providers.ToolDefinition{{Type: "function", Function: providers.ToolFunctionDefinition{Name: "exec"}}}
+
+	base := CountMessages(c, plain, nil)
+	if got := CountMessages(c, withCall, nil); got <= base+len(`{"command":"ls"}`) {
+		t.Errorf("CountMessages() = %d, want tool call arguments and results counted (base %d)", got, base)
+	}
+	if got := CountMessages(c, plain, tools); got <= base {
+		t.Errorf("CountMessages() with tools = %d, want more than %d", got, base)
+	}
+}
+
+func TestContextWindow(t *testing.T) {
+	tests := map[string]int{
+		"gpt-4o":                        128000,
+		"openrouter/anthropic/claude-3": 200000,
+		"glm-4.7":                       200000,
+		"o3-mini":                       200000,
+		"my-local-model":                DefaultContextWindow,
+	}
+	for model, want := range tests {
+		if got := ContextWindow(model); got != want {
+			t.Errorf("ContextWindow(%s) = %d, want %d", model, got, want)
+		}
+	}
+}
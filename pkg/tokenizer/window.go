@@ -0,0 +1,51 @@
+package tokenizer
+
+import "path"
+
+// DefaultContextWindow is assumed for models not listed in contextWindows.
+const DefaultContextWindow = 32768
+
+// contextWindows lists the context window of well-known models, in tokens.
+// More specific patterns come first.
+var contextWindows = []struct {
+	pattern string
+	tokens  int
+}{
+	{"gpt-4.1*", 1047576},
+	{"gpt-5*", 400000},
+	{"gpt-4o*", 128000},
+	{"chatgpt-*", 128000},
+	{"gpt-4-turbo*", 128000},
+	{"gpt-4", 8192},
+	{"gpt-3.5*", 16385},
+	{"o1-mini*", 128000},
+	{"o[134]*", 200000},
+	{"claude*", 200000},
+	{"gemini*", 1048576},
+	{"glm-4.[67]*", 200000},
+	{"glm-*", 128000},
+	{"kimi-k2*", 262144},
+	{"kimi*", 131072},
+	{"moonshot-v1-8k*", 8192},
+	{"moonshot-v1-32k*", 32768},
+	{"moonshot-v1-128k*", 131072},
+	{"deepseek*", 128000},
+	{"qwen*", 131072},
+	{"llama-3*", 131072},
+	{"llama3*", 131072},
+	{"mistral-large*", 131072},
+	{"grok*", 131072},
+}
+
+// ContextWindow returns the context window of model, or
+// DefaultContextWindow when the model is unknown. A provider prefix such as
+// "openrouter/anthropic/claude-sonnet-4" is ignored.
+func ContextWindow(model string) int {
+	name := path.Base(model)
+	for _, w := range contextWindows {
+		if matched, _ := path.Match(w.pattern, name); matched {
+			return w.tokens
+		}
+	}
+	return DefaultContextWindow
+}
@@ -0,0 +1,157 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+)
+
+// ApprovalRule makes calls of the tools whose name matches the glob pattern
+// Tool wait for the user's approval. With Pattern set, only calls whose
+// argument Arg matches the regular expression need approval; without Arg,
+// Pattern is matched against all arguments as JSON.
+type ApprovalRule struct {
+	Tool    string
+	Arg     string
+	Pattern string
+}
+
+type approvalRule struct {
+	ApprovalRule
+	re *regexp.Regexp
+}
+
+// ApprovalPolicy decides which tool calls need the user's approval.
+type ApprovalPolicy struct {
+	rules []approvalRule
+}
+
+// NewApprovalPolicy compiles rules into a policy. A nil policy approves
+// every call.
+func NewApprovalPolicy(rules []ApprovalRule) (*ApprovalPolicy, error) {
+	p := &ApprovalPolicy{}
+	for _, rule := range rules {
+		if _, err := path.Match(rule.Tool, ""); err != nil {
+			return nil, fmt.Errorf("invalid approval tool pattern %q: %w", rule.Tool, err)
+		}
+		compiled := approvalRule{ApprovalRule: rule}
+		if rule.Pattern != "" {
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid approval pattern %q: %w", rule.Pattern, err)
+			}
+			compiled.re = re
+		}
+		p.rules = append(p.rules, compiled)
+	}
+	return p, nil
+}
+
+// Match returns the first rule that requires approval for a call of the
+// named tool with args.
+func (p *ApprovalPolicy) Match(name string, args map[string]interface{}) (ApprovalRule, bool) {
+	if p == nil {
+		return ApprovalRule{}, false
+	}
+	for _, rule := range p.rules {
+		if ok, _ := path.Match(rule.Tool, name); !ok {
+			continue
+		}
+		if rule.re == nil || rule.re.MatchString(approvalSubject(rule.Arg, args)) {
+			return rule.ApprovalRule, true
+		}
+	}
+	return ApprovalRule{}, false
+}
+
+// Always reports whether every call of the named tool needs approval.
+func (p *ApprovalPolicy) Always(name string) bool {
+	if p == nil {
+		return false
+	}
+	for _, rule := range p.rules {
+		if ok, _ := path.Match(rule.Tool, name); ok && rule.re == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// approvalSubject returns the text a rule's pattern is matched against.
+func approvalSubject(arg string, args map[string]interface{}) string {
+	if arg == "" {
+		data, _ := json.Marshal(args)
+		return string(data)
+	}
+	switch v := args[arg].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// ApprovalRequest describes a tool call that waits for the user's approval.
+type ApprovalRequest struct {
+	Tool     string
+	Args     map[string]interface{}
+	Rule     ApprovalRule // the rule that requires approval
+	Channel  string       // conversation the call was made for
+	ChatID   string
+	SenderID string // user whose message started the turn; only they may answer
+}
+
+// Subject returns the text of the call that the rule's pattern matched:
+// the rule's argument, or all arguments as JSON.
+func (r ApprovalRequest) Subject() string {
+	return approvalSubject(r.Rule.Arg, r.Args)
+}
+
+// DelegatingTool is implemented by tools whose calls make another tool run
+// later, such as cron jobs with a command. Such a call needs the approval
+// the later call would need, since that one is not checked when it runs.
+type DelegatingTool interface {
+	Tool
+	// DelegatedCall returns the call that args will make, if any.
+	DelegatedCall(args map[string]interface{}) (name string, delegated map[string]interface{}, ok bool)
+}
+
+// Approver asks the user whether a tool call may run. RequestApproval
+// blocks until the user answers and returns nil if the call is approved,
+// or an error saying why it is not: the user denied it, did not answer in
+// time, or could not be asked.
+type Approver interface {
+	RequestApproval(ctx context.Context, req ApprovalRequest) error
+}
+
+// SetApproval makes calls matching policy wait for approver before they
+// run. A nil policy or approver runs every call without asking.
+func (r *ToolRegistry) SetApproval(policy *ApprovalPolicy, approver Approver) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.approval = policy
+	r.approver = approver
+}
+
+// needsApproval returns the rule that requires approval for a call, if any.
+// Calls of a DelegatingTool are also checked as the call they delegate.
+func (r *ToolRegistry) needsApproval(tool Tool, name string, args map[string]interface{}) (ApprovalRule, Approver, bool) {
+	r.mu.RLock()
+	policy, approver := r.approval, r.approver
+	r.mu.RUnlock()
+	if approver == nil {
+		return ApprovalRule{}, nil, false
+	}
+	rule, ok := policy.Match(name, args)
+	if d, delegating := tool.(DelegatingTool); !ok && delegating {
+		if delegatedName, delegated, has := d.DelegatedCall(args); has {
+			rule, ok = policy.Match(delegatedName, delegated)
+		}
+	}
+	return rule, approver, ok
+}
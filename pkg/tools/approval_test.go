@@ -0,0 +1,114 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/cron"
+)
+
+func TestApprovalPolicy_Match(t *testing.T) {
+	policy, err := NewApprovalPolicy([]ApprovalRule{
+		{Tool: "exec", Arg: "command", Pattern: `\b(rm|sudo)\b`},
+		{Tool: "*_file", Arg: "path", Pattern: `^/etc/`},
+	})
+	if err != nil {
+		t.Fatalf("NewApprovalPolicy() error: %v", err)
+	}
+
+	tests := []struct {
+		tool string
+		args map[string]interface{}
+		want bool
+	}{
+		{"exec", map[string]interface{}{"command": "sudo reboot"}, true},
+		{"exec", map[string]interface{}{"command": "ls -la"}, false},
+		{"write_file", map[string]interface{}{"path": "/etc/hosts"}, true},
+		{"write_file", map[string]interface{}{"path": "notes.md"}, false},
+		{"read_file", map[string]interface{}{"path": "/etc/hosts"}, true},
+		{"web_fetch", map[string]interface{}{"url": "https://example.com/rm"}, false},
+	}
+	for _, tt := range tests {
+		if _, got := policy.Match(tt.tool, tt.args); got != tt.want {
+			t.Errorf("Match(%q, %v) = %v, want %v", tt.tool, tt.args, got, tt.want)
+		}
+	}
+
+	if _, err := NewApprovalPolicy([]ApprovalRule{{Tool: "exec", Pattern: "("}}); err == nil {
+		t.Error("NewApprovalPolicy() with an invalid pattern should fail")
+	}
+}
+
+type approverFunc func(ctx context.Context, req ApprovalRequest) error
+
+func (f approverFunc) RequestApproval(ctx context.Context, req ApprovalRequest) error {
+	return f(ctx, req)
+}
+
+func TestToolRegistry_ApprovalGatesExecution(t *testing.T) {
+	tool := &probeTool{name: "exec"}
+	r := NewToolRegistry()
+	r.Register(tool)
+
+	policy, _ := NewApprovalPolicy([]ApprovalRule{{Tool: "exec"}})
+	var asked []ApprovalRequest
+	approve := false
+	r.SetApproval(policy, approverFunc(func(ctx context.Context, req ApprovalRequest) error {
+		asked = append(asked, req)
+		if !approve {
+			return errors.New("the user denied it")
+		}
+		return nil
+	}))
+
+	args := map[string]interface{}{"id": "rm", "ms": 0, "command": "rm -rf build"}
+	result := r.ExecuteWithContext(context.Background(), "exec", args, "telegram", "42", nil)
+	if !result.IsError || !strings.Contains(result.ForLLM, "denied") {
+		t.Errorf("denied call result = %+v, want an error saying it was denied", result)
+	}
+	if len(tool.finished) != 0 {
+		t.Fatal("denied call was executed")
+	}
+
+	approve = true
+	result = r.ExecuteWithContext(context.Background(), "exec", args, "telegram", "42", nil)
+	if result.IsError || len(tool.finished) != 1 {
+		t.Errorf("approved call result = %+v, want it executed", result)
+	}
+
+	if len(asked) != 2 || asked[0].Channel != "telegram" || asked[0].ChatID != "42" || asked[0].Rule.Tool != "exec" {
+		t.Errorf("approval requests = %+v, want two for telegram:42 naming the rule", asked)
+	}
+}
+
+func TestToolRegistry_ApprovalCoversScheduledCommands(t *testing.T) {
+	cronService := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	r := NewToolRegistry()
+	r.Register(NewCronTool(cronService, nil, bus.NewMessageBus(), t.TempDir(), true, 0))
+
+	// Only exec has a rule; a command scheduled through cron must still ask.
+	policy, _ := NewApprovalPolicy([]ApprovalRule{{Tool: "exec", Arg: "command", Pattern: `\brm\b`}})
+	var asked []ApprovalRequest
+	r.SetApproval(policy, approverFunc(func(ctx context.Context, req ApprovalRequest) error {
+		asked = append(asked, req)
+		return errors.New("the user denied it")
+	}))
+
+	add := map[string]interface{}{"action": "add", "message": "clean up", "command": "rm -rf /", "at_seconds": 60.0}
+	result := r.ExecuteWithContext(context.Background(), "cron", add, "telegram", "42", nil)
+	if !result.IsError || len(asked) != 1 || asked[0].Tool != "cron" || asked[0].Subject() != "rm -rf /" {
+		t.Errorf("result = %+v, requests = %+v; want the cron call denied after asking about its command", result, asked)
+	}
+	if jobs := cronService.ListJobs(true); len(jobs) != 0 {
+		t.Errorf("a command job was created without approval: %+v", jobs)
+	}
+
+	reminder := map[string]interface{}{"action": "add", "message": "stretch", "at_seconds": 60.0}
+	if result := r.ExecuteWithContext(context.Background(), "cron", reminder, "telegram", "42", nil); result.IsError || len(asked) != 1 {
+		t.Errorf("a reminder without a command asked for approval or failed: %+v", result)
+	}
+}
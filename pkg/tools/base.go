@@ -11,12 +11,31 @@ type Tool interface {
 }
 
 // ContextualTool is an optional interface that tools can implement
-// to receive the current message context (channel, chatID)
+// to receive a default message context (channel, chatID).
+//
+// The agent passes the per-call context through context.Context (see
+// WithChannel); SetContext only provides a fallback for standalone use.
 type ContextualTool interface {
 	Tool
 	SetContext(channel, chatID string)
 }
 
+// ConcurrentTool is an optional interface for tools whose calls may run at
+// the same time as other calls in the same response. Tools without side
+// effects on shared state, such as reading files or fetching pages,
+// implement it; tools that change files, send messages or run commands do
+// not, and run one at a time in the order the model asked for them.
+type ConcurrentTool interface {
+	Tool
+	ConcurrencySafe() bool
+}
+
+// IsConcurrencySafe reports whether calls of tool may run in parallel.
+func IsConcurrencySafe(tool Tool) bool {
+	c, ok := tool.(ConcurrentTool)
+	return ok && c.ConcurrencySafe()
+}
+
 // AsyncCallback is a function type that async tools use to notify completion.
 // When an async tool finishes its work, it calls this callback with the result.
 //
@@ -41,7 +60,8 @@ type AsyncCallback func(ctx context.Context, result *ToolResult)
 // asynchronous execution with completion callbacks.
 //
 // Async tools return immediately with an AsyncResult, then notify completion
-// via the callback set by SetCallback.
+// via the callback carried by the call context (see WithAsyncCallback), or
+// the one set by SetCallback when no per-call callback is present.
 //
 // This is useful for:
 // - Long-running operations that shouldn't block the agent loop
@@ -0,0 +1,127 @@
+package tools
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type toolContextKey struct{}
+
+// toolContext carries per-call information for a single tool execution.
+// It travels through context.Context so that concurrent agent turns never
+// share mutable state on a tool instance.
+type toolContext struct {
+	channel       string
+	chatID        string
+	session       string
+	sender        string
+	asyncCallback AsyncCallback
+	turn          *TurnState
+}
+
+// TurnState records side effects produced by tools during one agent turn.
+// A fresh TurnState is attached to the context at the start of every turn.
+type TurnState struct {
+	messageSent   atomic.Bool
+	replyStreamed atomic.Bool
+}
+
+// NewTurnState creates an empty TurnState.
+func NewTurnState() *TurnState {
+	return &TurnState{}
+}
+
+// MarkMessageSent records that a tool already delivered a message to the user.
+func (s *TurnState) MarkMessageSent() {
+	s.messageSent.Store(true)
+}
+
+// MessageSent reports whether a tool delivered a message during this turn.
+func (s *TurnState) MessageSent() bool {
+	return s.messageSent.Load()
+}
+
+// MarkReplyStreamed records that the final reply was shown as a streamed
+// preview, which stays open until a regular message replaces it.
+func (s *TurnState) MarkReplyStreamed() {
+	s.replyStreamed.Store(true)
+}
+
+// ReplyStreamed reports whether the final reply was streamed as a preview.
+func (s *TurnState) ReplyStreamed() bool {
+	return s.replyStreamed.Load()
+}
+
+func toolContextFrom(ctx context.Context) toolContext {
+	if ctx == nil {
+		return toolContext{}
+	}
+	tc, _ := ctx.Value(toolContextKey{}).(toolContext)
+	return tc
+}
+
+// WithChannel returns a context that carries the channel and chat ID of the
+// conversation a tool is executed for.
+func WithChannel(ctx context.Context, channel, chatID string) context.Context {
+	tc := toolContextFrom(ctx)
+	tc.channel = channel
+	tc.chatID = chatID
+	return context.WithValue(ctx, toolContextKey{}, tc)
+}
+
+// ChannelFromContext returns the channel and chat ID attached with WithChannel.
+func ChannelFromContext(ctx context.Context) (channel, chatID string) {
+	tc := toolContextFrom(ctx)
+	return tc.channel, tc.chatID
+}
+
+// WithSession returns a context that carries the key of the session a tool
+// is executed for.
+func WithSession(ctx context.Context, sessionKey string) context.Context {
+	tc := toolContextFrom(ctx)
+	tc.session = sessionKey
+	return context.WithValue(ctx, toolContextKey{}, tc)
+}
+
+// SessionFromContext returns the session key attached with WithSession.
+func SessionFromContext(ctx context.Context) string {
+	return toolContextFrom(ctx).session
+}
+
+// WithSender returns a context that carries the ID of the user whose message
+// started the turn a tool is executed in.
+func WithSender(ctx context.Context, senderID string) context.Context {
+	tc := toolContextFrom(ctx)
+	tc.sender = senderID
+	return context.WithValue(ctx, toolContextKey{}, tc)
+}
+
+// SenderFromContext returns the sender ID attached with WithSender.
+func SenderFromContext(ctx context.Context) string {
+	return toolContextFrom(ctx).sender
+}
+
+// WithTurnState returns a context that carries the given TurnState.
+func WithTurnState(ctx context.Context, state *TurnState) context.Context {
+	tc := toolContextFrom(ctx)
+	tc.turn = state
+	return context.WithValue(ctx, toolContextKey{}, tc)
+}
+
+// TurnStateFromContext returns the TurnState attached with WithTurnState, or nil.
+func TurnStateFromContext(ctx context.Context) *TurnState {
+	return toolContextFrom(ctx).turn
+}
+
+// WithAsyncCallback returns a context that carries the completion callback
+// for async tools started during this call.
+func WithAsyncCallback(ctx context.Context, cb AsyncCallback) context.Context {
+	tc := toolContextFrom(ctx)
+	tc.asyncCallback = cb
+	return context.WithValue(ctx, toolContextKey{}, tc)
+}
+
+// AsyncCallbackFromContext returns the callback attached with WithAsyncCallback, or nil.
+func AsyncCallbackFromContext(ctx context.Context) AsyncCallback {
+	return toolContextFrom(ctx).asyncCallback
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/sandbox"
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
@@ -40,6 +41,24 @@ func NewCronTool(cronService *cron.CronService, executor JobExecutor, msgBus *bu
 	}
 }
 
+// SetSandbox runs the commands of scheduled jobs in sb.
+func (t *CronTool) SetSandbox(sb *sandbox.Sandbox) {
+	t.execTool.SetSandbox(sb)
+}
+
+// SetExecPolicy applies the exec tool's policy to the commands of
+// scheduled jobs. They keep the timeout set for cron.
+func (t *CronTool) SetExecPolicy(policy ExecPolicy, channels map[string]ExecPolicy) error {
+	timeout := t.execTool.timeout
+	policy.Timeout = timeout
+	byChannel := make(map[string]ExecPolicy, len(channels))
+	for channel, p := range channels {
+		p.Timeout = timeout
+		byChannel[channel] = p
+	}
+	return t.execTool.SetPolicy(policy, byChannel)
+}
+
 // Name returns the tool name
 func (t *CronTool) Name() string {
 	return "cron"
@@ -101,6 +120,17 @@ func (t *CronTool) SetContext(channel, chatID string) {
 	t.chatID = chatID
 }
 
+// DelegatedCall reports the exec call that adding a job with a command
+// schedules, so that the command needs the approval exec would need.
+func (t *CronTool) DelegatedCall(args map[string]interface{}) (string, map[string]interface{}, bool) {
+	action, _ := args["action"].(string)
+	command, _ := args["command"].(string)
+	if action != "add" || command == "" {
+		return "", nil, false
+	}
+	return "exec", map[string]interface{}{"command": command}, true
+}
+
 // Execute runs the tool with the given arguments
 func (t *CronTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
 	action, ok := args["action"].(string)
@@ -110,7 +140,7 @@ func (t *CronTool) Execute(ctx context.Context, args map[string]interface{}) *To
 
 	switch action {
 	case "add":
-		return t.addJob(args)
+		return t.addJob(ctx, args)
 	case "list":
 		return t.listJobs()
 	case "remove":
@@ -124,11 +154,14 @@ func (t *CronTool) Execute(ctx context.Context, args map[string]interface{}) *To
 	}
 }
 
-func (t *CronTool) addJob(args map[string]interface{}) *ToolResult {
-	t.mu.RLock()
-	channel := t.channel
-	chatID := t.chatID
-	t.mu.RUnlock()
+func (t *CronTool) addJob(ctx context.Context, args map[string]interface{}) *ToolResult {
+	channel, chatID := ChannelFromContext(ctx)
+	if channel == "" || chatID == "" {
+		t.mu.RLock()
+		channel = t.channel
+		chatID = t.chatID
+		t.mu.RUnlock()
+	}
 
 	if channel == "" || chatID == "" {
 		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
@@ -282,7 +315,7 @@ func (t *CronTool) ExecuteJob(ctx context.Context, job *cron.CronJob) string {
 			"command": job.Payload.Command,
 		}
 
-		result := t.execTool.Execute(ctx, args)
+		result := t.execTool.Execute(WithChannel(ctx, channel, chatID), args)
 		var output string
 		if result.IsError {
 			output = fmt.Sprintf("Error executing scheduled command: %s", result.ForLLM)
@@ -94,6 +94,10 @@ func (t *ReadFileTool) Description() string {
 	return "Read the contents of a file"
 }
 
+func (t *ReadFileTool) ConcurrencySafe() bool {
+	return true
+}
+
 func (t *ReadFileTool) Parameters() map[string]interface{} {
 	return map[string]interface{}{
 		"type": "object",
@@ -205,6 +209,10 @@ func (t *ListDirTool) Description() string {
 	return "List files and directories in a path"
 }
 
+func (t *ListDirTool) ConcurrencySafe() bool {
+	return true
+}
+
 func (t *ListDirTool) Parameters() map[string]interface{} {
 	return map[string]interface{}{
 		"type": "object",
@@ -3,19 +3,33 @@ package tools
 import (
 	"context"
 	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
 )
 
-type SendCallback func(channel, chatID, content string) error
+// maxSendFileBytes is the largest file the message tool sends; most chat
+// platforms reject bot uploads above 50 MB.
+const maxSendFileBytes = 50 << 20
+
+// SendCallback delivers a message and the files attached to it.
+type SendCallback func(channel, chatID, content string, attachments []bus.Attachment) error
 
+// MessageTool sends text, optionally with files from the workspace, to a chat.
 type MessageTool struct {
+	workspace      string
+	restrict       bool
 	sendCallback   SendCallback
 	defaultChannel string
 	defaultChatID  string
-	sentInRound    bool // Tracks whether a message was sent in the current processing round
 }
 
-func NewMessageTool() *MessageTool {
-	return &MessageTool{}
+func NewMessageTool(workspace string, restrict bool) *MessageTool {
+	return &MessageTool{workspace: workspace, restrict: restrict}
 }
 
 func (t *MessageTool) Name() string {
@@ -23,7 +37,7 @@ func (t *MessageTool) Name() string {
 }
 
 func (t *MessageTool) Description() string {
-	return "Send a message to user on a chat channel. Use this when you want to communicate something."
+	return "Send a message to user on a chat channel. Use this when you want to communicate something. Attach files (images, documents, audio or video) you created or downloaded with files."
 }
 
 func (t *MessageTool) Parameters() map[string]interface{} {
@@ -32,7 +46,12 @@ func (t *MessageTool) Parameters() map[string]interface{} {
 		"properties": map[string]interface{}{
 			"content": map[string]interface{}{
 				"type":        "string",
-				"description": "The message content to send",
+				"description": "The message content to send; may be empty when sending files",
+			},
+			"files": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Optional: paths of files to send with the message",
 			},
 			"channel": map[string]interface{}{
 				"type":        "string",
@@ -47,15 +66,10 @@ func (t *MessageTool) Parameters() map[string]interface{} {
 	}
 }
 
+// SetContext sets the fallback target used when the call context carries none.
 func (t *MessageTool) SetContext(channel, chatID string) {
 	t.defaultChannel = channel
 	t.defaultChatID = chatID
-	t.sentInRound = false // Reset send tracking for new processing round
-}
-
-// HasSentInRound returns true if the message tool sent a message during the current round.
-func (t *MessageTool) HasSentInRound() bool {
-	return t.sentInRound
 }
 
 func (t *MessageTool) SetSendCallback(callback SendCallback) {
@@ -64,20 +78,12 @@ func (t *MessageTool) SetSendCallback(callback SendCallback) {
 
 func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
 	content, ok := args["content"].(string)
-	if !ok {
+	files := stringList(args["files"])
+	if !ok && len(files) == 0 {
 		return &ToolResult{ForLLM: "content is required", IsError: true}
 	}
 
-	channel, _ := args["channel"].(string)
-	chatID, _ := args["chat_id"].(string)
-
-	if channel == "" {
-		channel = t.defaultChannel
-	}
-	if chatID == "" {
-		chatID = t.defaultChatID
-	}
-
+	channel, chatID := resolveTarget(ctx, args, t.defaultChannel, t.defaultChatID)
 	if channel == "" || chatID == "" {
 		return &ToolResult{ForLLM: "No target channel/chat specified", IsError: true}
 	}
@@ -86,7 +92,16 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 		return &ToolResult{ForLLM: "Message sending not configured", IsError: true}
 	}
 
-	if err := t.sendCallback(channel, chatID, content); err != nil {
+	attachments, err := t.attachments(files)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	return t.send(ctx, channel, chatID, content, attachments)
+}
+
+// send delivers a message that has been checked already.
+func (t *MessageTool) send(ctx context.Context, channel, chatID, content string, attachments []bus.Attachment) *ToolResult {
+	if err := t.sendCallback(channel, chatID, content, attachments); err != nil {
 		return &ToolResult{
 			ForLLM:  fmt.Sprintf("sending message: %v", err),
 			IsError: true,
@@ -94,10 +109,105 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 		}
 	}
 
-	t.sentInRound = true
+	if turn := TurnStateFromContext(ctx); turn != nil {
+		turn.MarkMessageSent()
+	}
 	// Silent: user already received the message directly
+	forLLM := fmt.Sprintf("Message sent to %s:%s", channel, chatID)
+	if len(attachments) > 0 {
+		names := make([]string, len(attachments))
+		for i, a := range attachments {
+			names[i] = filepath.Base(a.Path)
+		}
+		forLLM += fmt.Sprintf(" with %s", strings.Join(names, ", "))
+	}
 	return &ToolResult{
-		ForLLM: fmt.Sprintf("Message sent to %s:%s", channel, chatID),
+		ForLLM: forLLM,
 		Silent: true,
 	}
 }
+
+// attachments checks the files to send and describes them for the channel.
+func (t *MessageTool) attachments(paths []string) ([]bus.Attachment, error) {
+	var attachments []bus.Attachment
+	for _, path := range paths {
+		resolvedPath, err := validatePath(path, t.workspace, t.restrict)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(resolvedPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %v", err)
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("%s is a directory", path)
+		}
+		if info.Size() > maxSendFileBytes {
+			return nil, fmt.Errorf("%s is too large to send (%d bytes, limit %d)", path, info.Size(), maxSendFileBytes)
+		}
+		attachments = append(attachments, bus.Attachment{
+			Path:     resolvedPath,
+			MimeType: detectMimeType(resolvedPath),
+		})
+	}
+	return attachments, nil
+}
+
+// stringList returns the strings of an array argument; a single string
+// counts as a list of one.
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []string:
+		return v
+	case []interface{}:
+		var list []string
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// resolveTarget picks the chat a message goes to: explicit channel/chat_id
+// arguments first, then the channel of the current turn, then the fallback.
+func resolveTarget(ctx context.Context, args map[string]interface{}, defaultChannel, defaultChatID string) (string, string) {
+	channel, _ := args["channel"].(string)
+	chatID, _ := args["chat_id"].(string)
+
+	ctxChannel, ctxChatID := ChannelFromContext(ctx)
+	if ctxChannel == "" || ctxChatID == "" {
+		ctxChannel, ctxChatID = defaultChannel, defaultChatID
+	}
+	if channel == "" {
+		channel = ctxChannel
+	}
+	if chatID == "" {
+		chatID = ctxChatID
+	}
+	return channel, chatID
+}
+
+// detectMimeType guesses a file's MIME type from its extension, falling
+// back to sniffing its first bytes.
+func detectMimeType(path string) string {
+	if t := mime.TypeByExtension(strings.ToLower(filepath.Ext(path))); t != "" {
+		return t
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer f.Close()
+
+	buf := make([]byte, 512)
+	n, _ := f.Read(buf)
+	return http.DetectContentType(buf[:n])
+}
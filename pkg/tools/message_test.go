@@ -3,15 +3,19 @@ package tools
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
 )
 
 func TestMessageTool_Execute_Success(t *testing.T) {
-	tool := NewMessageTool()
+	tool := NewMessageTool("", false)
 	tool.SetContext("test-channel", "test-chat-id")
 
 	var sentChannel, sentChatID, sentContent string
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(channel, chatID, content string, attachments []bus.Attachment) error {
 		sentChannel = channel
 		sentChatID = chatID
 		sentContent = content
@@ -58,12 +62,53 @@ func TestMessageTool_Execute_Success(t *testing.T) {
 	}
 }
 
+func TestMessageTool_Execute_WithFiles(t *testing.T) {
+	workspace := t.TempDir()
+	os.WriteFile(filepath.Join(workspace, "report.pdf"), []byte("%PDF-1.4"), 0644)
+	os.WriteFile(filepath.Join(workspace, "chart.png"), []byte("\x89PNG\r\n\x1a\n"), 0644)
+
+	tool := NewMessageTool(workspace, true)
+	var sentContent string
+	var sent []bus.Attachment
+	tool.SetSendCallback(func(channel, chatID, content string, attachments []bus.Attachment) error {
+		sentContent, sent = content, attachments
+		return nil
+	})
+
+	ctx := WithChannel(context.Background(), "telegram", "42")
+	result := tool.Execute(ctx, map[string]interface{}{
+		"content": "Here is this week's report",
+		"files":   []interface{}{"report.pdf", "chart.png"},
+	})
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+	if sentContent != "Here is this week's report" || len(sent) != 2 {
+		t.Fatalf("Expected the text and two files in one message, got %q and %+v", sentContent, sent)
+	}
+	if sent[0].Path != filepath.Join(workspace, "report.pdf") || sent[0].MimeType != "application/pdf" || sent[1].MimeType != "image/png" {
+		t.Errorf("Unexpected attachments: %+v", sent)
+	}
+	if result.ForLLM != "Message sent to telegram:42 with report.pdf, chart.png" {
+		t.Errorf("Unexpected ForLLM: %s", result.ForLLM)
+	}
+
+	sent = nil
+	result = tool.Execute(ctx, map[string]interface{}{
+		"content": "Also this",
+		"files":   []interface{}{"report.pdf", "/etc/hostname"},
+	})
+	if !result.IsError || sent != nil {
+		t.Errorf("Expected a file outside the workspace to fail the whole message, got %+v", result)
+	}
+}
+
 func TestMessageTool_Execute_WithCustomChannel(t *testing.T) {
-	tool := NewMessageTool()
+	tool := NewMessageTool("", false)
 	tool.SetContext("default-channel", "default-chat-id")
 
 	var sentChannel, sentChatID string
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(channel, chatID, content string, attachments []bus.Attachment) error {
 		sentChannel = channel
 		sentChatID = chatID
 		return nil
@@ -95,11 +140,11 @@ func TestMessageTool_Execute_WithCustomChannel(t *testing.T) {
 }
 
 func TestMessageTool_Execute_SendFailure(t *testing.T) {
-	tool := NewMessageTool()
+	tool := NewMessageTool("", false)
 	tool.SetContext("test-channel", "test-chat-id")
 
 	sendErr := errors.New("network error")
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(channel, chatID, content string, attachments []bus.Attachment) error {
 		return sendErr
 	})
 
@@ -132,7 +177,7 @@ func TestMessageTool_Execute_SendFailure(t *testing.T) {
 }
 
 func TestMessageTool_Execute_MissingContent(t *testing.T) {
-	tool := NewMessageTool()
+	tool := NewMessageTool("", false)
 	tool.SetContext("test-channel", "test-chat-id")
 
 	ctx := context.Background()
@@ -149,11 +194,44 @@ func TestMessageTool_Execute_MissingContent(t *testing.T) {
 	}
 }
 
+func TestMessageTool_Execute_UsesCallContext(t *testing.T) {
+	tool := NewMessageTool("", false)
+	tool.SetContext("default-channel", "default-chat-id")
+
+	var sentChannel, sentChatID string
+	tool.SetSendCallback(func(channel, chatID, content string, attachments []bus.Attachment) error {
+		sentChannel = channel
+		sentChatID = chatID
+		return nil
+	})
+
+	turn := NewTurnState()
+	ctx := WithTurnState(WithChannel(context.Background(), "ctx-channel", "ctx-chat-id"), turn)
+	args := map[string]interface{}{
+		"content": "Test message",
+	}
+
+	result := tool.Execute(ctx, args)
+
+	// Per-call context takes precedence over the tool's default context
+	if sentChannel != "ctx-channel" || sentChatID != "ctx-chat-id" {
+		t.Errorf("Expected target 'ctx-channel:ctx-chat-id', got '%s:%s'", sentChannel, sentChatID)
+	}
+	if result.IsError {
+		t.Errorf("Expected success, got error: %s", result.ForLLM)
+	}
+
+	// The send is recorded on the turn, not on the shared tool
+	if !turn.MessageSent() {
+		t.Error("Expected turn state to record the sent message")
+	}
+}
+
 func TestMessageTool_Execute_NoTargetChannel(t *testing.T) {
-	tool := NewMessageTool()
+	tool := NewMessageTool("", false)
 	// No SetContext called, so defaultChannel and defaultChatID are empty
 
-	tool.SetSendCallback(func(channel, chatID, content string) error {
+	tool.SetSendCallback(func(channel, chatID, content string, attachments []bus.Attachment) error {
 		return nil
 	})
 
@@ -174,7 +252,7 @@ func TestMessageTool_Execute_NoTargetChannel(t *testing.T) {
 }
 
 func TestMessageTool_Execute_NotConfigured(t *testing.T) {
-	tool := NewMessageTool()
+	tool := NewMessageTool("", false)
 	tool.SetContext("test-channel", "test-chat-id")
 	// No SetSendCallback called
 
@@ -195,14 +273,14 @@ func TestMessageTool_Execute_NotConfigured(t *testing.T) {
 }
 
 func TestMessageTool_Name(t *testing.T) {
-	tool := NewMessageTool()
+	tool := NewMessageTool("", false)
 	if tool.Name() != "message" {
 		t.Errorf("Expected name 'message', got '%s'", tool.Name())
 	}
 }
 
 func TestMessageTool_Description(t *testing.T) {
-	tool := NewMessageTool()
+	tool := NewMessageTool("", false)
 	desc := tool.Description()
 	if desc == "" {
 		t.Error("Description should not be empty")
@@ -210,7 +288,7 @@ func TestMessageTool_Description(t *testing.T) {
 }
 
 func TestMessageTool_Parameters(t *testing.T) {
-	tool := NewMessageTool()
+	tool := NewMessageTool("", false)
 	params := tool.Parameters()
 
 	// Verify parameters structure
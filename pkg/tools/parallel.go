@@ -0,0 +1,125 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+const (
+	DefaultMaxParallelTools = 4
+	DefaultToolTimeout      = 60 * time.Second
+)
+
+// SetParallelism sets how many concurrency-safe calls ExecuteAll runs at
+// once and how long each of them may take. Zero values keep the defaults;
+// a limit of 1 runs every call one after another.
+func (r *ToolRegistry) SetParallelism(maxConcurrent int, timeout time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maxParallel = maxConcurrent
+	r.parallelTimeout = timeout
+}
+
+func (r *ToolRegistry) parallelism() (int, time.Duration) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	maxConcurrent, timeout := r.maxParallel, r.parallelTimeout
+	if maxConcurrent <= 0 {
+		maxConcurrent = DefaultMaxParallelTools
+	}
+	if timeout <= 0 {
+		timeout = DefaultToolTimeout
+	}
+	return maxConcurrent, timeout
+}
+
+// ExecuteAll runs the tool calls of one LLM response and returns their
+// results in the order of calls. Consecutive calls of concurrency-safe
+// tools run in parallel, each with a timeout; any other call waits for the
+// calls before it and runs alone, so side effects keep their order.
+// callback, when set, returns the async callback of each call.
+func (r *ToolRegistry) ExecuteAll(ctx context.Context, calls []providers.ToolCall, channel, chatID string, callback func(tc providers.ToolCall) AsyncCallback) []*ToolResult {
+	maxConcurrent, timeout := r.parallelism()
+	results := make([]*ToolResult, len(calls))
+
+	execute := func(ctx context.Context, i int) *ToolResult {
+		var asyncCallback AsyncCallback
+		if callback != nil {
+			asyncCallback = callback(calls[i])
+		}
+		return r.ExecuteWithContext(ctx, calls[i].Name, calls[i].Arguments, channel, chatID, asyncCallback)
+	}
+
+	for start := 0; start < len(calls); {
+		end := start
+		for end < len(calls) && maxConcurrent > 1 && r.isConcurrencySafe(calls[end]) {
+			end++
+		}
+		if end-start < 2 {
+			results[start] = execute(ctx, start)
+			start++
+			continue
+		}
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, maxConcurrent)
+		for i := start; i < end; i++ {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				results[i] = executeWithTimeout(ctx, calls[i].Name, timeout, func(ctx context.Context) *ToolResult {
+					return execute(ctx, i)
+				})
+			}()
+		}
+		wg.Wait()
+		start = end
+	}
+	return results
+}
+
+// isConcurrencySafe reports whether call may run in parallel. Calls that
+// wait for the user's approval run alone, so the tool timeout does not cut
+// the wait short.
+func (r *ToolRegistry) isConcurrencySafe(call providers.ToolCall) bool {
+	tool, ok := r.Get(call.Name)
+	if !ok || !IsConcurrencySafe(tool) {
+		return false
+	}
+	_, _, needsApproval := r.needsApproval(tool, call.Name, call.Arguments)
+	return !needsApproval
+}
+
+// executeWithTimeout runs fn with a deadline and gives up on it once the
+// deadline passes, even if the tool does not watch its context.
+func executeWithTimeout(ctx context.Context, name string, timeout time.Duration, fn func(ctx context.Context) *ToolResult) *ToolResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan *ToolResult, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- ErrorResult(fmt.Sprintf("tool %q panicked: %v", name, p))
+			}
+		}()
+		done <- fn(ctx)
+	}()
+
+	select {
+	case result := <-done:
+		return result
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return ErrorResult(fmt.Sprintf("tool %q did not finish within %s", name, timeout)).WithError(ctx.Err())
+		}
+		return ErrorResult(fmt.Sprintf("tool %q was canceled", name)).WithError(ctx.Err())
+	}
+}
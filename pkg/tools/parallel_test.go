@@ -0,0 +1,122 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// probeTool records how many of its calls run at the same time. Each call
+// sleeps for args["ms"] milliseconds and returns args["id"].
+type probeTool struct {
+	name     string
+	safe     bool
+	running  atomic.Int32
+	peak     atomic.Int32
+	mu       sync.Mutex
+	finished []string
+}
+
+func (t *probeTool) Name() string        { return t.name }
+func (t *probeTool) Description() string { return "probe" }
+func (t *probeTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{"type": "object"}
+}
+func (t *probeTool) ConcurrencySafe() bool { return t.safe }
+
+func (t *probeTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	n := t.running.Add(1)
+	defer t.running.Add(-1)
+	for {
+		peak := t.peak.Load()
+		if n <= peak || t.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+
+	select {
+	case <-time.After(time.Duration(args["ms"].(int)) * time.Millisecond):
+	case <-ctx.Done():
+	}
+
+	id := args["id"].(string)
+	t.mu.Lock()
+	t.finished = append(t.finished, id)
+	t.mu.Unlock()
+	return NewToolResult(id)
+}
+
+func call(name, id string, ms int) providers.ToolCall {
+	return providers.ToolCall{ID: id, Name: name, Arguments: map[string]interface{}{"id": id, "ms": ms}}
+}
+
+func TestExecuteAll_RunsSafeCallsInParallelInOrder(t *testing.T) {
+	r := NewToolRegistry()
+	fetch := &probeTool{name: "fetch", safe: true}
+	r.Register(fetch)
+
+	calls := []providers.ToolCall{call("fetch", "a", 60), call("fetch", "b", 10), call("fetch", "c", 30)}
+	start := time.Now()
+	results := r.ExecuteAll(context.Background(), calls, "", "", nil)
+	elapsed := time.Since(start)
+
+	for i, want := range []string{"a", "b", "c"} {
+		if results[i].ForLLM != want {
+			t.Errorf("results[%d] = %q, want %q", i, results[i].ForLLM, want)
+		}
+	}
+	if fetch.peak.Load() != 3 {
+		t.Errorf("peak concurrency = %d, want 3", fetch.peak.Load())
+	}
+	if elapsed >= 100*time.Millisecond {
+		t.Errorf("calls took %s, expected them to overlap", elapsed)
+	}
+}
+
+func TestExecuteAll_UnsafeCallsAreBarriers(t *testing.T) {
+	r := NewToolRegistry()
+	fetch := &probeTool{name: "fetch", safe: true}
+	write := &probeTool{name: "write"}
+	r.Register(fetch)
+	r.Register(write)
+	r.SetParallelism(2, 0)
+
+	calls := []providers.ToolCall{
+		call("fetch", "f1", 20), call("fetch", "f2", 20), call("fetch", "f3", 20),
+		call("write", "w1", 1),
+		call("fetch", "f4", 1),
+	}
+	results := r.ExecuteAll(context.Background(), calls, "", "", nil)
+
+	if fetch.peak.Load() != 2 {
+		t.Errorf("peak concurrency = %d, want the limit of 2", fetch.peak.Load())
+	}
+	if write.finished[0] != "w1" || len(fetch.finished) != 4 || fetch.finished[3] != "f4" {
+		t.Errorf("fetch finished %v, write finished %v; want f4 to run after w1", fetch.finished, write.finished)
+	}
+	for i, tc := range calls {
+		if results[i].ForLLM != tc.ID {
+			t.Errorf("results[%d] = %q, want %q", i, results[i].ForLLM, tc.ID)
+		}
+	}
+}
+
+func TestExecuteAll_TimesOutSlowCalls(t *testing.T) {
+	r := NewToolRegistry()
+	r.Register(&probeTool{name: "fetch", safe: true})
+	r.SetParallelism(4, 20*time.Millisecond)
+
+	results := r.ExecuteAll(context.Background(), []providers.ToolCall{call("fetch", "fast", 1), call("fetch", "slow", 1000)}, "", "", nil)
+
+	if results[0].IsError || results[0].ForLLM != "fast" {
+		t.Errorf("fast call = %+v, want its result", results[0])
+	}
+	if !results[1].IsError || !strings.Contains(results[1].ForLLM, "did not finish") {
+		t.Errorf("slow call = %+v, want a timeout error", results[1])
+	}
+}
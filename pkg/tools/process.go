@@ -0,0 +1,563 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	// startupWait is how long a background start waits for early output,
+	// so that a command that fails at once reports why.
+	startupWait = time.Second
+	// killGrace is how long a process may take to exit after SIGTERM.
+	killGrace = 2 * time.Second
+	// maxReadWait caps how long a read waits for new output.
+	maxReadWait = 30 * time.Second
+)
+
+// ansiEscape matches the terminal control sequences of PTY output.
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)|\x1b[()][0-9A-Za-z]|\x1b[=>]`)
+
+// ProcessManager keeps the commands the exec tool started in the background,
+// by the session that started them. Processes end when they are killed, when
+// they run longer than the lifetime limit, when their session ends, or when
+// the manager shuts down.
+type ProcessManager struct {
+	mu            sync.Mutex
+	processes     map[string]*backgroundProcess
+	nextID        int
+	maxPerSession int
+	maxLifetime   time.Duration
+	bufferSize    int
+}
+
+// NewProcessManager creates a manager that runs up to maxPerSession
+// processes per session, kills them after maxLifetime (0 means never) and
+// keeps the last bufferSize bytes of each output stream.
+func NewProcessManager(maxPerSession int, maxLifetime time.Duration, bufferSize int) *ProcessManager {
+	if maxPerSession <= 0 {
+		maxPerSession = 8
+	}
+	if bufferSize <= 0 {
+		bufferSize = 256 * 1024
+	}
+	return &ProcessManager{
+		processes:     make(map[string]*backgroundProcess),
+		maxPerSession: maxPerSession,
+		maxLifetime:   maxLifetime,
+		bufferSize:    bufferSize,
+	}
+}
+
+type backgroundProcess struct {
+	id      string
+	session string
+	command string
+	pty     bool
+	started time.Time
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser // a pipe, or the PTY master
+	stdout  *outputLog
+	stderr  *outputLog // nil for PTY processes, whose streams are merged
+	wake    chan struct{}
+	done    chan struct{} // closed when the process has exited
+	ended   time.Time
+}
+
+func (p *backgroundProcess) running() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// status describes the state of p, such as "running" or "exit status 1".
+func (p *backgroundProcess) status() string {
+	if p.running() {
+		return "running"
+	}
+	if p.cmd.ProcessState == nil {
+		return "failed"
+	}
+	return p.cmd.ProcessState.String()
+}
+
+// outputLog keeps the latest output of a stream, up to limit bytes, and
+// the offset up to which it was read.
+type outputLog struct {
+	mu    sync.Mutex
+	data  []byte
+	start int64 // stream offset of data[0]
+	read  int64 // stream offset up to which output was returned
+	limit int
+	wake  chan struct{}
+}
+
+func (l *outputLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	l.data = append(l.data, p...)
+	if over := len(l.data) - l.limit; over > 0 {
+		l.data = append(l.data[:0], l.data[over:]...)
+		l.start += int64(over)
+	}
+	l.mu.Unlock()
+
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+// unread returns the output not returned before, and how many bytes of it
+// were dropped because the buffer was full.
+func (l *outputLog) unread() (string, int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var skipped int64
+	if l.read < l.start {
+		skipped = l.start - l.read
+		l.read = l.start
+	}
+	text := string(l.data[l.read-l.start:])
+	l.read = l.start + int64(len(l.data))
+	return text, skipped
+}
+
+func (l *outputLog) pending() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.read < l.start+int64(len(l.data))
+}
+
+// Start runs the command built by build in the background for session, in a
+// pseudo-terminal if pty is set. build receives the context that ends the
+// process.
+func (m *ProcessManager) Start(session, command string, pty bool, build func(ctx context.Context) (*exec.Cmd, error)) (*backgroundProcess, error) {
+	m.mu.Lock()
+	running := 0
+	for _, p := range m.processes {
+		if p.session == session && p.running() {
+			running++
+		}
+	}
+	if running >= m.maxPerSession {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("%d background processes are already running in this session; kill one first", running)
+	}
+	m.nextID++
+	id := fmt.Sprintf("p%d", m.nextID)
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if m.maxLifetime > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), m.maxLifetime)
+	}
+	cmd, err := build(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	wake := make(chan struct{}, 1)
+	p := &backgroundProcess{
+		id:      id,
+		session: session,
+		command: command,
+		pty:     pty,
+		cmd:     cmd,
+		stdout:  &outputLog{limit: m.bufferSize, wake: wake},
+		wake:    wake,
+		done:    make(chan struct{}),
+	}
+
+	// Stopping the context kills the whole process group.
+	cmd.Cancel = func() error { return signalProcess(cmd.Process, "KILL") }
+	cmd.WaitDelay = killGrace
+
+	var copied chan struct{}
+	if pty {
+		master, tty, err := openPTY()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+		setTerminal(cmd)
+		err = cmd.Start()
+		tty.Close()
+		if err != nil {
+			master.Close()
+			cancel()
+			return nil, err
+		}
+		p.stdin = master
+		copied = make(chan struct{})
+		go func() {
+			defer close(copied)
+			// Reading fails with EIO once the terminal is closed.
+			io.Copy(p.stdout, master)
+		}()
+	} else {
+		p.stderr = &outputLog{limit: m.bufferSize, wake: wake}
+		cmd.Stdout, cmd.Stderr = p.stdout, p.stderr
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		setProcessGroup(cmd)
+		if err := cmd.Start(); err != nil {
+			cancel()
+			return nil, err
+		}
+		p.stdin = stdin
+	}
+	p.started = time.Now()
+
+	go func() {
+		cmd.Wait()
+		if copied != nil {
+			select {
+			case <-copied:
+			case <-time.After(killGrace):
+			}
+			p.stdin.Close()
+		}
+		p.ended = time.Now()
+		close(p.done)
+		cancel()
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+		logger.InfoCF("tool", "Background process exited",
+			map[string]interface{}{
+				"id":      id,
+				"session": session,
+				"status":  p.status(),
+			})
+	}()
+
+	m.mu.Lock()
+	m.processes[id] = p
+	m.pruneLocked(session)
+	m.mu.Unlock()
+
+	logger.InfoCF("tool", "Background process started",
+		map[string]interface{}{
+			"id":      id,
+			"session": session,
+			"pid":     cmd.Process.Pid,
+			"pty":     pty,
+			"command": command,
+		})
+	return p, nil
+}
+
+// pruneLocked forgets the oldest exited processes of session beyond the
+// per-session limit.
+func (m *ProcessManager) pruneLocked(session string) {
+	var exited []*backgroundProcess
+	for _, p := range m.processes {
+		if p.session == session && !p.running() {
+			exited = append(exited, p)
+		}
+	}
+	sort.Slice(exited, func(i, j int) bool { return exited[i].ended.Before(exited[j].ended) })
+	for len(exited) > m.maxPerSession {
+		delete(m.processes, exited[0].id)
+		exited = exited[1:]
+	}
+}
+
+// get returns the process id of session.
+func (m *ProcessManager) get(session, id string) (*backgroundProcess, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.processes[id]
+	if !ok || p.session != session {
+		return nil, fmt.Errorf("no process %q in this session", id)
+	}
+	return p, nil
+}
+
+// list returns the processes of session, oldest first.
+func (m *ProcessManager) list(session string) []*backgroundProcess {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var result []*backgroundProcess
+	for _, p := range m.processes {
+		if p.session == session {
+			result = append(result, p)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].started.Before(result[j].started) })
+	return result
+}
+
+// kill stops p with SIGTERM, then SIGKILL if it is still running after a
+// grace period, and waits for it to exit.
+func (m *ProcessManager) kill(p *backgroundProcess) {
+	if !p.running() {
+		return
+	}
+	signalProcess(p.cmd.Process, "TERM")
+	select {
+	case <-p.done:
+	case <-time.After(killGrace):
+		signalProcess(p.cmd.Process, "KILL")
+		<-p.done
+	}
+}
+
+// EndSession kills the processes of session and forgets them.
+func (m *ProcessManager) EndSession(session string) {
+	m.killAll(func(p *backgroundProcess) bool { return p.session == session })
+}
+
+// Shutdown kills every process.
+func (m *ProcessManager) Shutdown() {
+	m.killAll(func(p *backgroundProcess) bool { return true })
+}
+
+func (m *ProcessManager) killAll(match func(p *backgroundProcess) bool) {
+	m.mu.Lock()
+	var victims []*backgroundProcess
+	for id, p := range m.processes {
+		if match(p) {
+			victims = append(victims, p)
+			delete(m.processes, id)
+		}
+	}
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, p := range victims {
+		wg.Add(1)
+		go func(p *backgroundProcess) {
+			defer wg.Done()
+			m.kill(p)
+		}(p)
+	}
+	wg.Wait()
+}
+
+// report waits up to wait for new output or for p to exit, then describes p
+// and returns the output not read before, keeping the last maxOutput
+// characters.
+func (m *ProcessManager) report(ctx context.Context, p *backgroundProcess, wait time.Duration, maxOutput int) string {
+	if wait > 0 && p.running() && !p.stdout.pending() && (p.stderr == nil || !p.stderr.pending()) {
+		timer := time.NewTimer(wait)
+		select {
+		case <-p.wake:
+			// Let the rest of a burst of output arrive.
+			time.Sleep(100 * time.Millisecond)
+		case <-p.done:
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		timer.Stop()
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Process %s (pid %d, %s, %s): %s", p.id, p.cmd.Process.Pid, p.status(),
+		processAge(p), p.command)
+
+	section := func(name string, log *outputLog) {
+		text, skipped := log.unread()
+		if p.pty {
+			text = ansiEscape.ReplaceAllString(text, "")
+			text = strings.ReplaceAll(text, "\r\n", "\n")
+		}
+		if maxOutput > 0 && len(text) > maxOutput {
+			skipped += int64(len(text) - maxOutput)
+			text = text[len(text)-maxOutput:]
+		}
+		if text == "" && skipped == 0 {
+			return
+		}
+		fmt.Fprintf(&sb, "\n--- %s ---\n", name)
+		if skipped > 0 {
+			fmt.Fprintf(&sb, "... (%d earlier bytes skipped)\n", skipped)
+		}
+		sb.WriteString(strings.TrimSuffix(text, "\n"))
+	}
+	before := sb.Len()
+	if p.pty {
+		section("terminal", p.stdout)
+	} else {
+		section("stdout", p.stdout)
+		section("stderr", p.stderr)
+	}
+	if sb.Len() == before {
+		sb.WriteString("\n(no new output)")
+	}
+	return sb.String()
+}
+
+func processAge(p *backgroundProcess) string {
+	end := time.Now()
+	if !p.running() {
+		end = p.ended
+	}
+	return "ran " + end.Sub(p.started).Round(time.Second).String()
+}
+
+// ProcessTool manages the commands the exec tool started in the background.
+type ProcessTool struct {
+	manager   *ProcessManager
+	maxOutput int
+}
+
+func NewProcessTool(manager *ProcessManager, maxOutput int) *ProcessTool {
+	return &ProcessTool{manager: manager, maxOutput: maxOutput}
+}
+
+func (t *ProcessTool) Name() string {
+	return "process"
+}
+
+func (t *ProcessTool) Description() string {
+	return "Manage commands started with exec in the background (background=true or pty=true): list them, read their new output, write to their input, send signals, or kill them. Processes are stopped when the conversation ends."
+}
+
+func (t *ProcessTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"list", "read", "write", "signal", "kill"},
+				"description": "list: show the processes of this conversation. read: new output since the last read. write: send input. signal: send a signal. kill: stop the process.",
+			},
+			"id": map[string]interface{}{
+				"type":        "string",
+				"description": "Process ID returned by exec, e.g. p1 (all actions except list)",
+			},
+			"wait_seconds": map[string]interface{}{
+				"type":        "number",
+				"description": "For read and write: wait up to this long for new output (max 30)",
+			},
+			"input": map[string]interface{}{
+				"type":        "string",
+				"description": "For write: text to send; a newline is added unless no_newline is true",
+			},
+			"no_newline": map[string]interface{}{
+				"type":        "boolean",
+				"description": "For write: do not add a newline after input",
+			},
+			"eof": map[string]interface{}{
+				"type":        "boolean",
+				"description": "For write: close the input (Ctrl-D in a terminal) after sending it",
+			},
+			"signal": map[string]interface{}{
+				"type":        "string",
+				"description": "For signal: INT, TERM, HUP, KILL, QUIT, USR1, USR2, STOP or CONT",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *ProcessTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	session := processSession(ctx)
+
+	if action == "list" {
+		processes := t.manager.list(session)
+		if len(processes) == 0 {
+			return SilentResult("No background processes in this conversation.")
+		}
+		var sb strings.Builder
+		sb.WriteString("Background processes:")
+		for _, p := range processes {
+			fmt.Fprintf(&sb, "\n- %s (pid %d, %s, %s", p.id, p.cmd.Process.Pid, p.status(), processAge(p))
+			if p.pty {
+				sb.WriteString(", pty")
+			}
+			fmt.Fprintf(&sb, "): %s", p.command)
+		}
+		return SilentResult(sb.String())
+	}
+
+	id, _ := args["id"].(string)
+	if id == "" {
+		return ErrorResult("id is required")
+	}
+	p, err := t.manager.get(session, id)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+
+	wait := time.Duration(0)
+	if seconds, ok := args["wait_seconds"].(float64); ok && seconds > 0 {
+		wait = min(time.Duration(seconds*float64(time.Second)), maxReadWait)
+	}
+
+	switch action {
+	case "read":
+		return SilentResult(t.manager.report(ctx, p, wait, t.maxOutput))
+
+	case "write":
+		if !p.running() {
+			return ErrorResult(fmt.Sprintf("process %s has exited (%s)", p.id, p.status()))
+		}
+		input, _ := args["input"].(string)
+		if noNewline, _ := args["no_newline"].(bool); !noNewline && input != "" {
+			input += "\n"
+		}
+		eof, _ := args["eof"].(bool)
+		if eof && p.pty {
+			input += "\x04"
+		}
+		if _, err := io.WriteString(p.stdin, input); err != nil {
+			return ErrorResult(fmt.Sprintf("writing to %s failed: %v", p.id, err))
+		}
+		if eof && !p.pty {
+			p.stdin.Close()
+		}
+		if wait == 0 {
+			wait = startupWait
+		}
+		return SilentResult(t.manager.report(ctx, p, wait, t.maxOutput))
+
+	case "signal":
+		name, _ := args["signal"].(string)
+		if name == "" {
+			return ErrorResult("signal is required")
+		}
+		if err := signalProcess(p.cmd.Process, name); err != nil {
+			return ErrorResult(fmt.Sprintf("signal %s to %s failed: %v", name, p.id, err))
+		}
+		return SilentResult(t.manager.report(ctx, p, 500*time.Millisecond, t.maxOutput))
+
+	case "kill":
+		t.manager.kill(p)
+		return SilentResult(t.manager.report(ctx, p, 0, t.maxOutput))
+
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+// processSession returns the owner of the processes started in ctx: the
+// session, or the conversation when there is no session.
+func processSession(ctx context.Context) string {
+	if session := SessionFromContext(ctx); session != "" {
+		return session
+	}
+	channel, chatID := ChannelFromContext(ctx)
+	return channel + ":" + chatID
+}
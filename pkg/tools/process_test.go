@@ -0,0 +1,127 @@
+package tools
+
+import (
+	"context"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startBackground(t *testing.T, tool *ExecTool, ctx context.Context, args map[string]interface{}) string {
+	t.Helper()
+	result := tool.Execute(ctx, args)
+	if result.IsError {
+		t.Fatalf("background exec failed: %s", result.ForLLM)
+	}
+	id := regexp.MustCompile(`Started (p\d+)`).FindStringSubmatch(result.ForLLM)
+	if id == nil {
+		t.Fatalf("no process ID in %q", result.ForLLM)
+	}
+	return id[1]
+}
+
+func TestProcessTool_Lifecycle(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	manager := NewProcessManager(2, time.Minute, 1024)
+	defer manager.Shutdown()
+	execTool := NewExecTool(t.TempDir(), false)
+	execTool.SetProcessManager(manager)
+	processTool := NewProcessTool(manager, 0)
+	ctx := WithSession(context.Background(), "s1")
+
+	id := startBackground(t, execTool, ctx, map[string]interface{}{
+		"command":    `echo ready; while read line; do echo "got $line"; echo oops >&2; done`,
+		"background": true,
+	})
+
+	result := processTool.Execute(ctx, map[string]interface{}{"action": "write", "id": id, "input": "hello", "wait_seconds": 2.0})
+	if !strings.Contains(result.ForLLM, "got hello") || strings.Contains(result.ForLLM, "\nready") {
+		t.Errorf("write result = %q, want only the new output", result.ForLLM)
+	}
+	// stderr may arrive just after stdout
+	if !strings.Contains(result.ForLLM, "oops") {
+		result = processTool.Execute(ctx, map[string]interface{}{"action": "read", "id": id, "wait_seconds": 2.0})
+		if !strings.Contains(result.ForLLM, "--- stderr ---\noops") {
+			t.Errorf("read result = %q, want the stderr output", result.ForLLM)
+		}
+	}
+
+	other := WithSession(context.Background(), "s2")
+	if result := processTool.Execute(other, map[string]interface{}{"action": "read", "id": id}); !result.IsError {
+		t.Error("another session could read the process")
+	}
+
+	result = processTool.Execute(ctx, map[string]interface{}{"action": "kill", "id": id})
+	if !strings.Contains(result.ForLLM, "signal: terminated") {
+		t.Errorf("kill result = %q, want the process terminated", result.ForLLM)
+	}
+	result = processTool.Execute(ctx, map[string]interface{}{"action": "list"})
+	if !strings.Contains(result.ForLLM, id+" (pid") {
+		t.Errorf("list = %q, want the exited process", result.ForLLM)
+	}
+
+	// The limit counts running processes of the session only.
+	startBackground(t, execTool, ctx, map[string]interface{}{"command": "sleep 60", "background": true})
+	startBackground(t, execTool, ctx, map[string]interface{}{"command": "sleep 60", "background": true})
+	if result := execTool.Execute(ctx, map[string]interface{}{"command": "sleep 60", "background": true}); !result.IsError {
+		t.Error("started more processes than the session limit")
+	}
+	startBackground(t, execTool, other, map[string]interface{}{"command": "sleep 60", "background": true})
+
+	manager.EndSession("s1")
+	if processes := manager.list("s1"); len(processes) != 0 {
+		t.Errorf("%d processes left after the session ended", len(processes))
+	}
+	if processes := manager.list("s2"); len(processes) != 1 || !processes[0].running() {
+		t.Error("ending a session stopped the processes of another")
+	}
+}
+
+func TestProcessTool_PTY(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("pty mode is only supported on Linux")
+	}
+	manager := NewProcessManager(0, 0, 0)
+	defer manager.Shutdown()
+	execTool := NewExecTool(t.TempDir(), false)
+	execTool.SetProcessManager(manager)
+	processTool := NewProcessTool(manager, 0)
+	ctx := WithSession(context.Background(), "s1")
+
+	id := startBackground(t, execTool, ctx, map[string]interface{}{
+		"command": `if [ -t 0 ]; then echo tty; fi; read line; echo "got $line"`,
+		"pty":     true,
+	})
+	result := processTool.Execute(ctx, map[string]interface{}{"action": "write", "id": id, "input": "hi", "wait_seconds": 2.0})
+	output := result.ForLLM
+	if !strings.Contains(output, "got hi") {
+		time.Sleep(200 * time.Millisecond)
+		output += processTool.Execute(ctx, map[string]interface{}{"action": "read", "id": id, "wait_seconds": 2.0}).ForLLM
+	}
+	if !strings.Contains(output, "got hi") {
+		t.Errorf("pty output = %q, want the echoed input", output)
+	}
+	p, _ := manager.get("s1", id)
+	if p.stdout.start != 0 || !strings.HasPrefix(string(p.stdout.data), "tty") {
+		t.Errorf("terminal output = %q, want the command to see a terminal", p.stdout.data)
+	}
+}
+
+func TestOutputLog_KeepsLatest(t *testing.T) {
+	log := &outputLog{limit: 5, wake: make(chan struct{}, 1)}
+	log.Write([]byte("abc"))
+	if text, skipped := log.unread(); text != "abc" || skipped != 0 {
+		t.Errorf("unread() = %q, %d", text, skipped)
+	}
+	log.Write([]byte("defghij"))
+	if text, skipped := log.unread(); text != "fghij" || skipped != 2 {
+		t.Errorf("unread() after overflow = %q, %d, want fghij and 2 skipped", text, skipped)
+	}
+	if text, _ := log.unread(); text != "" {
+		t.Errorf("second unread() = %q, want nothing new", text)
+	}
+}
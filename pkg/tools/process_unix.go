@@ -0,0 +1,55 @@
+//go:build !windows
+
+package tools
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+var processSignals = map[string]syscall.Signal{
+	"INT":  syscall.SIGINT,
+	"TERM": syscall.SIGTERM,
+	"HUP":  syscall.SIGHUP,
+	"KILL": syscall.SIGKILL,
+	"QUIT": syscall.SIGQUIT,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"STOP": syscall.SIGSTOP,
+	"CONT": syscall.SIGCONT,
+}
+
+// setProcessGroup starts cmd in a process group of its own, so that
+// signals reach the processes it starts as well.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// setTerminal starts cmd in a session of its own with its standard input,
+// a terminal, as the controlling terminal.
+func setTerminal(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Ctty = 0
+}
+
+// signalProcess sends the named signal to the process group led by p.
+func signalProcess(p *os.Process, name string) error {
+	sig, ok := processSignals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return fmt.Errorf("unknown signal %q", name)
+	}
+	if err := syscall.Kill(-p.Pid, sig); err != nil {
+		return p.Signal(sig)
+	}
+	return nil
+}
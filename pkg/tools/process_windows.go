@@ -0,0 +1,22 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func setTerminal(cmd *exec.Cmd) {}
+
+// signalProcess stops p; Windows has no other signals.
+func signalProcess(p *os.Process, name string) error {
+	switch strings.TrimPrefix(strings.ToUpper(name), "SIG") {
+	case "KILL", "TERM", "INT":
+		return p.Kill()
+	default:
+		return fmt.Errorf("signal %s is not supported on Windows", name)
+	}
+}
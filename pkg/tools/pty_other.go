@@ -0,0 +1,13 @@
+//go:build !linux
+
+package tools
+
+import (
+	"errors"
+	"os"
+)
+
+// openPTY is a stub for non-Linux platforms.
+func openPTY() (master, tty *os.File, err error) {
+	return nil, nil, errors.New("pty mode is only supported on Linux")
+}
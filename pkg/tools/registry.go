@@ -3,6 +3,7 @@ package tools
 import (
 	"context"
 	"fmt"
+	"path"
 	"sync"
 	"time"
 
@@ -11,8 +12,13 @@ import (
 )
 
 type ToolRegistry struct {
-	tools map[string]Tool
-	mu    sync.RWMutex
+	tools           map[string]Tool
+	allowed         []string // glob patterns; empty allows every tool
+	maxParallel     int      // concurrency-safe calls run at once by ExecuteAll
+	parallelTimeout time.Duration
+	approval        *ApprovalPolicy // calls it matches wait for approver
+	approver        Approver
+	mu              sync.RWMutex
 }
 
 func NewToolRegistry() *ToolRegistry {
@@ -21,12 +27,52 @@ func NewToolRegistry() *ToolRegistry {
 	}
 }
 
+// SetAllowed restricts the registry to tools whose names match one of the
+// glob patterns. Tools already registered that do not match are removed and
+// later registrations of such tools are ignored. No patterns allow all tools.
+func (r *ToolRegistry) SetAllowed(patterns []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.allowed = patterns
+	for name := range r.tools {
+		if !r.isAllowed(name) {
+			delete(r.tools, name)
+		}
+	}
+}
+
+func (r *ToolRegistry) isAllowed(name string) bool {
+	if len(r.allowed) == 0 {
+		return true
+	}
+	for _, pattern := range r.allowed {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *ToolRegistry) Register(tool Tool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	if !r.isAllowed(tool.Name()) {
+		logger.DebugCF("tool", "Tool not in allowlist, skipping",
+			map[string]interface{}{
+				"tool": tool.Name(),
+			})
+		return
+	}
 	r.tools[tool.Name()] = tool
 }
 
+// Unregister removes a tool; unknown names are ignored.
+func (r *ToolRegistry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tools, name)
+}
+
 func (r *ToolRegistry) Get(name string) (Tool, bool) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -39,8 +85,8 @@ func (r *ToolRegistry) Execute(ctx context.Context, name string, args map[string
 }
 
 // ExecuteWithContext executes a tool with channel/chatID context and optional async callback.
-// If the tool implements AsyncTool and a non-nil callback is provided,
-// the callback will be set on the tool before execution.
+// The channel, chatID and callback are attached to ctx for this call only;
+// tools read them with ChannelFromContext and AsyncCallbackFromContext.
 func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args map[string]interface{}, channel, chatID string, asyncCallback AsyncCallback) *ToolResult {
 	logger.InfoCF("tool", "Tool execution started",
 		map[string]interface{}{
@@ -57,18 +103,38 @@ func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args
 		return ErrorResult(fmt.Sprintf("tool %q not found", name)).WithError(fmt.Errorf("tool not found"))
 	}
 
-	// If tool implements ContextualTool, set context
-	if contextualTool, ok := tool.(ContextualTool); ok && channel != "" && chatID != "" {
-		contextualTool.SetContext(channel, chatID)
+	// Per-call context travels through ctx so that concurrent turns do not
+	// overwrite each other's channel/chatID on shared tool instances.
+	if channel != "" && chatID != "" {
+		ctx = WithChannel(ctx, channel, chatID)
+	}
+	if asyncCallback != nil {
+		ctx = WithAsyncCallback(ctx, asyncCallback)
+		if _, ok := tool.(AsyncTool); ok {
+			logger.DebugCF("tool", "Async callback injected",
+				map[string]interface{}{
+					"tool": name,
+				})
+		}
 	}
 
-	// If tool implements AsyncTool and callback is provided, set callback
-	if asyncTool, ok := tool.(AsyncTool); ok && asyncCallback != nil {
-		asyncTool.SetCallback(asyncCallback)
-		logger.DebugCF("tool", "Async callback injected",
-			map[string]interface{}{
-				"tool": name,
-			})
+	if rule, approver, ok := r.needsApproval(tool, name, args); ok {
+		err := approver.RequestApproval(ctx, ApprovalRequest{
+			Tool:     name,
+			Args:     args,
+			Rule:     rule,
+			Channel:  channel,
+			ChatID:   chatID,
+			SenderID: SenderFromContext(ctx),
+		})
+		if err != nil {
+			logger.WarnCF("tool", "Tool call not approved",
+				map[string]interface{}{
+					"tool":  name,
+					"error": err.Error(),
+				})
+			return ErrorResult(fmt.Sprintf("Tool %q was not run: %v. Do not retry it unless the user asks.", name, err)).WithError(err)
+		}
 	}
 
 	start := time.Now()
@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"context"
+)
+
+// SendFileTool is send_file, an alias of the message tool for sending one
+// file with an optional caption. It goes through the message tool, so the
+// same checks apply and the file reaches the same chat.
+type SendFileTool struct {
+	message *MessageTool
+}
+
+func NewSendFileTool(message *MessageTool) *SendFileTool {
+	return &SendFileTool{message: message}
+}
+
+func (t *SendFileTool) Name() string {
+	return "send_file"
+}
+
+func (t *SendFileTool) Description() string {
+	return "Send a file (image, document, audio or video) to the user on a chat channel. Same as the message tool with files; prefer that to send text and files together."
+}
+
+func (t *SendFileTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "Path of the file to send",
+			},
+			"caption": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: text shown with the file",
+			},
+			"channel": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: target channel (telegram, discord, etc.)",
+			},
+			"chat_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: target chat/user ID",
+			},
+		},
+		"required": []string{"path"},
+	}
+}
+
+func (t *SendFileTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	path, ok := args["path"].(string)
+	if !ok || path == "" {
+		return ErrorResult("path is required")
+	}
+	caption, _ := args["caption"].(string)
+
+	channel, chatID := resolveTarget(ctx, args, t.message.defaultChannel, t.message.defaultChatID)
+	if channel == "" || chatID == "" {
+		return ErrorResult("No target channel/chat specified")
+	}
+	if t.message.sendCallback == nil {
+		return ErrorResult("File sending not configured")
+	}
+
+	attachments, err := t.message.attachments([]string{path})
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	attachments[0].Caption = caption
+	return t.message.send(ctx, channel, chatID, "", attachments)
+}
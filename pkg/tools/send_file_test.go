@@ -0,0 +1,75 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestSendFileTool_Execute_Success(t *testing.T) {
+	workspace := t.TempDir()
+	os.WriteFile(filepath.Join(workspace, "chart.png"), []byte("\x89PNG\r\n\x1a\n"), 0644)
+
+	message := NewMessageTool(workspace, true)
+	tool := NewSendFileTool(message)
+
+	var sentChannel, sentChatID, sentContent string
+	var sent []bus.Attachment
+	message.SetSendCallback(func(channel, chatID, content string, attachments []bus.Attachment) error {
+		sentChannel, sentChatID, sentContent, sent = channel, chatID, content, attachments
+		return nil
+	})
+
+	ctx := WithChannel(context.Background(), "telegram", "42")
+	result := tool.Execute(ctx, map[string]interface{}{
+		"path":    "chart.png",
+		"caption": "Weekly stats",
+	})
+
+	if result.IsError {
+		t.Fatalf("Expected success, got error: %s", result.ForLLM)
+	}
+	if !result.Silent {
+		t.Error("Expected Silent=true for successful send")
+	}
+	if sentChannel != "telegram" || sentChatID != "42" {
+		t.Errorf("Expected target telegram:42, got %s:%s", sentChannel, sentChatID)
+	}
+	if sentContent != "" || len(sent) != 1 {
+		t.Fatalf("Expected one file without text, got %q and %+v", sentContent, sent)
+	}
+	if sent[0].Path != filepath.Join(workspace, "chart.png") {
+		t.Errorf("Expected absolute workspace path, got %s", sent[0].Path)
+	}
+	if sent[0].MimeType != "image/png" || sent[0].Caption != "Weekly stats" {
+		t.Errorf("Unexpected attachment: %+v", sent[0])
+	}
+}
+
+func TestSendFileTool_Execute_Errors(t *testing.T) {
+	workspace := t.TempDir()
+	message := NewMessageTool(workspace, true)
+	message.SetContext("telegram", "42")
+	message.SetSendCallback(func(channel, chatID, content string, attachments []bus.Attachment) error {
+		t.Error("Callback should not be called")
+		return nil
+	})
+	tool := NewSendFileTool(message)
+
+	tests := map[string]string{
+		"missing file":      "missing.pdf",
+		"directory":         ".",
+		"outside workspace": "/etc/hostname",
+	}
+	for name, path := range tests {
+		t.Run(name, func(t *testing.T) {
+			result := tool.Execute(context.Background(), map[string]interface{}{"path": path})
+			if !result.IsError {
+				t.Errorf("Expected error for %s", path)
+			}
+		})
+	}
+}
@@ -6,40 +6,136 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/sipeed/picoclaw/pkg/sandbox"
 )
 
 type ExecTool struct {
 	workingDir          string
-	timeout             time.Duration
-	denyPatterns        []*regexp.Regexp
-	allowPatterns       []*regexp.Regexp
 	restrictToWorkspace bool
+	sandbox             *sandbox.Sandbox
+	processes           *ProcessManager       // runs background commands; nil disables them
+	execRules                                 // used when the channel has no rules of its own
+	channels            map[string]*execRules // by channel name
 }
 
-func NewExecTool(workingDir string, restrict bool) *ExecTool {
-	denyPatterns := []*regexp.Regexp{
-		regexp.MustCompile(`\brm\s+-[rf]{1,2}\b`),
-		regexp.MustCompile(`\bdel\s+/[fq]\b`),
-		regexp.MustCompile(`\brmdir\s+/s\b`),
-		regexp.MustCompile(`\b(format|mkfs|diskpart)\b\s`), // Match disk wiping commands (must be followed by space/args)
-		regexp.MustCompile(`\bdd\s+if=`),
-		regexp.MustCompile(`>\s*/dev/sd[a-z]\b`), // Block writes to disk devices (but allow /dev/null)
-		regexp.MustCompile(`\b(shutdown|reboot|poweroff)\b`),
-		regexp.MustCompile(`:\(\)\s*\{.*\};\s*:`),
-	}
+// execRules decide which commands run and how.
+type execRules struct {
+	timeout       time.Duration
+	maxOutput     int
+	shell         string
+	denyPatterns  []*regexp.Regexp
+	allowPatterns []*regexp.Regexp
+	envAllowlist  []string
+	env           map[string]string
+	disabled      bool
+}
+
+// defaultDenyPatterns block commands that destroy data or stop the system.
+var defaultDenyPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\brm\s+-[rf]{1,2}\b`),
+	regexp.MustCompile(`\bdel\s+/[fq]\b`),
+	regexp.MustCompile(`\brmdir\s+/s\b`),
+	regexp.MustCompile(`\b(format|mkfs|diskpart)\b\s`), // Match disk wiping commands (must be followed by space/args)
+	regexp.MustCompile(`\bdd\s+if=`),
+	regexp.MustCompile(`>\s*/dev/sd[a-z]\b`), // Block writes to disk devices (but allow /dev/null)
+	regexp.MustCompile(`\b(shutdown|reboot|poweroff)\b`),
+	regexp.MustCompile(`:\(\)\s*\{.*\};\s*:`),
+}
+
+// defaultMaxOutput is how many characters of output are returned when no
+// policy sets it.
+const defaultMaxOutput = 10000
 
+func NewExecTool(workingDir string, restrict bool) *ExecTool {
 	return &ExecTool{
 		workingDir:          workingDir,
-		timeout:             60 * time.Second,
-		denyPatterns:        denyPatterns,
-		allowPatterns:       nil,
 		restrictToWorkspace: restrict,
+		execRules: execRules{
+			timeout:      60 * time.Second,
+			maxOutput:    defaultMaxOutput,
+			denyPatterns: defaultDenyPatterns,
+		},
+	}
+}
+
+// ExecPolicy configures which commands the exec tool runs and how.
+type ExecPolicy struct {
+	Timeout       time.Duration     // 0 means no timeout
+	MaxOutput     int               // characters of output returned, 0 means unlimited
+	Shell         string            // sh, or powershell on Windows, when empty
+	AllowPatterns []string          // when set, only commands matching one run
+	DenyPatterns  []string          // blocked besides the built-in patterns
+	EnvAllowlist  []string          // host variables passed on (glob patterns); empty passes all
+	Env           map[string]string // set for every command
+	Disabled      bool              // refuse every command
+}
+
+func compileExecRules(p ExecPolicy) (*execRules, error) {
+	r := &execRules{
+		timeout:      p.Timeout,
+		maxOutput:    p.MaxOutput,
+		shell:        p.Shell,
+		denyPatterns: append([]*regexp.Regexp(nil), defaultDenyPatterns...),
+		envAllowlist: p.EnvAllowlist,
+		env:          p.Env,
+		disabled:     p.Disabled,
+	}
+	for _, pattern := range p.DenyPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deny pattern %q: %w", pattern, err)
+		}
+		r.denyPatterns = append(r.denyPatterns, re)
+	}
+	for _, pattern := range p.AllowPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allow pattern %q: %w", pattern, err)
+		}
+		r.allowPatterns = append(r.allowPatterns, re)
+	}
+	for _, pattern := range p.EnvAllowlist {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid env allowlist pattern %q: %w", pattern, err)
+		}
+	}
+	return r, nil
+}
+
+// SetPolicy replaces the rules of the tool with policy, and with the
+// policies of channels for commands run for those channels.
+func (t *ExecTool) SetPolicy(policy ExecPolicy, channels map[string]ExecPolicy) error {
+	rules, err := compileExecRules(policy)
+	if err != nil {
+		return err
+	}
+	byChannel := make(map[string]*execRules, len(channels))
+	for channel, p := range channels {
+		r, err := compileExecRules(p)
+		if err != nil {
+			return fmt.Errorf("channel %s: %w", channel, err)
+		}
+		byChannel[channel] = r
 	}
+	t.execRules = *rules
+	t.channels = byChannel
+	return nil
+}
+
+// rulesFor returns the rules for commands run for channel.
+func (t *ExecTool) rulesFor(channel string) *execRules {
+	if r, ok := t.channels[channel]; ok {
+		return r
+	}
+	return &t.execRules
 }
 
 func (t *ExecTool) Name() string {
@@ -51,19 +147,30 @@ func (t *ExecTool) Description() string {
 }
 
 func (t *ExecTool) Parameters() map[string]interface{} {
-	return map[string]interface{}{
-		"type": "object",
-		"properties": map[string]interface{}{
-			"command": map[string]interface{}{
-				"type":        "string",
-				"description": "The shell command to execute",
-			},
-			"working_dir": map[string]interface{}{
-				"type":        "string",
-				"description": "Optional working directory for the command",
-			},
+	properties := map[string]interface{}{
+		"command": map[string]interface{}{
+			"type":        "string",
+			"description": "The shell command to execute",
+		},
+		"working_dir": map[string]interface{}{
+			"type":        "string",
+			"description": "Optional working directory for the command",
 		},
-		"required": []string{"command"},
+	}
+	if t.processes != nil {
+		properties["background"] = map[string]interface{}{
+			"type":        "boolean",
+			"description": "Start the command in the background and return a process ID at once, for servers, watchers and long jobs. Use the process tool to read its output or stop it.",
+		}
+		properties["pty"] = map[string]interface{}{
+			"type":        "boolean",
+			"description": "Run the command in the background in a terminal, for interactive programs such as REPLs. Implies background.",
+		}
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   []string{"command"},
 	}
 }
 
@@ -85,35 +192,39 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) *To
 		}
 	}
 
-	if guardError := t.guardCommand(command, cwd); guardError != "" {
-		return ErrorResult(guardError)
+	channel, _ := ChannelFromContext(ctx)
+	rules := t.rulesFor(channel)
+	if decision := t.guardCommand(rules, command, cwd); !decision.Allowed {
+		return ErrorResult(decision.Reason)
+	}
+
+	background, _ := args["background"].(bool)
+	pty, _ := args["pty"].(bool)
+	if background || pty {
+		return t.startBackground(ctx, rules, command, cwd, pty)
 	}
 
 	// timeout == 0 means no timeout
 	var cmdCtx context.Context
 	var cancel context.CancelFunc
-	if t.timeout > 0 {
-		cmdCtx, cancel = context.WithTimeout(ctx, t.timeout)
+	if rules.timeout > 0 {
+		cmdCtx, cancel = context.WithTimeout(ctx, rules.timeout)
 	} else {
 		cmdCtx, cancel = context.WithCancel(ctx)
 	}
 	defer cancel()
 
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.CommandContext(cmdCtx, "powershell", "-NoProfile", "-NonInteractive", "-Command", command)
-	} else {
-		cmd = exec.CommandContext(cmdCtx, "sh", "-c", command)
-	}
-	if cwd != "" {
-		cmd.Dir = cwd
+	cmd, err := t.command(cmdCtx, rules, command, cwd)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("Command not run: %v", err))
 	}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	stdout := &cappedBuffer{limit: t.sandbox.OutputLimit()}
+	stderr := &cappedBuffer{limit: t.sandbox.OutputLimit()}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 
-	err := cmd.Run()
+	err = cmd.Run()
 	output := stdout.String()
 	if stderr.Len() > 0 {
 		output += "\nSTDERR:\n" + stderr.String()
@@ -121,7 +232,7 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) *To
 
 	if err != nil {
 		if cmdCtx.Err() == context.DeadlineExceeded {
-			msg := fmt.Sprintf("Command timed out after %v", t.timeout)
+			msg := fmt.Sprintf("Command timed out after %v", rules.timeout)
 			return &ToolResult{
 				ForLLM:  msg,
 				ForUser: msg,
@@ -135,8 +246,7 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) *To
 		output = "(no output)"
 	}
 
-	maxLen := 10000
-	if len(output) > maxLen {
+	if maxLen := rules.maxOutput; maxLen > 0 && len(output) > maxLen {
 		output = output[:maxLen] + fmt.Sprintf("\n... (truncated, %d more chars)", len(output)-maxLen)
 	}
 
@@ -155,37 +265,95 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) *To
 	}
 }
 
-func (t *ExecTool) guardCommand(command, cwd string) string {
+// command returns the command that runs command with rules in cwd, in the
+// sandbox if there is one.
+func (t *ExecTool) command(ctx context.Context, rules *execRules, command, cwd string) (*exec.Cmd, error) {
+	argv := shellArgs(rules.shell, command)
+	if t.sandbox != nil {
+		return t.sandbox.Command(ctx, argv, cwd, rules.environ(t.sandbox.Environ()))
+	}
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = rules.environ(nil)
+	if cwd != "" {
+		cmd.Dir = cwd
+	}
+	return cmd, nil
+}
+
+// startBackground starts command under the process manager and reports its
+// ID with the output of its first moments.
+func (t *ExecTool) startBackground(ctx context.Context, rules *execRules, command, cwd string, pty bool) *ToolResult {
+	if t.processes == nil {
+		return ErrorResult("background commands are not available here")
+	}
+	p, err := t.processes.Start(processSession(ctx), command, pty, func(procCtx context.Context) (*exec.Cmd, error) {
+		return t.command(procCtx, rules, command, cwd)
+	})
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("Command not started: %v", err))
+	}
+
+	report := t.processes.report(ctx, p, startupWait, rules.maxOutput)
+	return SilentResult(fmt.Sprintf("Started %s in the background. Use the process tool with id %q to read its output, write to it or stop it.\n\n%s",
+		p.id, p.id, report))
+}
+
+// ExecDecision tells whether the exec tool would run a command.
+type ExecDecision struct {
+	Allowed bool
+	Reason  string // why the command is blocked
+	Rule    string // the rule that allowed or blocked it, if any
+}
+
+// Check reports whether a command run in the working directory for
+// channel would pass the rules, without running it.
+func (t *ExecTool) Check(command, channel string) ExecDecision {
+	cwd := t.workingDir
+	if cwd == "" {
+		cwd, _ = os.Getwd()
+	}
+	return t.guardCommand(t.rulesFor(channel), command, cwd)
+}
+
+func (t *ExecTool) guardCommand(rules *execRules, command, cwd string) ExecDecision {
+	blocked := func(reason, rule string) ExecDecision {
+		return ExecDecision{Reason: reason, Rule: rule}
+	}
+
+	if rules.disabled {
+		return blocked("Command blocked: commands are disabled in this channel", "disabled")
+	}
+
 	cmd := strings.TrimSpace(command)
 	lower := strings.ToLower(cmd)
 
-	for _, pattern := range t.denyPatterns {
+	for _, pattern := range rules.denyPatterns {
 		if pattern.MatchString(lower) {
-			return "Command blocked by safety guard (dangerous pattern detected)"
+			return blocked("Command blocked by safety guard (dangerous pattern detected)", "deny pattern "+pattern.String())
 		}
 	}
 
-	if len(t.allowPatterns) > 0 {
-		allowed := false
-		for _, pattern := range t.allowPatterns {
+	var allowedBy string
+	if len(rules.allowPatterns) > 0 {
+		for _, pattern := range rules.allowPatterns {
 			if pattern.MatchString(lower) {
-				allowed = true
+				allowedBy = "allow pattern " + pattern.String()
 				break
 			}
 		}
-		if !allowed {
-			return "Command blocked by safety guard (not in allowlist)"
+		if allowedBy == "" {
+			return blocked("Command blocked by safety guard (not in allowlist)", "allow_patterns")
 		}
 	}
 
 	if t.restrictToWorkspace {
 		if strings.Contains(cmd, "..\\") || strings.Contains(cmd, "../") {
-			return "Command blocked by safety guard (path traversal detected)"
+			return blocked("Command blocked by safety guard (path traversal detected)", "restrict_to_workspace")
 		}
 
 		cwdPath, err := filepath.Abs(cwd)
 		if err != nil {
-			return ""
+			return ExecDecision{Allowed: true, Rule: allowedBy}
 		}
 
 		pathPattern := regexp.MustCompile(`[A-Za-z]:\\[^\\\"']+|/[^\s\"']+`)
@@ -203,18 +371,29 @@ func (t *ExecTool) guardCommand(command, cwd string) string {
 			}
 
 			if strings.HasPrefix(rel, "..") {
-				return "Command blocked by safety guard (path outside working dir)"
+				return blocked("Command blocked by safety guard (path outside working dir)", "restrict_to_workspace")
 			}
 		}
 	}
 
-	return ""
+	return ExecDecision{Allowed: true, Rule: allowedBy}
 }
 
 func (t *ExecTool) SetTimeout(timeout time.Duration) {
 	t.timeout = timeout
 }
 
+// SetProcessManager lets the tool start commands in the background under
+// pm; nil disables background commands.
+func (t *ExecTool) SetProcessManager(pm *ProcessManager) {
+	t.processes = pm
+}
+
+// SetSandbox runs commands in sb; nil runs them directly on the host.
+func (t *ExecTool) SetSandbox(sb *sandbox.Sandbox) {
+	t.sandbox = sb
+}
+
 func (t *ExecTool) SetRestrictToWorkspace(restrict bool) {
 	t.restrictToWorkspace = restrict
 }
@@ -230,3 +409,91 @@ func (t *ExecTool) SetAllowPatterns(patterns []string) error {
 	}
 	return nil
 }
+
+// shellArgs returns the command line that runs command with shell.
+func shellArgs(shell, command string) []string {
+	if shell == "" {
+		if runtime.GOOS == "windows" {
+			shell = "powershell"
+		} else {
+			shell = "sh"
+		}
+	}
+	name := strings.TrimSuffix(strings.ToLower(filepath.Base(shell)), ".exe")
+	switch name {
+	case "powershell", "pwsh":
+		return []string{shell, "-NoProfile", "-NonInteractive", "-Command", command}
+	case "cmd":
+		return []string{shell, "/C", command}
+	default:
+		return []string{shell, "-c", command}
+	}
+}
+
+// environ returns the environment of commands. With an allowlist it
+// takes the allowed variables of this process's environment, and PATH;
+// without one it starts from base, which is nil to pass on this process's
+// environment unchanged.
+func (r *execRules) environ(base []string) []string {
+	if len(r.envAllowlist) == 0 && len(r.env) == 0 {
+		return base
+	}
+	source := base
+	if source == nil || len(r.envAllowlist) > 0 {
+		source = os.Environ()
+	}
+	env := []string{}
+	for _, kv := range source {
+		name, _, _ := strings.Cut(kv, "=")
+		if _, ok := r.env[name]; ok {
+			continue
+		}
+		if len(r.envAllowlist) == 0 || strings.EqualFold(name, "PATH") || matchAny(r.envAllowlist, name) {
+			env = append(env, kv)
+		}
+	}
+	names := make([]string, 0, len(r.env))
+	for name := range r.env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, name+"="+r.env[name])
+	}
+	return env
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// cappedBuffer keeps the first limit bytes written to it and counts the
+// rest, so a command printing without end cannot exhaust memory. A limit
+// of 0 keeps everything.
+type cappedBuffer struct {
+	bytes.Buffer
+	limit   int
+	dropped int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 && b.Len()+len(p) > b.limit {
+		keep := max(b.limit-b.Len(), 0)
+		b.dropped += len(p) - keep
+		b.Buffer.Write(p[:keep])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+func (b *cappedBuffer) String() string {
+	if b.dropped > 0 {
+		return b.Buffer.String() + fmt.Sprintf("\n... (%d more bytes not captured)", b.dropped)
+	}
+	return b.Buffer.String()
+}
@@ -186,6 +186,16 @@ func TestShellTool_OutputTruncation(t *testing.T) {
 	}
 }
 
+// TestCappedBuffer verifies that output past the limit is counted, not kept
+func TestCappedBuffer(t *testing.T) {
+	b := &cappedBuffer{limit: 8}
+	b.Write([]byte("hello "))
+	b.Write([]byte("world"))
+	if got := b.String(); got != "hello wo\n... (3 more bytes not captured)" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
 // TestShellTool_RestrictToWorkspace verifies workspace restriction
 func TestShellTool_RestrictToWorkspace(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -208,3 +218,65 @@ func TestShellTool_RestrictToWorkspace(t *testing.T) {
 		t.Errorf("Expected 'blocked' message for path traversal, got ForLLM: %s, ForUser: %s", result.ForLLM, result.ForUser)
 	}
 }
+
+// TestShellTool_Policy verifies the configured rules, per-channel overrides
+// and environment
+func TestShellTool_Policy(t *testing.T) {
+	t.Setenv("PICOCLAW_TEST_SECRET", "hunter2")
+	tool := NewExecTool(t.TempDir(), false)
+	err := tool.SetPolicy(ExecPolicy{
+		Timeout:      time.Second,
+		MaxOutput:    100,
+		DenyPatterns: []string{`\bcurl\b`},
+		EnvAllowlist: []string{"HOME"},
+		Env:          map[string]string{"GREETING": "hi"},
+	}, map[string]ExecPolicy{
+		"slack": {AllowPatterns: []string{`^echo `}},
+	})
+	if err != nil {
+		t.Fatalf("SetPolicy() error: %v", err)
+	}
+
+	if d := tool.Check("curl example.com", ""); d.Allowed || d.Rule != `deny pattern \bcurl\b` {
+		t.Errorf("Check(curl) = %+v, want blocked by the deny pattern", d)
+	}
+	if d := tool.Check("rm -rf /", ""); d.Allowed {
+		t.Error("built-in deny patterns should stay in effect")
+	}
+	if d := tool.Check("ls", "slack"); d.Allowed {
+		t.Error("Check(ls) in slack = allowed, want blocked by the channel allowlist")
+	}
+	if d := tool.Check("echo ok", "slack"); !d.Allowed || d.Rule != "allow pattern ^echo " {
+		t.Errorf("Check(echo) in slack = %+v, want allowed by the channel pattern", d)
+	}
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"command": `echo "$GREETING:$PICOCLAW_TEST_SECRET"; seq 1000`,
+	})
+	if !strings.HasPrefix(result.ForLLM, "hi:\n") {
+		t.Errorf("output = %q, want GREETING set and the secret not passed on", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "truncated") {
+		t.Errorf("output of %d chars was not truncated to 100", len(result.ForLLM))
+	}
+
+	if err := tool.SetPolicy(ExecPolicy{DenyPatterns: []string{"("}}, nil); err == nil {
+		t.Error("SetPolicy() with an invalid pattern should fail")
+	}
+}
+
+func TestShellArgs(t *testing.T) {
+	tests := []struct {
+		shell string
+		want  string
+	}{
+		{"bash", "bash -c ls"},
+		{"/usr/bin/pwsh", "/usr/bin/pwsh -NoProfile -NonInteractive -Command ls"},
+		{"CMD.EXE", "CMD.EXE /C ls"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(shellArgs(tt.shell, "ls"), " "); got != tt.want {
+			t.Errorf("shellArgs(%q) = %q, want %q", tt.shell, got, tt.want)
+		}
+	}
+}
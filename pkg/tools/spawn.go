@@ -67,8 +67,17 @@ func (t *SpawnTool) Execute(ctx context.Context, args map[string]interface{}) *T
 		return ErrorResult("Subagent manager not configured")
 	}
 
+	channel, chatID := ChannelFromContext(ctx)
+	if channel == "" || chatID == "" {
+		channel, chatID = t.originChannel, t.originChatID
+	}
+	callback := AsyncCallbackFromContext(ctx)
+	if callback == nil {
+		callback = t.callback
+	}
+
 	// Pass callback to manager for async completion notification
-	result, err := t.manager.Spawn(ctx, task, label, t.originChannel, t.originChatID, t.callback)
+	result, err := t.manager.Spawn(ctx, task, label, channel, chatID, callback)
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("failed to spawn subagent: %v", err))
 	}
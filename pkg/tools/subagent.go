@@ -276,6 +276,11 @@ func (t *SubagentTool) Execute(ctx context.Context, args map[string]interface{})
 		},
 	}
 
+	channel, chatID := ChannelFromContext(ctx)
+	if channel == "" || chatID == "" {
+		channel, chatID = t.originChannel, t.originChatID
+	}
+
 	// Use RunToolLoop to execute with tools (same as async SpawnTool)
 	sm := t.manager
 	sm.mu.RLock()
@@ -292,7 +297,7 @@ func (t *SubagentTool) Execute(ctx context.Context, args map[string]interface{})
 			"max_tokens":  4096,
 			"temperature": 0.7,
 		},
-	}, messages, t.originChannel, t.originChatID)
+	}, messages, channel, chatID)
 
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("Subagent execution failed: %v", err)).WithError(err)
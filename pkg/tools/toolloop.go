@@ -113,7 +113,7 @@ func RunToolLoop(ctx context.Context, config ToolLoopConfig, messages []provider
 		}
 		messages = append(messages, assistantMsg)
 
-		// 7. Execute tool calls
+		// 7. Execute tool calls; concurrency-safe ones run in parallel
 		for _, tc := range response.ToolCalls {
 			argsJSON, _ := json.Marshal(tc.Arguments)
 			argsPreview := utils.Truncate(string(argsJSON), 200)
@@ -122,13 +122,18 @@ func RunToolLoop(ctx context.Context, config ToolLoopConfig, messages []provider
 					"tool":      tc.Name,
 					"iteration": iteration,
 				})
+		}
+
+		// No async callback for subagents - they run independently
+		var toolResults []*ToolResult
+		if config.Tools != nil {
+			toolResults = config.Tools.ExecuteAll(ctx, response.ToolCalls, channel, chatID, nil)
+		}
 
-			// Execute tool (no async callback for subagents - they run independently)
-			var toolResult *ToolResult
-			if config.Tools != nil {
-				toolResult = config.Tools.ExecuteWithContext(ctx, tc.Name, tc.Arguments, channel, chatID, nil)
-			} else {
-				toolResult = ErrorResult("No tools available")
+		for i, tc := range response.ToolCalls {
+			toolResult := ErrorResult("No tools available")
+			if toolResults != nil {
+				toolResult = toolResults[i]
 			}
 
 			// Determine content for LLM
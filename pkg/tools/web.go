@@ -1,15 +1,22 @@
 package tools
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
 	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/netguard"
+	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
 const (
@@ -36,7 +43,7 @@ func (p *BraveSearchProvider) Search(ctx context.Context, query string, count in
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("X-Subscription-Token", p.apiKey)
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := netguard.Client(10 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("request failed: %w", err)
@@ -59,8 +66,11 @@ func (p *BraveSearchProvider) Search(ctx context.Context, query string, count in
 	}
 
 	if err := json.Unmarshal(body, &searchResp); err != nil {
-		// Log error body for debugging
-		fmt.Printf("Brave API Error Body: %s\n", string(body))
+		// Logged rather than printed: stdout carries the MCP stream in "mcp serve"
+		logger.WarnCF("tool", "Brave API error body",
+			map[string]interface{}{
+				"body": utils.Truncate(string(body), 500),
+			})
 		return "", fmt.Errorf("failed to parse response: %w", err)
 	}
 
@@ -96,7 +106,7 @@ func (p *DuckDuckGoSearchProvider) Search(ctx context.Context, query string, cou
 
 	req.Header.Set("User-Agent", userAgent)
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := netguard.Client(10 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("request failed: %w", err)
@@ -206,7 +216,7 @@ func (p *PerplexitySearchProvider) Search(ctx context.Context, query string, cou
 	req.Header.Set("Authorization", "Bearer "+p.apiKey)
 	req.Header.Set("User-Agent", userAgent)
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := netguard.Client(30 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("request failed: %w", err)
@@ -295,6 +305,10 @@ func (t *WebSearchTool) Description() string {
 	return "Search the web for current information. Returns titles, URLs, and snippets from search results."
 }
 
+func (t *WebSearchTool) ConcurrencySafe() bool {
+	return true
+}
+
 func (t *WebSearchTool) Parameters() map[string]interface{} {
 	return map[string]interface{}{
 		"type": "object",
@@ -338,25 +352,45 @@ func (t *WebSearchTool) Execute(ctx context.Context, args map[string]interface{}
 	}
 }
 
+// maxFetchBytes caps the size of a fetched document.
+const maxFetchBytes = 20 << 20
+
 type WebFetchTool struct {
 	maxChars int
+	policy   *netguard.Policy // nil uses netguard.Default
+	cache    *webCache
 }
 
 func NewWebFetchTool(maxChars int) *WebFetchTool {
 	if maxChars <= 0 {
-		maxChars = 50000
+		maxChars = 20000
 	}
 	return &WebFetchTool{
 		maxChars: maxChars,
 	}
 }
 
+// SetNetworkPolicy sets the policy deciding which hosts can be fetched.
+func (t *WebFetchTool) SetNetworkPolicy(policy *netguard.Policy) {
+	t.policy = policy
+}
+
+// SetCache keeps fetched pages in dir, using up to maxBytes, so fetching
+// them again only takes a conditional request.
+func (t *WebFetchTool) SetCache(dir string, maxBytes int64) {
+	t.cache = newWebCache(dir, maxBytes)
+}
+
 func (t *WebFetchTool) Name() string {
 	return "web_fetch"
 }
 
 func (t *WebFetchTool) Description() string {
-	return "Fetch a URL and extract readable content (HTML to text). Use this to get weather info, news, articles, or any web content."
+	return "Fetch a URL and return its readable content: the main text of web pages as Markdown with headings, links, lists and tables, the text of PDFs, or JSON. Long documents are returned in parts; pass offset to read on. Use this to get weather info, news, articles, or any web content."
+}
+
+func (t *WebFetchTool) ConcurrencySafe() bool {
+	return true
 }
 
 func (t *WebFetchTool) Parameters() map[string]interface{} {
@@ -369,9 +403,14 @@ func (t *WebFetchTool) Parameters() map[string]interface{} {
 			},
 			"maxChars": map[string]interface{}{
 				"type":        "integer",
-				"description": "Maximum characters to extract",
+				"description": "Maximum characters to return",
 				"minimum":     100.0,
 			},
+			"offset": map[string]interface{}{
+				"type":        "integer",
+				"description": "Character to start from, to read the next part of a long document",
+				"minimum":     0.0,
+			},
 		},
 		"required": []string{"url"},
 	}
@@ -402,107 +441,145 @@ func (t *WebFetchTool) Execute(ctx context.Context, args map[string]interface{})
 			maxChars = int(mc)
 		}
 	}
+	offset := 0
+	if o, ok := args["offset"].(float64); ok && o > 0 {
+		offset = int(o)
+	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
-	if err != nil {
-		return ErrorResult(fmt.Sprintf("failed to create request: %v", err))
+	policy := t.policy
+	if policy == nil {
+		policy = netguard.Default()
+	}
+	if err := policy.CheckHost(parsedURL.Hostname()); err != nil {
+		return ErrorResult(fmt.Sprintf("cannot fetch %s: %v", urlStr, err))
 	}
 
-	req.Header.Set("User-Agent", userAgent)
+	page, cached, err := t.fetch(ctx, policy, urlStr)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
 
-	client := &http.Client{
-		Timeout: 60 * time.Second,
-		Transport: &http.Transport{
-			MaxIdleConns:        10,
-			IdleConnTimeout:     30 * time.Second,
-			DisableCompression:  false,
-			TLSHandshakeTimeout: 15 * time.Second,
-		},
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			if len(via) >= 5 {
-				return fmt.Errorf("stopped after 5 redirects")
-			}
-			return nil
-		},
+	text := []rune(page.Text)
+	if offset > len(text) {
+		return ErrorResult(fmt.Sprintf("offset %d is past the end of the document (%d characters)", offset, len(text)))
 	}
+	end := min(offset+maxChars, len(text))
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return ErrorResult(fmt.Sprintf("request failed: %v", err))
+	var b strings.Builder
+	fmt.Fprintf(&b, "URL: %s\n", page.URL)
+	if page.Title != "" {
+		fmt.Fprintf(&b, "Title: %s\n", page.Title)
 	}
-	defer resp.Body.Close()
+	fmt.Fprintf(&b, "Status: %d (%s, extractor: %s", page.Status, page.ContentType, page.Extractor)
+	if cached {
+		b.WriteString(", not modified since cached")
+	}
+	b.WriteString(")\n")
+	if offset > 0 || end < len(text) {
+		fmt.Fprintf(&b, "Showing characters %d-%d of %d.", offset, end, len(text))
+		if end < len(text) {
+			fmt.Fprintf(&b, " Call web_fetch with offset=%d for the next part.", end)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	b.WriteString(string(text[offset:end]))
 
-	body, err := io.ReadAll(resp.Body)
+	return SilentResult(b.String())
+}
+
+// fetch downloads urlStr and extracts its text, revalidating the cached
+// copy if there is one. It reports whether the cached copy was used.
+func (t *WebFetchTool) fetch(ctx context.Context, policy *netguard.Policy, urlStr string) (*webPage, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
 	if err != nil {
-		return ErrorResult(fmt.Sprintf("failed to read response: %v", err))
+		return nil, false, fmt.Errorf("failed to create request: %v", err)
 	}
 
-	contentType := resp.Header.Get("Content-Type")
-
-	var text, extractor string
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/pdf,application/json,text/plain;q=0.9,*/*;q=0.8")
+	cached := t.cache.get(urlStr)
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
 
-	if strings.Contains(contentType, "application/json") {
-		var jsonData interface{}
-		if err := json.Unmarshal(body, &jsonData); err == nil {
-			formatted, _ := json.MarshalIndent(jsonData, "", "  ")
-			text = string(formatted)
-			extractor = "json"
-		} else {
-			text = string(body)
-			extractor = "raw"
+	// The policy also checks the addresses of redirects when connecting.
+	client := policy.Client(60 * time.Second)
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return fmt.Errorf("stopped after 5 redirects")
 		}
-	} else if strings.Contains(contentType, "text/html") || len(body) > 0 &&
-		(strings.HasPrefix(string(body), "<!DOCTYPE") || strings.HasPrefix(strings.ToLower(string(body)), "<html")) {
-		text = t.extractText(string(body))
-		extractor = "text"
-	} else {
-		text = string(body)
-		extractor = "raw"
+		return nil
 	}
 
-	truncated := len(text) > maxChars
-	if truncated {
-		text = text[:maxChars]
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("request failed: %v", err)
 	}
+	defer resp.Body.Close()
 
-	result := map[string]interface{}{
-		"url":       urlStr,
-		"status":    resp.StatusCode,
-		"extractor": extractor,
-		"truncated": truncated,
-		"length":    len(text),
-		"text":      text,
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return cached, true, nil
 	}
 
-	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchBytes))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read response: %v", err)
+	}
 
-	return &ToolResult{
-		ForLLM:  fmt.Sprintf("Fetched %d bytes from %s (extractor: %s, truncated: %v)", len(text), urlStr, extractor, truncated),
-		ForUser: string(resultJSON),
+	page := &webPage{
+		URL:          resp.Request.URL.String(),
+		Status:       resp.StatusCode,
+		ContentType:  resp.Header.Get("Content-Type"),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now(),
+	}
+	page.Title, page.Text, page.Extractor, err = extractContent(body, page.ContentType, resp.Request.URL)
+	if err != nil {
+		return nil, false, err
 	}
+	if resp.StatusCode == http.StatusOK {
+		t.cache.put(urlStr, page)
+	}
+	return page, false, nil
 }
 
-func (t *WebFetchTool) extractText(htmlContent string) string {
-	re := regexp.MustCompile(`<script[\s\S]*?</script>`)
-	result := re.ReplaceAllLiteralString(htmlContent, "")
-	re = regexp.MustCompile(`<style[\s\S]*?</style>`)
-	result = re.ReplaceAllLiteralString(result, "")
-	re = regexp.MustCompile(`<[^>]+>`)
-	result = re.ReplaceAllLiteralString(result, "")
-
-	result = strings.TrimSpace(result)
-
-	re = regexp.MustCompile(`\s+`)
-	result = re.ReplaceAllLiteralString(result, " ")
-
-	lines := strings.Split(result, "\n")
-	var cleanLines []string
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line != "" {
-			cleanLines = append(cleanLines, line)
+// extractContent returns the title and text of a fetched document and the
+// name of the extractor used.
+func extractContent(body []byte, contentType string, base *url.URL) (title, text, extractor string, err error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	start := strings.ToLower(strings.TrimSpace(string(body[:min(len(body), 512)])))
+
+	switch {
+	case mediaType == "application/pdf" || bytes.HasPrefix(body, []byte("%PDF-")):
+		text, err := extractPDFText(body)
+		if err != nil {
+			return "", "", "", fmt.Errorf("failed to read PDF: %v", err)
 		}
+		return "", text, "pdf", nil
+	case strings.Contains(mediaType, "json"):
+		var jsonData interface{}
+		if err := json.Unmarshal(body, &jsonData); err == nil {
+			formatted, _ := json.MarshalIndent(jsonData, "", "  ")
+			return "", string(formatted), "json", nil
+		}
+		return "", string(body), "raw", nil
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml" ||
+		strings.HasPrefix(start, "<!doctype html") || strings.HasPrefix(start, "<html"):
+		title, markdown, err := extractArticle(string(body), base)
+		if err != nil {
+			return "", "", "", fmt.Errorf("failed to parse HTML: %v", err)
+		}
+		return title, markdown, "readability", nil
+	case strings.HasPrefix(mediaType, "text/") || strings.Contains(mediaType, "xml") ||
+		strings.Contains(mediaType, "javascript") || utf8.Valid(body):
+		return "", string(body), "raw", nil
 	}
-
-	return strings.Join(cleanLines, "\n")
+	return "", "", "", fmt.Errorf("cannot extract text from %s content", mediaType)
 }
@@ -0,0 +1,138 @@
+package tools
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// webPage is a fetched document after text extraction.
+type webPage struct {
+	URL          string    `json:"url"` // after redirects
+	Status       int       `json:"status"`
+	ContentType  string    `json:"content_type"`
+	Title        string    `json:"title,omitempty"`
+	Extractor    string    `json:"extractor"`
+	Text         string    `json:"text"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+// webCache keeps extracted pages on disk with their ETag and Last-Modified
+// headers, so fetching a page again, for example to read its next part,
+// only takes a conditional request. A nil *webCache caches nothing.
+type webCache struct {
+	dir      string
+	maxBytes int64
+	mu       sync.Mutex
+}
+
+func newWebCache(dir string, maxBytes int64) *webCache {
+	return &webCache{dir: dir, maxBytes: maxBytes}
+}
+
+func (c *webCache) path(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+// get returns the cached page fetched from rawURL, or nil.
+func (c *webCache) get(rawURL string) *webPage {
+	if c == nil {
+		return nil
+	}
+	data, err := os.ReadFile(c.path(rawURL))
+	if err != nil {
+		return nil
+	}
+	var page webPage
+	if err := json.Unmarshal(data, &page); err != nil {
+		return nil
+	}
+	now := time.Now()
+	_ = os.Chtimes(c.path(rawURL), now, now) // pruning removes the least recently used first
+	return &page
+}
+
+// put caches page under rawURL if the server sent validators for it.
+func (c *webCache) put(rawURL string, page *webPage) {
+	if c == nil || (page.ETag == "" && page.LastModified == "") {
+		return
+	}
+	data, err := json.Marshal(page)
+	if err != nil || int64(len(data)) > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		logger.WarnCF("tool", "Failed to create web cache directory",
+			map[string]interface{}{
+				"error": err.Error(),
+			})
+		return
+	}
+	tmpFile, err := os.CreateTemp(c.dir, "page-*.tmp")
+	if err != nil {
+		return
+	}
+	tmpPath := tmpFile.Name()
+	_, err = tmpFile.Write(data)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, c.path(rawURL))
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return
+	}
+	c.prune()
+}
+
+// prune removes the least recently used pages until the cache fits in
+// maxBytes.
+func (c *webCache) prune() {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	type cached struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []cached
+	var total int64
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, cached{filepath.Join(c.dir, entry.Name()), info.Size(), info.ModTime()})
+		total += info.Size()
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, f := range files {
+		if total <= c.maxBytes {
+			break
+		}
+		if os.Remove(f.path) == nil {
+			total -= f.size
+		}
+	}
+}
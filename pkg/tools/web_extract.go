@@ -0,0 +1,560 @@
+package tools
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	// unlikelyContent matches the class and id of page chrome: navigation,
+	// cookie banners, sharing buttons, comments and the like.
+	unlikelyContent = regexp.MustCompile(`(?i)\b(?:banner|breadcrumbs?|combx|comments?|community|consent|cookies?|disqus|footer|gdpr|header|menu|modal|nav|navbar|newsletter|pagination|popup|promo|related|remark|rss|share|sharing|shoutbox|sidebar|skip|social|sponsor|subscribe|tags|toolbar|widget|ad-break|advert\w*|ads)\b`)
+	// likelyContent matches the class and id of article bodies.
+	likelyContent = regexp.MustCompile(`(?i)\b(?:article|body|content|entry|h-entry|main|page|post|story|text|blog)\b`)
+	whitespace    = regexp.MustCompile(`\s+`)
+	blankLines    = regexp.MustCompile(`\n{3,}`)
+)
+
+// removedTags never hold readable content.
+var removedTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Iframe: true, atom.Svg: true, atom.Canvas: true, atom.Form: true,
+	atom.Button: true, atom.Input: true, atom.Select: true, atom.Textarea: true,
+	atom.Nav: true, atom.Footer: true, atom.Aside: true, atom.Dialog: true,
+	atom.Object: true, atom.Embed: true, atom.Link: true, atom.Meta: true,
+}
+
+// removedRoles are ARIA landmarks of page chrome.
+var removedRoles = map[string]bool{
+	"navigation": true, "banner": true, "contentinfo": true, "complementary": true,
+	"dialog": true, "alertdialog": true, "search": true, "menu": true, "menubar": true,
+}
+
+var blockTags = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Aside: true, atom.Blockquote: true,
+	atom.Center: true, atom.Details: true, atom.Dialog: true, atom.Dd: true,
+	atom.Div: true, atom.Dl: true, atom.Dt: true, atom.Fieldset: true,
+	atom.Figcaption: true, atom.Figure: true, atom.Footer: true, atom.Form: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Header: true, atom.Hr: true, atom.Li: true, atom.Main: true, atom.Nav: true,
+	atom.Ol: true, atom.P: true, atom.Pre: true, atom.Section: true, atom.Summary: true,
+	atom.Table: true, atom.Ul: true, atom.Body: true, atom.Html: true,
+}
+
+// extractArticle parses an HTML page and returns its title and the main
+// content as Markdown, leaving out navigation, banners, footers and other
+// page chrome. base resolves relative links.
+func extractArticle(page string, base *url.URL) (title, markdown string, err error) {
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		return "", "", err
+	}
+
+	title = pageTitle(doc)
+	body := findElement(doc, atom.Body)
+	if body == nil {
+		body = doc
+	}
+	pruneChrome(body, false)
+
+	root := mainContent(body)
+	markdown = renderMarkdown(root, base)
+	if len(markdown) < 200 && root != body {
+		markdown = renderMarkdown(body, base)
+	}
+	return title, markdown, nil
+}
+
+// pageTitle returns the og:title of the page, or its <title>.
+func pageTitle(doc *html.Node) string {
+	var title, ogTitle string
+	walk(doc, func(n *html.Node) bool {
+		switch n.DataAtom {
+		case atom.Title:
+			if title == "" {
+				title = collapseSpace(textContent(n))
+			}
+		case atom.Meta:
+			if attr(n, "property") == "og:title" && ogTitle == "" {
+				ogTitle = collapseSpace(attr(n, "content"))
+			}
+		}
+		return true
+	})
+	if ogTitle != "" {
+		return strings.TrimSpace(ogTitle)
+	}
+	return strings.TrimSpace(title)
+}
+
+// pruneChrome removes the elements under n that hold page chrome rather
+// than content. Headers are kept inside articles, where they hold the
+// article's title.
+func pruneChrome(n *html.Node, inArticle bool) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.Type == html.CommentNode:
+			n.RemoveChild(c)
+		case c.Type == html.ElementNode && isChrome(c, inArticle):
+			n.RemoveChild(c)
+		case c.Type == html.ElementNode:
+			pruneChrome(c, inArticle || c.DataAtom == atom.Article || c.DataAtom == atom.Main)
+		}
+		c = next
+	}
+}
+
+func isChrome(n *html.Node, inArticle bool) bool {
+	if removedTags[n.DataAtom] || removedRoles[attr(n, "role")] {
+		return true
+	}
+	if n.DataAtom == atom.Header && !inArticle {
+		return true
+	}
+	if hasAttr(n, "hidden") || attr(n, "aria-hidden") == "true" ||
+		strings.Contains(strings.ReplaceAll(attr(n, "style"), " ", ""), "display:none") {
+		return true
+	}
+	// Only containers are judged by their class; links and headings
+	// styled as "header" are content.
+	switch n.DataAtom {
+	case atom.Body, atom.Article, atom.Main, atom.Table, atom.Pre,
+		atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		return false
+	}
+	if !blockTags[n.DataAtom] {
+		return false
+	}
+	names := attr(n, "class") + " " + attr(n, "id")
+	return unlikelyContent.MatchString(names) && !likelyContent.MatchString(names)
+}
+
+// mainContent returns the element holding the main content of the page:
+// its only <article> or <main>, or else the element whose paragraphs
+// score highest, the way readability does.
+func mainContent(body *html.Node) *html.Node {
+	var landmarks []*html.Node
+	walk(body, func(n *html.Node) bool {
+		if n.DataAtom == atom.Article || n.DataAtom == atom.Main || attr(n, "role") == "main" {
+			landmarks = append(landmarks, n)
+			return false
+		}
+		return true
+	})
+	if len(landmarks) == 1 && len(collapseSpace(textContent(landmarks[0]))) >= 200 {
+		return landmarks[0]
+	}
+
+	scores := make(map[*html.Node]float64)
+	var candidates []*html.Node
+	addScore := func(n *html.Node, score float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			scores[n] = initialScore(n)
+			candidates = append(candidates, n)
+		}
+		scores[n] += score
+	}
+	walk(body, func(n *html.Node) bool {
+		switch n.DataAtom {
+		case atom.P, atom.Pre, atom.Td, atom.Blockquote:
+		default:
+			return true
+		}
+		text := collapseSpace(textContent(n))
+		if len(text) < 25 {
+			return false
+		}
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text))/100, 3)
+		addScore(n.Parent, score)
+		if n.Parent != nil {
+			addScore(n.Parent.Parent, score/2)
+		}
+		return false
+	})
+
+	best, bestScore := body, 0.0
+	for _, n := range candidates {
+		score := scores[n] * (1 - linkDensity(n))
+		if score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	return best
+}
+
+func initialScore(n *html.Node) float64 {
+	var score float64
+	switch n.DataAtom {
+	case atom.Div, atom.Article, atom.Main, atom.Section:
+		score = 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		score = 3
+	case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li, atom.Form:
+		score = -3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		score = -5
+	}
+	names := attr(n, "class") + " " + attr(n, "id")
+	if likelyContent.MatchString(names) {
+		score += 25
+	}
+	if unlikelyContent.MatchString(names) {
+		score -= 25
+	}
+	return score
+}
+
+// linkDensity returns the share of the text of n inside links.
+func linkDensity(n *html.Node) float64 {
+	total := len(collapseSpace(textContent(n)))
+	if total == 0 {
+		return 0
+	}
+	var links int
+	walk(n, func(c *html.Node) bool {
+		if c.DataAtom == atom.A {
+			links += len(collapseSpace(textContent(c)))
+			return false
+		}
+		return true
+	})
+	return float64(links) / float64(total)
+}
+
+// renderMarkdown renders n as Markdown, keeping headings, links, lists,
+// tables, quotes and code.
+func renderMarkdown(n *html.Node, base *url.URL) string {
+	r := &markdownRenderer{base: base}
+	md := blankLines.ReplaceAllString(r.blocks(n), "\n\n")
+	return strings.TrimSpace(md)
+}
+
+type markdownRenderer struct {
+	base *url.URL
+}
+
+// blocks renders the children of n as blocks separated by blank lines.
+func (r *markdownRenderer) blocks(n *html.Node) string {
+	var blocks []string
+	var inline strings.Builder
+	flush := func() {
+		if text := trimLines(inline.String()); text != "" {
+			blocks = append(blocks, text)
+		}
+		inline.Reset()
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && blockTags[c.DataAtom] {
+			flush()
+			if block := r.block(c); block != "" {
+				blocks = append(blocks, block)
+			}
+			continue
+		}
+		inline.WriteString(r.inline(c))
+	}
+	flush()
+	return strings.Join(blocks, "\n\n")
+}
+
+func (r *markdownRenderer) block(n *html.Node) string {
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		text := r.inlineText(n)
+		if text == "" {
+			return ""
+		}
+		level := int(n.Data[1] - '0')
+		return strings.Repeat("#", level) + " " + text
+	case atom.Ul, atom.Ol:
+		return r.list(n)
+	case atom.Blockquote:
+		text := r.blocks(n)
+		if text == "" {
+			return ""
+		}
+		return "> " + strings.ReplaceAll(text, "\n", "\n> ")
+	case atom.Pre:
+		code := strings.Trim(textContent(n), "\n")
+		if strings.TrimSpace(code) == "" {
+			return ""
+		}
+		return "```" + codeLanguage(n) + "\n" + code + "\n```"
+	case atom.Table:
+		return r.table(n)
+	case atom.Hr:
+		return "---"
+	}
+	return r.blocks(n)
+}
+
+// list renders a list, indenting the lines of each item under its marker.
+func (r *markdownRenderer) list(n *html.Node) string {
+	var items []string
+	number := 1
+	if start, err := strconv.Atoi(attr(n, "start")); err == nil {
+		number = start
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		content := r.blocks(c)
+		if c.DataAtom != atom.Li {
+			content = r.block(c)
+		}
+		if content == "" {
+			continue
+		}
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = strconv.Itoa(number) + ". "
+			number++
+		}
+		content = strings.ReplaceAll(content, "\n\n", "\n")
+		indent := "\n" + strings.Repeat(" ", len(marker))
+		items = append(items, marker+strings.ReplaceAll(content, "\n", indent))
+	}
+	return strings.Join(items, "\n")
+}
+
+// table renders a table as a Markdown table. Layout tables with a single
+// column are rendered as their cells' content instead.
+func (r *markdownRenderer) table(n *html.Node) string {
+	var rows [][]string
+	columns := 0
+	walk(n, func(c *html.Node) bool {
+		if c != n && c.DataAtom == atom.Table {
+			return false
+		}
+		if c.DataAtom != atom.Tr {
+			return true
+		}
+		var row []string
+		for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+			if cell.DataAtom == atom.Td || cell.DataAtom == atom.Th {
+				text := strings.ReplaceAll(r.inlineText(cell), "|", `\|`)
+				row = append(row, strings.ReplaceAll(text, "\n", " "))
+			}
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+			columns = max(columns, len(row))
+		}
+		return false
+	})
+	if len(rows) == 0 {
+		return ""
+	}
+	if columns == 1 {
+		var blocks []string
+		walk(n, func(c *html.Node) bool {
+			if c.DataAtom == atom.Td || c.DataAtom == atom.Th {
+				if text := r.blocks(c); text != "" {
+					blocks = append(blocks, text)
+				}
+				return false
+			}
+			return true
+		})
+		return strings.Join(blocks, "\n\n")
+	}
+
+	var b strings.Builder
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			b.WriteString("|" + strings.Repeat(" --- |", columns) + "\n")
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// inlineText renders the content of n on one line.
+func (r *markdownRenderer) inlineText(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(r.inline(c))
+	}
+	return collapseSpace(b.String())
+}
+
+func (r *markdownRenderer) inline(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return whitespace.ReplaceAllString(n.Data, " ")
+	}
+	if n.Type != html.ElementNode {
+		return ""
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		return "\n"
+	case atom.Img:
+		alt := collapseSpace(attr(n, "alt"))
+		if alt == "" {
+			return ""
+		}
+		if src := r.resolve(attr(n, "src")); src != "" {
+			return "![" + alt + "](" + src + ")"
+		}
+		return alt
+	case atom.Code, atom.Kbd, atom.Samp, atom.Tt:
+		if text := strings.TrimSpace(textContent(n)); text != "" {
+			return "`" + whitespace.ReplaceAllString(text, " ") + "`"
+		}
+		return ""
+	}
+
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(r.inline(c))
+	}
+	text := b.String()
+	if blockTags[n.DataAtom] {
+		return " " + text + " "
+	}
+
+	switch n.DataAtom {
+	case atom.A:
+		href := r.resolve(attr(n, "href"))
+		if href == "" || strings.TrimSpace(text) == "" {
+			return text
+		}
+		return wrapInline(text, "[", "]("+href+")")
+	case atom.Strong, atom.B:
+		return wrapInline(text, "**", "**")
+	case atom.Em, atom.I:
+		return wrapInline(text, "_", "_")
+	case atom.Del, atom.S, atom.Strike:
+		return wrapInline(text, "~~", "~~")
+	}
+	return text
+}
+
+// resolve returns href as an absolute URL, or "" for links that lead
+// nowhere outside the page.
+func (r *markdownRenderer) resolve(href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return ""
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	if r.base != nil {
+		u = r.base.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "mailto" {
+		return ""
+	}
+	return u.String()
+}
+
+// wrapInline wraps text in Markdown markup, keeping the surrounding
+// whitespace outside of it.
+func wrapInline(text, open, close string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	start := strings.Index(text, trimmed)
+	return text[:start] + open + trimmed + close + text[start+len(trimmed):]
+}
+
+func codeLanguage(pre *html.Node) string {
+	for _, n := range []*html.Node{pre, pre.FirstChild} {
+		if n == nil || n.Type != html.ElementNode {
+			continue
+		}
+		for _, class := range strings.Fields(attr(n, "class")) {
+			if lang, ok := strings.CutPrefix(class, "language-"); ok {
+				return lang
+			}
+			if lang, ok := strings.CutPrefix(class, "lang-"); ok {
+				return lang
+			}
+		}
+	}
+	return ""
+}
+
+// trimLines trims the lines of inline content and drops empty ones.
+func trimLines(text string) string {
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+func collapseSpace(text string) string {
+	return strings.TrimSpace(whitespace.ReplaceAllString(text, " "))
+}
+
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	walk(n, func(c *html.Node) bool {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+		return true
+	})
+	return b.String()
+}
+
+// walk calls visit for n and its descendants in document order, skipping
+// the descendants of nodes for which visit returns false.
+func walk(n *html.Node, visit func(*html.Node) bool) {
+	if !visit(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, visit)
+	}
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	var found *html.Node
+	walk(n, func(c *html.Node) bool {
+		if found == nil && c.DataAtom == a {
+			found = c
+		}
+		return found == nil
+	})
+	return found
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package tools
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestExtractArticle(t *testing.T) {
+	page := `<!DOCTYPE html><html><head><title>Ignored</title>
+<meta property="og:title" content="Growing Tomatoes"></head><body>
+<header><a href="/">Home</a> <a href="/blog">Blog</a></header>
+<nav class="menu"><ul><li><a href="/a">A</a></li><li><a href="/b">B</a></li></ul></nav>
+<div id="cookie-banner">We use cookies. <button>Accept</button></div>
+<div class="post-content">
+  <h1>Growing Tomatoes</h1>
+  <p>Tomatoes need <strong>full sun</strong>, warm soil, and steady water, so plant them after the last frost.
+  See the <a href="/guides/soil">soil guide</a> for details.</p>
+  <h2>What you need</h2>
+  <ul><li>Seedlings</li><li>Stakes, or <em>cages</em><ul><li>Metal lasts longer</li></ul></li></ul>
+  <ol start="3"><li>Dig</li><li>Plant</li></ol>
+  <table><tr><th>Variety</th><th>Days</th></tr><tr><td>Roma</td><td>75</td></tr><tr><td>Cherry | small</td><td>60</td></tr></table>
+  <pre><code class="language-sh">water --daily
+  --deep</code></pre>
+  <blockquote><p>Water the roots, not the leaves.</p></blockquote>
+</div>
+<aside>Related posts</aside>
+<footer>Copyright, Privacy, Terms</footer>
+<script>track()</script>
+</body></html>`
+
+	base, _ := url.Parse("https://garden.example/blog/tomatoes")
+	title, markdown, err := extractArticle(page, base)
+	if err != nil {
+		t.Fatalf("extractArticle() error: %v", err)
+	}
+	if title != "Growing Tomatoes" {
+		t.Errorf("title = %q, want the og:title", title)
+	}
+
+	for _, want := range []string{
+		"# Growing Tomatoes",
+		"## What you need",
+		"Tomatoes need **full sun**, warm soil",
+		"[soil guide](https://garden.example/guides/soil)",
+		"- Seedlings\n- Stakes, or _cages_\n  - Metal lasts longer",
+		"3. Dig\n4. Plant",
+		"| Variety | Days |\n| --- | --- |\n| Roma | 75 |\n| Cherry \\| small | 60 |",
+		"```sh\nwater --daily\n  --deep\n```",
+		"> Water the roots, not the leaves.",
+	} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("markdown lacks %q:\n%s", want, markdown)
+		}
+	}
+	for _, chrome := range []string{"cookies", "Accept", "Home", "Related", "Copyright", "track"} {
+		if strings.Contains(markdown, chrome) {
+			t.Errorf("markdown contains page chrome %q:\n%s", chrome, markdown)
+		}
+	}
+}
+
+// testPDF builds a one-page PDF whose compressed content stream draws text
+// in a font with a ToUnicode map, and in one without.
+func testPDF(t *testing.T) []byte {
+	t.Helper()
+	var content bytes.Buffer
+	zw := zlib.NewWriter(&content)
+	fmt.Fprint(zw, "BT /F1 12 Tf 72 720 Td <00010002> Tj [-300 <0003>] TJ 0 -14 Td /F2 12 Tf (Second \\(line\\)) Tj ET")
+	zw.Close()
+
+	cmap := "begincmap\n2 beginbfchar\n<0001> <0048>\n<0002> <0069>\nendbfchar\n1 beginbfrange\n<0003> <0003> <00500044>\nendbfrange\nendcmap"
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	fmt.Fprint(&pdf, "1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n")
+	fmt.Fprint(&pdf, "2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 /Resources << /Font << /F1 5 0 R /F2 7 0 R >> >> >> endobj\n")
+	fmt.Fprint(&pdf, "3 0 obj << /Type /Page /Parent 2 0 R /Contents 4 0 R >> endobj\n")
+	fmt.Fprintf(&pdf, "4 0 obj << /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream\nendobj\n", content.Len(), content.Bytes())
+	fmt.Fprint(&pdf, "5 0 obj << /Type /Font /Subtype /Type0 /ToUnicode 6 0 R >> endobj\n")
+	fmt.Fprintf(&pdf, "6 0 obj << /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(cmap), cmap)
+	fmt.Fprint(&pdf, "7 0 obj << /Type /Font /Subtype /Type1 /BaseFont /Helvetica >> endobj\n")
+	pdf.WriteString("trailer << /Root 1 0 R >>\n%%EOF\n")
+	return pdf.Bytes()
+}
+
+func TestExtractPDFText(t *testing.T) {
+	text, err := extractPDFText(testPDF(t))
+	if err != nil {
+		t.Fatalf("extractPDFText() error: %v", err)
+	}
+	if want := "Hi PD\nSecond (line)"; text != want {
+		t.Errorf("extractPDFText() = %q, want %q", text, want)
+	}
+
+	if _, err := extractPDFText([]byte("<html></html>")); err == nil {
+		t.Error("extractPDFText() of HTML should fail")
+	}
+}
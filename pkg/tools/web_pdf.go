@@ -0,0 +1,722 @@
+package tools
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+var (
+	pdfObjectStart = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+	pdfReference   = regexp.MustCompile(`^(\d+)\s+\d+\s+R`)
+	pdfNamedRef    = regexp.MustCompile(`/([^\s/<>\[\]()]+)\s+(\d+)\s+\d+\s+R`)
+	pdfReferences  = regexp.MustCompile(`(\d+)\s+\d+\s+R`)
+	pdfTypePage    = regexp.MustCompile(`/Type\s*/Page\b`)
+	pdfTypePages   = regexp.MustCompile(`/Type\s*/Pages\b`)
+	pdfCMapHex     = regexp.MustCompile(`<([0-9A-Fa-f]*)>`)
+)
+
+// maxPDFStream caps the decompressed size of one PDF stream.
+const maxPDFStream = 32 << 20
+
+type pdfObject struct {
+	dict   string
+	stream []byte // decoded; nil if absent or in an unsupported encoding
+}
+
+type pdfCMap struct {
+	width int // bytes per character code
+	chars map[uint32]string
+}
+
+// extractPDFText returns the text of a PDF, page by page. It reads text
+// drawn by uncompressed and Flate-compressed content streams, mapping
+// character codes through the fonts' ToUnicode tables where they have one.
+// Scanned pages have no text to extract and encrypted files are refused.
+func extractPDFText(data []byte) (string, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return "", errors.New("not a PDF file")
+	}
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return "", errors.New("the PDF is encrypted")
+	}
+
+	objects := parsePDFObjects(data)
+	var pages []string
+	cmaps := make(map[int]*pdfCMap)
+	for _, num := range pdfPages(objects) {
+		page := objects[num]
+		fonts := pdfFonts(objects, page, cmaps)
+		var content []byte
+		for _, ref := range pdfReferences.FindAllStringSubmatch(pdfValue(page.dict, "/Contents"), -1) {
+			n, _ := strconv.Atoi(ref[1])
+			if obj, ok := objects[n]; ok && obj.stream != nil {
+				content = append(append(content, obj.stream...), '\n')
+			} else if ok {
+				// An array of content streams held in another object
+				for _, inner := range pdfReferences.FindAllStringSubmatch(obj.dict, -1) {
+					m, _ := strconv.Atoi(inner[1])
+					if stream, ok := objects[m]; ok {
+						content = append(append(content, stream.stream...), '\n')
+					}
+				}
+			}
+		}
+		if text := strings.TrimSpace(pdfContentText(content, fonts)); text != "" {
+			pages = append(pages, text)
+		}
+	}
+
+	if len(pages) == 0 {
+		return "", errors.New("the PDF has no extractable text (it may be scanned)")
+	}
+	return strings.Join(pages, "\n\n"), nil
+}
+
+// parsePDFObjects reads the objects of a PDF, including those packed in
+// object streams, by scanning for "N G obj" rather than trusting the
+// cross-reference table.
+func parsePDFObjects(data []byte) map[int]*pdfObject {
+	objects := make(map[int]*pdfObject)
+	starts := pdfObjectStart.FindAllSubmatchIndex(data, -1)
+	for i, m := range starts {
+		num, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+		end := len(data)
+		if i+1 < len(starts) {
+			end = starts[i+1][0]
+		}
+		body := data[m[1]:end]
+		if idx := bytes.Index(body, []byte("endobj")); idx >= 0 && !bytes.Contains(body[:idx], []byte("stream")) {
+			body = body[:idx]
+		}
+
+		obj := &pdfObject{dict: string(body)}
+		if idx := bytes.Index(body, []byte("stream")); idx >= 0 {
+			obj.dict = string(body[:idx])
+			raw := body[idx+len("stream"):]
+			raw = bytes.TrimPrefix(bytes.TrimPrefix(raw, []byte("\r")), []byte("\n"))
+			if length, err := strconv.Atoi(pdfValue(obj.dict, "/Length")); err == nil && length >= 0 && length <= len(raw) {
+				raw = raw[:length]
+			} else if end := bytes.LastIndex(raw, []byte("endstream")); end >= 0 {
+				raw = raw[:end]
+			}
+			obj.stream = decodePDFStream(obj.dict, raw)
+		}
+		objects[num] = obj
+	}
+
+	// Object streams pack dictionaries, such as fonts and pages, of PDF 1.5+.
+	for _, obj := range objects {
+		if !strings.Contains(obj.dict, "/ObjStm") || obj.stream == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(pdfValue(obj.dict, "/N"))
+		first, _ := strconv.Atoi(pdfValue(obj.dict, "/First"))
+		if first <= 0 || first > len(obj.stream) {
+			continue
+		}
+		header := strings.Fields(string(obj.stream[:first]))
+		for i := 0; i+1 < len(header) && i/2 < n; i += 2 {
+			num, err1 := strconv.Atoi(header[i])
+			offset, err2 := strconv.Atoi(header[i+1])
+			if err1 != nil || err2 != nil || first+offset > len(obj.stream) {
+				continue
+			}
+			end := len(obj.stream)
+			if i+3 < len(header) {
+				if next, err := strconv.Atoi(header[i+3]); err == nil && first+next <= end && next >= offset {
+					end = first + next
+				}
+			}
+			if _, exists := objects[num]; !exists {
+				objects[num] = &pdfObject{dict: string(obj.stream[first+offset : end])}
+			}
+		}
+	}
+	return objects
+}
+
+// decodePDFStream returns the decoded stream data, or nil for filters
+// other than FlateDecode, such as images.
+func decodePDFStream(dict string, raw []byte) []byte {
+	filter := pdfValue(dict, "/Filter")
+	switch strings.Trim(filter, "[] \r\n") {
+	case "":
+		return raw
+	case "/FlateDecode", "/Fl":
+		zr, err := zlib.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil
+		}
+		defer zr.Close()
+		// Truncated streams still yield the text before the damage.
+		decoded, _ := io.ReadAll(io.LimitReader(zr, maxPDFStream))
+		return decoded
+	}
+	return nil
+}
+
+// pdfPages returns the page objects in reading order, following the page
+// tree from its root, or in object order if there is no usable tree.
+func pdfPages(objects map[int]*pdfObject) []int {
+	var pages []int
+	visited := make(map[int]bool)
+	var visit func(num int)
+	visit = func(num int) {
+		obj, ok := objects[num]
+		if !ok || visited[num] {
+			return
+		}
+		visited[num] = true
+		if pdfTypePage.MatchString(obj.dict) {
+			pages = append(pages, num)
+			return
+		}
+		for _, ref := range pdfReferences.FindAllStringSubmatch(pdfValue(obj.dict, "/Kids"), -1) {
+			kid, _ := strconv.Atoi(ref[1])
+			visit(kid)
+		}
+	}
+	for num, obj := range objects {
+		if pdfTypePages.MatchString(obj.dict) && pdfValue(obj.dict, "/Parent") == "" {
+			visit(num)
+			break
+		}
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+
+	for num, obj := range objects {
+		if pdfTypePage.MatchString(obj.dict) {
+			pages = append(pages, num)
+		}
+	}
+	sort.Ints(pages)
+	return pages
+}
+
+// pdfFonts returns the ToUnicode maps of the fonts in the resources of a
+// page by resource name. Pages inherit resources from the page tree.
+func pdfFonts(objects map[int]*pdfObject, page *pdfObject, cmaps map[int]*pdfCMap) map[string]*pdfCMap {
+	var resources string
+	for obj, depth := page, 0; obj != nil && depth < 32; depth++ {
+		if resources = pdfResolve(objects, pdfValue(obj.dict, "/Resources")); resources != "" {
+			break
+		}
+		obj = pdfObjectAt(objects, pdfValue(obj.dict, "/Parent"))
+	}
+
+	fonts := make(map[string]*pdfCMap)
+	fontDict := pdfResolve(objects, pdfValue(resources, "/Font"))
+	for _, ref := range pdfNamedRef.FindAllStringSubmatch(fontDict, -1) {
+		num, _ := strconv.Atoi(ref[2])
+		font, ok := objects[num]
+		if !ok {
+			continue
+		}
+		toUnicode := pdfReference.FindStringSubmatch(pdfValue(font.dict, "/ToUnicode"))
+		if toUnicode == nil {
+			continue
+		}
+		cmapNum, _ := strconv.Atoi(toUnicode[1])
+		if _, done := cmaps[cmapNum]; !done {
+			cmaps[cmapNum] = nil
+			if obj, ok := objects[cmapNum]; ok && obj.stream != nil {
+				cmaps[cmapNum] = parseToUnicode(string(obj.stream))
+			}
+		}
+		fonts[ref[1]] = cmaps[cmapNum]
+	}
+	return fonts
+}
+
+// parseToUnicode reads the bfchar and bfrange mappings of a ToUnicode
+// CMap.
+func parseToUnicode(cmap string) *pdfCMap {
+	m := &pdfCMap{width: 1, chars: make(map[uint32]string)}
+	setWidth := func(hex string) {
+		if len(hex) >= 4 {
+			m.width = len(hex) / 2
+		}
+	}
+
+	for _, section := range pdfSections(cmap, "beginbfchar", "endbfchar") {
+		hexes := pdfCMapHex.FindAllStringSubmatch(section, -1)
+		for i := 0; i+1 < len(hexes); i += 2 {
+			setWidth(hexes[i][1])
+			m.chars[parseHexCode(hexes[i][1])] = decodeUTF16Hex(hexes[i+1][1])
+		}
+	}
+
+	for _, section := range pdfSections(cmap, "beginbfrange", "endbfrange") {
+		for _, line := range strings.Split(section, "\n") {
+			hexes := pdfCMapHex.FindAllStringSubmatch(line, -1)
+			if len(hexes) < 3 {
+				continue
+			}
+			setWidth(hexes[0][1])
+			lo, hi := parseHexCode(hexes[0][1]), parseHexCode(hexes[1][1])
+			if hi < lo || hi-lo > 0xFFFF {
+				continue
+			}
+			if strings.Contains(line, "[") {
+				// <lo> <hi> [<dst> <dst> ...] lists each destination
+				for i, h := range hexes[2:] {
+					m.chars[lo+uint32(i)] = decodeUTF16Hex(h[1])
+				}
+				continue
+			}
+			dst := []rune(decodeUTF16Hex(hexes[2][1]))
+			if len(dst) == 0 {
+				continue
+			}
+			for code := lo; code <= hi; code++ {
+				last := dst[len(dst)-1] + rune(code-lo)
+				m.chars[code] = string(dst[:len(dst)-1]) + string(last)
+			}
+		}
+	}
+	return m
+}
+
+func (m *pdfCMap) decode(s []byte) string {
+	var b strings.Builder
+	for i := 0; i+m.width <= len(s); i += m.width {
+		var code uint32
+		for _, c := range s[i : i+m.width] {
+			code = code<<8 | uint32(c)
+		}
+		if text, ok := m.chars[code]; ok {
+			b.WriteString(text)
+		} else if m.width == 1 {
+			b.WriteRune(rune(code))
+		}
+	}
+	return b.String()
+}
+
+// pdfContentText runs the text operators of a page's content stream and
+// returns the text they draw, starting a new line where the text moves
+// down.
+func pdfContentText(content []byte, fonts map[string]*pdfCMap) string {
+	var b strings.Builder
+	var font *pdfCMap
+	var operands []pdfToken
+	var arrayStart []int
+	lastY, haveY := 0.0, false
+
+	write := func(s []byte) {
+		if font != nil {
+			b.WriteString(font.decode(s))
+		} else {
+			b.WriteString(decodePDFString(s))
+		}
+	}
+	space := func() {
+		if text := b.String(); text != "" && !strings.HasSuffix(text, " ") && !strings.HasSuffix(text, "\n") {
+			b.WriteByte(' ')
+		}
+	}
+	newline := func() {
+		if text := b.String(); text != "" && !strings.HasSuffix(text, "\n") {
+			b.WriteByte('\n')
+		}
+	}
+	number := func(i int) float64 {
+		if i < 0 || i >= len(operands) {
+			return 0
+		}
+		return operands[i].number
+	}
+
+	lex := &pdfLexer{data: content}
+	for {
+		tok, ok := lex.next()
+		if !ok {
+			break
+		}
+		switch tok.kind {
+		case pdfArrayStart:
+			arrayStart = append(arrayStart, len(operands))
+			continue
+		case pdfArrayEnd:
+			if n := len(arrayStart); n > 0 {
+				start := arrayStart[n-1]
+				arrayStart = arrayStart[:n-1]
+				items := append([]pdfToken(nil), operands[start:]...)
+				operands = append(operands[:start], pdfToken{kind: pdfArray, items: items})
+			}
+			continue
+		case pdfOperator:
+		default:
+			operands = append(operands, tok)
+			continue
+		}
+
+		switch tok.text {
+		case "Tf":
+			font = nil
+			if len(operands) >= 2 && operands[len(operands)-2].kind == pdfName {
+				font = fonts[operands[len(operands)-2].text]
+			}
+		case "Tj":
+			if len(operands) > 0 {
+				write(operands[len(operands)-1].bytes)
+			}
+		case "'", "\"":
+			newline()
+			if len(operands) > 0 {
+				write(operands[len(operands)-1].bytes)
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				for _, item := range operands[len(operands)-1].items {
+					if item.kind == pdfString {
+						write(item.bytes)
+					} else if item.kind == pdfNumber && item.number < -250 {
+						space()
+					}
+				}
+			}
+		case "Td", "TD":
+			if number(1) != 0 {
+				newline()
+			} else if number(0) > 0 {
+				space()
+			}
+		case "Tm":
+			y := number(5)
+			if haveY && y != lastY {
+				newline()
+			} else {
+				space()
+			}
+			lastY, haveY = y, true
+		case "T*":
+			newline()
+		case "ET":
+			space()
+		}
+		operands = operands[:0]
+		arrayStart = arrayStart[:0]
+	}
+	return trimLines(b.String())
+}
+
+// decodePDFString decodes a string drawn without a ToUnicode map: UTF-16
+// if it has a byte order mark, else one byte per character.
+func decodePDFString(s []byte) string {
+	if len(s) >= 2 && s[0] == 0xFE && s[1] == 0xFF {
+		return decodeUTF16(s[2:])
+	}
+	runes := make([]rune, 0, len(s))
+	for _, c := range s {
+		if c >= 0x20 || c == '\t' {
+			runes = append(runes, rune(c))
+		}
+	}
+	return string(runes)
+}
+
+func decodeUTF16Hex(hex string) string {
+	return decodeUTF16(parseHexBytes(hex))
+}
+
+func decodeUTF16(s []byte) string {
+	units := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+func parseHexCode(hex string) uint32 {
+	code, _ := strconv.ParseUint(hex, 16, 32)
+	return uint32(code)
+}
+
+func parseHexBytes(hex string) []byte {
+	hex = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(" \t\r\n\f", r) {
+			return -1
+		}
+		return r
+	}, hex)
+	if len(hex)%2 == 1 {
+		hex += "0"
+	}
+	out := make([]byte, 0, len(hex)/2)
+	for i := 0; i+1 < len(hex); i += 2 {
+		v, err := strconv.ParseUint(hex[i:i+2], 16, 8)
+		if err != nil {
+			break
+		}
+		out = append(out, byte(v))
+	}
+	return out
+}
+
+// pdfValue returns the raw value of key in a dictionary: a nested
+// dictionary or array with its delimiters, a reference, or a single token.
+func pdfValue(dict, key string) string {
+	idx := 0
+	for {
+		i := strings.Index(dict[idx:], key)
+		if i < 0 {
+			return ""
+		}
+		idx += i + len(key)
+		// Skip longer names that start with key, like /Font in /FontFile.
+		if idx < len(dict) && !strings.ContainsRune(" \t\r\n\f/<[(", rune(dict[idx])) {
+			continue
+		}
+		break
+	}
+
+	rest := strings.TrimLeft(dict[idx:], " \t\r\n\f")
+	switch {
+	case strings.HasPrefix(rest, "<<"):
+		return balanced(rest, "<<", ">>")
+	case strings.HasPrefix(rest, "["):
+		return balanced(rest, "[", "]")
+	}
+	if ref := pdfReference.FindString(rest); ref != "" {
+		return ref
+	}
+	end := strings.IndexAny(rest[min(1, len(rest)):], " \t\r\n\f/<>[]()")
+	if end < 0 {
+		return rest
+	}
+	return rest[:end+min(1, len(rest))]
+}
+
+// balanced returns the prefix of s up to the close matching its opening.
+func balanced(s, open, close string) string {
+	depth := 0
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], open):
+			depth++
+			i += len(open)
+		case strings.HasPrefix(s[i:], close):
+			depth--
+			i += len(close)
+			if depth == 0 {
+				return s[:i]
+			}
+		default:
+			i++
+		}
+	}
+	return s
+}
+
+// pdfResolve returns value, or the dictionary of the object it refers to.
+func pdfResolve(objects map[int]*pdfObject, value string) string {
+	if obj := pdfObjectAt(objects, value); obj != nil {
+		return obj.dict
+	}
+	return value
+}
+
+func pdfObjectAt(objects map[int]*pdfObject, ref string) *pdfObject {
+	m := pdfReference.FindStringSubmatch(ref)
+	if m == nil {
+		return nil
+	}
+	num, _ := strconv.Atoi(m[1])
+	return objects[num]
+}
+
+func pdfSections(s, begin, end string) []string {
+	var sections []string
+	for {
+		i := strings.Index(s, begin)
+		if i < 0 {
+			return sections
+		}
+		s = s[i+len(begin):]
+		j := strings.Index(s, end)
+		if j < 0 {
+			return append(sections, s)
+		}
+		sections = append(sections, s[:j])
+		s = s[j+len(end):]
+	}
+}
+
+type pdfTokenKind int
+
+const (
+	pdfNumber pdfTokenKind = iota
+	pdfString
+	pdfName
+	pdfOperator
+	pdfArrayStart
+	pdfArrayEnd
+	pdfArray
+	pdfOther
+)
+
+type pdfToken struct {
+	kind   pdfTokenKind
+	text   string
+	number float64
+	bytes  []byte
+	items  []pdfToken
+}
+
+// pdfLexer splits a content stream into tokens.
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func (l *pdfLexer) next() (pdfToken, bool) {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		case c == '(':
+			return pdfToken{kind: pdfString, bytes: l.literal()}, true
+		case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+			l.pos += 2
+			return pdfToken{kind: pdfOther}, true
+		case c == '>' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '>':
+			l.pos += 2
+			return pdfToken{kind: pdfOther}, true
+		case c == '<':
+			end := bytes.IndexByte(l.data[l.pos:], '>')
+			if end < 0 {
+				end = len(l.data) - l.pos
+			}
+			hex := string(l.data[l.pos+1 : l.pos+end])
+			l.pos += end + 1
+			return pdfToken{kind: pdfString, bytes: parseHexBytes(hex)}, true
+		case c == '[':
+			l.pos++
+			return pdfToken{kind: pdfArrayStart}, true
+		case c == ']':
+			l.pos++
+			return pdfToken{kind: pdfArrayEnd}, true
+		case c == '{' || c == '}' || c == ')' || c == '>':
+			l.pos++
+		case c == '/':
+			l.pos++
+			return pdfToken{kind: pdfName, text: l.word()}, true
+		default:
+			word := l.word()
+			if n, err := strconv.ParseFloat(word, 64); err == nil {
+				return pdfToken{kind: pdfNumber, number: n}, true
+			}
+			if word == "BI" {
+				l.skipInlineImage()
+				continue
+			}
+			return pdfToken{kind: pdfOperator, text: word}, true
+		}
+	}
+	return pdfToken{}, false
+}
+
+func (l *pdfLexer) word() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !strings.ContainsRune("()<>[]{}/%", rune(l.data[l.pos])) {
+		l.pos++
+	}
+	if l.pos == start {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+// literal reads a (string) with its escapes and balanced parentheses.
+func (l *pdfLexer) literal() []byte {
+	var out []byte
+	depth := 0
+	l.pos++
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return out
+			}
+			depth--
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				if e == '\r' && l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				v := int(e - '0')
+				for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+					v = v*8 + int(l.data[l.pos]-'0')
+					l.pos++
+				}
+				c = byte(v)
+			default:
+				c = e
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// skipInlineImage skips the data of an inline image, up to "EI".
+func (l *pdfLexer) skipInlineImage() {
+	idx := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if idx < 0 {
+		l.pos = len(l.data)
+		return
+	}
+	l.pos += idx + 2
+	for l.pos < len(l.data) {
+		idx = bytes.Index(l.data[l.pos:], []byte("EI"))
+		if idx < 0 {
+			l.pos = len(l.data)
+			return
+		}
+		l.pos += idx + 2
+		if isPDFSpace(l.data[l.pos-3]) && (l.pos >= len(l.data) || isPDFSpace(l.data[l.pos])) {
+			return
+		}
+	}
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
@@ -7,8 +7,24 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/netguard"
 )
 
+// newLocalWebFetchTool returns a web_fetch tool allowed to reach the
+// loopback address of httptest servers.
+func newLocalWebFetchTool(t *testing.T, maxChars int) *WebFetchTool {
+	t.Helper()
+	policy, err := netguard.New(config.NetworkConfig{AllowHosts: []string{"127.0.0.1"}})
+	if err != nil {
+		t.Fatalf("netguard.New() error: %v", err)
+	}
+	tool := NewWebFetchTool(maxChars)
+	tool.SetNetworkPolicy(policy)
+	return tool
+}
+
 // TestWebTool_WebFetch_Success verifies successful URL fetching
 func TestWebTool_WebFetch_Success(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -18,7 +34,7 @@ func TestWebTool_WebFetch_Success(t *testing.T) {
 	}))
 	defer server.Close()
 
-	tool := NewWebFetchTool(50000)
+	tool := newLocalWebFetchTool(t, 50000)
 	ctx := context.Background()
 	args := map[string]interface{}{
 		"url": server.URL,
@@ -31,15 +47,20 @@ func TestWebTool_WebFetch_Success(t *testing.T) {
 		t.Errorf("Expected success, got IsError=true: %s", result.ForLLM)
 	}
 
-	// ForUser should contain the fetched content
-	if !strings.Contains(result.ForUser, "Test Page") {
-		t.Errorf("Expected ForUser to contain 'Test Page', got: %s", result.ForUser)
+	// ForLLM should contain the fetched content as Markdown
+	if !strings.Contains(result.ForLLM, "# Test Page") {
+		t.Errorf("Expected ForLLM to contain '# Test Page', got: %s", result.ForLLM)
 	}
 
-	// ForLLM should contain summary
-	if !strings.Contains(result.ForLLM, "bytes") && !strings.Contains(result.ForLLM, "extractor") {
+	// ForLLM should start with a summary
+	if !strings.Contains(result.ForLLM, "extractor: readability") {
 		t.Errorf("Expected ForLLM to contain summary, got: %s", result.ForLLM)
 	}
+
+	// The content goes to the LLM, not to the chat
+	if !result.Silent {
+		t.Errorf("Expected a silent result")
+	}
 }
 
 // TestWebTool_WebFetch_JSON verifies JSON content handling
@@ -54,7 +75,7 @@ func TestWebTool_WebFetch_JSON(t *testing.T) {
 	}))
 	defer server.Close()
 
-	tool := NewWebFetchTool(50000)
+	tool := newLocalWebFetchTool(t, 50000)
 	ctx := context.Background()
 	args := map[string]interface{}{
 		"url": server.URL,
@@ -67,9 +88,9 @@ func TestWebTool_WebFetch_JSON(t *testing.T) {
 		t.Errorf("Expected success, got IsError=true: %s", result.ForLLM)
 	}
 
-	// ForUser should contain formatted JSON
-	if !strings.Contains(result.ForUser, "key") && !strings.Contains(result.ForUser, "value") {
-		t.Errorf("Expected ForUser to contain JSON data, got: %s", result.ForUser)
+	// ForLLM should contain formatted JSON
+	if !strings.Contains(result.ForLLM, string(expectedJSON)) {
+		t.Errorf("Expected ForLLM to contain JSON data, got: %s", result.ForLLM)
 	}
 }
 
@@ -145,7 +166,7 @@ func TestWebTool_WebFetch_Truncation(t *testing.T) {
 	}))
 	defer server.Close()
 
-	tool := NewWebFetchTool(1000) // Limit to 1000 chars
+	tool := newLocalWebFetchTool(t, 1000) // Limit to 1000 chars
 	ctx := context.Background()
 	args := map[string]interface{}{
 		"url": server.URL,
@@ -158,18 +179,25 @@ func TestWebTool_WebFetch_Truncation(t *testing.T) {
 		t.Errorf("Expected success, got IsError=true: %s", result.ForLLM)
 	}
 
-	// ForUser should contain truncated content (not the full 20000 chars)
-	resultMap := make(map[string]interface{})
-	json.Unmarshal([]byte(result.ForUser), &resultMap)
-	if text, ok := resultMap["text"].(string); ok {
-		if len(text) > 1100 { // Allow some margin
-			t.Errorf("Expected content to be truncated to ~1000 chars, got: %d", len(text))
-		}
+	// ForLLM should contain truncated content (not the full 20000 chars)
+	if n := strings.Count(result.ForLLM, "xxxxxxxxxx"); n != 100 {
+		t.Errorf("Expected content to be truncated to 1000 chars, got: %d", n*10)
 	}
 
-	// Should be marked as truncated
-	if truncated, ok := resultMap["truncated"].(bool); !ok || !truncated {
-		t.Errorf("Expected 'truncated' to be true in result")
+	// Should say how to read the next part
+	if !strings.Contains(result.ForLLM, "offset=1000") {
+		t.Errorf("Expected ForLLM to point to the next part, got: %s", result.ForLLM[:200])
+	}
+
+	args["offset"] = float64(19500)
+	result = tool.Execute(ctx, args)
+	if result.IsError || strings.Count(result.ForLLM, "xxxxxxxxxx") != 50 || strings.Contains(result.ForLLM, "next part") {
+		t.Errorf("Expected the last 500 chars at offset 19500, got: %s", result.ForLLM[:200])
+	}
+
+	args["offset"] = float64(30000)
+	if result = tool.Execute(ctx, args); !result.IsError {
+		t.Errorf("Expected an error for an offset past the end")
 	}
 }
 
@@ -210,7 +238,7 @@ func TestWebTool_WebFetch_HTMLExtraction(t *testing.T) {
 	}))
 	defer server.Close()
 
-	tool := NewWebFetchTool(50000)
+	tool := newLocalWebFetchTool(t, 50000)
 	ctx := context.Background()
 	args := map[string]interface{}{
 		"url": server.URL,
@@ -223,14 +251,14 @@ func TestWebTool_WebFetch_HTMLExtraction(t *testing.T) {
 		t.Errorf("Expected success, got IsError=true: %s", result.ForLLM)
 	}
 
-	// ForUser should contain extracted text (without script/style tags)
-	if !strings.Contains(result.ForUser, "Title") && !strings.Contains(result.ForUser, "Content") {
-		t.Errorf("Expected ForUser to contain extracted text, got: %s", result.ForUser)
+	// ForLLM should contain extracted text (without script/style tags)
+	if !strings.Contains(result.ForLLM, "Title") && !strings.Contains(result.ForLLM, "Content") {
+		t.Errorf("Expected ForLLM to contain extracted text, got: %s", result.ForLLM)
 	}
 
 	// Should NOT contain script or style tags
-	if strings.Contains(result.ForUser, "<script>") || strings.Contains(result.ForUser, "<style>") {
-		t.Errorf("Expected script/style tags to be removed, got: %s", result.ForUser)
+	if strings.Contains(result.ForLLM, "alert") || strings.Contains(result.ForLLM, "color:red") {
+		t.Errorf("Expected script/style tags to be removed, got: %s", result.ForLLM)
 	}
 }
 
@@ -254,3 +282,69 @@ func TestWebTool_WebFetch_MissingDomain(t *testing.T) {
 		t.Errorf("Expected domain error message, got ForLLM: %s", result.ForLLM)
 	}
 }
+
+// TestWebTool_WebFetch_NetworkPolicy verifies that private addresses are
+// blocked, also when an allowed host redirects to one
+func TestWebTool_WebFetch_NetworkPolicy(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, strings.Replace(server.URL, "localhost", "127.0.0.1", 1)+"/secret", http.StatusFound)
+			return
+		}
+		w.Write([]byte("secret"))
+	}))
+	defer server.Close()
+	localURL := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	result := NewWebFetchTool(50000).Execute(context.Background(), map[string]interface{}{"url": server.URL})
+	if !result.IsError || !strings.Contains(result.ForLLM, "loopback") {
+		t.Errorf("fetching a loopback address = %+v, want it blocked", result)
+	}
+
+	policy, _ := netguard.New(config.NetworkConfig{AllowHosts: []string{"localhost"}})
+	tool := NewWebFetchTool(50000)
+	tool.SetNetworkPolicy(policy)
+	result = tool.Execute(context.Background(), map[string]interface{}{"url": localURL + "/redirect"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "blocked") {
+		t.Errorf("redirect to a blocked address = %+v, want it blocked", result)
+	}
+	result = tool.Execute(context.Background(), map[string]interface{}{"url": localURL + "/page"})
+	if result.IsError {
+		t.Errorf("fetching an allowed host failed: %s", result.ForLLM)
+	}
+}
+
+// TestWebTool_WebFetch_Cache verifies that pages with an ETag are cached
+// and revalidated with a conditional request
+func TestWebTool_WebFetch_Cache(t *testing.T) {
+	var requests, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write(testPDF(t))
+	}))
+	defer server.Close()
+
+	tool := newLocalWebFetchTool(t, 50000)
+	tool.SetCache(t.TempDir(), 1<<20)
+	args := map[string]interface{}{"url": server.URL + "/doc.pdf"}
+
+	first := tool.Execute(context.Background(), args)
+	if first.IsError || !strings.Contains(first.ForLLM, "extractor: pdf") || !strings.Contains(first.ForLLM, "Second (line)") {
+		t.Fatalf("first fetch = %s, want the PDF text", first.ForLLM)
+	}
+	second := tool.Execute(context.Background(), args)
+	if second.IsError || !strings.Contains(second.ForLLM, "not modified since cached") || !strings.Contains(second.ForLLM, "Second (line)") {
+		t.Errorf("second fetch = %s, want the cached text", second.ForLLM)
+	}
+	if requests != 2 || notModified != 1 {
+		t.Errorf("server saw %d requests, %d conditional; want 2 and 1", requests, notModified)
+	}
+}
@@ -0,0 +1,304 @@
+// Package usage records the tokens every LLM call consumes, prices them
+// and enforces budgets.
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Record is the usage of one LLM call.
+type Record struct {
+	Time             time.Time `json:"time"`
+	Session          string    `json:"session,omitempty"`
+	Channel          string    `json:"channel,omitempty"`
+	Sender           string    `json:"sender,omitempty"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Cost             float64   `json:"cost"` // USD, 0 when the model has no price
+}
+
+// Totals sums the usage of several calls.
+type Totals struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+func (t Totals) Tokens() int {
+	return t.PromptTokens + t.CompletionTokens
+}
+
+func (t *Totals) add(r Record) {
+	t.Requests++
+	t.PromptTokens += r.PromptTokens
+	t.CompletionTokens += r.CompletionTokens
+	t.Cost += r.Cost
+}
+
+// Ledger appends usage records to one JSONL file per month in dir and keeps
+// running totals for the current day and month.
+type Ledger struct {
+	dir    string
+	prices map[string]config.ModelPrice
+	now    func() time.Time
+
+	mu       sync.Mutex
+	day      string
+	month    string
+	dayTotal Totals
+	monTotal Totals
+}
+
+// NewLedger opens the ledger in dir, loading this month's totals.
+func NewLedger(dir string, prices map[string]config.ModelPrice) (*Ledger, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	l := &Ledger{dir: dir, prices: prices, now: time.Now}
+	if err := l.reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// reload recomputes the running totals from the current month's file.
+func (l *Ledger) reload() error {
+	now := l.now()
+	l.day, l.month = now.Format("2006-01-02"), now.Format("2006-01")
+	l.dayTotal, l.monTotal = Totals{}, Totals{}
+
+	records, err := readFile(filepath.Join(l.dir, l.month+".jsonl"))
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		l.monTotal.add(r)
+		if r.Time.Local().Format("2006-01-02") == l.day {
+			l.dayTotal.add(r)
+		}
+	}
+	return nil
+}
+
+// Price returns the cost in USD of the given tokens on model. Prices are
+// looked up by exact model name first, then by glob pattern.
+func (l *Ledger) Price(model string, promptTokens, completionTokens int) float64 {
+	price, ok := l.prices[model]
+	if !ok {
+		patterns := make([]string, 0, len(l.prices))
+		for pattern := range l.prices {
+			patterns = append(patterns, pattern)
+		}
+		sort.Strings(patterns)
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, model); matched {
+				price, ok = l.prices[pattern], true
+				break
+			}
+		}
+	}
+	if !ok {
+		return 0
+	}
+	return (float64(promptTokens)*price.Input + float64(completionTokens)*price.Output) / 1e6
+}
+
+// Record prices r and appends it to the ledger.
+func (l *Ledger) Record(r Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if r.Time.IsZero() {
+		r.Time = l.now()
+	}
+	r.Cost = l.Price(r.Model, r.PromptTokens, r.CompletionTokens)
+
+	now := l.now()
+	if now.Format("2006-01-02") != l.day {
+		if err := l.reload(); err != nil {
+			return err
+		}
+	}
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(l.dir, l.month+".jsonl"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	l.dayTotal.add(r)
+	l.monTotal.add(r)
+	return nil
+}
+
+// Current returns the totals of today and of this month.
+func (l *Ledger) Current() (day, month Totals) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.now().Format("2006-01-02") != l.day {
+		l.reload()
+	}
+	return l.dayTotal, l.monTotal
+}
+
+// BudgetError reports an exceeded budget.
+type BudgetError struct {
+	Period string // "daily" or "monthly"
+	Limit  string
+	Used   string
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("%s usage budget exceeded (%s of %s)", e.Period, e.Used, e.Limit)
+}
+
+// CheckBudget returns a *BudgetError if today's or this month's usage has
+// reached a limit of b.
+func (l *Ledger) CheckBudget(b config.BudgetConfig) error {
+	day, month := l.Current()
+	switch {
+	case b.DailyTokens > 0 && day.Tokens() >= b.DailyTokens:
+		return &BudgetError{Period: "daily", Limit: fmt.Sprintf("%d tokens", b.DailyTokens), Used: fmt.Sprintf("%d tokens", day.Tokens())}
+	case b.DailyCost > 0 && day.Cost >= b.DailyCost:
+		return &BudgetError{Period: "daily", Limit: FormatCost(b.DailyCost), Used: FormatCost(day.Cost)}
+	case b.MonthlyTokens > 0 && month.Tokens() >= b.MonthlyTokens:
+		return &BudgetError{Period: "monthly", Limit: fmt.Sprintf("%d tokens", b.MonthlyTokens), Used: fmt.Sprintf("%d tokens", month.Tokens())}
+	case b.MonthlyCost > 0 && month.Cost >= b.MonthlyCost:
+		return &BudgetError{Period: "monthly", Limit: FormatCost(b.MonthlyCost), Used: FormatCost(month.Cost)}
+	}
+	return nil
+}
+
+func FormatCost(cost float64) string {
+	return fmt.Sprintf("$%.4f", cost)
+}
+
+// Read returns the records in dir from since onwards, oldest first.
+func Read(dir string, since time.Time) ([]Record, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	firstMonth := since.Format("2006-01")
+	var records []Record
+	for _, file := range files {
+		if filepath.Base(file) < firstMonth {
+			continue
+		}
+		fileRecords, err := readFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range fileRecords {
+			if !r.Time.Before(since) {
+				records = append(records, r)
+			}
+		}
+	}
+	return records, nil
+}
+
+// readFile reads one month's records, skipping lines that do not parse.
+func readFile(file string) ([]Record, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Record
+		if json.Unmarshal(scanner.Bytes(), &r) == nil {
+			records = append(records, r)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// Row is one line of a usage report.
+type Row struct {
+	Key string
+	Totals
+}
+
+// Group sums records by the given dimension: "day", "model", "session",
+// "channel" or "sender". Rows are sorted by cost, then tokens, descending;
+// days are sorted chronologically.
+func Group(records []Record, by string) ([]Row, error) {
+	var key func(Record) string
+	switch by {
+	case "day":
+		key = func(r Record) string { return r.Time.Local().Format("2006-01-02") }
+	case "model":
+		key = func(r Record) string { return r.Model }
+	case "session":
+		key = func(r Record) string { return r.Session }
+	case "channel":
+		key = func(r Record) string { return r.Channel }
+	case "sender":
+		key = func(r Record) string { return r.Sender }
+	default:
+		return nil, fmt.Errorf("unknown usage grouping %q (use day, model, session, channel or sender)", by)
+	}
+
+	totals := make(map[string]*Totals)
+	for _, r := range records {
+		k := key(r)
+		if k == "" {
+			k = "-"
+		}
+		if totals[k] == nil {
+			totals[k] = &Totals{}
+		}
+		totals[k].add(r)
+	}
+
+	rows := make([]Row, 0, len(totals))
+	for k, t := range totals {
+		rows = append(rows, Row{Key: k, Totals: *t})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if by == "day" {
+			return rows[i].Key < rows[j].Key
+		}
+		if rows[i].Cost != rows[j].Cost {
+			return rows[i].Cost > rows[j].Cost
+		}
+		if rows[i].Tokens() != rows[j].Tokens() {
+			return rows[i].Tokens() > rows[j].Tokens()
+		}
+		return rows[i].Key < rows[j].Key
+	})
+	return rows, nil
+}
+
+// Dir returns where the ledger of a workspace is kept.
+func Dir(workspace string) string {
+	return filepath.Join(workspace, "state", "usage")
+}
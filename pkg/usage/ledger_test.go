@@ -0,0 +1,131 @@
+package usage
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newTestLedger(t *testing.T, now *time.Time) *Ledger {
+	t.Helper()
+	l, err := NewLedger(t.TempDir(), map[string]config.ModelPrice{
+		"gpt-4o":   {Input: 2.5, Output: 10},
+		"claude-*": {Input: 3, Output: 15},
+	})
+	if err != nil {
+		t.Fatalf("NewLedger() error: %v", err)
+	}
+	l.now = func() time.Time { return *now }
+	l.reload()
+	return l
+}
+
+func TestLedger_Price(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	l := newTestLedger(t, &now)
+
+	tests := []struct {
+		model string
+		want  float64
+	}{
+		{"gpt-4o", 2.5 + 10},
+		{"claude-sonnet-4", 3 + 15},
+		{"glm-4.7", 0},
+	}
+	for _, tt := range tests {
+		if got := l.Price(tt.model, 1_000_000, 1_000_000); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Price(%q) = %v, want %v", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestLedger_TotalsSurviveReopenAndDayChange(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	l := newTestLedger(t, &now)
+
+	l.Record(Record{Session: "s1", Model: "gpt-4o", PromptTokens: 1000, CompletionTokens: 100})
+	now = now.Add(24 * time.Hour)
+	l.Record(Record{Session: "s2", Model: "gpt-4o", PromptTokens: 2000, CompletionTokens: 200})
+
+	day, month := l.Current()
+	if day.Requests != 1 || day.Tokens() != 2200 {
+		t.Errorf("day totals = %+v, want 1 request of 2200 tokens", day)
+	}
+	if month.Requests != 2 || month.Tokens() != 3300 {
+		t.Errorf("month totals = %+v, want 2 requests of 3300 tokens", month)
+	}
+
+	reopened, err := NewLedger(l.dir, l.prices)
+	if err != nil {
+		t.Fatalf("NewLedger() error: %v", err)
+	}
+	reopened.now = l.now
+	reopened.reload()
+	if _, got := reopened.Current(); got != month {
+		t.Errorf("reopened month totals = %+v, want %+v", got, month)
+	}
+
+	now = time.Date(2026, 4, 1, 9, 0, 0, 0, time.Local)
+	if day, month := l.Current(); day.Requests != 0 || month.Requests != 0 {
+		t.Errorf("totals in a new month = %+v, %+v, want zero", day, month)
+	}
+}
+
+func TestLedger_CheckBudget(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	l := newTestLedger(t, &now)
+	l.Record(Record{Model: "gpt-4o", PromptTokens: 800, CompletionTokens: 200})
+
+	if err := l.CheckBudget(config.BudgetConfig{DailyTokens: 1001, MonthlyCost: 1}); err != nil {
+		t.Errorf("CheckBudget() within limits = %v, want nil", err)
+	}
+
+	var budgetErr *BudgetError
+	err := l.CheckBudget(config.BudgetConfig{DailyTokens: 1000})
+	if !errors.As(err, &budgetErr) || budgetErr.Period != "daily" {
+		t.Errorf("CheckBudget() = %v, want a daily BudgetError", err)
+	}
+	err = l.CheckBudget(config.BudgetConfig{MonthlyCost: 0.001})
+	if !errors.As(err, &budgetErr) || budgetErr.Period != "monthly" {
+		t.Errorf("CheckBudget() = %v, want a monthly BudgetError", err)
+	}
+}
+
+func TestReadAndGroup(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	l := newTestLedger(t, &now)
+	l.Record(Record{Channel: "telegram", Model: "gpt-4o", PromptTokens: 100, CompletionTokens: 10})
+	now = now.Add(time.Hour)
+	l.Record(Record{Channel: "discord", Model: "claude-sonnet-4", PromptTokens: 100, CompletionTokens: 10})
+	now = now.Add(24 * time.Hour)
+	l.Record(Record{Channel: "telegram", Model: "gpt-4o", PromptTokens: 100, CompletionTokens: 10})
+
+	records, err := Read(l.dir, time.Date(2026, 3, 11, 0, 0, 0, 0, time.Local))
+	if err != nil {
+		t.Fatalf("Read() error: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Read() returned %d records, want 1", len(records))
+	}
+
+	records, _ = Read(l.dir, time.Time{})
+	rows, err := Group(records, "channel")
+	if err != nil {
+		t.Fatalf("Group() error: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Key != "telegram" || rows[0].Requests != 2 {
+		t.Errorf("Group(channel) = %+v, want telegram with 2 requests first", rows)
+	}
+
+	rows, _ = Group(records, "day")
+	if len(rows) != 2 || rows[0].Key != "2026-03-10" || rows[1].Key != "2026-03-11" {
+		t.Errorf("Group(day) = %+v, want two days in order", rows)
+	}
+
+	if _, err := Group(records, "color"); err == nil {
+		t.Error("Group() with an unknown key should fail")
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/netguard"
 )
 
 // IsAudioFile checks if a file is an audio file based on its filename extension and content type.
@@ -32,6 +33,19 @@ func IsAudioFile(filename, contentType string) bool {
 	return false
 }
 
+// IsImageFile checks if a file is an image based on its filename extension and content type.
+func IsImageFile(filename, contentType string) bool {
+	imageExtensions := []string{".jpg", ".jpeg", ".png", ".gif", ".webp"}
+
+	for _, ext := range imageExtensions {
+		if strings.HasSuffix(strings.ToLower(filename), ext) {
+			return true
+		}
+	}
+
+	return strings.HasPrefix(strings.ToLower(contentType), "image/")
+}
+
 // SanitizeFilename removes potentially dangerous characters from a filename
 // and returns a safe version for local filesystem storage.
 func SanitizeFilename(filename string) string {
@@ -53,7 +67,8 @@ type DownloadOptions struct {
 	LoggerPrefix string
 }
 
-// DownloadFile downloads a file from URL to a local temp directory.
+// DownloadFile downloads a file from URL to a local temp directory, subject
+// to the default network policy.
 // Returns the local file path or empty string on error.
 func DownloadFile(url, filename string, opts DownloadOptions) string {
 	// Set defaults
@@ -90,7 +105,7 @@ func DownloadFile(url, filename string, opts DownloadOptions) string {
 		req.Header.Set(key, value)
 	}
 
-	client := &http.Client{Timeout: opts.Timeout}
+	client := netguard.Client(opts.Timeout)
 	resp, err := client.Do(req)
 	if err != nil {
 		logger.ErrorCF(opts.LoggerPrefix, "Failed to download file", map[string]interface{}{